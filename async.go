@@ -0,0 +1,63 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"context"
+)
+
+// AsyncToken is a token or error delivered by Async.
+type AsyncToken struct {
+	Token Token
+	Err   error
+}
+
+// Async starts a goroutine that reads tokens from r and sends them on the
+// returned channel, which has a buffer size of n.
+// Tokens are copied before they are sent so they remain valid after further
+// tokens are read.
+//
+// When r returns an error (including io.EOF) it is sent as the final value and
+// the channel is closed.
+// If ctx is canceled the goroutine stops and the channel is closed.
+// A read that is blocked when ctx is canceled is only interrupted if r has a
+// TokenContext method (such as a Tokenizer reading from a net.Conn), otherwise
+// the goroutine exits once the read returns.
+func Async(ctx context.Context, r TokenReader, n int) <-chan AsyncToken {
+	c := make(chan AsyncToken, n)
+	go func() {
+		defer close(c)
+		cr, canInterrupt := r.(interface {
+			TokenContext(context.Context) (Token, error)
+		})
+		for {
+			var tok Token
+			var err error
+			if canInterrupt {
+				tok, err = cr.TokenContext(ctx)
+			} else {
+				tok, err = r.Token()
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if tok != nil {
+				select {
+				case c <- AsyncToken{Token: copyToken(tok)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				select {
+				case c <- AsyncToken{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}()
+	return c
+}
@@ -0,0 +1,59 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestAsync(t *testing.T) {
+	const in = `<a>foo<b/></a>`
+	want := []AsyncToken{
+		{Token: StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}},
+		{Token: CharData("foo")},
+		{Token: StartElement{Name: Name{Local: "b"}, Attr: []Attr{}}},
+		{Token: EndElement{Name: Name{Local: "b"}}},
+		{Token: EndElement{Name: Name{Local: "a"}}},
+		{Err: io.EOF},
+	}
+	var got []AsyncToken
+	for tok := range Async(context.Background(), NewTokenizer(strings.NewReader(in)), 2) {
+		got = append(got, tok)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, got)
+	}
+}
+
+func TestAsyncCancel(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := Async(ctx, NewTokenizer(client), 0)
+	go func() {
+		/* #nosec */
+		server.Write([]byte(`<a>`))
+	}()
+	tok := <-c
+	want := AsyncToken{Token: StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}}
+	if !reflect.DeepEqual(tok, want) {
+		t.Fatalf("wrong token: want=%+v, got=%+v", want, tok)
+	}
+
+	// The goroutine is now blocked reading from the pipe.
+	cancel()
+	for tok := range c {
+		t.Errorf("unexpected value after cancel: %+v", tok)
+	}
+}
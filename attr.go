@@ -0,0 +1,62 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// GetAttr returns the value of the first attribute of start with the given
+// name and reports whether it was found.
+//
+// Both the local name and the namespace must match, so an empty Space only
+// matches attributes that are not in a namespace.
+// The "xml" prefix and the XML namespace are treated as the same namespace.
+func GetAttr(start StartElement, name Name) (string, bool) {
+	for _, a := range start.Attr {
+		if nameEqual(a.Name, name) {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttr sets the value of the first attribute of start with the same name as
+// attr, or appends attr if there is no such attribute.
+// Names are matched as they are by GetAttr.
+// Like DelAttr, it does not modify the underlying array of start.Attr.
+func SetAttr(start *StartElement, attr Attr) {
+	n := len(start.Attr)
+	for i, a := range start.Attr {
+		if nameEqual(a.Name, attr.Name) {
+			start.Attr = append([]Attr(nil), start.Attr...)
+			start.Attr[i].Value = attr.Value
+			return
+		}
+	}
+	start.Attr = append(start.Attr[:n:n], attr)
+}
+
+// DelAttr removes all attributes of start with the given name.
+// Names are matched as they are by GetAttr.
+// The underlying array of start.Attr is not modified so that other copies of
+// the start element are not affected.
+func DelAttr(start *StartElement, name Name) {
+	for i := 0; i < len(start.Attr); i++ {
+		if nameEqual(start.Attr[i].Name, name) {
+			start.Attr = append(start.Attr[:i:i], start.Attr[i+1:]...)
+			i--
+		}
+	}
+}
+
+func nameEqual(a, b Name) bool {
+	if a.Local != b.Local {
+		return false
+	}
+	if a.Space == "xml" {
+		a.Space = xmlURL
+	}
+	if b.Space == "xml" {
+		b.Space = xmlURL
+	}
+	return a.Space == b.Space
+}
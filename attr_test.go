@@ -0,0 +1,64 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestAttr(t *testing.T) {
+	orig := StartElement{
+		Name: Name{Local: "a"},
+		Attr: []Attr{
+			{Name: Name{Local: "id"}, Value: "1"},
+			{Name: Name{Space: "urn:b", Local: "id"}, Value: "2"},
+			{Name: Name{Space: "xml", Local: "lang"}, Value: "en"},
+			{Name: Name{Local: "id"}, Value: "3"},
+		},
+	}
+	start := orig
+
+	if v, ok := GetAttr(start, Name{Local: "id"}); !ok || v != "1" {
+		t.Errorf("wrong value for id: want=1, got=%q (%t)", v, ok)
+	}
+	if v, ok := GetAttr(start, Name{Space: "urn:b", Local: "id"}); !ok || v != "2" {
+		t.Errorf("wrong value for namespaced id: want=2, got=%q (%t)", v, ok)
+	}
+	if v, ok := GetAttr(start, Name{Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"}); !ok || v != "en" {
+		t.Errorf("wrong value for xml:lang: want=en, got=%q (%t)", v, ok)
+	}
+	if _, ok := GetAttr(start, Name{Local: "lang"}); ok {
+		t.Errorf("attribute without namespace should not match xml:lang")
+	}
+
+	DelAttr(&start, Name{Local: "id"})
+	if len(start.Attr) != 2 {
+		t.Fatalf("wrong number of attributes after delete: want=2, got=%d", len(start.Attr))
+	}
+	if orig.Attr[0].Value != "1" || orig.Attr[3].Value != "3" {
+		t.Errorf("delete modified the original attributes: %+v", orig.Attr)
+	}
+	if _, ok := GetAttr(start, Name{Local: "id"}); ok {
+		t.Errorf("attribute was not deleted")
+	}
+
+	alias := start
+	SetAttr(&start, Attr{Name: Name{Space: "xml", Local: "lang"}, Value: "fr"})
+	SetAttr(&start, Attr{Name: Name{Local: "new"}, Value: "v"})
+	if v, _ := GetAttr(alias, Name{Space: "xml", Local: "lang"}); v != "en" || len(alias.Attr) != 2 {
+		t.Errorf("set modified a copy of the start element: %+v", alias.Attr)
+	}
+	if cap(alias.Attr) > len(alias.Attr) && alias.Attr[:cap(alias.Attr)][2].Name.Local == "new" {
+		t.Errorf("set appended to the array of a copy of the start element")
+	}
+	if v, _ := GetAttr(start, Name{Space: "xml", Local: "lang"}); v != "fr" {
+		t.Errorf("wrong value after set: want=fr, got=%q", v)
+	}
+	if v, _ := GetAttr(start, Name{Local: "new"}); v != "v" || len(start.Attr) != 3 {
+		t.Errorf("attribute was not appended: %+v", start.Attr)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// TokenBuffer is a queue of tokens.
+// Tokens are read from the front of the buffer with Token and added to the back
+// with EncodeToken, or pushed back onto the front with Unget.
+// All tokens are copied when they are added to the buffer.
+//
+// The zero value is an empty buffer ready to use.
+type TokenBuffer struct {
+	toks []Token
+	head int
+}
+
+// Token returns the token at the front of the buffer.
+// If the buffer is empty it returns io.EOF.
+func (b *TokenBuffer) Token() (Token, error) {
+	if b.head == len(b.toks) {
+		b.Reset()
+		return nil, io.EOF
+	}
+	tok := b.toks[b.head]
+	b.toks[b.head] = nil
+	b.head++
+	return tok, nil
+}
+
+// EncodeToken appends a copy of t to the back of the buffer.
+// It never returns an error.
+func (b *TokenBuffer) EncodeToken(t Token) error {
+	b.toks = append(b.toks, copyToken(t))
+	return nil
+}
+
+// Flush is a no-op that satisfies the TokenWriter interface.
+func (b *TokenBuffer) Flush() error {
+	return nil
+}
+
+// Unget pushes a copy of t onto the front of the buffer so that it is returned
+// by the next call to Token.
+func (b *TokenBuffer) Unget(t Token) {
+	t = copyToken(t)
+	if b.head > 0 {
+		b.head--
+		b.toks[b.head] = t
+		return
+	}
+	b.toks = append(b.toks, nil)
+	copy(b.toks[1:], b.toks)
+	b.toks[0] = t
+}
+
+// Len returns the number of tokens in the buffer.
+func (b *TokenBuffer) Len() int {
+	return len(b.toks) - b.head
+}
+
+// Reset empties the buffer.
+func (b *TokenBuffer) Reset() {
+	for i := range b.toks {
+		b.toks[i] = nil
+	}
+	b.toks = b.toks[:0]
+	b.head = 0
+}
+
+// copyToken is like CopyToken except that it also copies the tokens defined by
+// this package.
+func copyToken(t Token) Token {
+	switch tok := t.(type) {
+	case SourceToken:
+		return SourceToken{
+			Token:  copyToken(tok.Token),
+			Source: append([]byte(nil), tok.Source...),
+		}
+	case CDATA:
+		return tok.Copy()
+	}
+	return CopyToken(t)
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestTokenBuffer(t *testing.T) {
+	var b TokenBuffer
+	cd := CharData("foo")
+	for _, tok := range []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, cd, EndElement{Name: Name{Local: "a"}}} {
+		if err := b.EncodeToken(tok); err != nil {
+			t.Fatalf("unexpected error encoding token: %v", err)
+		}
+	}
+	// Tokens must be copied when they are added.
+	cd[0] = 'b'
+	if b.Len() != 3 {
+		t.Fatalf("wrong length: want=3, got=%d", b.Len())
+	}
+
+	tok, _ := b.Token()
+	if !reflect.DeepEqual(tok, StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}) {
+		t.Fatalf("wrong first token: %+v", tok)
+	}
+	b.Unget(tok)
+	b.Unget(Comment("c"))
+
+	want := []Token{
+		Comment("c"),
+		StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		CharData("foo"),
+		EndElement{Name: Name{Local: "a"}},
+	}
+	toks, err := readAll(&b)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+	if _, err = b.Token(); err != io.EOF {
+		t.Fatalf("expected EOF from empty buffer, got %v", err)
+	}
+	if b.Len() != 0 {
+		t.Fatalf("expected empty buffer, got length %d", b.Len())
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// Builder constructs an element and its children.
+// Each method returns the builder so that calls can be chained, for example:
+//
+//	Build("message").
+//		Attr("to", "juliet@example.net").
+//		Child(Build("body").Text("Art thou not Romeo?"))
+//
+// A builder can be turned into tokens any number of times, unless it contains a
+// TokenReader added with Tokens, which can only be read once.
+type Builder struct {
+	start    StartElement
+	children []builderChild
+}
+
+type builderChild struct {
+	tok Token
+	b   *Builder
+	r   TokenReader
+}
+
+// Build returns a builder for an element with the given local name and no
+// namespace.
+func Build(local string) *Builder {
+	return &Builder{start: StartElement{Name: Name{Local: local}, Attr: []Attr{}}}
+}
+
+// Namespace sets the namespace of the element.
+func (b *Builder) Namespace(space string) *Builder {
+	b.start.Name.Space = space
+	return b
+}
+
+// Attr adds an attribute with no namespace to the element.
+func (b *Builder) Attr(local, value string) *Builder {
+	return b.AttrNS("", local, value)
+}
+
+// AttrNS adds an attribute in the given namespace to the element.
+func (b *Builder) AttrNS(space, local, value string) *Builder {
+	b.start.Attr = append(b.start.Attr, Attr{Name: Name{Space: space, Local: local}, Value: value})
+	return b
+}
+
+// Text adds character data to the contents of the element.
+func (b *Builder) Text(s string) *Builder {
+	b.children = append(b.children, builderChild{tok: CharData(s)})
+	return b
+}
+
+// Comment adds a comment to the contents of the element.
+func (b *Builder) Comment(s string) *Builder {
+	b.children = append(b.children, builderChild{tok: Comment(s)})
+	return b
+}
+
+// Child adds child elements to the contents of the element.
+func (b *Builder) Child(c ...*Builder) *Builder {
+	for _, child := range c {
+		b.children = append(b.children, builderChild{b: child})
+	}
+	return b
+}
+
+// Tokens adds all tokens read from r to the contents of the element.
+func (b *Builder) Tokens(r TokenReader) *Builder {
+	b.children = append(b.children, builderChild{r: r})
+	return b
+}
+
+// TokenReader returns a TokenReader that reads the tokens of the element, its
+// contents, and its end element.
+func (b *Builder) TokenReader() TokenReader {
+	inner := make([]TokenReader, 0, len(b.children))
+	for _, c := range b.children {
+		switch {
+		case c.b != nil:
+			inner = append(inner, c.b.TokenReader())
+		case c.r != nil:
+			inner = append(inner, c.r)
+		default:
+			buf := &TokenBuffer{}
+			/* #nosec */
+			buf.EncodeToken(c.tok)
+			inner = append(inner, buf)
+		}
+	}
+	return Wrap(MultiTokenReader(inner...), b.start)
+}
+
+// Encode writes the tokens of the element, its contents, and its end element to
+// w.
+// It does not call Flush.
+func (b *Builder) Encode(w TokenWriter) error {
+	r := b.TokenReader()
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			if e := w.EncodeToken(tok); e != nil {
+				return e
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
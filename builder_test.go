@@ -0,0 +1,55 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestBuilder(t *testing.T) {
+	b := Build("message").
+		Namespace("jabber:client").
+		Attr("xmlns", "jabber:client").
+		Attr("to", "juliet@example.net").
+		Child(
+			Build("body").Namespace("jabber:client").Text("Art thou not Romeo?"),
+			Build("thread").Namespace("jabber:client").AttrNS("xml", "lang", "en"),
+		).
+		Comment(" c ")
+
+	const out = `<message xmlns="jabber:client" to="juliet@example.net"><body>Art thou not Romeo?</body><thread xml:lang="en"></thread><!-- c --></message>`
+	// Encode twice to make sure the builder can be reused.
+	for i := 0; i < 2; i++ {
+		var buf strings.Builder
+		e := NewEncoder(&buf)
+		err := b.Encode(e)
+		if err != nil {
+			t.Fatalf("unexpected error encoding: %v", err)
+		}
+		if err = e.Flush(); err != nil {
+			t.Fatalf("unexpected error flushing: %v", err)
+		}
+		if s := buf.String(); s != out {
+			t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+		}
+	}
+}
+
+func TestBuilderTokens(t *testing.T) {
+	b := Build("a").Tokens(NewTokenizer(strings.NewReader(`<b/>c`)))
+	toks, err := readAll(b.TokenReader())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(toks) != 5 {
+		t.Fatalf("wrong number of tokens: want=5, got=%d", len(toks))
+	}
+	if cd, ok := toks[3].(CharData); !ok || string(cd) != "c" {
+		t.Fatalf("wrong token: want=CharData(c), got=%T(%[1]v)", toks[3])
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"io"
+)
+
+// NewTokenizerBytes creates a new XML parser reading from b.
+// Because the entire input is already in memory, it is read directly instead
+// of through a bufio.Reader and runs of text are scanned in bulk.
+//
+// If ZeroCopy is also set, CharData tokens that contain no entity or character
+// references are returned as slices of b itself, so b must not be modified
+// while they are in use.
+func NewTokenizerBytes(b []byte) *Tokenizer {
+	t := &Tokenizer{}
+	t.setBytes(b)
+	return t
+}
+
+func (t *Tokenizer) setBytes(b []byte) {
+	mem := &bytesReader{b: b}
+	t.setReader(mem)
+	t.mem = mem
+}
+
+// bytesReader is a bufferedByteReader over a byte slice.
+type bytesReader struct {
+	b   []byte
+	off int
+}
+
+func (r *bytesReader) Read(p []byte) (int, error) {
+	if r.off >= len(r.b) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.b[r.off:])
+	r.off += n
+	return n, nil
+}
+
+func (r *bytesReader) ReadByte() (byte, error) {
+	if r.off >= len(r.b) {
+		return 0, io.EOF
+	}
+	b := r.b[r.off]
+	r.off++
+	return b, nil
+}
+
+func (r *bytesReader) Buffered() int {
+	return len(r.b) - r.off
+}
+
+func (r *bytesReader) Peek(n int) ([]byte, error) {
+	if rest := len(r.b) - r.off; n > rest {
+		return r.b[r.off:], io.EOF
+	}
+	return r.b[r.off : r.off+n], nil
+}
+
+func (r *bytesReader) Discard(n int) (int, error) {
+	if rest := len(r.b) - r.off; n > rest {
+		r.off = len(r.b)
+		return rest, io.EOF
+	}
+	r.off += n
+	return n, nil
+}
+
+// memCharData returns character data that begins with b as a slice of the
+// input if the input is in memory and the text can be returned as is.
+// If it returns false nothing has been consumed.
+func (t *Tokenizer) memCharData(b byte) (CharData, bool) {
+	if t.mem == nil || t.r != t.mem || len(t.pending) > 0 || t.CharDataChunkSize > 0 || t.mem.off == 0 || t.afterCR {
+		return nil, false
+	}
+	// If b was unread it may not have come from the input, but if the byte
+	// before the input matches it the slice is the same either way.
+	start := t.mem.off - 1
+	if t.mem.b[start] != b {
+		return nil, false
+	}
+	rest := t.mem.b[t.mem.off:]
+	n := bytes.IndexAny(rest, "<&")
+	switch {
+	case n < 0:
+		n = len(rest)
+	case rest[n] == '&':
+		return nil, false
+	}
+	if bytes.IndexByte(rest[:n], '\r') >= 0 {
+		// Line endings have to be normalized.
+		return nil, false
+	}
+	// Limit the capacity so that appending to the text, for instance to
+	// coalesce it with a following CDATA section, never overwrites the input.
+	end := t.mem.off + n
+	cd := CharData(t.mem.b[start:end:end])
+	if n < len(rest) {
+		// Consume the '<' that ended the text.
+		n++
+		t.foundStart = true
+	}
+	t.textCont = false
+	run := rest[:n]
+	t.advance(run)
+	t.discard(t.mem, run)
+	return cd, true
+}
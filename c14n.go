@@ -0,0 +1,516 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+)
+
+// Method is a canonicalization algorithm.
+type Method int
+
+// A list of supported canonicalization algorithms.
+const (
+	// ExcC14N is Exclusive XML Canonicalization Version 1.0
+	// (http://www.w3.org/2001/10/xml-exc-c14n#).
+	ExcC14N Method = iota
+
+	// C14N11 is Canonical XML Version 1.1
+	// (http://www.w3.org/2006/12/xml-c14n11).
+	// Unlike exclusive canonicalization all namespace declarations that are in
+	// scope are written, and the xml:lang, xml:space, and xml:base attributes
+	// of the ancestors given in XMLAttrs are inherited by the outermost
+	// elements.
+	C14N11
+)
+
+// Canonicalizer is a TokenWriter that writes the canonical form of the tokens
+// it is given.
+// By default Exclusive XML Canonicalization
+// (https://www.w3.org/TR/xml-exc-c14n/) is used.
+//
+// Tokens are expected to have their names resolved to namespaces and to still
+// contain their xmlns attributes, as returned by a Tokenizer or Decoder.
+// If they are wrapped in a SourceToken, as they are when they are read from a
+// Tokenizer with SourceTokens set, the prefixes used in the input are kept.
+// Otherwise prefixes are recovered from the namespace declarations that are in
+// scope, preferring the default namespace for elements and then the innermost
+// and most recently declared prefix, which may not match the input if more
+// than one prefix is bound to the same namespace.
+// Names in a namespace that has no declaration in scope are written as is, with
+// the Space used as the prefix.
+//
+// Character data and attribute values are expected to have had entities and
+// character references replaced and line endings and attribute values
+// normalized already, as they are by a Tokenizer.
+// Directives, XML declarations, and character data outside of the root element
+// are not part of the canonical form and are dropped.
+type Canonicalizer struct {
+	// Method is the canonicalization algorithm to use.
+	Method Method
+
+	// Comments causes comments to be written to the output, resulting in the
+	// "WithComments" variant of the canonical form.
+	Comments bool
+
+	// InclusiveNamespaces is the InclusiveNamespaces PrefixList.
+	// Prefixes in the list are treated as they would be by inclusive
+	// canonicalization and have their declarations written on the outermost
+	// element where they are in scope, whether they are used or not.
+	// The default namespace is represented by "#default".
+	// It is only used by ExcC14N.
+	InclusiveNamespaces []string
+
+	// Namespaces are the namespace declarations in scope at the start of the
+	// token stream keyed by prefix, with the empty string representing the
+	// default namespace.
+	// This is useful when canonicalizing an element that is a descendant of
+	// elements which declare namespaces, such as an XMPP stanza.
+	Namespaces map[string]string
+
+	// XMLAttrs are the attributes in the xml namespace, such as xml:lang, that
+	// are in scope at the start of the token stream.
+	// If xml:base is given multiple times the values are joined in order.
+	// It is only used by C14N11.
+	XMLAttrs []Attr
+
+	w      *bufio.Writer
+	scopes []c14nScope
+	ns     nsStack
+	root   bool
+}
+
+type c14nScope struct {
+	start    Name
+	name     string
+	rendered map[string]string
+}
+
+// NewCanonicalizer returns a new canonicalizer that writes to w.
+func NewCanonicalizer(w io.Writer) *Canonicalizer {
+	return &Canonicalizer{w: bufio.NewWriter(w)}
+}
+
+// EncodeToken writes the canonical form of t to the stream.
+// It returns an error if StartElement and EndElement tokens are not properly
+// matched.
+//
+// EncodeToken does not call Flush.
+func (c *Canonicalizer) EncodeToken(t Token) error {
+	switch tok := unwrapSource(t).(type) {
+	case StartElement:
+		var src *StartElement
+		if st, ok := t.(SourceToken); ok {
+			if orig, ok := decodeSource(st.Source, nil).(StartElement); ok && len(orig.Attr) <= len(tok.Attr) {
+				// Attributes with default values from the DTD are appended to the
+				// decoded element and do not appear in the source.
+				src = &orig
+			}
+		}
+		return c.writeStart(tok, src)
+	case EndElement:
+		return c.writeEnd(tok)
+	case CharData:
+		if len(c.scopes) == 0 {
+			return nil
+		}
+		return escapeC14NText(c.w, tok)
+	case CDATA:
+		if len(c.scopes) == 0 {
+			return nil
+		}
+		return escapeC14NText(c.w, tok)
+	case Comment:
+		if !c.Comments {
+			return nil
+		}
+		c.beforeNode()
+		/* #nosec */
+		c.w.WriteString("<!--")
+		/* #nosec */
+		c.w.Write(tok)
+		/* #nosec */
+		c.w.WriteString("-->")
+		return c.afterNode()
+	case ProcInst:
+		if tok.Target == "xml" {
+			return nil
+		}
+		c.beforeNode()
+		/* #nosec */
+		c.w.WriteString("<?")
+		/* #nosec */
+		c.w.WriteString(tok.Target)
+		// The target and the data are separated by a single space.
+		if inst := bytes.TrimLeft(tok.Inst, xmlSpace); len(inst) > 0 {
+			/* #nosec */
+			c.w.WriteByte(' ')
+			/* #nosec */
+			c.w.Write(inst)
+		}
+		/* #nosec */
+		c.w.WriteString("?>")
+		return c.afterNode()
+	case Directive, Declaration:
+		return nil
+	}
+	return fmt.Errorf("xml: EncodeToken of invalid token type")
+}
+
+// Flush flushes any buffered output to the underlying writer.
+func (c *Canonicalizer) Flush() error {
+	return c.w.Flush()
+}
+
+// beforeNode separates a comment or processing instruction after the root
+// element from the preceding output.
+func (c *Canonicalizer) beforeNode() {
+	if len(c.scopes) == 0 && c.root {
+		/* #nosec */
+		c.w.WriteByte('\n')
+	}
+}
+
+// afterNode separates a comment or processing instruction before the root
+// element from the following output.
+func (c *Canonicalizer) afterNode() error {
+	if len(c.scopes) == 0 && !c.root {
+		return c.w.WriteByte('\n')
+	}
+	return nil
+}
+
+// writeStart writes a start element.
+// If src is non-nil it is the start element as it appeared in the input, and
+// the prefixes used in the input are kept.
+func (c *Canonicalizer) writeStart(start StartElement, src *StartElement) error {
+	if start.Name.Local == "" {
+		return fmt.Errorf("xml: start tag with no name")
+	}
+	scope := c14nScope{
+		start:    start.Name,
+		rendered: make(map[string]string),
+	}
+	var attrs []c14nAttr
+	c.scopes = append(c.scopes, scope)
+	c.ns.push(xmlnsDecls(start.Attr)...)
+	c.root = true
+
+	used := make(map[string]string)
+	var prefer string
+	if src != nil {
+		prefer = src.Name.Space
+	}
+	name, prefix, space, ok := c.qualify(start.Name, false, prefer)
+	if ok {
+		used[prefix] = space
+	}
+	for i, a := range start.Attr {
+		if a.Name.Local == "" || a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		prefer = ""
+		if src != nil && i < len(src.Attr) {
+			prefer = src.Attr[i].Name.Space
+		}
+		qname, prefix, space, ok := c.qualify(a.Name, true, prefer)
+		if ok {
+			used[prefix] = space
+		}
+		attrs = append(attrs, c14nAttr{name: qname, space: space, local: a.Name.Local, value: a.Value})
+	}
+	switch c.Method {
+	case C14N11:
+		used = make(map[string]string)
+		if len(c.scopes) == 1 {
+			for prefix, space := range c.Namespaces {
+				used[prefix] = space
+			}
+			attrs = c.inherit(attrs)
+		}
+		for _, decl := range c.ns.own() {
+			used[decl.prefix] = decl.space
+		}
+	default:
+		for _, prefix := range c.InclusiveNamespaces {
+			if prefix == "#default" {
+				prefix = ""
+			}
+			if _, ok := used[prefix]; ok {
+				continue
+			}
+			if space, ok := c.lookup(prefix); ok {
+				used[prefix] = space
+			}
+		}
+	}
+
+	var decls []string
+	for prefix, space := range used {
+		rendered, ok := c.rendered(prefix)
+		if (prefix == "" && rendered == space) || (prefix != "" && ok && rendered == space) {
+			continue
+		}
+		scope.rendered[prefix] = space
+		decls = append(decls, prefix)
+	}
+	sort.Strings(decls)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].local < attrs[j].local
+	})
+	c.scopes[len(c.scopes)-1].name = name
+
+	/* #nosec */
+	c.w.WriteByte('<')
+	/* #nosec */
+	c.w.WriteString(name)
+	for _, prefix := range decls {
+		if prefix == "" {
+			/* #nosec */
+			c.w.WriteString(` xmlns="`)
+		} else {
+			/* #nosec */
+			c.w.WriteString(` xmlns:`)
+			/* #nosec */
+			c.w.WriteString(prefix)
+			/* #nosec */
+			c.w.WriteString(`="`)
+		}
+		err := escapeC14NAttr(c.w, scope.rendered[prefix])
+		if err != nil {
+			return err
+		}
+		/* #nosec */
+		c.w.WriteByte('"')
+	}
+	for _, a := range attrs {
+		/* #nosec */
+		c.w.WriteByte(' ')
+		/* #nosec */
+		c.w.WriteString(a.name)
+		/* #nosec */
+		c.w.WriteString(`="`)
+		err := escapeC14NAttr(c.w, a.value)
+		if err != nil {
+			return err
+		}
+		/* #nosec */
+		c.w.WriteByte('"')
+	}
+	return c.w.WriteByte('>')
+}
+
+func (c *Canonicalizer) writeEnd(end EndElement) error {
+	if len(c.scopes) == 0 {
+		return fmt.Errorf("xml: end tag </%s> without start tag", end.Name.Local)
+	}
+	scope := c.scopes[len(c.scopes)-1]
+	if scope.start != end.Name {
+		return fmt.Errorf("xml: end tag </%s> does not match start tag <%s>", end.Name.Local, scope.start.Local)
+	}
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.ns.pop()
+	/* #nosec */
+	c.w.WriteString("</")
+	/* #nosec */
+	c.w.WriteString(scope.name)
+	return c.w.WriteByte('>')
+}
+
+// inherit adds the xml:lang and xml:space attributes from XMLAttrs to attrs if
+// they are not already present and joins any xml:base values.
+// The xml:id attribute is not inherited.
+func (c *Canonicalizer) inherit(attrs []c14nAttr) []c14nAttr {
+	var base string
+	var hasBase bool
+	inherited := make(map[string]string)
+	for _, a := range c.XMLAttrs {
+		if a.Name.Space != "xml" && a.Name.Space != xmlURL {
+			continue
+		}
+		switch a.Name.Local {
+		case "lang", "space":
+			inherited[a.Name.Local] = a.Value
+		case "base":
+			if hasBase {
+				base = joinBase(base, a.Value)
+			} else {
+				base = a.Value
+			}
+			hasBase = true
+		}
+	}
+	if hasBase {
+		inherited["base"] = base
+	}
+	for i, a := range attrs {
+		if a.space != xmlURL {
+			continue
+		}
+		v, ok := inherited[a.local]
+		if !ok {
+			continue
+		}
+		if a.local == "base" {
+			attrs[i].value = joinBase(v, a.value)
+		}
+		delete(inherited, a.local)
+	}
+	for local, v := range inherited {
+		attrs = append(attrs, c14nAttr{name: "xml:" + local, space: xmlURL, local: local, value: v})
+	}
+	return attrs
+}
+
+// joinBase resolves the xml:base value ref against base.
+// If either value is not a valid URI reference ref is returned.
+func joinBase(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+type c14nAttr struct {
+	name  string
+	space string
+	local string
+	value string
+}
+
+// qualify returns the name as it should be written in the current scope along
+// with the prefix and namespace that it visibly utilizes, if any.
+// If prefer is bound to the namespace of the name it is used as the prefix.
+func (c *Canonicalizer) qualify(name Name, attr bool, prefer string) (qname, prefix, space string, ok bool) {
+	switch name.Space {
+	case "":
+		return name.Local, "", "", !attr
+	case "xml", xmlURL:
+		return "xml:" + name.Local, "", xmlURL, false
+	}
+	if prefer != "" && prefer != "xmlns" {
+		if space, _ := c.lookup(prefer); space == name.Space {
+			return prefer + ":" + name.Local, prefer, name.Space, true
+		}
+	}
+	if !attr {
+		if space, _ := c.lookup(""); space == name.Space {
+			return name.Local, "", name.Space, true
+		}
+	}
+	if prefix, ok := c.prefix(name.Space); ok {
+		return prefix + ":" + name.Local, prefix, name.Space, true
+	}
+	return name.Space + ":" + name.Local, "", name.Space, false
+}
+
+// prefix returns the innermost and most recently declared prefix that is bound
+// to space in the current scope, or the lexically smallest prefix bound to it
+// by Namespaces.
+func (c *Canonicalizer) prefix(space string) (string, bool) {
+	if prefix, ok := c.ns.prefixFor(nil, space); ok {
+		return prefix, true
+	}
+	var found string
+	for prefix, s := range c.Namespaces {
+		if prefix == "" || s != space || (found != "" && found < prefix) {
+			continue
+		}
+		if bound, _ := c.lookup(prefix); bound == space {
+			found = prefix
+		}
+	}
+	return found, found != ""
+}
+
+// lookup returns the namespace bound to prefix by the open elements or, if
+// they do not declare it, by Namespaces.
+func (c *Canonicalizer) lookup(prefix string) (string, bool) {
+	if space, ok := c.ns.lookup(prefix); ok {
+		return space, true
+	}
+	space, ok := c.Namespaces[prefix]
+	return space, ok
+}
+
+// rendered returns the namespace that was declared for prefix by the nearest
+// ancestor of the current element that declared it in the output.
+func (c *Canonicalizer) rendered(prefix string) (string, bool) {
+	for i := len(c.scopes) - 2; i >= 0; i-- {
+		if space, ok := c.scopes[i].rendered[prefix]; ok {
+			return space, true
+		}
+	}
+	return "", false
+}
+
+func escapeC14NText(w *bufio.Writer, s []byte) error {
+	last := 0
+	for i, b := range s {
+		var esc string
+		switch b {
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			esc = "&gt;"
+		case '\r':
+			esc = "&#xD;"
+		default:
+			continue
+		}
+		/* #nosec */
+		w.Write(s[last:i])
+		/* #nosec */
+		w.WriteString(esc)
+		last = i + 1
+	}
+	_, err := w.Write(s[last:])
+	return err
+}
+
+func escapeC14NAttr(w *bufio.Writer, s string) error {
+	last := 0
+	for i := 0; i < len(s); i++ {
+		var esc string
+		switch s[i] {
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '"':
+			esc = "&quot;"
+		case '\t':
+			esc = "&#x9;"
+		case '\n':
+			esc = "&#xA;"
+		case '\r':
+			esc = "&#xD;"
+		default:
+			continue
+		}
+		/* #nosec */
+		w.WriteString(s[last:i])
+		/* #nosec */
+		w.WriteString(esc)
+		last = i + 1
+	}
+	_, err := w.WriteString(s[last:])
+	return err
+}
@@ -0,0 +1,405 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var c14nTestCases = []struct {
+	in        string
+	toks      []Token
+	method    Method
+	comments  bool
+	inclusive []string
+	ns        map[string]string
+	xmlAttrs  []Attr
+	out       string
+}{
+	0: {
+		in:  `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`,
+		out: `<n0:local xmlns:n0="foo:bar"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2></n0:local>`,
+	},
+	1: {
+		in:        `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`,
+		inclusive: []string{"n3"},
+		out:       `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff></n3:stuff></n1:elem2></n0:local>`,
+	},
+	2: {
+		in:  `<a xmlns:b="urn:b" z="1" b:a="2" a="3" xmlns="urn:d"></a>`,
+		out: `<a xmlns="urn:d" xmlns:b="urn:b" a="3" z="1" b:a="2"></a>`,
+	},
+	3: {
+		in:  `<a xmlns:x="urn:x"><b></b></a>`,
+		out: `<a><b></b></a>`,
+	},
+	4: {
+		in:  `<?xml version="1.0"?><!DOCTYPE a><?pi a?><!--c--><a>b<!--e--></a><!--d--> `,
+		out: "<?pi a?>\n<a>b</a>",
+	},
+	5: {
+		in:       `<?xml version="1.0"?><!DOCTYPE a><?pi a?><!--c--><a>b<!--e--></a><!--d--> `,
+		comments: true,
+		out:      "<?pi a?>\n<!--c-->\n<a>b<!--e--></a>\n<!--d-->",
+	},
+	6: {
+		in:  `<a xmlns="urn:a"><b xmlns=""></b></a>`,
+		out: `<a xmlns="urn:a"><b xmlns=""></b></a>`,
+	},
+	7: {
+		in:  `<a><b xmlns=""></b></a>`,
+		out: `<a><b></b></a>`,
+	},
+	8: {
+		in:  `<a xmlns="urn:a"><b xmlns="urn:a"></b></a>`,
+		out: `<a xmlns="urn:a"><b></b></a>`,
+	},
+	9: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "jabber:client", Local: "message"}, Attr: []Attr{{Name: Name{Local: "to"}, Value: "a\"<b>\t"}}},
+			CharData("a&b>\r"),
+			EndElement{Name: Name{Space: "jabber:client", Local: "message"}},
+		},
+		ns:  map[string]string{"": "jabber:client", "stream": "http://etherx.jabber.org/streams"},
+		out: `<message xmlns="jabber:client" to="a&quot;&lt;b>&#x9;">a&amp;b&gt;&#xD;</message>`,
+	},
+	10: {
+		in:        `<a xmlns="urn:a" xmlns:b="urn:b"><c xmlns=""></c></a>`,
+		inclusive: []string{"#default", "b"},
+		out:       `<a xmlns="urn:a" xmlns:b="urn:b"><c xmlns=""></c></a>`,
+	},
+	11: {
+		in:     `<a xmlns:x="urn:x"><b xmlns:x="urn:x" xmlns:y="urn:y"></b></a>`,
+		method: C14N11,
+		out:    `<a xmlns:x="urn:x"><b xmlns:y="urn:y"></b></a>`,
+	},
+	12: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "jabber:client", Local: "message"}},
+			EndElement{Name: Name{Space: "jabber:client", Local: "message"}},
+		},
+		method: C14N11,
+		ns:     map[string]string{"": "jabber:client", "stream": "http://etherx.jabber.org/streams"},
+		out:    `<message xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams"></message>`,
+	},
+	13: {
+		in:     `<a xml:base="b/"><c xml:base="d/"></c></a>`,
+		method: C14N11,
+		xmlAttrs: []Attr{
+			{Name: Name{Space: "xml", Local: "lang"}, Value: "en"},
+			{Name: Name{Space: "xml", Local: "id"}, Value: "foo"},
+			{Name: Name{Space: "xml", Local: "base"}, Value: "http://example.com/"},
+			{Name: Name{Space: "xml", Local: "base"}, Value: "a/"},
+		},
+		out: `<a xml:base="http://example.com/a/b/" xml:lang="en"><c xml:base="d/"></c></a>`,
+	},
+	14: {
+		in:       `<a xml:lang="fr"></a>`,
+		method:   C14N11,
+		xmlAttrs: []Attr{{Name: Name{Space: "xml", Local: "lang"}, Value: "en"}},
+		out:      `<a xml:lang="fr"></a>`,
+	},
+}
+
+func TestCanonicalizer(t *testing.T) {
+	for i, tc := range c14nTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			toks := tc.toks
+			if toks == nil {
+				td := NewTokenizer(strings.NewReader(tc.in))
+				td.DecodeDeclaration = true
+				var err error
+				toks, err = readAll(td)
+				if err != nil {
+					t.Fatalf("unexpected error decoding: %v", err)
+				}
+			}
+			var buf strings.Builder
+			c := NewCanonicalizer(&buf)
+			c.Method = tc.method
+			c.Comments = tc.comments
+			c.InclusiveNamespaces = tc.inclusive
+			c.Namespaces = tc.ns
+			c.XMLAttrs = tc.xmlAttrs
+			for _, tok := range toks {
+				err := c.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Fatalf("wrong output:\nwant=%q,\n got=%q", tc.out, s)
+			}
+		})
+	}
+}
+
+func TestCanonicalizerMismatch(t *testing.T) {
+	c := NewCanonicalizer(&strings.Builder{})
+	err := c.EncodeToken(StartElement{Name: Name{Local: "a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	err = c.EncodeToken(EndElement{Name: Name{Local: "b"}})
+	if err == nil {
+		t.Fatalf("expected error on mismatched end element")
+	}
+}
+
+// c14nSpecTestCases are the examples from section 3 of Canonical XML Version 1.0
+// (https://www.w3.org/TR/xml-c14n), which Canonical XML 1.1 produces the same
+// output for, and from Exclusive XML Canonicalization Version 1.0
+// (https://www.w3.org/TR/xml-exc-c14n/).
+var c14nSpecTestCases = []struct {
+	in       string
+	method   Method
+	comments bool
+	ns       map[string]string
+	out      string
+}{
+	// 3.1 PIs, Comments, and Outside of Document Element
+	0: {
+		in: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+		method: C14N11,
+		out: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`,
+	},
+	1: {
+		in: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+		method:   C14N11,
+		comments: true,
+		out: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`,
+	},
+	// 3.2 Whitespace in Document Content
+	2: {
+		in: `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`,
+		method: C14N11,
+		out: `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`,
+	},
+	// 3.3 Start and End Tags
+	3: {
+		in:     c14nStartEndTags,
+		method: C14N11,
+		out: `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org" attr="default"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+	},
+	4: {
+		in: c14nStartEndTags,
+		out: `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6>
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 attr="default"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+	},
+	// 3.4 Character Modifications and Character References
+	5: {
+		in: `<!DOCTYPE doc [
+<!ATTLIST normId id ID #IMPLIED>
+<!ATTLIST normNames attr NMTOKENS #IMPLIED>
+]>
+<doc>
+   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+   <normNames attr='   A   &#x20;&#13;&#xa;&#9;   B   '/>
+   <normId id=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`,
+		method: C14N11,
+		out: `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>
+   <normNames attr="A &#xD;&#xA;&#x9; B"></normNames>
+   <normId id="' &#xD;&#xA;&#x9; '"></normId>
+</doc>`,
+	},
+	// 3.6 UTF-8 Encoding
+	6: {
+		in:     `<?xml version="1.0" encoding="ISO-8859-1"?>` + "\n" + `<doc>&#169;</doc>`,
+		method: C14N11,
+		out:    `<doc>©</doc>`,
+	},
+	// Exclusive XML Canonicalization 2.2, canonicalizing the n1:elem2 element
+	// on its own.
+	7: {
+		in: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"/>
+   </n1:elem2>`,
+		ns: map[string]string{"n0": "foo:bar", "n3": "ftp://example.org"},
+		out: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+   </n1:elem2>`,
+	},
+	8: {
+		in: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"/>
+   </n1:elem2>`,
+		ns:     map[string]string{"n0": "foo:bar", "n3": "ftp://example.org"},
+		method: C14N11,
+		out: `<n1:elem2 xmlns:n0="foo:bar" xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en">
+       <n3:stuff></n3:stuff>
+   </n1:elem2>`,
+	},
+	// Line endings are normalized but carriage returns from character
+	// references are not.
+	9: {
+		in:  "<a b='c\r\nd\re&#xD;'>\r\n&#xD;\r</a>",
+		out: "<a b=\"c d e&#xD;\">\n&#xD;\n</a>",
+	},
+	// The prefixes used in the input are kept even if another prefix, or the
+	// default namespace, is bound to the same namespace.
+	10: {
+		in:  `<b:x xmlns:b="urn:u" xmlns:a="urn:u"/>`,
+		out: `<b:x xmlns:b="urn:u"></b:x>`,
+	},
+	11: {
+		in:  `<p:x xmlns="urn:u" xmlns:p="urn:u"><y p:z="1"/></p:x>`,
+		out: `<p:x xmlns:p="urn:u"><y xmlns="urn:u" p:z="1"></y></p:x>`,
+	},
+	12: {
+		in:     `<p:x xmlns="urn:u" xmlns:p="urn:u"><y p:z="1"/></p:x>`,
+		method: C14N11,
+		out:    `<p:x xmlns="urn:u" xmlns:p="urn:u"><y p:z="1"></y></p:x>`,
+	},
+}
+
+const c14nStartEndTags = `<!DOCTYPE doc [<!ATTLIST e9 attr CDATA "default">]>
+<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`
+
+func TestCanonicalizerSpec(t *testing.T) {
+	for i, tc := range c14nSpecTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SourceTokens = true
+			var buf strings.Builder
+			c := NewCanonicalizer(&buf)
+			c.Method = tc.method
+			c.Comments = tc.comments
+			c.Namespaces = tc.ns
+			for {
+				tok, err := td.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error decoding: %v", err)
+				}
+				err = c.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err := c.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// CDATA is character data that is written as a CDATA section.
+// Any "]]>" in the data is split across two sections when it is encoded.
+//
+// CDATA is never returned by a Tokenizer, it is only used to control how
+// character data is encoded by a RawEncoder.
+// Other writers in this package treat it as CharData.
+type CDATA []byte
+
+// Copy creates a new copy of CDATA.
+func (c CDATA) Copy() CDATA {
+	return CDATA(append([]byte(nil), c...))
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"context"
+	"time"
+)
+
+// aLongTimeAgo is a non-zero time in the past used to immediately interrupt
+// reads.
+var aLongTimeAgo = time.Unix(1, 0)
+
+type readDeadliner interface {
+	SetReadDeadline(time.Time) error
+}
+
+// TokenContext is like Token except that if ctx is canceled while waiting on
+// input the read is interrupted and the context's error is returned.
+//
+// Reads can only be interrupted if the reader passed to NewTokenizer (or
+// SetReader) has a SetReadDeadline method, such as a net.Conn.
+// Otherwise the context is only checked before reading begins.
+// Any partially decoded token is kept so that decoding can resume on the next
+// call to Token or TokenContext.
+func (t *Tokenizer) TokenContext(ctx context.Context) (Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, ok := t.src.(readDeadliner)
+	if !ok || ctx.Done() == nil {
+		return t.Token()
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			/* #nosec */
+			d.SetReadDeadline(aLongTimeAgo)
+		case <-stop:
+		}
+	}()
+
+	tok, err := t.Token()
+	close(stop)
+	<-done
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		// The deadline may have been set after the read completed, so always
+		// clear it.
+		/* #nosec */
+		d.SetReadDeadline(time.Time{})
+		if err != nil {
+			return nil, ctxErr
+		}
+	}
+	return tok, err
+}
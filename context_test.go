@@ -0,0 +1,73 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	. "mellium.im/xml"
+)
+
+func TestTokenContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	td := NewTokenizer(errReader{})
+	_, err := td.TokenContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error: want=%v, got=%v", context.Canceled, err)
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("should not be read")
+}
+
+func TestTokenContextInterrupt(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		/* #nosec */
+		server.Write([]byte(`<a><b c="d`))
+	}()
+
+	td := NewTokenizer(client)
+	tok, err := td.TokenContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}
+	if !reflect.DeepEqual(tok, want) {
+		t.Fatalf("wrong token: want=%+v, got=%+v", want, tok)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = td.TokenContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error: want=%v, got=%v", context.DeadlineExceeded, err)
+	}
+
+	go func() {
+		/* #nosec */
+		server.Write([]byte(`"/>`))
+	}()
+	tok, err = td.TokenContext(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error after interrupt: %v", err)
+	}
+	want = StartElement{Name: Name{Local: "b"}, Attr: []Attr{{Name: Name{Local: "c"}, Value: "d"}}}
+	if !reflect.DeepEqual(tok, want) {
+		t.Fatalf("wrong token after interrupt: want=%+v, got=%+v", want, tok)
+	}
+}
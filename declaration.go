@@ -0,0 +1,92 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"strings"
+)
+
+// Declaration is the XML declaration that may appear at the very start of a
+// document, for example:
+//
+//	<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+//
+// It is only returned by a Tokenizer if DecodeDeclaration is set, otherwise
+// the declaration is returned as a ProcInst.
+type Declaration struct {
+	Version  string
+	Encoding string
+
+	// Standalone is "yes" or "no", or empty if the declaration does not have a
+	// standalone pseudo-attribute.
+	Standalone string
+}
+
+// ProcInst returns the declaration as a processing instruction.
+func (d Declaration) ProcInst() ProcInst {
+	var inst strings.Builder
+	inst.WriteString(`version="`)
+	inst.WriteString(d.Version)
+	inst.WriteByte('"')
+	if d.Encoding != "" {
+		inst.WriteString(` encoding="`)
+		inst.WriteString(d.Encoding)
+		inst.WriteByte('"')
+	}
+	if d.Standalone != "" {
+		inst.WriteString(` standalone="`)
+		inst.WriteString(d.Standalone)
+		inst.WriteByte('"')
+	}
+	return ProcInst{Target: "xml", Inst: []byte(inst.String())}
+}
+
+// parseDeclaration parses and validates the pseudo-attributes of an XML
+// declaration.
+func parseDeclaration(pi ProcInst) (Declaration, error) {
+	var d Declaration
+	attrs, err := ProcInstAttrs(pi)
+	if err != nil {
+		return d, err
+	}
+	for i, attr := range attrs {
+		switch {
+		case i == 0 && attr.Name.Local == "version":
+			if !validVersion(attr.Value) {
+				return d, &SyntaxError{Msg: "invalid version " + attr.Value + " in XML declaration"}
+			}
+			d.Version = attr.Value
+		case i > 0 && attr.Name.Local == "encoding" && d.Encoding == "" && d.Standalone == "":
+			d.Encoding = attr.Value
+		case i > 0 && attr.Name.Local == "standalone" && i == len(attrs)-1:
+			switch attr.Value {
+			case "yes", "no":
+				d.Standalone = attr.Value
+			default:
+				return d, &SyntaxError{Msg: "invalid standalone value " + attr.Value + " in XML declaration"}
+			}
+		default:
+			return d, &SyntaxError{Msg: "unexpected " + attr.Name.Local + " in XML declaration"}
+		}
+	}
+	if d.Version == "" {
+		return d, &SyntaxError{Msg: "missing version in XML declaration"}
+	}
+	return d, nil
+}
+
+// validVersion reports whether v matches the VersionNum production.
+func validVersion(v string) bool {
+	if !strings.HasPrefix(v, "1.") || len(v) == 2 {
+		return false
+	}
+	minor := v[2:]
+	for _, c := range minor {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var declarationTestCases = []struct {
+	in  string
+	out Token
+	err bool
+}{
+	0: {
+		in:  `<?xml version="1.0"?>`,
+		out: Declaration{Version: "1.0"},
+	},
+	1: {
+		in:  `<?xml version='1.1' encoding="UTF-8" standalone='yes'?>`,
+		out: Declaration{Version: "1.1", Encoding: "UTF-8", Standalone: "yes"},
+	},
+	2: {
+		in:  `<?xml version="1.0" standalone="no"?>`,
+		out: Declaration{Version: "1.0", Standalone: "no"},
+	},
+	3: {
+		in:  `<?xml encoding="UTF-8"?>`,
+		err: true,
+	},
+	4: {
+		in:  `<?xml version="2.0"?>`,
+		err: true,
+	},
+	5: {
+		in:  `<?xml version="1.0" standalone="maybe"?>`,
+		err: true,
+	},
+	6: {
+		in:  `<?xml standalone="yes" version="1.0"?>`,
+		err: true,
+	},
+	7: {
+		in:  `<?xml-stylesheet href="a.xsl"?>`,
+		out: ProcInst{Target: "xml-stylesheet", Inst: []byte(`href="a.xsl"`)},
+	},
+}
+
+func TestDeclaration(t *testing.T) {
+	for i, tc := range declarationTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.DecodeDeclaration = true
+			tok, err := td.Token()
+			switch {
+			case tc.err && err == nil:
+				t.Fatalf("expected error, got token %T(%+[1]v)", tok)
+			case !tc.err && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tok, tc.out) && !tc.err {
+				t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", tc.out, tok)
+			}
+		})
+	}
+}
+
+func TestDeclarationNotAtStart(t *testing.T) {
+	td := NewTokenizer(strings.NewReader(`<a/><?xml version="1.0"?>`))
+	td.DecodeDeclaration = true
+	for i := 0; i < 2; i++ {
+		_, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+	}
+	_, err := td.Token()
+	if err == nil {
+		t.Fatalf("expected error for declaration that is not at the start of the document")
+	}
+}
+
+func TestDeclarationProcInst(t *testing.T) {
+	d := Declaration{Version: "1.0", Encoding: "UTF-8", Standalone: "yes"}
+	pi := d.ProcInst()
+	const want = `version="1.0" encoding="UTF-8" standalone="yes"`
+	if pi.Target != "xml" || string(pi.Inst) != want {
+		t.Fatalf("wrong procinst: want=xml %q, got=%s %q", want, pi.Target, pi.Inst)
+	}
+}
+
+func TestDeclarationRoundTrip(t *testing.T) {
+	for _, in := range []string{
+		`<?xml version="1.0"?>`,
+		`<?xml version="1.0" standalone="no"?>`,
+		`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`,
+	} {
+		td := NewTokenizer(strings.NewReader(in))
+		td.DecodeDeclaration = true
+		tok, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error decoding %s: %v", in, err)
+		}
+		var buf strings.Builder
+		e := NewEncoder(&buf)
+		if err = e.EncodeToken(tok); err != nil {
+			t.Fatalf("unexpected error encoding %s: %v", in, err)
+		}
+		if err = e.Flush(); err != nil {
+			t.Fatalf("unexpected error flushing %s: %v", in, err)
+		}
+		if out := buf.String(); out != in {
+			t.Errorf("wrong output: want=%s, got=%s", in, out)
+		}
+	}
+}
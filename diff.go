@@ -0,0 +1,172 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Difference describes a pair of tokens that differ between two token streams.
+type Difference struct {
+	// Index is the zero based index of the tokens in both streams.
+	Index int
+
+	// Path contains the names of the elements that enclose the token in the
+	// first stream.
+	Path []Name
+
+	// A and B are the tokens from the first and second stream.
+	// A token is nil if its stream ended before the other.
+	A, B Token
+
+	// ASpan and BSpan are the positions of the tokens in the input if the
+	// TokenReader that returned them has a Span method, such as a Tokenizer.
+	ASpan, BSpan Span
+}
+
+// String returns a human readable description of the difference.
+func (d Difference) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "token %d", d.Index)
+	if len(d.Path) > 0 {
+		b.WriteString(" in ")
+		for _, name := range d.Path {
+			b.WriteByte('/')
+			b.WriteString(describeName(name))
+		}
+	}
+	fmt.Fprintf(&b, ": %s%s != %s%s", describeToken(d.A), describeSpan(d.ASpan), describeToken(d.B), describeSpan(d.BSpan))
+	return b.String()
+}
+
+// Diff compares the tokens read from a and b using Equal until both reach
+// io.EOF and returns the first difference, or nil if the streams are equal.
+// If either reader returns an error other than io.EOF it is returned.
+func Diff(a, b TokenReader) (*Difference, error) {
+	diffs, err := diff(a, b, false)
+	if len(diffs) == 0 {
+		return nil, err
+	}
+	return &diffs[0], err
+}
+
+// DiffAll is like Diff except that it reads both streams to the end and
+// returns every difference.
+// Tokens are compared pairwise, so a token that is missing from one stream
+// results in a difference for every token that follows it.
+func DiffAll(a, b TokenReader) ([]Difference, error) {
+	return diff(a, b, true)
+}
+
+type spanReader interface {
+	Span() Span
+}
+
+func diff(a, b TokenReader, all bool) ([]Difference, error) {
+	var (
+		diffs        []Difference
+		path         []Name
+		doneA, doneB bool
+	)
+	next := func(r TokenReader, done *bool) (Token, Span, error) {
+		if *done {
+			return nil, Span{}, nil
+		}
+		tok, err := r.Token()
+		if err == io.EOF {
+			*done = true
+			err = nil
+		}
+		var span Span
+		if s, ok := r.(spanReader); ok && tok != nil {
+			span = s.Span()
+		}
+		return tok, span, err
+	}
+	for i := 0; ; i++ {
+		ta, sa, err := next(a, &doneA)
+		if err != nil {
+			return diffs, err
+		}
+		tb, sb, err := next(b, &doneB)
+		if err != nil {
+			return diffs, err
+		}
+		if ta == nil && tb == nil && doneA && doneB {
+			return diffs, nil
+		}
+		if !Equal(ta, tb) {
+			diffs = append(diffs, Difference{
+				Index: i,
+				Path:  append([]Name(nil), path...),
+				A:     ta,
+				B:     tb,
+				ASpan: sa,
+				BSpan: sb,
+			})
+			if !all {
+				return diffs, nil
+			}
+		}
+		switch tok := unwrapSource(ta).(type) {
+		case StartElement:
+			path = append(path, tok.Name)
+		case EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+}
+
+func describeName(name Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+func describeSpan(s Span) string {
+	if s == (Span{}) {
+		return ""
+	}
+	return fmt.Sprintf(" (line %d, column %d)", s.Start.Line, s.Start.Col)
+}
+
+// describeToken returns a short description of tok for use in messages.
+func describeToken(tok Token) string {
+	switch tok := unwrapSource(tok).(type) {
+	case nil:
+		return "end of input"
+	case StartElement:
+		var b strings.Builder
+		b.WriteString("<")
+		b.WriteString(describeName(tok.Name))
+		for _, a := range tok.Attr {
+			fmt.Fprintf(&b, " %s=%s", describeName(a.Name), strconv.Quote(a.Value))
+		}
+		b.WriteString(">")
+		return b.String()
+	case EndElement:
+		return "</" + describeName(tok.Name) + ">"
+	case CharData:
+		return "text " + strconv.Quote(string(tok))
+	case CDATA:
+		return "CDATA " + strconv.Quote(string(tok))
+	case Comment:
+		return "comment " + strconv.Quote(string(tok))
+	case ProcInst:
+		return "<?" + tok.Target + " " + string(tok.Inst) + "?>"
+	case Declaration:
+		pi := tok.ProcInst()
+		return "<?" + pi.Target + " " + string(pi.Inst) + "?>"
+	case Directive:
+		return "<!" + string(tok) + ">"
+	}
+	return fmt.Sprintf("%v", tok)
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var diffTestCases = [...]struct {
+	a, b string
+	diff string
+	all  []string
+}{
+	0: {a: `<a><b/></a>`, b: `<a><b></b></a>`},
+	1: {a: `<a xmlns:x="urn:x"><x:b/></a>`, b: `<a><b xmlns="urn:x"/></a>`},
+	2: {
+		a:    `<a><b c="1">text</b></a>`,
+		b:    `<a><b c="2">text</b></a>`,
+		diff: `token 1 in /a: <b c="1"> (line 1, column 4) != <b c="2"> (line 1, column 4)`,
+	},
+	3: {
+		a:    "<a>\n<b>x</b>\n<c>y</c></a>",
+		b:    "<a>\n<b>z</b>\n<c>w</c></a>",
+		diff: `token 3 in /a/b: text "x" (line 2, column 4) != text "z" (line 2, column 4)`,
+		all: []string{
+			`token 3 in /a/b: text "x" (line 2, column 4) != text "z" (line 2, column 4)`,
+			`token 7 in /a/c: text "y" (line 3, column 4) != text "w" (line 3, column 4)`,
+		},
+	},
+	4: {
+		a:    `<a></a>`,
+		b:    `<a></a><!--b-->`,
+		diff: `token 2: end of input != comment "b" (line 1, column 8)`,
+	},
+}
+
+func TestDiff(t *testing.T) {
+	for i, tc := range diffTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d, err := Diff(NewTokenizer(strings.NewReader(tc.a)), NewTokenizer(strings.NewReader(tc.b)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			switch {
+			case d == nil && tc.diff != "":
+				t.Fatalf("expected difference %s", tc.diff)
+			case d != nil && tc.diff == "":
+				t.Fatalf("unexpected difference: %s", d)
+			case d != nil && d.String() != tc.diff:
+				t.Errorf("wrong difference:\nwant=%s,\n got=%s", tc.diff, d)
+			}
+
+			all, err := DiffAll(NewTokenizer(strings.NewReader(tc.a)), NewTokenizer(strings.NewReader(tc.b)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := tc.all
+			if want == nil && tc.diff != "" {
+				want = []string{tc.diff}
+			}
+			if len(all) != len(want) {
+				t.Fatalf("wrong number of differences: want=%d, got=%d (%v)", len(want), len(all), all)
+			}
+			for i, d := range all {
+				if d.String() != want[i] {
+					t.Errorf("wrong difference %d:\nwant=%s,\n got=%s", i, want[i], d)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffError(t *testing.T) {
+	_, err := Diff(NewTokenizer(strings.NewReader(`<a/>`)), NewTokenizer(errReader{}))
+	if err == nil {
+		t.Errorf("expected error from reader")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"hash"
+	"io"
+)
+
+// DigestOptions selects the canonicalization algorithm used by Digest and its
+// options.
+// The fields have the same meaning as the fields of Canonicalizer with the
+// same names.
+type DigestOptions struct {
+	Method              Method
+	Comments            bool
+	InclusiveNamespaces []string
+	Namespaces          map[string]string
+	XMLAttrs            []Attr
+}
+
+// Digest writes the canonical form of the tokens read from r to h until r
+// returns io.EOF and returns the resulting sum.
+// The canonical form is written directly to h and is never held in memory in
+// its entirety.
+//
+// To digest a single element and its children use ElementReader or Wrap and
+// Inner to limit r to the element and set opts.Namespaces to the namespaces
+// declared by its ancestors.
+func Digest(h hash.Hash, r TokenReader, opts DigestOptions) ([]byte, error) {
+	c := NewCanonicalizer(h)
+	c.Method = opts.Method
+	c.Comments = opts.Comments
+	c.InclusiveNamespaces = opts.InclusiveNamespaces
+	c.Namespaces = opts.Namespaces
+	c.XMLAttrs = opts.XMLAttrs
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			if e := c.EncodeToken(tok); e != nil {
+				return nil, e
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestDigest(t *testing.T) {
+	const (
+		in        = `<?xml version="1.0"?><a xmlns:x="urn:x" c="d" b="c"><!-- e --><x:f/></a>`
+		canonical = `<a b="c" c="d"><x:f xmlns:x="urn:x"></x:f></a>`
+	)
+	want := sha256.Sum256([]byte(canonical))
+
+	sum, err := Digest(sha256.New(), NewTokenizer(strings.NewReader(in)), DigestOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(sum, want[:]) {
+		t.Fatalf("wrong digest: want=%x, got=%x", want, sum)
+	}
+}
+
+func TestDigestElement(t *testing.T) {
+	const (
+		in        = `<stream:stream xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams"><message to="a"><body>b</body></message>`
+		canonical = `<message xmlns="jabber:client" to="a"><body>b</body></message>`
+	)
+	want := sha256.Sum256([]byte(canonical))
+
+	d := NewTokenizer(strings.NewReader(in))
+	_, err := d.Token()
+	if err != nil {
+		t.Fatalf("unexpected error reading stream header: %v", err)
+	}
+	tok, err := d.Token()
+	if err != nil {
+		t.Fatalf("unexpected error reading stanza: %v", err)
+	}
+	start := tok.(StartElement)
+	sum, err := Digest(sha256.New(), Wrap(Inner(d), start), DigestOptions{
+		Namespaces: map[string]string{"": "jabber:client", "stream": "http://etherx.jabber.org/streams"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(sum, want[:]) {
+		t.Fatalf("wrong digest: want=%x, got=%x", want, sum)
+	}
+}
+
+func TestDigestOptions(t *testing.T) {
+	const (
+		in        = `<a xmlns:x="urn:x"><!-- c --><b/></a>`
+		canonical = `<a xmlns:x="urn:x"><!-- c --><b></b></a>`
+	)
+	want := sha256.Sum256([]byte(canonical))
+
+	sum, err := Digest(sha256.New(), NewTokenizer(strings.NewReader(in)), DigestOptions{
+		Method:   C14N11,
+		Comments: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(sum, want[:]) {
+		t.Fatalf("wrong digest: want=%x, got=%x", want, sum)
+	}
+}
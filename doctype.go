@@ -0,0 +1,409 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// doctype holds the declarations from a DOCTYPE directive that affect
+// tokenizing.
+type doctype struct {
+	// name is the name of the root element.
+	name string
+
+	// publicID and systemID identify the external subset, if any.
+	publicID string
+	systemID string
+
+	// attlists contains the attribute declarations keyed by the qualified name
+	// of the element as it appears in the declaration.
+	// Attribute names are left unresolved with any prefix in the Space field.
+	attlists map[string][]attrDecl
+
+	// elements contains the content models declared by ELEMENT declarations.
+	elements map[string]*contentModel
+
+	// entities contains the external parsed general entities.
+	entities map[string]externalID
+
+	// internal contains the replacement text of internal general entities.
+	internal map[string]string
+
+	// declared contains the names of all general entities that are declared,
+	// including internal and unparsed entities.
+	declared map[string]bool
+}
+
+// attrDecl is an attribute declared by an ATTLIST declaration.
+type attrDecl struct {
+	// Attr holds the name of the attribute and its default value, if any.
+	Attr
+
+	// typ is the declared type, such as CDATA or ID, and enum holds the allowed
+	// values of enumerated and NOTATION types.
+	typ  string
+	enum []string
+
+	// mode is #REQUIRED, #IMPLIED, #FIXED, or empty if the attribute has a
+	// default value that is not fixed.
+	mode string
+}
+
+// hasDefault reports whether the attribute has a default value.
+func (a attrDecl) hasDefault() bool {
+	return a.mode == "" || a.mode == "#FIXED"
+}
+
+type externalID struct {
+	publicID string
+	systemID string
+}
+
+// parseDoctype parses a DOCTYPE directive and the declarations in its internal
+// subset.
+// If dir is not a DOCTYPE it returns nil.
+func parseDoctype(dir []byte) *doctype {
+	if !bytes.HasPrefix(dir, []byte("DOCTYPE")) {
+		return nil
+	}
+	d := &doctype{
+		attlists: make(map[string][]attrDecl),
+		elements: make(map[string]*contentModel),
+		entities: make(map[string]externalID),
+		internal: make(map[string]string),
+		declared: make(map[string]bool),
+	}
+	s := string(dir[len("DOCTYPE"):])
+	start, subset := internalSubset(s)
+	if toks := declTokens(s[:start]); len(toks) > 0 {
+		d.name = toks[0]
+		if id, ok := parseExternalID(toks[1:]); ok {
+			d.publicID, d.systemID = id.publicID, id.systemID
+		}
+	}
+	d.parseDecls(subset)
+	return d
+}
+
+// parseDecls parses the declarations in a DTD subset.
+//
+// As required of non-validating processors, the first declaration of an
+// attribute or entity is binding and declarations that follow a parameter
+// entity reference are not processed.
+// The same is true of element declarations.
+// Malformed declarations are ignored.
+func (d *doctype) parseDecls(subset string) {
+	for len(subset) > 0 {
+		switch {
+		case isSpace(subset[0]):
+			subset = subset[1:]
+			continue
+		case subset[0] == '%', strings.HasPrefix(subset, "<!["):
+			return
+		case subset[0] != '<':
+			// Not well formed; give up rather than guess.
+			return
+		}
+		end := declEnd(subset)
+		decl := subset[:end]
+		subset = subset[end:]
+		if !strings.HasSuffix(decl, ">") {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(decl, "<!ATTLIST"):
+			parseAttlist(d.attlists, decl[len("<!ATTLIST"):len(decl)-1])
+		case strings.HasPrefix(decl, "<!ENTITY"):
+			d.parseEntity(decl[len("<!ENTITY") : len(decl)-1])
+		case strings.HasPrefix(decl, "<!ELEMENT"):
+			toks := declTokens(decl[len("<!ELEMENT") : len(decl)-1])
+			if len(toks) == 0 {
+				continue
+			}
+			if _, declared := d.elements[toks[0]]; declared {
+				continue
+			}
+			body := strings.TrimSpace(decl[len("<!ELEMENT") : len(decl)-1])
+			if m, ok := parseContentSpec(strings.TrimSpace(body[len(toks[0]):])); ok {
+				d.elements[toks[0]] = m
+			}
+		}
+	}
+}
+
+// parseEntity records the name of a general entity declared by an ENTITY
+// declaration and either its replacement text if it is an internal entity or
+// its identifier if it is an external parsed entity.
+func (d *doctype) parseEntity(decl string) {
+	toks := declTokens(decl)
+	if len(toks) < 2 || toks[0] == "%" || d.declared[toks[0]] {
+		return
+	}
+	d.declared[toks[0]] = true
+	if len(toks) == 2 && isQuoted(toks[1]) {
+		d.internal[toks[0]] = replacementText(unquote(toks[1]))
+		return
+	}
+	if len(toks) < 3 {
+		return
+	}
+	id, ok := parseExternalID(toks[1:])
+	if !ok {
+		return
+	}
+	n := 3
+	if toks[1] == "PUBLIC" {
+		n = 4
+	}
+	// Unparsed entities cannot be referenced from content.
+	if len(toks) > n {
+		return
+	}
+	d.entities[toks[0]] = id
+}
+
+// parseExternalID parses a SYSTEM or PUBLIC external identifier from the start
+// of toks.
+func parseExternalID(toks []string) (externalID, bool) {
+	var id externalID
+	switch {
+	case len(toks) >= 2 && toks[0] == "SYSTEM" && isQuoted(toks[1]):
+		id.systemID = unquote(toks[1])
+	case len(toks) >= 3 && toks[0] == "PUBLIC" && isQuoted(toks[1]) && isQuoted(toks[2]):
+		id.publicID, id.systemID = unquote(toks[1]), unquote(toks[2])
+	default:
+		return id, false
+	}
+	return id, true
+}
+
+// replacementText returns the replacement text of an internal entity with the
+// given literal value.
+// Character references are replaced when the entity is declared, but
+// references to other entities are left to be expanded where the entity is
+// used.
+func replacementText(lit string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(lit, "&#")
+		if i < 0 {
+			break
+		}
+		end := strings.IndexByte(lit[i:], ';')
+		if end < 0 {
+			break
+		}
+		r, ok := resolveEntity(lit[i+1 : i+end])
+		if !ok {
+			// Leave the reference for the tokenizer to report where the entity is
+			// used.
+			b.WriteString(lit[:i+end+1])
+			lit = lit[i+end+1:]
+			continue
+		}
+		b.WriteString(lit[:i])
+		b.WriteRune(r)
+		lit = lit[i+end+1:]
+	}
+	b.WriteString(lit)
+	return b.String()
+}
+
+func isQuoted(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0]
+}
+
+func unquote(s string) string {
+	return s[1 : len(s)-1]
+}
+
+// internalSubset returns the text between the brackets of a DOCTYPE
+// directive and the offset of the opening bracket, or the length of dir if
+// there is none.
+func internalSubset(dir string) (int, string) {
+	var inquote byte
+	start := -1
+	for i := 0; i < len(dir); i++ {
+		b := dir[i]
+		switch {
+		case inquote != 0:
+			if b == inquote {
+				inquote = 0
+			}
+		case b == '"' || b == '\'':
+			inquote = b
+		case b == '[' && start < 0:
+			start = i + 1
+		case b == ']' && start >= 0:
+			return start - 1, dir[start:i]
+		}
+	}
+	return len(dir), ""
+}
+
+// declEnd returns the length of the markup declaration, comment, or
+// processing instruction at the start of s.
+func declEnd(s string) int {
+	if strings.HasPrefix(s, "<?") {
+		if i := strings.Index(s, "?>"); i >= 0 {
+			return i + 2
+		}
+		return len(s)
+	}
+	var inquote byte
+	for i := 1; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case inquote != 0:
+			if b == inquote {
+				inquote = 0
+			}
+		case b == '"' || b == '\'':
+			inquote = b
+		case b == '>':
+			return i + 1
+		}
+	}
+	return len(s)
+}
+
+// parseAttlist adds the attributes declared by the body of an ATTLIST
+// declaration.
+func parseAttlist(attlists map[string][]attrDecl, decl string) {
+	toks := declTokens(decl)
+	if len(toks) == 0 {
+		return
+	}
+	elem := toks[0]
+	toks = toks[1:]
+	for len(toks) >= 3 {
+		name, typ := toks[0], toks[1]
+		toks = toks[2:]
+		attr := attrDecl{typ: typ}
+		if typ == "NOTATION" {
+			typ = toks[0]
+			toks = toks[1:]
+			if len(toks) == 0 {
+				return
+			}
+		}
+		if strings.HasPrefix(typ, "(") {
+			if attr.typ != "NOTATION" {
+				attr.typ = "ENUMERATION"
+			}
+			for _, v := range strings.Split(strings.Trim(typ, "()"), "|") {
+				attr.enum = append(attr.enum, strings.TrimSpace(v))
+			}
+		}
+		def := toks[0]
+		toks = toks[1:]
+		switch def {
+		case "#REQUIRED", "#IMPLIED":
+			attr.mode = def
+		case "#FIXED":
+			if len(toks) == 0 {
+				return
+			}
+			attr.mode = def
+			def = toks[0]
+			toks = toks[1:]
+		}
+		if attr.hasDefault() {
+			if !isQuoted(def) {
+				return
+			}
+			attr.Value = normalizeAttr(unquote(def), attr.typ == "CDATA")
+		}
+		if prefix, local, ok := strings.Cut(name, ":"); ok {
+			attr.Name = Name{Space: prefix, Local: local}
+		} else {
+			attr.Name.Local = name
+		}
+		declared := false
+		for _, a := range attlists[elem] {
+			if a.Name == attr.Name {
+				declared = true
+				break
+			}
+		}
+		if !declared {
+			attlists[elem] = append(attlists[elem], attr)
+		}
+	}
+}
+
+// declTokens splits a declaration on whitespace, keeping quoted strings and
+// parenthesized groups together.
+func declTokens(s string) []string {
+	var toks []string
+	for i := 0; i < len(s); {
+		if isSpace(s[i]) {
+			i++
+			continue
+		}
+		start := i
+		switch s[i] {
+		case '"', '\'':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end < 0 {
+				return toks
+			}
+			i += end + 2
+		case '(':
+			end := strings.IndexByte(s[i:], ')')
+			if end < 0 {
+				return toks
+			}
+			i += end + 1
+		default:
+			for i < len(s) && !isSpace(s[i]) && s[i] != '"' && s[i] != '\'' && s[i] != '(' {
+				i++
+			}
+		}
+		toks = append(toks, s[start:i])
+	}
+	return toks
+}
+
+// normalizeAttr normalizes a default attribute value, replacing whitespace
+// with spaces and character and predefined entity references with the
+// characters that they represent.
+// If the attribute is not of type CDATA leading and trailing spaces are
+// removed and runs of spaces are collapsed.
+func normalizeAttr(v string, cdata bool) string {
+	var b []byte
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		switch {
+		case isSpace(c):
+			b = append(b, ' ')
+			continue
+		case c == '&':
+			if end := strings.IndexByte(v[i:], ';'); end > 0 {
+				if r, ok := resolveEntity(v[i+1 : i+end]); ok {
+					b = utf8.AppendRune(b, r)
+					i += end
+					continue
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	if cdata {
+		return string(b)
+	}
+	return collapseSpace(string(b))
+}
+
+// collapseSpace removes leading and trailing spaces from v and replaces runs of
+// spaces with a single space.
+func collapseSpace(v string) string {
+	return strings.Join(strings.FieldsFunc(v, func(r rune) bool {
+		return r == ' '
+	}), " ")
+}
@@ -0,0 +1,212 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package dom builds an in-memory tree of nodes from an XML token stream.
+//
+// The tree is useful for workloads that need random access to, or mutation of,
+// a document that is small enough to fit in memory.
+// For large documents prefer processing tokens as they are read.
+package dom // import "mellium.im/xml/dom"
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// NodeType is the type of a Node.
+type NodeType int
+
+// A list of node types.
+const (
+	// DocumentNode is the root of a tree.
+	// Its children are the top level nodes of the document.
+	DocumentNode NodeType = iota
+
+	// ElementNode is an element.
+	// Its Name and Attr fields are set.
+	ElementNode
+
+	// TextNode is character data, including CDATA sections.
+	// Its Data field is set.
+	TextNode
+
+	// CommentNode is a comment.
+	// Its Data field is set.
+	CommentNode
+
+	// ProcInstNode is a processing instruction, including the XML declaration.
+	// Its Name.Local field is the target and Data field is the instruction.
+	ProcInstNode
+
+	// DirectiveNode is a directive such as a DOCTYPE.
+	// Its Data field is set.
+	DirectiveNode
+
+	// AttrNode is an attribute.
+	// Attributes are stored in the Attr field of their element and do not
+	// appear in the tree, but nodes of this type are returned by XPath
+	// expressions that select attributes.
+	// Its Name and Data fields are set and its Parent is the element.
+	AttrNode
+)
+
+// Node is a node in the tree.
+type Node struct {
+	Type NodeType
+	Name xml.Name
+	Attr []xml.Attr
+	Data string
+
+	Parent      *Node
+	FirstChild  *Node
+	LastChild   *Node
+	PrevSibling *Node
+	NextSibling *Node
+}
+
+// Parse reads tokens from r until io.EOF and returns a DocumentNode
+// containing the resulting tree.
+// Adjacent character data is combined into a single TextNode.
+//
+// Names are expected to have already been resolved to their namespaces, as
+// they are by a Tokenizer, and xmlns attributes are kept as attributes.
+func Parse(r xml.TokenReader) (*Node, error) {
+	doc := &Node{Type: DocumentNode}
+	parent := doc
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			parent, err = parseToken(parent, tok, err)
+		}
+		if err == io.EOF {
+			if parent != doc {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return doc, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseToken adds tok to the tree and returns the new parent.
+func parseToken(parent *Node, tok xml.Token, err error) (*Node, error) {
+	if st, ok := tok.(xml.SourceToken); ok {
+		tok = st.Token
+	}
+	switch tok := tok.(type) {
+	case xml.StartElement:
+		n := &Node{
+			Type: ElementNode,
+			Name: tok.Name,
+			Attr: tok.Copy().Attr,
+		}
+		parent.appendChild(n)
+		return n, err
+	case xml.EndElement:
+		if parent.Type != ElementNode {
+			return parent, fmt.Errorf("dom: unexpected end element </%s>", tok.Name.Local)
+		}
+		if parent.Name != tok.Name {
+			return parent, fmt.Errorf("dom: end element </%s> does not match start element <%s>", tok.Name.Local, parent.Name.Local)
+		}
+		return parent.Parent, err
+	case xml.CharData:
+		parent.appendText(string(tok))
+	case xml.CDATA:
+		parent.appendText(string(tok))
+	case xml.Comment:
+		parent.appendChild(&Node{Type: CommentNode, Data: string(tok)})
+	case xml.ProcInst:
+		parent.appendChild(&Node{Type: ProcInstNode, Name: xml.Name{Local: tok.Target}, Data: string(tok.Inst)})
+	case xml.Declaration:
+		pi := tok.ProcInst()
+		parent.appendChild(&Node{Type: ProcInstNode, Name: xml.Name{Local: pi.Target}, Data: string(pi.Inst)})
+	case xml.Directive:
+		parent.appendChild(&Node{Type: DirectiveNode, Data: string(tok)})
+	}
+	return parent, err
+}
+
+func (n *Node) appendText(s string) {
+	if n.LastChild != nil && n.LastChild.Type == TextNode {
+		n.LastChild.Data += s
+		return
+	}
+	n.appendChild(&Node{Type: TextNode, Data: s})
+}
+
+func (n *Node) appendChild(c *Node) {
+	c.Parent = n
+	c.PrevSibling = n.LastChild
+	if n.LastChild != nil {
+		n.LastChild.NextSibling = c
+	} else {
+		n.FirstChild = c
+	}
+	n.LastChild = c
+}
+
+// Root returns the first element that is a child of the document containing
+// n, or nil if there is none.
+func (n *Node) Root() *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	if n.Type == ElementNode {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == ElementNode {
+			return c
+		}
+	}
+	return nil
+}
+
+// ElementByID returns the first element in document order, starting with n
+// itself, that has an xml:id attribute with the given value, or nil if there is
+// none.
+// Whitespace at the start and end of attribute values is ignored.
+func (n *Node) ElementByID(id string) *Node {
+	if n.Type == ElementNode {
+		for _, a := range n.Attr {
+			if a.Name.Local == "id" && (a.Name.Space == "xml" || a.Name.Space == xmlURL) && strings.TrimSpace(a.Value) == id {
+				return n
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := c.ElementByID(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Text returns the concatenated character data of n and all of its
+// descendants, or the value of n if it is an AttrNode.
+func (n *Node) Text() string {
+	if n.Type == TextNode || n.Type == AttrNode {
+		return n.Data
+	}
+	var b strings.Builder
+	n.text(&b)
+	return b.String()
+}
+
+func (n *Node) text(b *strings.Builder) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch c.Type {
+		case TextNode:
+			b.WriteString(c.Data)
+		case ElementNode:
+			c.text(b)
+		}
+	}
+}
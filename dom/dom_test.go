@@ -0,0 +1,97 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/dom"
+)
+
+func TestParse(t *testing.T) {
+	const in = `<?xml version="1.0"?><!-- a --><b xmlns="urn:b" c="d">e<f/>g<![CDATA[h]]><?i j?></b>`
+	doc, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.Type != DocumentNode {
+		t.Fatalf("wrong root node type: want=%v, got=%v", DocumentNode, doc.Type)
+	}
+	decl := doc.FirstChild
+	if decl.Type != ProcInstNode || decl.Name.Local != "xml" || decl.Data != `version="1.0"` {
+		t.Errorf("wrong declaration: %+v", decl)
+	}
+	if c := decl.NextSibling; c.Type != CommentNode || c.Data != " a " || c.PrevSibling != decl {
+		t.Errorf("wrong comment: %+v", c)
+	}
+	root := doc.Root()
+	if root != doc.LastChild || root.Parent != doc {
+		t.Fatalf("wrong root element")
+	}
+	if root.Name != (xml.Name{Space: "urn:b", Local: "b"}) || len(root.Attr) != 2 || root.Attr[1].Value != "d" {
+		t.Errorf("wrong root element: %+v", root)
+	}
+	var types []NodeType
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if c.Parent != root {
+			t.Errorf("wrong parent for %+v", c)
+		}
+		types = append(types, c.Type)
+	}
+	want := []NodeType{TextNode, ElementNode, TextNode, ProcInstNode}
+	if len(types) != len(want) {
+		t.Fatalf("wrong children: want=%v, got=%v", want, types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("wrong children: want=%v, got=%v", want, types)
+		}
+	}
+	if s := root.FirstChild.NextSibling.NextSibling.Data; s != "gh" {
+		t.Errorf("adjacent text not combined: got=%q", s)
+	}
+	if s := root.Text(); s != "egh" {
+		t.Errorf("wrong text: want=%q, got=%q", "egh", s)
+	}
+	if root.FirstChild.NextSibling.Root() != root {
+		t.Errorf("wrong root from descendant")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{`<a>`, `</a>`} {
+		_, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+		if err == nil {
+			t.Errorf("expected error parsing %q", in)
+		}
+	}
+	_, err := Parse(xml.NewTokenizer(strings.NewReader(`<a>`)))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("wrong error for unclosed element: want=%v, got=%v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestElementByID(t *testing.T) {
+	const in = `<a xml:id="a"><b><c xml:id=" c "/></b><d xml:id="c"/><e id="e"/></a>`
+	doc, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := doc.ElementByID("a"); n == nil || n.Name.Local != "a" {
+		t.Errorf("wrong element for a: %+v", n)
+	}
+	if n := doc.ElementByID("c"); n == nil || n.Name.Local != "c" {
+		t.Errorf("wrong element for c: %+v", n)
+	}
+	if n := doc.ElementByID("e"); n != nil {
+		t.Errorf("found element without xml:id: %+v", n)
+	}
+	if n := doc.Root().FirstChild.ElementByID("a"); n != nil {
+		t.Errorf("found element outside of the subtree: %+v", n)
+	}
+}
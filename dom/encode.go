@@ -0,0 +1,128 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom
+
+import (
+	"bytes"
+	"io"
+
+	"mellium.im/xml"
+)
+
+// TokenReader returns a TokenReader that walks n and its descendants in
+// document order.
+// A DocumentNode produces only the tokens of its children.
+//
+// The tree should not be modified until the reader has returned io.EOF.
+func (n *Node) TokenReader() xml.TokenReader {
+	return &nodeReader{root: n, n: n}
+}
+
+// Encode writes the tokens of n and its descendants to w.
+// It does not call Flush.
+func (n *Node) Encode(w xml.TokenWriter) error {
+	r := n.TokenReader()
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			if e := w.EncodeToken(tok); e != nil {
+				return e
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Render writes n and its descendants to w as XML.
+//
+// Namespaces are written using the xmlns attributes present in the tree.
+// Any namespace that is used without being declared, for example because its
+// element was moved out of the subtree that declared it, is declared where it
+// is first needed.
+func Render(w io.Writer, n *Node) error {
+	e := xml.NewEncoder(w)
+	err := n.Encode(e)
+	if err != nil {
+		return err
+	}
+	return e.Flush()
+}
+
+// RenderIndent is like Render but pretty prints the output as if by xml.Indent.
+func RenderIndent(w io.Writer, n *Node, prefix, indent string) error {
+	var buf bytes.Buffer
+	err := Render(&buf, n)
+	if err != nil {
+		return err
+	}
+	return xml.Indent(w, &buf, prefix, indent)
+}
+
+type nodeReader struct {
+	root    *Node
+	n       *Node
+	closing bool
+}
+
+func (r *nodeReader) Token() (xml.Token, error) {
+	for r.n != nil {
+		n := r.n
+		if r.closing {
+			r.advance()
+			if n.Type == ElementNode {
+				return xml.EndElement{Name: n.Name}, nil
+			}
+			continue
+		}
+		switch {
+		case n.FirstChild != nil:
+			r.n = n.FirstChild
+		case n.Type == ElementNode || n.Type == DocumentNode:
+			r.closing = true
+		default:
+			r.advance()
+		}
+		if tok := n.token(); tok != nil {
+			return tok, nil
+		}
+	}
+	return nil, io.EOF
+}
+
+// advance moves to the node after r.n, which has been completely read.
+func (r *nodeReader) advance() {
+	switch {
+	case r.n == r.root:
+		r.n = nil
+	case r.n.NextSibling != nil:
+		r.n = r.n.NextSibling
+		r.closing = false
+	default:
+		r.n = r.n.Parent
+		r.closing = true
+	}
+}
+
+// token returns the token that starts n, or nil for a DocumentNode.
+func (n *Node) token() xml.Token {
+	switch n.Type {
+	case ElementNode:
+		return xml.StartElement{Name: n.Name, Attr: n.Attr}.Copy()
+	case TextNode:
+		return xml.CharData(n.Data)
+	case CommentNode:
+		return xml.Comment(n.Data)
+	case ProcInstNode:
+		return xml.ProcInst{Target: n.Name.Local, Inst: []byte(n.Data)}
+	case DirectiveNode:
+		return xml.Directive(n.Data)
+	}
+	return nil
+}
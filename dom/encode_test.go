@@ -0,0 +1,118 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/dom"
+)
+
+var renderTestCases = [...]struct {
+	in  string
+	out string
+}{
+	0: {},
+	1: {
+		in: `<?xml version="1.0"?><!-- a --><b xmlns="urn:b" c="d">e<f></f>g<?i j?></b>`,
+	},
+	2: {
+		in:  `<a xmlns:b="urn:b"><b:c b:d="&lt;&#34;">&amp;e&gt;</b:c></a>`,
+		out: `<a xmlns:b="urn:b"><b:c b:d="&lt;&#34;">&amp;e&gt;</b:c></a>`,
+	},
+	3: {
+		in:  `<a><![CDATA[<b>]]></a>`,
+		out: `<a>&lt;b&gt;</a>`,
+	},
+}
+
+func TestRender(t *testing.T) {
+	for i, tc := range renderTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			doc, err := Parse(xml.NewTokenizer(strings.NewReader(tc.in)))
+			if err != nil {
+				t.Fatalf("unexpected error parsing: %v", err)
+			}
+			var b strings.Builder
+			err = Render(&b, doc)
+			if err != nil {
+				t.Fatalf("unexpected error rendering: %v", err)
+			}
+			out := tc.out
+			if out == "" {
+				out = tc.in
+			}
+			if s := b.String(); s != out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", out, s)
+			}
+		})
+	}
+}
+
+func TestRenderSubtree(t *testing.T) {
+	const in = `<a xmlns="urn:a" xmlns:b="urn:b"><c><b:d>e</b:d></c></a>`
+	doc, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error parsing: %v", err)
+	}
+	var b strings.Builder
+	err = Render(&b, doc.Root().FirstChild)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %v", err)
+	}
+	const out = `<c xmlns="urn:a"><d xmlns="urn:b">e</d></c>`
+	if s := b.String(); s != out {
+		t.Errorf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+}
+
+func TestRenderIndent(t *testing.T) {
+	const in = `<a><b>c</b><d></d></a>`
+	doc, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error parsing: %v", err)
+	}
+	var b strings.Builder
+	err = RenderIndent(&b, doc, "", "\t")
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %v", err)
+	}
+	const out = "<a>\n\t<b>c</b>\n\t<d></d>\n</a>"
+	if s := b.String(); s != out {
+		t.Errorf("wrong output:\nwant=%q,\n got=%q", out, s)
+	}
+}
+
+func TestTokenReader(t *testing.T) {
+	const in = `<a><b>c</b><!--d--></a>`
+	doc, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error parsing: %v", err)
+	}
+	r := doc.Root().FirstChild.TokenReader()
+	var toks []xml.Token
+	for {
+		tok, err := r.Token()
+		if err != nil {
+			break
+		}
+		toks = append(toks, tok)
+	}
+	if len(toks) != 3 {
+		t.Fatalf("wrong number of tokens: want=3, got=%d (%v)", len(toks), toks)
+	}
+	if start, ok := toks[0].(xml.StartElement); !ok || start.Name.Local != "b" {
+		t.Errorf("wrong start token: %v", toks[0])
+	}
+	if cd, ok := toks[1].(xml.CharData); !ok || string(cd) != "c" {
+		t.Errorf("wrong text token: %v", toks[1])
+	}
+	if end, ok := toks[2].(xml.EndElement); !ok || end.Name.Local != "b" {
+		t.Errorf("wrong end token: %v", toks[2])
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom
+
+import (
+	"mellium.im/xml"
+)
+
+// AppendChild adds c as the last child of n.
+// If c already has a parent it is first removed as if by RemoveChild.
+//
+// It panics if c is n or one of its ancestors.
+func (n *Node) AppendChild(c *Node) {
+	n.InsertBefore(c, nil)
+}
+
+// InsertBefore inserts newChild as a child of n immediately before oldChild.
+// If oldChild is nil, newChild is added as the last child.
+// If newChild already has a parent it is first removed as if by RemoveChild.
+//
+// It panics if oldChild is not nil and is not a child of n, or if newChild is
+// n or one of its ancestors.
+func (n *Node) InsertBefore(newChild, oldChild *Node) {
+	if oldChild != nil && oldChild.Parent != n {
+		panic("dom: InsertBefore called for an old child that is not a child of the node")
+	}
+	for p := n; p != nil; p = p.Parent {
+		if p == newChild {
+			panic("dom: InsertBefore called for a new child that is an ancestor of the node")
+		}
+	}
+	if newChild == oldChild {
+		return
+	}
+	if newChild.Parent != nil {
+		newChild.Parent.RemoveChild(newChild)
+	}
+
+	var prev *Node
+	if oldChild != nil {
+		prev = oldChild.PrevSibling
+		oldChild.PrevSibling = newChild
+	} else {
+		prev = n.LastChild
+		n.LastChild = newChild
+	}
+	if prev != nil {
+		prev.NextSibling = newChild
+	} else {
+		n.FirstChild = newChild
+	}
+	newChild.Parent = n
+	newChild.PrevSibling = prev
+	newChild.NextSibling = oldChild
+}
+
+// RemoveChild removes c from the children of n.
+//
+// Names in the tree are already resolved to their namespaces, but the xmlns
+// attributes that bind prefixes to those namespaces may be on an ancestor of c.
+// To keep its prefixes, any such declarations that are used in the subtree
+// rooted at c are copied onto c before it is removed.
+//
+// It panics if c is not a child of n.
+func (n *Node) RemoveChild(c *Node) {
+	if c.Parent != n {
+		panic("dom: RemoveChild called for a node that is not a child of the node")
+	}
+	c.declareNamespaces()
+
+	if c.PrevSibling != nil {
+		c.PrevSibling.NextSibling = c.NextSibling
+	} else {
+		n.FirstChild = c.NextSibling
+	}
+	if c.NextSibling != nil {
+		c.NextSibling.PrevSibling = c.PrevSibling
+	} else {
+		n.LastChild = c.PrevSibling
+	}
+	c.Parent = nil
+	c.PrevSibling = nil
+	c.NextSibling = nil
+}
+
+// ReplaceChild replaces oldChild, which must be a child of n, with newChild.
+// If newChild already has a parent it is first removed as if by RemoveChild.
+//
+// It panics if oldChild is not a child of n, or if newChild is n or one of its
+// ancestors.
+func (n *Node) ReplaceChild(newChild, oldChild *Node) {
+	if oldChild.Parent != n {
+		panic("dom: ReplaceChild called for an old child that is not a child of the node")
+	}
+	if newChild == oldChild {
+		return
+	}
+	n.InsertBefore(newChild, oldChild)
+	n.RemoveChild(oldChild)
+}
+
+// GetAttr returns the value of the attribute with the given name and reports
+// whether it was found.
+func (n *Node) GetAttr(name xml.Name) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttr sets the value of the attribute with the given name, adding it if it
+// does not already exist.
+func (n *Node) SetAttr(name xml.Name, value string) {
+	for i, a := range n.Attr {
+		if a.Name == name {
+			n.Attr[i].Value = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, xml.Attr{Name: name, Value: value})
+}
+
+// DelAttr removes the attribute with the given name if it exists.
+func (n *Node) DelAttr(name xml.Name) {
+	for i, a := range n.Attr {
+		if a.Name == name {
+			n.Attr = append(n.Attr[:i:i], n.Attr[i+1:]...)
+			return
+		}
+	}
+}
+
+// declareNamespaces copies namespace declarations that n inherits from its
+// ancestors and that are used by n or its descendants onto n.
+func (n *Node) declareNamespaces() {
+	if n.Type != ElementNode {
+		return
+	}
+	used := make(map[string]bool)
+	n.spaces(used)
+	declared := make(map[string]bool)
+	for _, a := range n.Attr {
+		if prefix, ok := nsPrefix(a.Name); ok {
+			declared[prefix] = true
+		}
+	}
+	for p := n.Parent; p != nil && p.Type == ElementNode; p = p.Parent {
+		for _, a := range p.Attr {
+			prefix, ok := nsPrefix(a.Name)
+			if !ok || declared[prefix] {
+				continue
+			}
+			declared[prefix] = true
+			if used[a.Value] {
+				n.Attr = append(n.Attr, a)
+			}
+		}
+	}
+}
+
+// spaces records the namespaces of n and its descendants in used.
+func (n *Node) spaces(used map[string]bool) {
+	if n.Type != ElementNode {
+		return
+	}
+	used[n.Name.Space] = true
+	for _, a := range n.Attr {
+		if _, ok := nsPrefix(a.Name); !ok && a.Name.Space != "" {
+			used[a.Name.Space] = true
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		c.spaces(used)
+	}
+}
+
+// nsPrefix returns the prefix declared by an xmlns attribute with the given
+// name, and reports whether the name is that of an xmlns attribute.
+// The default namespace is declared by the empty prefix.
+func nsPrefix(name xml.Name) (string, bool) {
+	switch {
+	case name.Space == "" && name.Local == "xmlns":
+		return "", true
+	case name.Space == "xmlns":
+		return name.Local, true
+	}
+	return "", false
+}
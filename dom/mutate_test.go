@@ -0,0 +1,120 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom_test
+
+import (
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/dom"
+)
+
+func parse(t *testing.T, in string) *Node {
+	t.Helper()
+	doc, err := Parse(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error parsing: %v", err)
+	}
+	return doc
+}
+
+func render(t *testing.T, n *Node) string {
+	t.Helper()
+	var b strings.Builder
+	err := Render(&b, n)
+	if err != nil {
+		t.Fatalf("unexpected error rendering: %v", err)
+	}
+	return b.String()
+}
+
+func TestMutate(t *testing.T) {
+	doc := parse(t, `<a><b></b><c></c></a>`)
+	root := doc.Root()
+	b, c := root.FirstChild, root.LastChild
+
+	d := &Node{Type: ElementNode, Name: xml.Name{Local: "d"}}
+	root.InsertBefore(d, c)
+	root.AppendChild(b)
+	root.InsertBefore(&Node{Type: TextNode, Data: "e"}, nil)
+	if out, want := render(t, doc), `<a><d></d><c></c><b></b>e</a>`; out != want {
+		t.Errorf("wrong output after insert:\nwant=%s,\n got=%s", want, out)
+	}
+
+	root.RemoveChild(c)
+	if c.Parent != nil || c.PrevSibling != nil || c.NextSibling != nil {
+		t.Errorf("removed node still linked into the tree: %+v", c)
+	}
+	root.ReplaceChild(c, d)
+	d.AppendChild(b)
+	if out, want := render(t, doc), `<a><c></c>e</a>`; out != want {
+		t.Errorf("wrong output after replace:\nwant=%s,\n got=%s", want, out)
+	}
+	if root.FirstChild != c || c.NextSibling != root.LastChild || root.LastChild.PrevSibling != c {
+		t.Errorf("sibling links not updated")
+	}
+}
+
+func TestMutatePanics(t *testing.T) {
+	doc := parse(t, `<a><b></b></a>`)
+	root := doc.Root()
+	for name, f := range map[string]func(){
+		"cycle":   func() { root.FirstChild.AppendChild(root) },
+		"self":    func() { root.AppendChild(root) },
+		"remove":  func() { root.FirstChild.RemoveChild(root) },
+		"replace": func() { root.ReplaceChild(&Node{}, doc) },
+		"insert":  func() { root.InsertBefore(&Node{}, doc) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("expected panic")
+				}
+			}()
+			f()
+		})
+	}
+}
+
+func TestMoveNamespaces(t *testing.T) {
+	doc := parse(t, `<a xmlns="urn:a" xmlns:b="urn:b" xmlns:c="urn:c"><d><b:e b:f="g"></b:e></d><h xmlns=""></h></a>`)
+	root := doc.Root()
+	d := root.FirstChild
+	h := root.LastChild
+	h.AppendChild(d.FirstChild)
+	const want = `<a xmlns="urn:a" xmlns:b="urn:b" xmlns:c="urn:c"><d></d><h xmlns=""><b:e b:f="g" xmlns:b="urn:b"></b:e></h></a>`
+	if out := render(t, doc); out != want {
+		t.Errorf("wrong output:\nwant=%s,\n got=%s", want, out)
+	}
+	h.AppendChild(d)
+	const wantDefault = `<a xmlns="urn:a" xmlns:b="urn:b" xmlns:c="urn:c"><h xmlns=""><b:e b:f="g" xmlns:b="urn:b"></b:e><d xmlns="urn:a"></d></h></a>`
+	if out := render(t, doc); out != wantDefault {
+		t.Errorf("wrong output:\nwant=%s,\n got=%s", wantDefault, out)
+	}
+}
+
+func TestAttr(t *testing.T) {
+	doc := parse(t, `<a xmlns:b="urn:b" c="d" b:c="e"></a>`)
+	root := doc.Root()
+	c := xml.Name{Local: "c"}
+	bc := xml.Name{Space: "urn:b", Local: "c"}
+	if v, ok := root.GetAttr(bc); !ok || v != "e" {
+		t.Errorf("wrong namespaced attribute value: want=e, got=%q (%t)", v, ok)
+	}
+	root.SetAttr(c, "f")
+	root.SetAttr(xml.Name{Local: "g"}, "h")
+	root.DelAttr(bc)
+	root.DelAttr(xml.Name{Local: "missing"})
+	if v, ok := root.GetAttr(c); !ok || v != "f" {
+		t.Errorf("wrong attribute value: want=f, got=%q (%t)", v, ok)
+	}
+	if _, ok := root.GetAttr(bc); ok {
+		t.Errorf("attribute was not deleted")
+	}
+	if out, want := render(t, doc), `<a xmlns:b="urn:b" c="f" g="h"></a>`; out != want {
+		t.Errorf("wrong output:\nwant=%s,\n got=%s", want, out)
+	}
+}
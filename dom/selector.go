@@ -0,0 +1,337 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Selector is a compiled CSS style selector.
+//
+// Selectors are a lighter weight alternative to XPath expressions for
+// selecting elements.
+// The supported syntax is a comma separated list of selectors, each made up of
+// type selectors (such as "item" or "*") and attribute selectors (such as
+// "[id]" or "[rel='alternate']") combined with the descendant (" ") and child
+// (">") combinators.
+// Attribute selectors support the =, ~=, |=, ^=, $=, and *= operators.
+//
+// As in CSS, a namespace prefix is separated from the name by a "|".
+// Prefixes are looked up in the namespaces passed to CompileSelector,
+// "*|name" matches a name in any namespace, and "|name" matches a name in no
+// namespace.
+// Unprefixed type selectors match elements in the namespace bound to the empty
+// prefix, or in any namespace if there is none, while unprefixed attribute
+// selectors only match attributes in no namespace.
+type Selector struct {
+	src    string
+	groups [][]compound
+}
+
+type compound struct {
+	// child is true if the previous compound must match the parent of the
+	// element matched by this one, or false if it may match any ancestor.
+	child bool
+	test  nodeTest
+	attrs []attrSelector
+}
+
+type attrSelector struct {
+	test nodeTest
+	op   string
+	val  string
+}
+
+// CompileSelector parses a selector.
+func CompileSelector(sel string, namespaces map[string]string) (*Selector, error) {
+	p := &selectorParser{src: sel, ns: namespaces}
+	s := &Selector{src: sel}
+	for {
+		group, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		s.groups = append(s.groups, group)
+		p.skipSpace()
+		if p.pos == len(p.src) {
+			return s, nil
+		}
+		if p.src[p.pos] != ',' {
+			return nil, p.errorf("unexpected %q", p.src[p.pos])
+		}
+		p.pos++
+	}
+}
+
+// MustCompileSelector is like CompileSelector but panics if the selector
+// cannot be parsed.
+func MustCompileSelector(sel string, namespaces map[string]string) *Selector {
+	s, err := CompileSelector(sel, namespaces)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// String returns the source text of the selector.
+func (s *Selector) String() string {
+	return s.src
+}
+
+// Match reports whether n is an element that matches the selector.
+func (s *Selector) Match(n *Node) bool {
+	if n.Type != ElementNode {
+		return false
+	}
+	for _, group := range s.groups {
+		if matchCompound(group, len(group)-1, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the descendants of n that match the selector in document order.
+// As with querySelectorAll in the HTML DOM, ancestors of n may be matched by
+// the parts of the selector that precede the last one.
+func (s *Selector) Find(n *Node) []*Node {
+	var nodes []*Node
+	descendants(n, func(c *Node) {
+		if s.Match(c) {
+			nodes = append(nodes, c)
+		}
+	})
+	return nodes
+}
+
+// Find compiles the selector and returns the descendants of n that match it.
+func (n *Node) Find(sel string, namespaces map[string]string) ([]*Node, error) {
+	s, err := CompileSelector(sel, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	return s.Find(n), nil
+}
+
+func matchCompound(group []compound, i int, n *Node) bool {
+	c := group[i]
+	if !c.test.match(n) {
+		return false
+	}
+	for _, a := range c.attrs {
+		if !a.match(n) {
+			return false
+		}
+	}
+	if i == 0 {
+		return true
+	}
+	for p := n.Parent; p != nil && p.Type == ElementNode; p = p.Parent {
+		if matchCompound(group, i-1, p) {
+			return true
+		}
+		if c.child {
+			break
+		}
+	}
+	return false
+}
+
+func (a attrSelector) match(n *Node) bool {
+	for _, attr := range n.Attr {
+		if _, ok := nsPrefix(attr.Name); ok {
+			continue
+		}
+		if !a.test.match(&Node{Type: AttrNode, Name: attr.Name}) {
+			continue
+		}
+		v := attr.Value
+		var ok bool
+		switch a.op {
+		case "":
+			ok = true
+		case "=":
+			ok = v == a.val
+		case "~=":
+			ok = a.val != "" && contains(strings.FieldsFunc(v, func(r rune) bool {
+				return r < 0x80 && isSpace(byte(r))
+			}), a.val)
+		case "|=":
+			ok = v == a.val || strings.HasPrefix(v, a.val+"-")
+		case "^=":
+			ok = a.val != "" && strings.HasPrefix(v, a.val)
+		case "$=":
+			ok = a.val != "" && strings.HasSuffix(v, a.val)
+		case "*=":
+			ok = a.val != "" && strings.Contains(v, a.val)
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+type selectorParser struct {
+	src string
+	pos int
+	ns  map[string]string
+}
+
+func (p *selectorParser) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("dom: error in selector %q at offset %d: %s", p.src, p.pos, fmt.Sprintf(format, v...))
+}
+
+func (p *selectorParser) skipSpace() bool {
+	start := p.pos
+	for p.pos < len(p.src) && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.pos > start
+}
+
+func (p *selectorParser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *selectorParser) parseSelector() ([]compound, error) {
+	var group []compound
+	p.skipSpace()
+	child := false
+	for {
+		c, err := p.parseCompound()
+		if err != nil {
+			return nil, err
+		}
+		c.child = child
+		group = append(group, c)
+
+		space := p.skipSpace()
+		switch b := p.peek(); {
+		case b == '>':
+			p.pos++
+			p.skipSpace()
+			child = true
+		case b == ',' || b == 0:
+			return group, nil
+		case space:
+			child = false
+		default:
+			return nil, p.errorf("unexpected %q", b)
+		}
+	}
+}
+
+func (p *selectorParser) parseCompound() (compound, error) {
+	c := compound{test: nodeTest{kind: testName, principal: ElementNode, anySpace: true, anyLocal: true}}
+	start := p.pos
+	if b := p.peek(); b != '[' {
+		var err error
+		c.test, err = p.parseName(false)
+		if err != nil {
+			return c, err
+		}
+	}
+	for p.peek() == '[' {
+		p.pos++
+		p.skipSpace()
+		test, err := p.parseName(true)
+		if err != nil {
+			return c, err
+		}
+		a := attrSelector{test: test}
+		p.skipSpace()
+		if strings.IndexByte("~|^$*", p.peek()) >= 0 && p.pos+1 < len(p.src) && p.src[p.pos+1] == '=' {
+			a.op = p.src[p.pos : p.pos+2]
+			p.pos += 2
+		} else if p.peek() == '=' {
+			a.op = "="
+			p.pos++
+		}
+		if a.op != "" {
+			p.skipSpace()
+			a.val, err = p.parseValue()
+			if err != nil {
+				return c, err
+			}
+			p.skipSpace()
+		}
+		if p.peek() != ']' {
+			return c, p.errorf("expected ]")
+		}
+		p.pos++
+		c.attrs = append(c.attrs, a)
+	}
+	if p.pos == start {
+		return c, p.errorf("expected type or attribute selector")
+	}
+	return c, nil
+}
+
+// parseName parses a possibly prefixed name, which may be "*" for a type
+// selector.
+func (p *selectorParser) parseName(attr bool) (nodeTest, error) {
+	test := nodeTest{kind: testName, principal: ElementNode}
+	if attr {
+		test.principal = AttrNode
+	}
+	first, prefixed := p.parseIdent(true), false
+	if p.peek() == '|' && (p.pos+1 >= len(p.src) || p.src[p.pos+1] != '=') {
+		p.pos++
+		prefixed = true
+		switch first {
+		case "*":
+			test.anySpace = true
+		case "":
+		default:
+			space, ok := p.ns[first]
+			if !ok {
+				return test, fmt.Errorf("dom: undeclared prefix %q in selector %q", first, p.src)
+			}
+			test.space = space
+		}
+		first = p.parseIdent(!attr)
+	}
+	if first == "" || (attr && first == "*") {
+		return test, p.errorf("expected name")
+	}
+	if !prefixed && !attr {
+		test.space, test.anySpace = p.ns[""], p.ns[""] == ""
+	}
+	test.local = first
+	test.anyLocal = first == "*"
+	return test, nil
+}
+
+func (p *selectorParser) parseIdent(star bool) string {
+	if star && p.peek() == '*' {
+		p.pos++
+		return "*"
+	}
+	start := p.pos
+	p.pos = scanNCName(p.src, p.pos)
+	return p.src[start:p.pos]
+}
+
+func (p *selectorParser) parseValue() (string, error) {
+	if q := p.peek(); q == '"' || q == '\'' {
+		end := strings.IndexByte(p.src[p.pos+1:], q)
+		if end < 0 {
+			return "", p.errorf("unterminated string")
+		}
+		v := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return v, nil
+	}
+	v := p.parseIdent(false)
+	if v == "" {
+		return "", p.errorf("expected value")
+	}
+	return v, nil
+}
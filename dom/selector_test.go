@@ -0,0 +1,98 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/dom"
+)
+
+const selectorDoc = `<rss xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+	<title>News</title>
+	<atom:link rel="self alternate" href="https://example.net/feed"/>
+	<item id="a"><title>One</title><category lang="en-US">x</category></item>
+	<item id="b"><title>Two</title><atom:link href="http://example.com/b"/></item>
+</channel>
+</rss>`
+
+var selectorNS = map[string]string{"atom": "http://www.w3.org/2005/Atom"}
+
+var selectorTestCases = [...]struct {
+	sel string
+	out string
+	err bool
+}{
+	0:  {sel: `rss > channel > item title`, out: "One|Two"},
+	1:  {sel: `channel > title`, out: "News"},
+	2:  {sel: `rss title`, out: "News|One|Two"},
+	3:  {sel: `rss > title`},
+	4:  {sel: `item[id=b] > title`, out: "Two"},
+	5:  {sel: `item[id="a"] title, channel>title`, out: "News|One"},
+	6:  {sel: `atom|link[href^='https']`, out: "https://example.net/feed"},
+	7:  {sel: `*|link[href$=".com/b"]`, out: "http://example.com/b"},
+	8:  {sel: `|link`},
+	9:  {sel: `[rel~=alternate]`, out: "https://example.net/feed"},
+	10: {sel: `[lang|=en]`, out: "x"},
+	11: {sel: `[href*=example]`, out: "https://example.net/feed|http://example.com/b"},
+	12: {sel: `item *`, out: "One|x|Two|http://example.com/b"},
+	13: {sel: `[id]`, out: "|"},
+	14: {sel: `link`, out: "https://example.net/feed|http://example.com/b"},
+	15: {sel: `foo|link`, err: true},
+	16: {sel: `item >`, err: true},
+	17: {sel: `item[id`, err: true},
+	18: {sel: `item:first-child`, err: true},
+	19: {sel: `[id='a]`, err: true},
+}
+
+func TestFind(t *testing.T) {
+	doc := parse(t, selectorDoc)
+	for i, tc := range selectorTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			nodes, err := doc.Find(tc.sel, selectorNS)
+			switch {
+			case err != nil && !tc.err:
+				t.Fatalf("unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Fatalf("expected error for %s", tc.sel)
+			case err != nil:
+				return
+			}
+			var s []string
+			for _, n := range nodes {
+				v, ok := n.GetAttr(xml.Name{Local: "href"})
+				if !ok {
+					v = n.Text()
+					if n.Name.Local == "item" {
+						v = ""
+					}
+				}
+				s = append(s, v)
+			}
+			if out := strings.Join(s, "|"); out != tc.out {
+				t.Errorf("wrong result for %s:\nwant=%q,\n got=%q", tc.sel, tc.out, out)
+			}
+		})
+	}
+}
+
+func TestSelectorDefaultNamespace(t *testing.T) {
+	doc := parse(t, `<a xmlns="urn:a"><b></b><c xmlns="urn:c"><b></b></c></a>`)
+	s := MustCompileSelector("b", map[string]string{"": "urn:a"})
+	nodes := s.Find(doc)
+	if len(nodes) != 1 || nodes[0].Parent.Name.Local != "a" {
+		t.Errorf("wrong nodes for default namespace: %v", nodes)
+	}
+	if s.Match(doc) {
+		t.Errorf("document node should never match")
+	}
+	if nodes := MustCompileSelector("b", nil).Find(doc); len(nodes) != 2 {
+		t.Errorf("wrong number of nodes without default namespace: want=2, got=%d", len(nodes))
+	}
+}
@@ -0,0 +1,859 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+const xmlURL = "http://www.w3.org/XML/1998/namespace"
+
+// Expr is a compiled XPath expression.
+//
+// A subset of XPath 1.0 is supported: all axes except the namespace axis, all
+// node tests, predicates, the operators, and the core function library except
+// for id().
+// Variable references are not supported.
+//
+// Expressions are evaluated against the tree as it is when Evaluate is
+// called.
+// Attributes are selected as nodes of type AttrNode which are not part of the
+// tree, and xmlns attributes are never selected.
+type Expr struct {
+	src string
+	e   xpathExpr
+}
+
+// Compile parses an XPath expression.
+//
+// Because names in the tree are resolved to their namespaces, prefixes used in
+// the expression are looked up in namespaces.
+// The "xml" prefix is always bound to the XML namespace.
+// Unprefixed names in element name tests match elements in the namespace bound
+// to the empty prefix, or in no namespace if there is none, while unprefixed
+// attribute names always match attributes in no namespace.
+func Compile(expr string, namespaces map[string]string) (*Expr, error) {
+	toks, err := lexXPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &xpathParser{src: expr, toks: toks, ns: namespaces}
+	e, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != xpathEOF {
+		return nil, p.errorf("unexpected token")
+	}
+	return &Expr{src: expr, e: e}, nil
+}
+
+// MustCompile is like Compile but panics if the expression cannot be parsed.
+func MustCompile(expr string, namespaces map[string]string) *Expr {
+	e, err := Compile(expr, namespaces)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source text of the expression.
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Evaluate evaluates the expression with n as the context node.
+// The result is one of []*Node (in document order), string, float64, or bool.
+func (e *Expr) Evaluate(n *Node) (interface{}, error) {
+	ev := &evaluator{}
+	return e.e.eval(ev, xpathContext{n: n, pos: 1, size: 1})
+}
+
+// Select evaluates the expression with n as the context node and returns the
+// resulting nodes in document order.
+// It is an error if the expression does not evaluate to a node-set.
+func (e *Expr) Select(n *Node) ([]*Node, error) {
+	v, err := e.Evaluate(n)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*Node)
+	if !ok {
+		return nil, fmt.Errorf("dom: XPath expression %q does not evaluate to a node-set", e.src)
+	}
+	return nodes, nil
+}
+
+type xpathContext struct {
+	n         *Node
+	pos, size int
+}
+
+// evaluator holds state that is shared for the duration of an evaluation.
+type evaluator struct {
+	attrs map[*Node][]*Node
+	order map[*Node]int
+}
+
+// attrNodes returns the attributes of n as nodes, creating them the first time
+// they are needed so that the same attribute is always the same node.
+func (ev *evaluator) attrNodes(n *Node) []*Node {
+	if n.Type != ElementNode {
+		return nil
+	}
+	if ev.attrs == nil {
+		ev.attrs = make(map[*Node][]*Node)
+	}
+	nodes, ok := ev.attrs[n]
+	if !ok {
+		for _, a := range n.Attr {
+			if _, ok := nsPrefix(a.Name); ok {
+				continue
+			}
+			nodes = append(nodes, &Node{Type: AttrNode, Name: a.Name, Data: a.Value, Parent: n})
+		}
+		ev.attrs[n] = nodes
+	}
+	return nodes
+}
+
+// sort puts nodes in document order.
+func (ev *evaluator) sort(nodes []*Node) {
+	if len(nodes) < 2 {
+		return
+	}
+	if ev.order == nil {
+		ev.order = make(map[*Node]int)
+	}
+	if _, ok := ev.order[nodes[0]]; !ok {
+		ev.number(top(nodes[0]))
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return ev.order[nodes[i]] < ev.order[nodes[j]]
+	})
+}
+
+// number records the document order of n and its descendants.
+func (ev *evaluator) number(n *Node) {
+	ev.order[n] = len(ev.order)
+	for _, a := range ev.attrNodes(n) {
+		ev.order[a] = len(ev.order)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		ev.number(c)
+	}
+}
+
+func top(n *Node) *Node {
+	for n.Parent != nil {
+		n = n.Parent
+	}
+	return n
+}
+
+type xpathExpr interface {
+	eval(ev *evaluator, ctx xpathContext) (interface{}, error)
+}
+
+type literalExpr string
+
+func (e literalExpr) eval(*evaluator, xpathContext) (interface{}, error) {
+	return string(e), nil
+}
+
+type numberExpr float64
+
+func (e numberExpr) eval(*evaluator, xpathContext) (interface{}, error) {
+	return float64(e), nil
+}
+
+type negExpr struct {
+	e xpathExpr
+}
+
+func (e negExpr) eval(ev *evaluator, ctx xpathContext) (interface{}, error) {
+	v, err := e.e.eval(ev, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return -toNumber(v), nil
+}
+
+type binaryExpr struct {
+	op   string
+	l, r xpathExpr
+}
+
+func (e *binaryExpr) eval(ev *evaluator, ctx xpathContext) (interface{}, error) {
+	l, err := e.l.eval(ev, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "or":
+		if toBool(l) {
+			return true, nil
+		}
+	case "and":
+		if !toBool(l) {
+			return false, nil
+		}
+	}
+	r, err := e.r.eval(ev, ctx)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "or", "and":
+		return toBool(r), nil
+	case "|":
+		ln, lok := l.([]*Node)
+		rn, rok := r.([]*Node)
+		if !lok || !rok {
+			return nil, fmt.Errorf("dom: operands of | must be node-sets")
+		}
+		nodes := appendUnique(append([]*Node(nil), ln...), rn)
+		ev.sort(nodes)
+		return nodes, nil
+	case "=", "!=", "<", "<=", ">", ">=":
+		return compare(e.op, l, r), nil
+	}
+	a, b := toNumber(l), toNumber(r)
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "div":
+		return a / b, nil
+	}
+	return math.Mod(a, b), nil
+}
+
+// appendUnique appends the nodes from src that are not already in dst.
+func appendUnique(dst, src []*Node) []*Node {
+	seen := make(map[*Node]bool, len(dst))
+	for _, n := range dst {
+		seen[n] = true
+	}
+	for _, n := range src {
+		if !seen[n] {
+			seen[n] = true
+			dst = append(dst, n)
+		}
+	}
+	return dst
+}
+
+// compare compares two values using the rules for comparisons in XPath 1.0.
+// Comparisons involving node-sets are true if they are true for any node.
+func compare(op string, l, r interface{}) bool {
+	ln, lok := l.([]*Node)
+	rn, rok := r.([]*Node)
+	switch {
+	case lok && rok:
+		for _, a := range ln {
+			for _, b := range rn {
+				if compareValues(op, stringValue(a), stringValue(b)) {
+					return true
+				}
+			}
+		}
+		return false
+	case lok:
+		if b, ok := r.(bool); ok {
+			return compareValues(op, len(ln) > 0, b)
+		}
+		for _, a := range ln {
+			if compareValues(op, stringValue(a), r) {
+				return true
+			}
+		}
+		return false
+	case rok:
+		if b, ok := l.(bool); ok {
+			return compareValues(op, b, len(rn) > 0)
+		}
+		for _, b := range rn {
+			if compareValues(op, l, stringValue(b)) {
+				return true
+			}
+		}
+		return false
+	}
+	return compareValues(op, l, r)
+}
+
+func compareValues(op string, l, r interface{}) bool {
+	if op == "=" || op == "!=" {
+		var eq bool
+		_, lb := l.(bool)
+		_, rb := r.(bool)
+		_, lf := l.(float64)
+		_, rf := r.(float64)
+		switch {
+		case lb || rb:
+			eq = toBool(l) == toBool(r)
+		case lf || rf:
+			eq = toNumber(l) == toNumber(r)
+		default:
+			eq = toString(l) == toString(r)
+		}
+		return eq == (op == "=")
+	}
+	a, b := toNumber(l), toNumber(r)
+	switch op {
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	}
+	return a >= b
+}
+
+type filterExpr struct {
+	e     xpathExpr
+	preds []xpathExpr
+}
+
+func (e *filterExpr) eval(ev *evaluator, ctx xpathContext) (interface{}, error) {
+	v, err := e.e.eval(ev, ctx)
+	if err != nil {
+		return nil, err
+	}
+	nodes, ok := v.([]*Node)
+	if !ok {
+		return nil, fmt.Errorf("dom: predicates may only be applied to node-sets")
+	}
+	for _, pred := range e.preds {
+		nodes, err = ev.filter(nodes, pred)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// filter returns the nodes for which pred is true.
+// A numeric predicate is true if it is equal to the position of the node.
+func (ev *evaluator) filter(nodes []*Node, pred xpathExpr) ([]*Node, error) {
+	var out []*Node
+	for i, n := range nodes {
+		v, err := pred.eval(ev, xpathContext{n: n, pos: i + 1, size: len(nodes)})
+		if err != nil {
+			return nil, err
+		}
+		keep := toBool(v)
+		if f, ok := v.(float64); ok {
+			keep = f == float64(i+1)
+		}
+		if keep {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+type pathExpr struct {
+	filter xpathExpr
+	abs    bool
+	steps  []*step
+}
+
+func (e *pathExpr) eval(ev *evaluator, ctx xpathContext) (interface{}, error) {
+	var nodes []*Node
+	switch {
+	case e.filter != nil:
+		v, err := e.filter.eval(ev, ctx)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		nodes, ok = v.([]*Node)
+		if !ok {
+			return nil, fmt.Errorf("dom: location steps may only follow node-sets")
+		}
+	case e.abs:
+		nodes = []*Node{top(ctx.n)}
+	default:
+		nodes = []*Node{ctx.n}
+	}
+	for _, s := range e.steps {
+		var out []*Node
+		for _, n := range nodes {
+			selected, err := s.eval(ev, n)
+			if err != nil {
+				return nil, err
+			}
+			out = appendUnique(out, selected)
+		}
+		ev.sort(out)
+		nodes = out
+	}
+	return nodes, nil
+}
+
+type step struct {
+	axis  string
+	test  nodeTest
+	preds []xpathExpr
+}
+
+// eval returns the nodes selected by the step from n in axis order, which is
+// reverse document order for the reverse axes.
+func (s *step) eval(ev *evaluator, n *Node) ([]*Node, error) {
+	var nodes []*Node
+	add := func(c *Node) {
+		if s.test.match(c) {
+			nodes = append(nodes, c)
+		}
+	}
+	switch s.axis {
+	case "self":
+		add(n)
+	case "child":
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			add(c)
+		}
+	case "descendant":
+		descendants(n, add)
+	case "descendant-or-self":
+		add(n)
+		descendants(n, add)
+	case "parent":
+		if n.Parent != nil {
+			add(n.Parent)
+		}
+	case "ancestor":
+		for p := n.Parent; p != nil; p = p.Parent {
+			add(p)
+		}
+	case "ancestor-or-self":
+		for p := n; p != nil; p = p.Parent {
+			add(p)
+		}
+	case "attribute":
+		for _, a := range ev.attrNodes(n) {
+			add(a)
+		}
+	case "following-sibling":
+		if n.Type != AttrNode {
+			for c := n.NextSibling; c != nil; c = c.NextSibling {
+				add(c)
+			}
+		}
+	case "preceding-sibling":
+		if n.Type != AttrNode {
+			for c := n.PrevSibling; c != nil; c = c.PrevSibling {
+				add(c)
+			}
+		}
+	case "following":
+		if n.Type == AttrNode {
+			n = n.Parent
+			descendants(n, add)
+		}
+		for p := n; p != nil; p = p.Parent {
+			for c := p.NextSibling; c != nil; c = c.NextSibling {
+				add(c)
+				descendants(c, add)
+			}
+		}
+	case "preceding":
+		if n.Type == AttrNode {
+			n = n.Parent
+		}
+		for p := n; p != nil; p = p.Parent {
+			for c := p.PrevSibling; c != nil; c = c.PrevSibling {
+				var subtree []*Node
+				subtree = append(subtree, c)
+				descendants(c, func(d *Node) { subtree = append(subtree, d) })
+				for i := len(subtree) - 1; i >= 0; i-- {
+					add(subtree[i])
+				}
+			}
+		}
+	}
+
+	var err error
+	for _, pred := range s.preds {
+		nodes, err = ev.filter(nodes, pred)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// descendants calls f for each descendant of n in document order.
+func descendants(n *Node, f func(*Node)) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		f(c)
+		descendants(c, f)
+	}
+}
+
+type testKind int
+
+const (
+	testName testKind = iota
+	testNode
+	testText
+	testComment
+	testProcInst
+)
+
+type nodeTest struct {
+	kind      testKind
+	principal NodeType
+	space     string
+	local     string
+	anySpace  bool
+	anyLocal  bool
+}
+
+func (t nodeTest) match(n *Node) bool {
+	switch t.kind {
+	case testNode:
+		return true
+	case testText:
+		return n.Type == TextNode
+	case testComment:
+		return n.Type == CommentNode
+	case testProcInst:
+		return n.Type == ProcInstNode && (t.local == "" || n.Name.Local == t.local)
+	}
+	if n.Type != t.principal {
+		return false
+	}
+	space := n.Name.Space
+	if space == "xml" {
+		space = xmlURL
+	}
+	return (t.anySpace || t.space == space) && (t.anyLocal || t.local == n.Name.Local)
+}
+
+// stringValue returns the XPath string-value of n.
+func stringValue(n *Node) string {
+	switch n.Type {
+	case DocumentNode, ElementNode:
+		return n.Text()
+	}
+	return n.Data
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return formatNumber(v)
+	case []*Node:
+		if len(v) == 0 {
+			return ""
+		}
+		return stringValue(v[0])
+	}
+	return ""
+}
+
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case f == 0:
+		return "0"
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		return parseNumber(v)
+	}
+	return parseNumber(toString(v))
+}
+
+// parseNumber converts a string to a number, returning NaN if the string is
+// not an optional minus sign followed by digits with an optional decimal point
+// and optional surrounding whitespace.
+func parseNumber(s string) float64 {
+	s = strings.TrimFunc(s, func(r rune) bool {
+		return r < 0x80 && isSpace(byte(r))
+	})
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits == "." {
+		return math.NaN()
+	}
+	for i := 0; i < len(digits); i++ {
+		if !isDigit(digits[i]) && digits[i] != '.' {
+			return math.NaN()
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return f
+}
+
+func toBool(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	case []*Node:
+		return len(v) > 0
+	}
+	return false
+}
+
+// xpathFuncs maps the supported functions to their minimum and maximum number
+// of arguments, where a maximum of -1 means there is no limit.
+var xpathFuncs = map[string][2]int{
+	"last":             {0, 0},
+	"position":         {0, 0},
+	"count":            {1, 1},
+	"local-name":       {0, 1},
+	"namespace-uri":    {0, 1},
+	"name":             {0, 1},
+	"string":           {0, 1},
+	"concat":           {2, -1},
+	"starts-with":      {2, 2},
+	"contains":         {2, 2},
+	"substring-before": {2, 2},
+	"substring-after":  {2, 2},
+	"substring":        {2, 3},
+	"string-length":    {0, 1},
+	"normalize-space":  {0, 1},
+	"translate":        {3, 3},
+	"boolean":          {1, 1},
+	"not":              {1, 1},
+	"true":             {0, 0},
+	"false":            {0, 0},
+	"lang":             {1, 1},
+	"number":           {0, 1},
+	"sum":              {1, 1},
+	"floor":            {1, 1},
+	"ceiling":          {1, 1},
+	"round":            {1, 1},
+}
+
+type funcExpr struct {
+	name string
+	args []xpathExpr
+}
+
+func (e *funcExpr) eval(ev *evaluator, ctx xpathContext) (interface{}, error) {
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		var err error
+		args[i], err = arg.eval(ev, ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Functions that take an optional argument default to the context node.
+	if len(args) == 0 && xpathFuncs[e.name][1] == 1 {
+		args = append(args, []*Node{ctx.n})
+	}
+
+	switch e.name {
+	case "last":
+		return float64(ctx.size), nil
+	case "position":
+		return float64(ctx.pos), nil
+	case "count", "sum", "local-name", "namespace-uri", "name":
+		nodes, ok := args[0].([]*Node)
+		if !ok {
+			return nil, fmt.Errorf("dom: argument to %s() must be a node-set", e.name)
+		}
+		switch e.name {
+		case "count":
+			return float64(len(nodes)), nil
+		case "sum":
+			var sum float64
+			for _, n := range nodes {
+				sum += parseNumber(stringValue(n))
+			}
+			return sum, nil
+		}
+		if len(nodes) == 0 {
+			return "", nil
+		}
+		n := nodes[0]
+		if n.Type != ElementNode && n.Type != AttrNode {
+			if n.Type == ProcInstNode && e.name != "namespace-uri" {
+				return n.Name.Local, nil
+			}
+			return "", nil
+		}
+		switch e.name {
+		case "local-name":
+			return n.Name.Local, nil
+		case "namespace-uri":
+			if n.Name.Space == "xml" {
+				return xmlURL, nil
+			}
+			return n.Name.Space, nil
+		}
+		return qualifiedName(n), nil
+	case "string":
+		return toString(args[0]), nil
+	case "concat":
+		var b strings.Builder
+		for _, arg := range args {
+			b.WriteString(toString(arg))
+		}
+		return b.String(), nil
+	case "starts-with":
+		return strings.HasPrefix(toString(args[0]), toString(args[1])), nil
+	case "contains":
+		return strings.Contains(toString(args[0]), toString(args[1])), nil
+	case "substring-before":
+		before, _, ok := strings.Cut(toString(args[0]), toString(args[1]))
+		if !ok {
+			return "", nil
+		}
+		return before, nil
+	case "substring-after":
+		_, after, _ := strings.Cut(toString(args[0]), toString(args[1]))
+		return after, nil
+	case "substring":
+		start := round(toNumber(args[1]))
+		end := math.Inf(1)
+		if len(args) > 2 {
+			end = start + round(toNumber(args[2]))
+		}
+		var b strings.Builder
+		for i, r := range []rune(toString(args[0])) {
+			if p := float64(i + 1); p >= start && p < end {
+				b.WriteRune(r)
+			}
+		}
+		return b.String(), nil
+	case "string-length":
+		return float64(len([]rune(toString(args[0])))), nil
+	case "normalize-space":
+		return strings.Join(strings.FieldsFunc(toString(args[0]), func(r rune) bool {
+			return r < 0x80 && isSpace(byte(r))
+		}), " "), nil
+	case "translate":
+		from, to := []rune(toString(args[1])), []rune(toString(args[2]))
+		return strings.Map(func(r rune) rune {
+			for i, f := range from {
+				if f == r {
+					if i < len(to) {
+						return to[i]
+					}
+					return -1
+				}
+			}
+			return r
+		}, toString(args[0])), nil
+	case "boolean":
+		return toBool(args[0]), nil
+	case "not":
+		return !toBool(args[0]), nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "lang":
+		return lang(ctx.n, toString(args[0])), nil
+	case "number":
+		return toNumber(args[0]), nil
+	case "floor":
+		return math.Floor(toNumber(args[0])), nil
+	case "ceiling":
+		return math.Ceil(toNumber(args[0])), nil
+	}
+	return round(toNumber(args[0])), nil
+}
+
+// round rounds to the closest integer, rounding halfway cases towards positive
+// infinity.
+func round(f float64) float64 {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return f
+	}
+	if f < 0 && f >= -0.5 {
+		return math.Copysign(0, -1)
+	}
+	return math.Floor(f + 0.5)
+}
+
+// lang reports whether the xml:lang attribute in scope at n is lang or a
+// sublanguage of lang.
+func lang(n *Node, lang string) bool {
+	for ; n != nil; n = n.Parent {
+		for _, a := range n.Attr {
+			if a.Name.Local != "lang" || (a.Name.Space != "xml" && a.Name.Space != xmlURL) {
+				continue
+			}
+			v := strings.ToLower(a.Value)
+			lang = strings.ToLower(lang)
+			return v == lang || strings.HasPrefix(v, lang+"-")
+		}
+	}
+	return false
+}
+
+// qualifiedName returns the name of n using the prefix bound to its namespace
+// by the xmlns attributes in scope.
+func qualifiedName(n *Node) string {
+	space := n.Name.Space
+	if space == "" || (n.Type == ElementNode && defaultSpace(n) == space) {
+		return n.Name.Local
+	}
+	if space == "xml" || space == xmlURL {
+		return "xml:" + n.Name.Local
+	}
+	for p := n; p != nil; p = p.Parent {
+		for _, a := range p.Attr {
+			if a.Name.Space == "xmlns" && a.Value == space {
+				return a.Name.Local + ":" + n.Name.Local
+			}
+		}
+	}
+	return n.Name.Local
+}
+
+// defaultSpace returns the default namespace in scope at n.
+func defaultSpace(n *Node) string {
+	for ; n != nil; n = n.Parent {
+		if v, ok := n.GetAttr(xml.Name{Local: "xmlns"}); ok {
+			return v
+		}
+	}
+	return ""
+}
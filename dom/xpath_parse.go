@@ -0,0 +1,559 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type xpathKind int
+
+const (
+	xpathEOF xpathKind = iota
+	xpathOp
+	xpathName
+	xpathLiteral
+	xpathNumber
+	xpathVar
+)
+
+type xpathToken struct {
+	kind xpathKind
+	val  string
+}
+
+// lexXPath splits an expression into tokens.
+// Following the XPath 1.0 rules for disambiguation, "*" and the names "and",
+// "or", "mod", and "div" are operators only when they follow a token that
+// could end an operand.
+func lexXPath(s string) ([]xpathToken, error) {
+	var toks []xpathToken
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		var next byte
+		if i+1 < len(s) {
+			next = s[i+1]
+		}
+		switch {
+		case isSpace(c):
+			i++
+			continue
+		case strings.IndexByte("()[]@,|+-=", c) >= 0:
+			toks = append(toks, xpathToken{kind: xpathOp, val: string(c)})
+			i++
+		case c == '.' && next == '.':
+			toks = append(toks, xpathToken{kind: xpathOp, val: ".."})
+			i += 2
+		case c == '.' && !isDigit(next):
+			toks = append(toks, xpathToken{kind: xpathOp, val: "."})
+			i++
+		case c == '.' || isDigit(c):
+			j := i
+			for j < len(s) && isDigit(s[j]) {
+				j++
+			}
+			if j < len(s) && s[j] == '.' {
+				j++
+				for j < len(s) && isDigit(s[j]) {
+					j++
+				}
+			}
+			toks = append(toks, xpathToken{kind: xpathNumber, val: s[i:j]})
+			i = j
+		case c == ':' && next == ':':
+			toks = append(toks, xpathToken{kind: xpathOp, val: "::"})
+			i += 2
+		case c == '/' && next == '/':
+			toks = append(toks, xpathToken{kind: xpathOp, val: "//"})
+			i += 2
+		case c == '/':
+			toks = append(toks, xpathToken{kind: xpathOp, val: "/"})
+			i++
+		case c == '!' && next == '=',
+			(c == '<' || c == '>') && next == '=':
+			toks = append(toks, xpathToken{kind: xpathOp, val: s[i : i+2]})
+			i += 2
+		case c == '<' || c == '>':
+			toks = append(toks, xpathToken{kind: xpathOp, val: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("dom: unterminated string literal in XPath expression %q", s)
+			}
+			toks = append(toks, xpathToken{kind: xpathLiteral, val: s[i+1 : i+1+end]})
+			i += end + 2
+		case c == '$':
+			j := scanNCName(s, i+1)
+			if j == i+1 {
+				return nil, fmt.Errorf("dom: missing variable name in XPath expression %q", s)
+			}
+			toks = append(toks, xpathToken{kind: xpathVar, val: s[i+1 : j]})
+			i = j
+		case c == '*':
+			if operatorAllowed(toks) {
+				toks = append(toks, xpathToken{kind: xpathOp, val: "*"})
+			} else {
+				toks = append(toks, xpathToken{kind: xpathName, val: "*"})
+			}
+			i++
+		case isNameStart(c):
+			j := scanNCName(s, i)
+			if j+1 < len(s) && s[j] == ':' && s[j+1] == '*' {
+				j += 2
+			} else if j+1 < len(s) && s[j] == ':' && isNameStart(s[j+1]) {
+				j = scanNCName(s, j+1)
+			}
+			name := s[i:j]
+			switch {
+			case operatorAllowed(toks) && (name == "and" || name == "or" || name == "mod" || name == "div"):
+				toks = append(toks, xpathToken{kind: xpathOp, val: name})
+			default:
+				toks = append(toks, xpathToken{kind: xpathName, val: name})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("dom: unexpected character %q in XPath expression %q", c, s)
+		}
+	}
+	return toks, nil
+}
+
+// operatorAllowed reports whether the next token should be treated as an
+// operator.
+func operatorAllowed(toks []xpathToken) bool {
+	if len(toks) == 0 {
+		return false
+	}
+	last := toks[len(toks)-1]
+	if last.kind != xpathOp {
+		return true
+	}
+	switch last.val {
+	case ")", "]", ".", "..":
+		return true
+	}
+	return false
+}
+
+func scanNCName(s string, i int) int {
+	if i >= len(s) || !isNameStart(s[i]) {
+		return i
+	}
+	for i < len(s) && (isNameStart(s[i]) || isDigit(s[i]) || s[i] == '.' || s[i] == '-') {
+		i++
+	}
+	return i
+}
+
+func isNameStart(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+type xpathParser struct {
+	src  string
+	toks []xpathToken
+	pos  int
+	ns   map[string]string
+}
+
+func (p *xpathParser) peekN(n int) xpathToken {
+	if p.pos+n >= len(p.toks) {
+		return xpathToken{}
+	}
+	return p.toks[p.pos+n]
+}
+
+func (p *xpathParser) peek() xpathToken {
+	return p.peekN(0)
+}
+
+func (p *xpathParser) next() xpathToken {
+	tok := p.peek()
+	if p.pos < len(p.toks) {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *xpathParser) isOp(val string) bool {
+	tok := p.peek()
+	return tok.kind == xpathOp && tok.val == val
+}
+
+func (p *xpathParser) expect(val string) error {
+	if !p.isOp(val) {
+		return p.errorf("expected %q", val)
+	}
+	p.next()
+	return nil
+}
+
+func (p *xpathParser) errorf(format string, v ...interface{}) error {
+	tok := p.peek()
+	at := "end of expression"
+	if tok.kind != xpathEOF {
+		at = strconv.Quote(tok.val)
+	}
+	return fmt.Errorf("dom: error in XPath expression %q at %s: %s", p.src, at, fmt.Sprintf(format, v...))
+}
+
+func (p *xpathParser) parseExpr() (xpathExpr, error) {
+	return p.parseBinary(0)
+}
+
+// xpathPrecedence lists the binary operators from lowest to highest
+// precedence, not including union which binds more tightly than unary minus.
+var xpathPrecedence = [][]string{
+	{"or"},
+	{"and"},
+	{"=", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "div", "mod"},
+}
+
+func (p *xpathParser) parseBinary(level int) (xpathExpr, error) {
+	if level == len(xpathPrecedence) {
+		return p.parseUnary()
+	}
+	l, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != xpathOp || !contains(xpathPrecedence[level], tok.val) {
+			return l, nil
+		}
+		p.next()
+		r, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: tok.val, l: l, r: r}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *xpathParser) parseUnary() (xpathExpr, error) {
+	if p.isOp("-") {
+		p.next()
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negExpr{e: e}, nil
+	}
+	l, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("|") {
+		p.next()
+		r, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{op: "|", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *xpathParser) startsLocationPath() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case xpathOp:
+		switch tok.val {
+		case "/", "//", ".", "..", "@":
+			return true
+		}
+	case xpathName:
+		next := p.peekN(1)
+		if next.kind == xpathOp && next.val == "(" {
+			return isNodeType(tok.val)
+		}
+		return true
+	}
+	return false
+}
+
+func (p *xpathParser) parsePath() (xpathExpr, error) {
+	if p.startsLocationPath() {
+		path := &pathExpr{}
+		switch {
+		case p.isOp("/"):
+			p.next()
+			path.abs = true
+			if !p.startsStep() {
+				return path, nil
+			}
+		case p.isOp("//"):
+			p.next()
+			path.abs = true
+			path.steps = append(path.steps, descendantOrSelf())
+		}
+		return path, p.parseRelative(path)
+	}
+
+	f, err := p.parseFilter()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("/") && !p.isOp("//") {
+		return f, nil
+	}
+	path := &pathExpr{filter: f}
+	if p.isOp("//") {
+		path.steps = append(path.steps, descendantOrSelf())
+	}
+	p.next()
+	return path, p.parseRelative(path)
+}
+
+func (p *xpathParser) startsStep() bool {
+	tok := p.peek()
+	switch tok.kind {
+	case xpathName:
+		return true
+	case xpathOp:
+		return tok.val == "." || tok.val == ".." || tok.val == "@"
+	}
+	return false
+}
+
+func (p *xpathParser) parseRelative(path *pathExpr) error {
+	for {
+		s, err := p.parseStep()
+		if err != nil {
+			return err
+		}
+		path.steps = append(path.steps, s)
+		switch {
+		case p.isOp("/"):
+		case p.isOp("//"):
+			path.steps = append(path.steps, descendantOrSelf())
+		default:
+			return nil
+		}
+		p.next()
+	}
+}
+
+func descendantOrSelf() *step {
+	return &step{axis: "descendant-or-self", test: nodeTest{kind: testNode}}
+}
+
+func (p *xpathParser) parseStep() (*step, error) {
+	switch {
+	case p.isOp("."):
+		p.next()
+		return &step{axis: "self", test: nodeTest{kind: testNode}}, nil
+	case p.isOp(".."):
+		p.next()
+		return &step{axis: "parent", test: nodeTest{kind: testNode}}, nil
+	}
+
+	s := &step{axis: "child"}
+	if p.isOp("@") {
+		p.next()
+		s.axis = "attribute"
+	} else if next := p.peekN(1); p.peek().kind == xpathName && next.kind == xpathOp && next.val == "::" {
+		s.axis = p.next().val
+		p.next()
+		if !isAxis(s.axis) {
+			return nil, fmt.Errorf("dom: unsupported axis %q in XPath expression %q", s.axis, p.src)
+		}
+	}
+	var err error
+	s.test, err = p.parseNodeTest(s.axis == "attribute")
+	if err != nil {
+		return nil, err
+	}
+	s.preds, err = p.parsePredicates()
+	return s, err
+}
+
+func isAxis(name string) bool {
+	switch name {
+	case "ancestor", "ancestor-or-self", "attribute", "child", "descendant",
+		"descendant-or-self", "following", "following-sibling", "parent",
+		"preceding", "preceding-sibling", "self":
+		return true
+	}
+	return false
+}
+
+func isNodeType(name string) bool {
+	switch name {
+	case "node", "text", "comment", "processing-instruction":
+		return true
+	}
+	return false
+}
+
+func (p *xpathParser) parseNodeTest(attr bool) (nodeTest, error) {
+	tok := p.peek()
+	if tok.kind != xpathName {
+		return nodeTest{}, p.errorf("expected node test")
+	}
+	p.next()
+	test := nodeTest{kind: testName, principal: ElementNode}
+	if attr {
+		test.principal = AttrNode
+	}
+
+	if isNodeType(tok.val) && p.isOp("(") {
+		p.next()
+		switch tok.val {
+		case "node":
+			test.kind = testNode
+		case "text":
+			test.kind = testText
+		case "comment":
+			test.kind = testComment
+		case "processing-instruction":
+			test.kind = testProcInst
+			if p.peek().kind == xpathLiteral {
+				test.local = p.next().val
+			}
+		}
+		return test, p.expect(")")
+	}
+
+	prefix, local, ok := strings.Cut(tok.val, ":")
+	if !ok {
+		prefix, local = "", tok.val
+	}
+	switch {
+	case ok:
+		space, found := p.lookup(prefix)
+		if !found {
+			return test, fmt.Errorf("dom: undeclared prefix %q in XPath expression %q", prefix, p.src)
+		}
+		test.space = space
+	case local == "*":
+		test.anySpace = true
+	case !attr:
+		test.space = p.ns[""]
+	}
+	test.anyLocal = local == "*"
+	test.local = local
+	return test, nil
+}
+
+func (p *xpathParser) lookup(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlURL, true
+	}
+	space, ok := p.ns[prefix]
+	return space, ok && prefix != ""
+}
+
+func (p *xpathParser) parsePredicates() ([]xpathExpr, error) {
+	var preds []xpathExpr
+	for p.isOp("[") {
+		p.next()
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+		preds = append(preds, e)
+	}
+	return preds, nil
+}
+
+func (p *xpathParser) parseFilter() (xpathExpr, error) {
+	e, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	preds, err := p.parsePredicates()
+	if err != nil {
+		return nil, err
+	}
+	if len(preds) == 0 {
+		return e, nil
+	}
+	return &filterExpr{e: e, preds: preds}, nil
+}
+
+func (p *xpathParser) parsePrimary() (xpathExpr, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case xpathLiteral:
+		p.next()
+		return literalExpr(tok.val), nil
+	case xpathNumber:
+		p.next()
+		f, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number")
+		}
+		return numberExpr(f), nil
+	case xpathVar:
+		return nil, fmt.Errorf("dom: variable references are not supported in XPath expression %q", p.src)
+	case xpathOp:
+		if tok.val != "(" {
+			break
+		}
+		p.next()
+		e, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case xpathName:
+		p.next()
+		arity, ok := xpathFuncs[tok.val]
+		if !ok {
+			return nil, fmt.Errorf("dom: unsupported function %q in XPath expression %q", tok.val, p.src)
+		}
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		call := &funcExpr{name: tok.val}
+		for !p.isOp(")") {
+			if len(call.args) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		p.next()
+		if len(call.args) < arity[0] || (arity[1] >= 0 && len(call.args) > arity[1]) {
+			return nil, fmt.Errorf("dom: wrong number of arguments to %s() in XPath expression %q", tok.val, p.src)
+		}
+		return call, nil
+	}
+	return nil, p.errorf("unexpected token")
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package dom_test
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml/dom"
+)
+
+const xpathDoc = `<?xml version="1.0"?>
+<library xmlns:b="urn:books" xml:lang="en-US">
+	<b:book id="1" year="1954"><b:title>The Fellowship of the Ring</b:title><b:price>10.50</b:price></b:book>
+	<b:book id="2" year="1937"><b:title>The Hobbit</b:title><b:price>7</b:price></b:book>
+	<!-- out of print -->
+	<b:book id="3" year="1977"><b:title>The Silmarillion</b:title><b:price>12</b:price></b:book>
+	<magazine id="4"><title>Amon Hen</title></magazine>
+</library>`
+
+var xpathNS = map[string]string{"b": "urn:books"}
+
+var xpathTestCases = [...]struct {
+	expr string
+	out  string
+	err  bool
+}{
+	0:  {expr: `/library/b:book/b:title`, out: "The Fellowship of the Ring|The Hobbit|The Silmarillion"},
+	1:  {expr: `//b:book[2]/b:title`, out: "The Hobbit"},
+	2:  {expr: `//b:book[last()]/@id`, out: "3"},
+	3:  {expr: `//b:book[@year > 1950]/@id`, out: "1|3"},
+	4:  {expr: `//b:book[@id = "2"]/b:price`, out: "7"},
+	5:  {expr: `count(//b:book)`, out: "3"},
+	6:  {expr: `sum(//b:price)`, out: "29.5"},
+	7:  {expr: `//*[@id][not(self::b:book)]/title`, out: "Amon Hen"},
+	8:  {expr: `//title | //b:title[1]`, out: "The Fellowship of the Ring|The Hobbit|The Silmarillion|Amon Hen"},
+	9:  {expr: `//b:title[. = "The Hobbit"]/../@year`, out: "1937"},
+	10: {expr: `//b:book[b:price < 11 and @year < 1950]/@id`, out: "2"},
+	11: {expr: `string(//b:book[3]/@year) = "1977"`, out: "true"},
+	12: {expr: `concat(substring("abcdef", 2, 3), "-", substring-after("a=b", "="), substring-before("a=b", "="))`, out: "bcd-ba"},
+	13: {expr: `normalize-space("  a   b ")`, out: "a b"},
+	14: {expr: `translate("bar", "abc", "AB")`, out: "BAr"},
+	15: {expr: `string-length(//magazine/title)`, out: "8"},
+	16: {expr: `round(2.5) + floor(-1.5) + ceiling(1.2) + 7 mod 3 - 6 div 4`, out: "2.5"},
+	17: {expr: `local-name(//b:book[1]) = "book" and namespace-uri(//b:book[1]) = "urn:books"`, out: "true"},
+	18: {expr: `name(//b:book[1]/b:title)`, out: "b:title"},
+	19: {expr: `//comment()/following-sibling::*[1]/@id`, out: "3"},
+	20: {expr: `//b:book[3]/preceding-sibling::b:book[1]/@id`, out: "2"},
+	21: {expr: `//b:title[starts-with(., "The")][contains(., "Ring")]/ancestor::*[last()]/@xml:lang`, out: "en-US"},
+	22: {expr: `lang("en")`, out: "false"},
+	23: {expr: `boolean(//b:book[lang("en")])`, out: "true"},
+	24: {expr: `//b:book/@*[position() = 2]`, out: "1954|1937|1977"},
+	25: {expr: `count(/library/descendant::*)`, out: "11"},
+	26: {expr: `//magazine/preceding::b:title[1]`, out: "The Silmarillion"},
+	27: {expr: `count(//b:book[1]/following::*)`, out: "8"},
+	28: {expr: `-(1 - 3) * 2`, out: "4"},
+	29: {expr: `number("abc")`, out: "NaN"},
+	30: {expr: `1 div 0`, out: "Infinity"},
+	31: {expr: `count(//processing-instruction("xml"))`, out: "1"},
+	32: {expr: `//c:book`, err: true},
+	33: {expr: `$var`, err: true},
+	34: {expr: `//b:book[`, err: true},
+	35: {expr: `id("1")`, err: true},
+	36: {expr: `namespace::*`, err: true},
+	37: {expr: `count(1)`, err: true},
+	38: {expr: `"unterminated`, err: true},
+}
+
+func TestXPath(t *testing.T) {
+	doc := parse(t, xpathDoc)
+	for i, tc := range xpathTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			e, err := Compile(tc.expr, xpathNS)
+			if err == nil {
+				var v interface{}
+				v, err = e.Evaluate(doc)
+				if err == nil {
+					if out := formatXPath(v); out != tc.out {
+						t.Errorf("wrong result for %s:\nwant=%q,\n got=%q", tc.expr, tc.out, out)
+					}
+				}
+			}
+			switch {
+			case err != nil && !tc.err:
+				t.Errorf("unexpected error: %v", err)
+			case err == nil && tc.err:
+				t.Errorf("expected error for %s", tc.expr)
+			}
+		})
+	}
+}
+
+func formatXPath(v interface{}) string {
+	switch v := v.(type) {
+	case []*Node:
+		var s []string
+		for _, n := range v {
+			s = append(s, n.Text())
+		}
+		return strings.Join(s, "|")
+	case float64:
+		if math.IsNaN(v) {
+			return "NaN"
+		}
+		if math.IsInf(v, 1) {
+			return "Infinity"
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return ""
+}
+
+func TestXPathDefaultNamespace(t *testing.T) {
+	doc := parse(t, `<a xmlns="urn:a"><b c="d"></b></a>`)
+	nodes, err := MustCompile(`/a/b`, map[string]string{"": "urn:a"}).Select(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name.Local != "b" {
+		t.Fatalf("wrong nodes selected: %v", nodes)
+	}
+	nodes, err = MustCompile(`/a/b`, nil).Select(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(nodes) != 0 {
+		t.Errorf("unprefixed name matched namespaced element without a default namespace")
+	}
+	attrs, err := MustCompile(`//@c`, map[string]string{"": "urn:a"}).Select(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(attrs) != 1 || attrs[0].Type != AttrNode || attrs[0].Parent.Name.Local != "b" {
+		t.Errorf("wrong attribute selected: %v", attrs)
+	}
+	_, err = MustCompile(`1 + 1`, nil).Select(doc)
+	if err == nil {
+		t.Errorf("expected error selecting a number")
+	}
+}
@@ -0,0 +1,424 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidityError describes a part of a document that does not conform to the
+// declarations in its DTD.
+type ValidityError struct {
+	Span Span
+	Msg  string
+}
+
+// Error returns a description of the error and where it occurred.
+func (e ValidityError) Error() string {
+	return fmt.Sprintf("xml: validity error at line %d, column %d: %s", e.Span.Start.Line, e.Span.Start.Col, e.Msg)
+}
+
+// ValidityErrors returns the violations of the DTD that have been found so
+// far if ValidateDTD is set.
+// Errors that depend on the whole document, such as IDREF attributes that do
+// not match any ID, are reported once the root element has ended.
+func (t *Tokenizer) ValidityErrors() []ValidityError {
+	return t.validity.errs
+}
+
+type contentKind int
+
+const (
+	anyContent contentKind = iota
+	emptyContent
+	mixedContent
+	childrenContent
+)
+
+// contentModel is the content allowed by an ELEMENT declaration.
+type contentModel struct {
+	kind  contentKind
+	mixed map[string]bool
+	root  *contentParticle
+}
+
+// contentParticle is a name, sequence, or choice in a children content model.
+type contentParticle struct {
+	name     string
+	choice   bool
+	children []*contentParticle
+	// occur is one of '?', '*', '+', or 0 if the particle occurs once.
+	occur byte
+}
+
+// parseContentSpec parses the content specification of an ELEMENT
+// declaration.
+func parseContentSpec(s string) (*contentModel, bool) {
+	switch s {
+	case "ANY":
+		return &contentModel{kind: anyContent}, true
+	case "EMPTY":
+		return &contentModel{kind: emptyContent}, true
+	}
+	if !strings.HasPrefix(s, "(") {
+		return nil, false
+	}
+	inner := strings.TrimSpace(s[1:])
+	if strings.HasPrefix(inner, "#PCDATA") {
+		end := strings.LastIndexByte(inner, ')')
+		if end < 0 {
+			return nil, false
+		}
+		m := &contentModel{kind: mixedContent, mixed: make(map[string]bool)}
+		for _, name := range strings.Split(inner[len("#PCDATA"):end], "|")[1:] {
+			m.mixed[strings.TrimSpace(name)] = true
+		}
+		return m, true
+	}
+	p := &cpParser{s: s}
+	root, ok := p.particle()
+	if !ok || strings.TrimSpace(p.s) != "" {
+		return nil, false
+	}
+	return &contentModel{kind: childrenContent, root: root}, true
+}
+
+type cpParser struct {
+	s string
+}
+
+func (p *cpParser) skipSpace() {
+	p.s = strings.TrimLeft(p.s, " \t\r\n")
+}
+
+func (p *cpParser) particle() (*contentParticle, bool) {
+	p.skipSpace()
+	cp := &contentParticle{}
+	if strings.HasPrefix(p.s, "(") {
+		p.s = p.s[1:]
+		var sep byte
+		for {
+			child, ok := p.particle()
+			if !ok {
+				return nil, false
+			}
+			cp.children = append(cp.children, child)
+			p.skipSpace()
+			if p.s == "" {
+				return nil, false
+			}
+			c := p.s[0]
+			p.s = p.s[1:]
+			if c == ')' {
+				break
+			}
+			if (c != ',' && c != '|') || (sep != 0 && c != sep) {
+				return nil, false
+			}
+			sep = c
+		}
+		cp.choice = sep == '|'
+	} else {
+		end := strings.IndexAny(p.s, " \t\r\n,|()?*+")
+		if end < 0 {
+			end = len(p.s)
+		}
+		if end == 0 {
+			return nil, false
+		}
+		cp.name, p.s = p.s[:end], p.s[end:]
+	}
+	if p.s != "" && strings.IndexByte("?*+", p.s[0]) >= 0 {
+		cp.occur, p.s = p.s[0], p.s[1:]
+	}
+	return cp, true
+}
+
+// dtdValidator holds the state of DTD validation.
+type dtdValidator struct {
+	errs   []ValidityError
+	stack  []*dtdFrame
+	ids    map[string]bool
+	idrefs []idref
+	done   bool
+}
+
+type idref struct {
+	id   string
+	span Span
+}
+
+// dtdFrame is an open element.
+type dtdFrame struct {
+	name     string
+	model    *contentModel
+	children []string
+	spans    []Span
+	// failed is set once a violation has been reported for the content.
+	failed bool
+}
+
+func (t *Tokenizer) invalid(span Span, format string, v ...interface{}) {
+	t.validity.errs = append(t.validity.errs, ValidityError{Span: span, Msg: fmt.Sprintf(format, v...)})
+}
+
+// validateStart checks an element and its attributes before their names are
+// resolved.
+func (t *Tokenizer) validateStart(name Name, attr []Attr) {
+	v := &t.validity
+	span := Span{Start: t.spanStart, End: t.pos()}
+	qname := rawName(name)
+	if len(v.stack) == 0 {
+		if v.done {
+			return
+		}
+		switch {
+		case t.doctype == nil:
+			t.invalid(span, "document has no DOCTYPE")
+		case t.doctype.name != qname:
+			t.invalid(span, "root element %s does not match DOCTYPE %s", qname, t.doctype.name)
+		}
+	} else {
+		parent := v.stack[len(v.stack)-1]
+		parent.children = append(parent.children, qname)
+		parent.spans = append(parent.spans, span)
+	}
+	f := &dtdFrame{name: qname}
+	v.stack = append(v.stack, f)
+	if t.doctype == nil {
+		return
+	}
+	f.model = t.doctype.elements[qname]
+	if f.model == nil {
+		t.invalid(span, "element %s is not declared", qname)
+	}
+	decls := t.doctype.attlists[qname]
+	seen := make(map[Name]bool, len(attr))
+	for _, a := range attr {
+		seen[a.Name] = true
+		var decl *attrDecl
+		for i := range decls {
+			if decls[i].Name == a.Name {
+				decl = &decls[i]
+				break
+			}
+		}
+		if decl == nil {
+			t.invalid(span, "attribute %s of element %s is not declared", rawName(a.Name), qname)
+			continue
+		}
+		t.validateAttr(span, qname, a, decl)
+	}
+	for _, decl := range decls {
+		if decl.mode == "#REQUIRED" && !seen[decl.Name] {
+			t.invalid(span, "element %s is missing required attribute %s", qname, rawName(decl.Name))
+		}
+	}
+}
+
+func (t *Tokenizer) validateAttr(span Span, elem string, a Attr, decl *attrDecl) {
+	v := &t.validity
+	name := rawName(a.Name)
+	value := a.Value
+	if decl.typ != "CDATA" {
+		value = strings.Join(strings.Fields(value), " ")
+	}
+	if decl.mode == "#FIXED" && value != decl.Value {
+		t.invalid(span, "attribute %s of element %s must have the value %q", name, elem, decl.Value)
+		return
+	}
+	tokens := strings.Fields(value)
+	valid := true
+	switch decl.typ {
+	case "ID", "IDREF", "ENTITY":
+		valid = len(tokens) == 1 && isName(value)
+	case "IDREFS", "ENTITIES":
+		valid = len(tokens) > 0
+		for _, tok := range tokens {
+			valid = valid && isName(tok)
+		}
+	case "NMTOKEN":
+		valid = len(tokens) == 1 && isNmtoken(value)
+	case "NMTOKENS":
+		valid = len(tokens) > 0
+		for _, tok := range tokens {
+			valid = valid && isNmtoken(tok)
+		}
+	case "ENUMERATION", "NOTATION":
+		valid = false
+		for _, allowed := range decl.enum {
+			valid = valid || value == allowed
+		}
+	}
+	if !valid {
+		t.invalid(span, "attribute %s of element %s has invalid %s value %q", name, elem, strings.ToLower(decl.typ), a.Value)
+		return
+	}
+	switch decl.typ {
+	case "ID":
+		if v.ids == nil {
+			v.ids = make(map[string]bool)
+		}
+		if v.ids[value] {
+			t.invalid(span, "duplicate ID %q", value)
+		}
+		v.ids[value] = true
+	case "IDREF", "IDREFS":
+		for _, tok := range tokens {
+			v.idrefs = append(v.idrefs, idref{id: tok, span: span})
+		}
+	}
+}
+
+// validateText checks character data in the innermost open element.
+func (t *Tokenizer) validateText(cd CharData) {
+	v := &t.validity
+	if len(v.stack) == 0 {
+		return
+	}
+	f := v.stack[len(v.stack)-1]
+	if f.model == nil || f.failed {
+		return
+	}
+	switch {
+	case f.model.kind == emptyContent:
+		t.invalid(t.Span(), "element %s must be empty", f.name)
+		f.failed = true
+	case f.model.kind == childrenContent && !onlySpace(cd):
+		t.invalid(t.Span(), "character data is not allowed in element %s", f.name)
+		f.failed = true
+	}
+}
+
+// validateEnd checks the children of the innermost open element when it ends.
+func (t *Tokenizer) validateEnd() {
+	v := &t.validity
+	if len(v.stack) == 0 {
+		return
+	}
+	f := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+	if len(v.stack) == 0 {
+		v.done = true
+		for _, ref := range v.idrefs {
+			if !v.ids[ref.id] {
+				t.invalid(ref.span, "IDREF %q does not match any ID", ref.id)
+			}
+		}
+		v.idrefs = nil
+	}
+	if f.model == nil {
+		return
+	}
+	switch f.model.kind {
+	case emptyContent:
+		if len(f.children) > 0 && !f.failed {
+			t.invalid(f.spans[0], "element %s must be empty", f.name)
+		}
+	case mixedContent:
+		for i, child := range f.children {
+			if !f.model.mixed[child] {
+				t.invalid(f.spans[i], "element %s is not allowed in element %s", child, f.name)
+			}
+		}
+	case childrenContent:
+		m := &cpMatcher{names: f.children}
+		from := make([]bool, len(f.children)+1)
+		from[0] = true
+		if m.match(f.model.root, from)[len(f.children)] {
+			return
+		}
+		if m.far < len(f.children) {
+			t.invalid(f.spans[m.far], "element %s is not allowed here in element %s", f.children[m.far], f.name)
+			return
+		}
+		t.invalid(t.Span(), "content of element %s is incomplete", f.name)
+	}
+}
+
+// cpMatcher matches a sequence of element names against a content model.
+// Each step takes the set of positions in the sequence that matching may
+// continue from and returns the set of positions after the particle.
+type cpMatcher struct {
+	names []string
+	// far is the furthest position that matching reached.
+	far int
+}
+
+func (m *cpMatcher) match(cp *contentParticle, from []bool) []bool {
+	out := make([]bool, len(from))
+	if cp.occur == '?' || cp.occur == '*' {
+		copy(out, from)
+	}
+	cur := from
+	for {
+		cur = m.once(cp, cur)
+		added := false
+		for i, ok := range cur {
+			if ok && !out[i] {
+				out[i] = true
+				added = true
+			}
+		}
+		if !added || cp.occur == 0 || cp.occur == '?' {
+			return out
+		}
+	}
+}
+
+func (m *cpMatcher) once(cp *contentParticle, from []bool) []bool {
+	if cp.name != "" {
+		out := make([]bool, len(from))
+		for i, ok := range from {
+			if ok && i < len(m.names) && m.names[i] == cp.name {
+				out[i+1] = true
+				if i+1 > m.far {
+					m.far = i + 1
+				}
+			}
+		}
+		return out
+	}
+	if !cp.choice {
+		for _, child := range cp.children {
+			from = m.match(child, from)
+		}
+		return from
+	}
+	out := make([]bool, len(from))
+	for _, child := range cp.children {
+		for i, ok := range m.match(child, from) {
+			out[i] = out[i] || ok
+		}
+	}
+	return out
+}
+
+// isName reports whether s matches the Name production.
+func isName(s string) bool {
+	for i, part := range strings.Split(s, ":") {
+		if part == "" {
+			return i > 0 && isNCName(strings.Replace(s, ":", "", -1))
+		}
+		if !isNCName(part) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isNmtoken reports whether s matches the Nmtoken production.
+func isNmtoken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r != ':' && !isNameChar(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+const testDTD = `<!DOCTYPE book [
+<!ELEMENT book (title, (chapter | appendix)+, index?)>
+<!ELEMENT title (#PCDATA)>
+<!ELEMENT chapter (#PCDATA | em)*>
+<!ELEMENT appendix ANY>
+<!ELEMENT index EMPTY>
+<!ELEMENT em (#PCDATA)>
+<!ATTLIST book
+  version CDATA #FIXED "1"
+  lang NMTOKEN #IMPLIED>
+<!ATTLIST chapter
+  id ID #REQUIRED
+  kind (intro|body) "body"
+  see IDREFS #IMPLIED>
+]>
+`
+
+var validateDTDTestCases = [...]struct {
+	in   string
+	errs []string
+}{
+	0: {
+		in: testDTD + `<book version="1" lang="en"><title>Go</title><chapter id="a">x<em>y</em></chapter>
+<chapter id="b" see="a b"/><index/></book>`,
+	},
+	1: {
+		in:   `<book/>`,
+		errs: []string{"xml: validity error at line 1, column 1: document has no DOCTYPE"},
+	},
+	2: {
+		in: testDTD + `<chapter id="a"/>`,
+		errs: []string{
+			"xml: validity error at line 16, column 1: root element chapter does not match DOCTYPE book",
+		},
+	},
+	3: {
+		in: testDTD + `<book version="2"><title/><chapter kind="outro" foo=""/></book>`,
+		errs: []string{
+			`xml: validity error at line 16, column 1: attribute version of element book must have the value "1"`,
+			`xml: validity error at line 16, column 27: attribute kind of element chapter has invalid enumeration value "outro"`,
+			"xml: validity error at line 16, column 27: attribute foo of element chapter is not declared",
+			"xml: validity error at line 16, column 27: element chapter is missing required attribute id",
+		},
+	},
+	4: {
+		in: testDTD + `<book><title/><chapter id="a" see="b"/><chapter id="a"/></book>`,
+		errs: []string{
+			`xml: validity error at line 16, column 40: duplicate ID "a"`,
+			`xml: validity error at line 16, column 15: IDREF "b" does not match any ID`,
+		},
+	},
+	5: {
+		in: testDTD + `<book><chapter id="a"/><index/></book>`,
+		errs: []string{
+			"xml: validity error at line 16, column 7: element chapter is not allowed here in element book",
+		},
+	},
+	6: {
+		in: testDTD + `<book><title/></book>`,
+		errs: []string{
+			"xml: validity error at line 16, column 15: content of element book is incomplete",
+		},
+	},
+	7: {
+		in: testDTD + `<book><title/>text<appendix><foo/></appendix><index>x</index></book>`,
+		errs: []string{
+			"xml: validity error at line 16, column 15: character data is not allowed in element book",
+			"xml: validity error at line 16, column 29: element foo is not declared",
+			"xml: validity error at line 16, column 53: element index must be empty",
+		},
+	},
+	8: {
+		in: testDTD + `<book><title><em/></title><chapter id="1"/></book>`,
+		errs: []string{
+			"xml: validity error at line 16, column 14: element em is not allowed in element title",
+			`xml: validity error at line 16, column 27: attribute id of element chapter has invalid id value "1"`,
+		},
+	},
+}
+
+func TestValidateDTD(t *testing.T) {
+	for i, tc := range validateDTDTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d := NewTokenizer(strings.NewReader(tc.in))
+			d.ValidateDTD = true
+			for {
+				_, err := d.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			var errs []string
+			for _, err := range d.ValidityErrors() {
+				errs = append(errs, err.Error())
+			}
+			if !reflect.DeepEqual(errs, tc.errs) {
+				t.Errorf("wrong errors:\nwant=%q,\n got=%q", tc.errs, errs)
+			}
+		})
+	}
+}
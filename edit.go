@@ -0,0 +1,229 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// TokenList is a tokenized document that can be updated after an edit by
+// tokenizing only the part of the document that the edit affects.
+// This keeps the tokens of large documents up to date as they are edited, for
+// example by an editor or language server.
+type TokenList struct {
+	// Tokens contains every token in the document, and Spans the range of
+	// input that each one occupies.
+	Tokens []Token
+	Spans  []Span
+
+	// Err is the error that stopped tokenization before the end of the
+	// document, if any.
+	Err error
+
+	src    []byte
+	states []resumeState
+}
+
+// TokenChange describes how the tokens of a TokenList changed after an edit.
+// Removed tokens starting at Index were replaced by Added new tokens.
+// The spans of the tokens after them may have moved, but they are otherwise
+// unchanged.
+type TokenChange struct {
+	Index   int
+	Removed int
+	Added   int
+}
+
+// resumeState is the state of the tokenizer before a token, which is enough to
+// start tokenizing again from that token.
+type resumeState struct {
+	start    Pos
+	started  bool
+	ns       []nsBinding
+	spaces   []string
+	preserve []bool
+	doctype  *doctype
+	// clean is false if the token can only be decoded as part of the token
+	// before it, such as the end element of an empty element tag.
+	clean bool
+}
+
+func (s resumeState) equal(o resumeState) bool {
+	if s.started != o.started || s.clean != o.clean || s.doctype != o.doctype ||
+		len(s.ns) != len(o.ns) || len(s.spaces) != len(o.spaces) || len(s.preserve) != len(o.preserve) {
+		return false
+	}
+	for i := range s.ns {
+		if s.ns[i] != o.ns[i] {
+			return false
+		}
+	}
+	for i := range s.spaces {
+		if s.spaces[i] != o.spaces[i] || s.preserve[i] != o.preserve[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// NewTokenList tokenizes b.
+// The list keeps b and it must not be modified except by calling Edit.
+func NewTokenList(b []byte) *TokenList {
+	l := &TokenList{src: b}
+	l.Tokens, l.Spans, l.states, _, l.Err = scanTokens(NewTokenizerBytes(b), nil)
+	return l
+}
+
+// Bytes returns the current contents of the document.
+func (l *TokenList) Bytes() []byte {
+	return l.src
+}
+
+// Edit replaces the del bytes at offset off with ins and updates the tokens.
+// Tokens are decoded again starting from the last token that begins before
+// off, until the tokenizer reaches the start of a token after the edit in the
+// same state that it was in before, after which the old tokens are reused.
+func (l *TokenList) Edit(off, del int, ins []byte) (TokenChange, error) {
+	if off < 0 || del < 0 || off+del > len(l.src) {
+		return TokenChange{}, fmt.Errorf("xml: edit of %d bytes at offset %d is out of range", del, off)
+	}
+	src := make([]byte, 0, len(l.src)-del+len(ins))
+	src = append(src, l.src[:off]...)
+	src = append(src, ins...)
+	src = append(src, l.src[off+del:]...)
+
+	// Find the last token that starts before the edit and can be decoded on
+	// its own.
+	k := len(l.states)
+	for k > 0 && (l.states[k-1].start.Offset >= int64(off) || !l.states[k-1].clean) {
+		k--
+	}
+	from := resumeState{start: Pos{Line: 1, Col: 1}, clean: true}
+	if k > 0 {
+		k--
+		from = l.states[k]
+	}
+	oldEnd := posAt(l.src, from.start, int64(off+del))
+	newEnd := posAt(src, from.start, int64(off+len(ins)))
+	delta := newEnd.Offset - oldEnd.Offset
+
+	t := NewTokenizerBytes(src[from.start.Offset:])
+	t.resume(from)
+	j := k
+	toks, spans, states, synced, err := scanTokens(t, func(s resumeState) bool {
+		if !s.clean || s.start.Offset < newEnd.Offset {
+			return false
+		}
+		for j < len(l.states) && l.states[j].start.Offset+delta < s.start.Offset {
+			j++
+		}
+		if j == len(l.states) || l.states[j].start.Offset < oldEnd.Offset || l.states[j].start.Offset+delta != s.start.Offset {
+			return false
+		}
+		old := l.states[j]
+		old.start = s.start
+		return old.equal(s)
+	})
+
+	change := TokenChange{Index: k, Added: len(toks)}
+	shift := func(p Pos) Pos {
+		if p.Line == oldEnd.Line {
+			p.Col += newEnd.Col - oldEnd.Col
+		}
+		p.Line += newEnd.Line - oldEnd.Line
+		p.Offset += delta
+		return p
+	}
+	var rest []Token
+	var restSpans []Span
+	var restStates []resumeState
+	if synced {
+		change.Removed = j - k
+		rest = l.Tokens[j:]
+		for i := j; i < len(l.states); i++ {
+			span := l.Spans[i]
+			span.Start, span.End = shift(span.Start), shift(span.End)
+			restSpans = append(restSpans, span)
+			s := l.states[i]
+			s.start = shift(s.start)
+			restStates = append(restStates, s)
+		}
+		err = l.Err
+	} else {
+		change.Removed = len(l.Tokens) - k
+	}
+	l.Tokens = append(append(l.Tokens[:k:k], toks...), rest...)
+	l.Spans = append(append(l.Spans[:k:k], spans...), restSpans...)
+	l.states = append(append(l.states[:k:k], states...), restStates...)
+	l.Err = err
+	l.src = src
+	return change, nil
+}
+
+// scanTokens reads tokens from t until the end of the input, an error, or
+// until stop returns true for the state before a token other than the first,
+// in which case stopped is true.
+func scanTokens(t *Tokenizer, stop func(resumeState) bool) (toks []Token, spans []Span, states []resumeState, stopped bool, err error) {
+	for {
+		s := t.snapshot()
+		if stop != nil && len(toks) > 0 && stop(s) {
+			return toks, spans, states, true, nil
+		}
+		tok, err := t.Token()
+		if errors.Is(err, io.EOF) {
+			return toks, spans, states, false, nil
+		}
+		if err != nil {
+			return toks, spans, states, false, err
+		}
+		toks = append(toks, tok)
+		spans = append(spans, t.Span())
+		states = append(states, s)
+	}
+}
+
+// snapshot records the state of the tokenizer before the next token.
+func (t *Tokenizer) snapshot() resumeState {
+	return resumeState{
+		start:    t.pos(),
+		started:  t.started,
+		ns:       append([]nsBinding(nil), t.ns...),
+		spaces:   append([]string(nil), t.spaces...),
+		preserve: append([]bool(nil), t.preserve...),
+		doctype:  t.doctype,
+		clean:    t.selfClose == nil && !t.inCDATA && !t.textCont,
+	}
+}
+
+// resume restores a state recorded by snapshot for a tokenizer that reads the
+// input starting at the token the state was recorded before.
+func (t *Tokenizer) resume(s resumeState) {
+	t.n = s.start.Offset
+	t.line = s.start.Line - 1
+	t.col = s.start.Col - 1
+	t.started = s.started
+	t.ns = append(t.ns[:0], s.ns...)
+	t.spaces = append(t.spaces[:0], s.spaces...)
+	t.preserve = append(t.preserve[:0], s.preserve...)
+	t.doctype = s.doctype
+}
+
+// posAt returns the position of off in src given the position of an earlier
+// offset.
+func posAt(src []byte, from Pos, off int64) Pos {
+	p := from
+	for _, b := range src[from.Offset:off] {
+		if b == '\n' {
+			p.Line++
+			p.Col = 1
+		} else {
+			p.Col++
+		}
+	}
+	p.Offset = off
+	return p
+}
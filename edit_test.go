@@ -0,0 +1,72 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+const editInput = `<?xml version="1.0"?>
+<a xmlns:p="urn:p">
+  <p:b c="d">text</p:b>
+  <e/><![CDATA[f]]>
+  <g>h &amp; i</g>
+</a>`
+
+var editTestCases = [...]struct {
+	off    int
+	del    int
+	ins    string
+	change TokenChange
+}{
+	0: {off: 55, del: 4, ins: "new text", change: TokenChange{Index: 4, Removed: 2, Added: 2}},
+	1: {off: 21, ins: "<x/>", change: TokenChange{Index: 0, Removed: 1, Added: 3}},
+	2: {off: 34, del: 5, ins: "urn:q"},
+	3: {off: 0, del: 21},
+	4: {off: 68, ins: "<"},
+	5: {off: 82, del: 3, ins: "]]"},
+	6: {off: len(editInput), ins: "<trailing/>"},
+	7: {off: 70, ins: "\n\n"},
+}
+
+func TestTokenListEdit(t *testing.T) {
+	for i, tc := range editTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			l := NewTokenList([]byte(editInput))
+			change, err := l.Edit(tc.off, tc.del, []byte(tc.ins))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := NewTokenList(l.Bytes())
+			if string(l.Bytes()) != editInput[:tc.off]+tc.ins+editInput[tc.off+tc.del:] {
+				t.Fatalf("wrong contents after edit: %q", l.Bytes())
+			}
+			if !reflect.DeepEqual(l.Tokens, want.Tokens) {
+				t.Errorf("wrong tokens:\nwant=%+v,\n got=%+v", want.Tokens, l.Tokens)
+			}
+			if !reflect.DeepEqual(l.Spans, want.Spans) {
+				t.Errorf("wrong spans:\nwant=%+v,\n got=%+v", want.Spans, l.Spans)
+			}
+			if !reflect.DeepEqual(l.Err, want.Err) {
+				t.Errorf("wrong error: want=%v, got=%v", want.Err, l.Err)
+			}
+			if tc.change != (TokenChange{}) && change != tc.change {
+				t.Errorf("wrong change: want=%+v, got=%+v", tc.change, change)
+			}
+		})
+	}
+}
+
+func TestTokenListEditRange(t *testing.T) {
+	l := NewTokenList([]byte(`<a/>`))
+	_, err := l.Edit(2, 3, nil)
+	if err == nil {
+		t.Errorf("expected error for edit past the end of the input")
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// Element is a small tree of XML.
+// It is useful for constructing and inspecting payloads where defining a struct
+// for every element would be overkill.
+//
+// Children may contain CharData, Comment, ProcInst, and Directive tokens, as
+// well as other Elements.
+type Element struct {
+	Name     Name
+	Attr     []Attr
+	Children []Token
+}
+
+// StartElement returns the start element of e.
+func (e Element) StartElement() StartElement {
+	attr := make([]Attr, len(e.Attr))
+	copy(attr, e.Attr)
+	return StartElement{Name: e.Name, Attr: attr}
+}
+
+// TokenReader returns a TokenReader that reads the tokens of the element, its
+// children, and its end element.
+func (e Element) TokenReader() TokenReader {
+	inner := make([]TokenReader, 0, len(e.Children))
+	var buf *TokenBuffer
+	for _, c := range e.Children {
+		var child Element
+		switch tok := c.(type) {
+		case Element:
+			child = tok
+		case *Element:
+			child = *tok
+		default:
+			if buf == nil {
+				buf = &TokenBuffer{}
+				inner = append(inner, buf)
+			}
+			/* #nosec */
+			buf.EncodeToken(tok)
+			continue
+		}
+		buf = nil
+		inner = append(inner, child.TokenReader())
+	}
+	return Wrap(MultiTokenReader(inner...), e.StartElement())
+}
+
+// MarshalXML satisfies the Marshaler interface.
+// The start element passed to MarshalXML is ignored and the element's own name
+// and attributes are used instead.
+func (e Element) MarshalXML(enc *Encoder, _ StartElement) error {
+	w := WrapEncoder(enc)
+	r := e.TokenReader()
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			if err := w.EncodeToken(tok); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// UnmarshalXML satisfies the Unmarshaler interface.
+// It decodes the start element and all of its children into e.
+func (e *Element) UnmarshalXML(d *Decoder, start StartElement) error {
+	e.Name = start.Name
+	e.Attr = start.Copy().Attr
+	e.Children = e.Children[:0]
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		switch tok := tok.(type) {
+		case StartElement:
+			var child Element
+			if err := child.UnmarshalXML(d, tok); err != nil {
+				return err
+			}
+			e.Children = append(e.Children, child)
+		case EndElement:
+			return nil
+		default:
+			e.Children = append(e.Children, CopyToken(tok))
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var testElement = Element{
+	Name: Name{Space: "jabber:client", Local: "message"},
+	Attr: []Attr{{Name: Name{Local: "to"}, Value: "juliet@example.net"}},
+	Children: []Token{
+		Element{
+			Name:     Name{Space: "jabber:client", Local: "body"},
+			Children: []Token{CharData("Art thou not Romeo?")},
+		},
+		Comment(" a "),
+		&Element{Name: Name{Space: "urn:example", Local: "x"}},
+	},
+}
+
+func TestElementTokenReader(t *testing.T) {
+	var buf strings.Builder
+	e := NewEncoder(&buf)
+	toks, err := readAll(testElement.TokenReader())
+	if err != nil {
+		t.Fatalf("unexpected error reading tokens: %v", err)
+	}
+	for _, tok := range toks {
+		if err = e.EncodeToken(tok); err != nil {
+			t.Fatalf("unexpected error encoding: %v", err)
+		}
+	}
+	if err = e.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	const out = `<message xmlns="jabber:client" to="juliet@example.net"><body>Art thou not Romeo?</body><!-- a --><x xmlns="urn:example"></x></message>`
+	if s := buf.String(); s != out {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+}
+
+func TestElementMarshalUnmarshal(t *testing.T) {
+	type payload struct {
+		XMLName Name    `xml:"a"`
+		Inner   Element `xml:"inner"`
+	}
+	b, err := Marshal(payload{Inner: testElement})
+	if err != nil {
+		t.Fatalf("unexpected error marshaling: %v", err)
+	}
+	const out = `<a><message xmlns="jabber:client" to="juliet@example.net"><body xmlns="jabber:client">Art thou not Romeo?</body><!-- a --><x xmlns="urn:example"></x></message></a>`
+	if s := string(b); s != out {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+
+	var el Element
+	err = Unmarshal(b, &el)
+	if err != nil {
+		t.Fatalf("unexpected error unmarshaling: %v", err)
+	}
+	if el.Name.Local != "a" || len(el.Children) != 1 {
+		t.Fatalf("wrong element: %+v", el)
+	}
+	msg := el.Children[0].(Element)
+	if msg.Name != testElement.Name {
+		t.Errorf("wrong name: want=%v, got=%v", testElement.Name, msg.Name)
+	}
+	body := msg.Children[0].(Element)
+	if !reflect.DeepEqual(body.Children, []Token{CharData("Art thou not Romeo?")}) {
+		t.Errorf("wrong body: %+v", body.Children)
+	}
+	if c, ok := msg.Children[1].(Comment); !ok || string(c) != " a " {
+		t.Errorf("wrong comment: %T(%[1]v)", msg.Children[1])
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxEntityExpansions limits the number of entities that are expanded while
+	// tokenizing a document so that entities that reference themselves cannot
+	// expand forever.
+	maxEntityExpansions = 1024
+
+	// maxEntitySize limits the size of each external entity.
+	maxEntitySize = 1 << 20
+)
+
+var errEntityExpansions = errors.New("xml: too many entity expansions")
+
+// EntityResolver loads external entities, including the external subset of a
+// DOCTYPE.
+//
+// Resolving external entities lets a document read local files or make
+// network requests (an XML External Entity, or XXE, attack), so a Tokenizer
+// never resolves them unless its EntityResolver field is set.
+// Resolvers should only load identifiers from trusted locations, for example
+// by looking them up in a local catalog.
+type EntityResolver interface {
+	// ResolveEntity returns the content of the external entity with the given
+	// public and system identifiers.
+	// The public identifier may be empty.
+	// System identifiers are passed as they appear in the document and
+	// relative identifiers are not resolved.
+	// If the returned reader is also an io.Closer it is closed after it has
+	// been read.
+	ResolveEntity(publicID, systemID string) (io.Reader, error)
+}
+
+// EntityResolverFunc is an adapter to allow the use of ordinary functions as
+// entity resolvers.
+type EntityResolverFunc func(publicID, systemID string) (io.Reader, error)
+
+// ResolveEntity calls f(publicID, systemID).
+func (f EntityResolverFunc) ResolveEntity(publicID, systemID string) (io.Reader, error) {
+	return f(publicID, systemID)
+}
+
+// externalEntity returns the identifier of an external parsed entity declared
+// by the DOCTYPE, if any, and if entities are being resolved.
+func (t *Tokenizer) externalEntity(name string) (externalID, bool) {
+	if t.EntityResolver == nil || t.doctype == nil {
+		return externalID{}, false
+	}
+	id, ok := t.doctype.entities[name]
+	return id, ok
+}
+
+// internalEntity returns the replacement text of an internal general entity
+// declared by the DOCTYPE, if any.
+func (t *Tokenizer) internalEntity(name string) (string, bool) {
+	if t.doctype == nil {
+		return "", false
+	}
+	text, ok := t.doctype.internal[name]
+	return text, ok
+}
+
+// expand counts an entity expansion and returns an error if there have been
+// too many.
+func (t *Tokenizer) expand() error {
+	t.expansions++
+	if t.expansions > maxEntityExpansions {
+		return errEntityExpansions
+	}
+	return nil
+}
+
+// appendAttrEntity appends the replacement text of an internal entity that is
+// referenced from an attribute value to buf.
+// References in the replacement text are expanded and whitespace is replaced
+// by spaces as if the text had appeared in the attribute value.
+func (t *Tokenizer) appendAttrEntity(buf []byte, text string) ([]byte, error) {
+	if err := t.expand(); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '<':
+			return nil, t.syntaxError("unescaped < inside quoted string")
+		case isSpace(c):
+			buf = append(buf, ' ')
+		case c == '&':
+			end := strings.IndexByte(text[i:], ';')
+			if end < 0 {
+				return nil, t.syntaxError("invalid character entity " + text[i:] + " (no semicolon)")
+			}
+			name := text[i+1 : i+end]
+			i += end
+			if r, ok := resolveEntity(name); ok {
+				buf = utf8.AppendRune(buf, r)
+				continue
+			}
+			inner, ok := t.internalEntity(name)
+			if !ok {
+				return nil, t.entityError(name)
+			}
+			var err error
+			buf, err = t.appendAttrEntity(buf, inner)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf, nil
+}
+
+// entityError returns the error for a reference to the named entity that
+// cannot be replaced.
+// Entities that are declared but that cannot be expanded, such as external
+// entities that are not resolved or unparsed entities, are reported
+// differently from references to entities that are not known to be declared.
+func (t *Tokenizer) entityError(name string) error {
+	if t.doctype != nil && t.doctype.declared[name] {
+		return t.syntaxError("cannot expand entity &" + name + ";")
+	}
+	return t.syntaxError("invalid character entity &" + name + ";")
+}
+
+// loadExternalSubset parses the declarations in the external subset of a
+// DOCTYPE, if any, and if entities are being resolved.
+// Declarations in the internal subset take precedence.
+func (t *Tokenizer) loadExternalSubset(d *doctype) error {
+	if t.EntityResolver == nil || d.systemID == "" {
+		return nil
+	}
+	subset, err := t.readEntity(externalID{publicID: d.publicID, systemID: d.systemID})
+	if err != nil {
+		return err
+	}
+	d.parseDecls(string(subset))
+	return nil
+}
+
+// readEntity loads an external entity and removes any text declaration from
+// the start of it.
+func (t *Tokenizer) readEntity(id externalID) ([]byte, error) {
+	if err := t.expand(); err != nil {
+		return nil, err
+	}
+	r, err := t.EntityResolver.ResolveEntity(id.publicID, id.systemID)
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		/* #nosec */
+		defer c.Close()
+	}
+	content, err := io.ReadAll(io.LimitReader(r, maxEntitySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxEntitySize {
+		return nil, fmt.Errorf("xml: external entity %q is too large", id.systemID)
+	}
+	if bytes.HasPrefix(content, []byte("<?xml")) && len(content) > 5 && isSpace(content[5]) {
+		if end := bytes.Index(content, []byte("?>")); end >= 0 {
+			content = content[end+2:]
+		}
+	}
+	return content, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+type entityCloser struct {
+	io.Reader
+	closed *int
+}
+
+func (c entityCloser) Close() error {
+	*c.closed++
+	return nil
+}
+
+var entities = map[string]string{
+	"text.ent":   `<?xml version="1.0" encoding="UTF-8"?>hello`,
+	"markup.ent": `<b c="&amp;">x</b>y`,
+	"loop.ent":   `&loop;`,
+	"ext.dtd":    `<!ENTITY sub SYSTEM "text.ent"><!ATTLIST a d CDATA "e">`,
+}
+
+var entityTestCases = [...]struct {
+	in      string
+	resolve bool
+	out     string
+	err     error
+}{
+	0: {
+		in:  `<!DOCTYPE a [<!ENTITY text SYSTEM "text.ent">]><a>&text;</a>`,
+		err: errors.New("XML syntax error on line 1: cannot expand entity &text;"),
+	},
+	1: {
+		in:      `<!DOCTYPE a [<!ENTITY text SYSTEM "text.ent">]><a>&text; &amp;&text;</a>`,
+		resolve: true,
+		out:     `<a>hello &amp;hello</a>`,
+	},
+	2: {
+		in:      `<!DOCTYPE a [<!ENTITY m PUBLIC "-//M//EN" "markup.ent">]><a>&m;&m;</a>`,
+		resolve: true,
+		out:     `<a><b c="&amp;">x</b>y<b c="&amp;">x</b>y</a>`,
+	},
+	3: {
+		in:      `<!DOCTYPE a SYSTEM "ext.dtd"><a>&sub;</a>`,
+		resolve: true,
+		out:     `<a d="e">hello</a>`,
+	},
+	4: {
+		in:      `<!DOCTYPE a [<!ENTITY text SYSTEM "text.ent">]><a b="&text;"/>`,
+		resolve: true,
+		err:     errors.New("XML syntax error on line 1: cannot expand entity &text;"),
+	},
+	5: {
+		in:      `<!DOCTYPE a [<!ENTITY loop SYSTEM "loop.ent">]><a>&loop;</a>`,
+		resolve: true,
+		err:     errors.New("xml: too many entity expansions"),
+	},
+	6: {
+		in:      `<!DOCTYPE a [<!ENTITY missing SYSTEM "missing.ent">]><a>&missing;</a>`,
+		resolve: true,
+		err:     errors.New(`no entity "missing.ent"`),
+	},
+	7: {
+		in:      `<!DOCTYPE a [<!ENTITY img SYSTEM "img.png" NDATA png>]><a>&img;</a>`,
+		resolve: true,
+		err:     errors.New("XML syntax error on line 1: cannot expand entity &img;"),
+	},
+	8: {
+		in:  `<!DOCTYPE a [<!ENTITY e "x&#9;&f;"><!ENTITY f "&#38;#38;">]><a b="&e;">&e;</a>`,
+		out: `<a b="x &amp;">x&#x9;&amp;</a>`,
+	},
+}
+
+func TestEntityResolver(t *testing.T) {
+	for i, tc := range entityTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var resolved, closed int
+			d := NewTokenizer(strings.NewReader(tc.in))
+			d.SkipDirectives = true
+			if tc.resolve {
+				d.EntityResolver = EntityResolverFunc(func(publicID, systemID string) (io.Reader, error) {
+					resolved++
+					content, ok := entities[systemID]
+					if !ok {
+						return nil, errors.New("no entity " + strconv.Quote(systemID))
+					}
+					return entityCloser{Reader: strings.NewReader(content), closed: &closed}, nil
+				})
+			}
+			var b strings.Builder
+			e := NewEncoder(&b)
+			var err error
+			for {
+				var tok Token
+				tok, err = d.Token()
+				if err != nil {
+					break
+				}
+				if err = e.EncodeToken(tok); err != nil {
+					break
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			switch {
+			case tc.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != nil && (err == nil || err.Error() != tc.err.Error()):
+				t.Fatalf("wrong error: want=%v, got=%v", tc.err, err)
+			}
+			if closed != resolved && tc.err == nil {
+				t.Errorf("resolved %d entities but closed %d", resolved, closed)
+			}
+			if err != nil {
+				return
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("error flushing: %v", err)
+			}
+			if out := b.String(); out != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+		})
+	}
+}
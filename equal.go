@@ -0,0 +1,151 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// Equal reports whether two tokens are semantically equal.
+//
+// Names are compared by namespace and local name, so prefix spelling is
+// ignored as long as the names have been resolved to their namespaces as they
+// are by a Tokenizer.
+// The attributes of start elements are compared without regard to their order,
+// and xmlns attributes are ignored since where namespaces are declared does not
+// change the meaning of a document.
+// CDATA is equal to CharData with the same text, a Declaration is equal to the
+// equivalent ProcInst, and SourceTokens are compared by the tokens they carry.
+func Equal(t1, t2 Token) bool {
+	t1, t2 = equalForm(t1), equalForm(t2)
+	switch a := t1.(type) {
+	case nil:
+		return t2 == nil
+	case StartElement:
+		b, ok := t2.(StartElement)
+		return ok && nameEqual(a.Name, b.Name) && attrsEqual(a.Attr, b.Attr)
+	case EndElement:
+		b, ok := t2.(EndElement)
+		return ok && nameEqual(a.Name, b.Name)
+	case CharData:
+		b, ok := t2.(CharData)
+		return ok && bytes.Equal(a, b)
+	case Comment:
+		b, ok := t2.(Comment)
+		return ok && bytes.Equal(a, b)
+	case Directive:
+		b, ok := t2.(Directive)
+		return ok && bytes.Equal(a, b)
+	case ProcInst:
+		b, ok := t2.(ProcInst)
+		return ok && a.Target == b.Target && bytes.Equal(a.Inst, b.Inst)
+	}
+	return false
+}
+
+// equalForm converts tokens that have more than one representation into a
+// single form for comparison.
+func equalForm(tok Token) Token {
+	switch t := unwrapSource(tok).(type) {
+	case CDATA:
+		return CharData(t)
+	case Declaration:
+		return t.ProcInst()
+	default:
+		return t
+	}
+}
+
+func attrsEqual(a, b []Attr) bool {
+	a, b = sortedAttrs(a), sortedAttrs(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !nameEqual(a[i].Name, b[i].Name) || a[i].Value != b[i].Value {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedAttrs returns a sorted copy of attr without any namespace
+// declarations.
+func sortedAttrs(attr []Attr) []Attr {
+	out := make([]Attr, 0, len(attr))
+	for _, a := range attr {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		if a.Name.Space == "xml" {
+			a.Name.Space = xmlURL
+		}
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name.Space != out[j].Name.Space {
+			return out[i].Name.Space < out[j].Name.Space
+		}
+		if out[i].Name.Local != out[j].Name.Local {
+			return out[i].Name.Local < out[j].Name.Local
+		}
+		return out[i].Value < out[j].Value
+	})
+	return out
+}
+
+// EquivalentDocuments reports whether the documents read from a and b are
+// semantically equal.
+//
+// Both documents are canonicalized using Exclusive XML Canonicalization
+// without comments, and the canonical forms are then tokenized and compared
+// with Equal.
+// This ignores the XML declaration and DOCTYPE, comments, whitespace inside
+// of tags and outside of the root element, line endings, attribute order,
+// prefix spelling, and where namespaces are declared, while entities,
+// character references, and CDATA sections are compared by the text they
+// represent.
+// All other whitespace, including whitespace between elements, is significant.
+// If either document is malformed an error is returned.
+func EquivalentDocuments(a, b io.Reader) (bool, error) {
+	ca, err := canonicalForm(a)
+	if err != nil {
+		return false, err
+	}
+	cb, err := canonicalForm(b)
+	if err != nil {
+		return false, err
+	}
+	d, err := Diff(NewTokenizerBytes(ca), NewTokenizerBytes(cb))
+	if err != nil {
+		return false, err
+	}
+	return d == nil, nil
+}
+
+// canonicalForm returns the canonical form of the document read from r.
+func canonicalForm(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	c := NewCanonicalizer(&buf)
+	t := NewTokenizer(r)
+	for {
+		tok, err := t.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = c.EncodeToken(tok); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
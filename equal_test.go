@@ -0,0 +1,135 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var equalTestCases = [...]struct {
+	t1, t2 Token
+	equal  bool
+}{
+	0: {equal: true},
+	1: {t1: CharData("a"), t2: CharData("a"), equal: true},
+	2: {t1: CharData("a"), t2: CDATA("a"), equal: true},
+	3: {t1: CharData("a"), t2: Comment("a")},
+	4: {t1: CharData("a")},
+	5: {
+		t1: StartElement{
+			Name: Name{Space: "urn:a", Local: "a"},
+			Attr: []Attr{
+				{Name: Name{Local: "xmlns"}, Value: "urn:a"},
+				{Name: Name{Local: "b"}, Value: "1"},
+				{Name: Name{Space: "urn:c", Local: "c"}, Value: "2"},
+			},
+		},
+		t2: StartElement{
+			Name: Name{Space: "urn:a", Local: "a"},
+			Attr: []Attr{
+				{Name: Name{Space: "urn:c", Local: "c"}, Value: "2"},
+				{Name: Name{Space: "xmlns", Local: "x"}, Value: "urn:c"},
+				{Name: Name{Local: "b"}, Value: "1"},
+			},
+		},
+		equal: true,
+	},
+	6: {
+		t1: StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "b"}, Value: "1"}}},
+		t2: StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "b"}, Value: "2"}}},
+	},
+	7: {
+		t1: StartElement{Name: Name{Local: "a"}},
+		t2: StartElement{Name: Name{Space: "urn:a", Local: "a"}},
+	},
+	8: {
+		t1:    StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Space: "xml", Local: "lang"}, Value: "en"}}},
+		t2:    StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Space: "http://www.w3.org/XML/1998/namespace", Local: "lang"}, Value: "en"}}},
+		equal: true,
+	},
+	9:  {t1: EndElement{Name: Name{Local: "a"}}, t2: EndElement{Name: Name{Local: "a"}}, equal: true},
+	10: {t1: EndElement{Name: Name{Local: "a"}}, t2: StartElement{Name: Name{Local: "a"}}},
+	11: {t1: Declaration{Version: "1.0"}, t2: ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)}, equal: true},
+	12: {t1: ProcInst{Target: "a", Inst: []byte("b")}, t2: ProcInst{Target: "a", Inst: []byte("c")}},
+	13: {t1: Directive("DOCTYPE a"), t2: Directive("DOCTYPE a"), equal: true},
+	14: {t1: SourceToken{Token: Comment("a"), Source: []byte("<!--a-->")}, t2: Comment("a"), equal: true},
+}
+
+func TestEqual(t *testing.T) {
+	for i, tc := range equalTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if eq := Equal(tc.t1, tc.t2); eq != tc.equal {
+				t.Errorf("wrong result comparing %#v and %#v: want=%t, got=%t", tc.t1, tc.t2, tc.equal, eq)
+			}
+			if eq := Equal(tc.t2, tc.t1); eq != tc.equal {
+				t.Errorf("wrong result comparing %#v and %#v: want=%t, got=%t", tc.t2, tc.t1, tc.equal, eq)
+			}
+		})
+	}
+}
+
+func TestEqualPrefixes(t *testing.T) {
+	r1 := NewTokenizer(strings.NewReader(`<a:b xmlns:a="urn:a" a:c="d"/>`))
+	r2 := NewTokenizer(strings.NewReader(`<b xmlns="urn:a" xmlns:x="urn:a" x:c="d"/>`))
+	for {
+		t1, err1 := r1.Token()
+		t2, err2 := r2.Token()
+		if err1 != err2 {
+			t.Fatalf("mismatched errors: %v, %v", err1, err2)
+		}
+		if !Equal(t1, t2) {
+			t.Errorf("tokens not equal: %#v, %#v", t1, t2)
+		}
+		if err1 != nil {
+			break
+		}
+	}
+}
+
+var equivalentTestCases = [...]struct {
+	a, b  string
+	equal bool
+}{
+	0: {a: `<a/>`, b: `<a></a>`, equal: true},
+	1: {
+		a:     `<?xml version="1.0"?><a:b xmlns:a="urn:a" x="1" y="2"><!-- c --><a:c>&lt;d&gt;</a:c></a:b>`,
+		b:     "<b xmlns=\"urn:a\" y='2' x='1' ><c ><![CDATA[<d>]]></c></b>\n",
+		equal: true,
+	},
+	2:  {a: `<a> b </a>`, b: `<a>b</a>`},
+	3:  {a: `<a xml:space="preserve"> </a>`, b: `<a xml:space="preserve"></a>`},
+	4:  {a: `<a xmlns="urn:a"/>`, b: `<a xmlns="urn:b"/>`},
+	5:  {a: `<a><b/></a>`, b: `<a><b/><b/></a>`},
+	6:  {a: `<a> </a>`, b: `<a/>`},
+	7:  {a: "<a>\n\t<b/>\n</a>", b: `<a><b/></a>`},
+	8:  {a: "<a b='c\r\nd'>\r\ne\rf</a>\r\n", b: "<a b='c d'>\ne\nf</a>", equal: true},
+	9:  {a: "<a>\r\n</a>", b: "<a>&#xD;\n</a>"},
+	10: {a: `<!DOCTYPE a [<!ATTLIST a b CDATA "c">]><a/>`, b: `<a b="c"/>`, equal: true},
+}
+
+func TestEquivalentDocuments(t *testing.T) {
+	for i, tc := range equivalentTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			eq, err := EquivalentDocuments(strings.NewReader(tc.a), strings.NewReader(tc.b))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if eq != tc.equal {
+				t.Errorf("wrong result: want=%t, got=%t", tc.equal, eq)
+			}
+		})
+	}
+}
+
+func TestEquivalentDocumentsError(t *testing.T) {
+	_, err := EquivalentDocuments(strings.NewReader(`<a><b c=></a>`), strings.NewReader(`<a><b c=></a>`))
+	if err == nil {
+		t.Errorf("expected error for malformed document")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// EscapeCharData returns s escaped for use as character data in element
+// content.
+// Only the characters that must be escaped are replaced: "&", "<", the ">" in
+// "]]>", and carriage returns (which would otherwise be normalized away when
+// the output is parsed).
+// Characters that are not allowed in XML are replaced with the Unicode
+// replacement character.
+func EscapeCharData(s string) string {
+	var b strings.Builder
+	/* #nosec */
+	escape(&b, []byte(s), false)
+	return b.String()
+}
+
+// EscapeAttr returns s escaped for use as an attribute value surrounded by
+// double quotes.
+// Only the characters that must be escaped are replaced: "&", "<", the double
+// quote, and tabs, newlines, and carriage returns (which would otherwise be
+// normalized to spaces when the output is parsed).
+// Characters that are not allowed in XML are replaced with the Unicode
+// replacement character.
+func EscapeAttr(s string) string {
+	var b strings.Builder
+	/* #nosec */
+	escape(&b, []byte(s), true)
+	return b.String()
+}
+
+// WriteEscapedCharData writes s to w escaped in the same way as
+// EscapeCharData.
+// A "]]>" that is split across multiple calls is not detected.
+func WriteEscapedCharData(w io.Writer, s []byte) error {
+	return escape(w, s, false)
+}
+
+// WriteEscapedAttr writes s to w escaped in the same way as EscapeAttr.
+func WriteEscapedAttr(w io.Writer, s []byte) error {
+	return escape(w, s, true)
+}
+
+func escape(w io.Writer, s []byte, attr bool) error {
+	var last int
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRune(s[i:])
+		var esc string
+		switch {
+		case r == '&':
+			esc = "&amp;"
+		case r == '<':
+			esc = "&lt;"
+		case r == '>' && !attr && i >= 2 && s[i-1] == ']' && s[i-2] == ']':
+			esc = "&gt;"
+		case r == '\r':
+			esc = "&#xD;"
+		case r == '"' && attr:
+			esc = "&quot;"
+		case r == '\t' && attr:
+			esc = "&#x9;"
+		case r == '\n' && attr:
+			esc = "&#xA;"
+		case (r == utf8.RuneError && width == 1) || !isInCharacterRange(r):
+			esc = "\uFFFD"
+		default:
+			i += width
+			continue
+		}
+		if _, err := w.Write(s[last:i]); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, esc); err != nil {
+			return err
+		}
+		i += width
+		last = i
+	}
+	_, err := w.Write(s[last:])
+	return err
+}
@@ -0,0 +1,55 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var escapeTestCases = []struct {
+	in       string
+	charData string
+	attr     string
+}{
+	0: {in: "abc", charData: "abc", attr: "abc"},
+	1: {in: `a&b<c>d`, charData: `a&amp;b&lt;c>d`, attr: `a&amp;b&lt;c>d`},
+	2: {in: `]]>`, charData: `]]&gt;`, attr: `]]>`},
+	3: {in: `"'`, charData: `"'`, attr: `&quot;'`},
+	4: {in: "a\tb\nc\rd", charData: "a\tb\nc&#xD;d", attr: "a&#x9;b&#xA;c&#xD;d"},
+	5: {in: "a\x00b\xffc白", charData: "a\uFFFDb\uFFFDc白", attr: "a\uFFFDb\uFFFDc白"},
+}
+
+func TestEscape(t *testing.T) {
+	for i, tc := range escapeTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if s := EscapeCharData(tc.in); s != tc.charData {
+				t.Errorf("wrong character data escaping: want=%q, got=%q", tc.charData, s)
+			}
+			if s := EscapeAttr(tc.in); s != tc.attr {
+				t.Errorf("wrong attribute escaping: want=%q, got=%q", tc.attr, s)
+			}
+			var buf strings.Builder
+			err := WriteEscapedCharData(&buf, []byte(tc.in))
+			if err != nil {
+				t.Fatalf("unexpected error writing character data: %v", err)
+			}
+			if s := buf.String(); s != tc.charData {
+				t.Errorf("wrong written character data: want=%q, got=%q", tc.charData, s)
+			}
+			buf.Reset()
+			err = WriteEscapedAttr(&buf, []byte(tc.in))
+			if err != nil {
+				t.Fatalf("unexpected error writing attribute: %v", err)
+			}
+			if s := buf.String(); s != tc.attr {
+				t.Errorf("wrong written attribute: want=%q, got=%q", tc.attr, s)
+			}
+		})
+	}
+}
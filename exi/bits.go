@@ -0,0 +1,126 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package exi
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	errOverflow = errors.New("exi: unsigned integer overflows")
+	errRune     = errors.New("exi: invalid character")
+)
+
+// bitWriter writes bit-packed values most significant bit first.
+type bitWriter struct {
+	w   *bufio.Writer
+	cur byte
+	n   uint
+}
+
+func (b *bitWriter) writeBits(v uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.cur = b.cur<<1 | byte(v>>uint(i)&1)
+		b.n++
+		if b.n == 8 {
+			/* #nosec */
+			b.w.WriteByte(b.cur)
+			b.cur, b.n = 0, 0
+		}
+	}
+}
+
+// writeUint writes an EXI Unsigned Integer as a sequence of octets that each
+// hold 7 bits, least significant first.
+func (b *bitWriter) writeUint(v uint64) {
+	for {
+		c := v & 0x7f
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		b.writeBits(c, 8)
+		if v == 0 {
+			return
+		}
+	}
+}
+
+// writeChars writes the characters of s without a length.
+func (b *bitWriter) writeChars(s string) {
+	for _, r := range s {
+		b.writeUint(uint64(r))
+	}
+}
+
+// pad fills the rest of the current byte with zeros.
+func (b *bitWriter) pad() {
+	if b.n > 0 {
+		b.writeBits(0, int(8-b.n))
+	}
+}
+
+// bitReader reads bit-packed values most significant bit first.
+type bitReader struct {
+	r   io.ByteReader
+	cur byte
+	n   uint
+}
+
+func (b *bitReader) readBits(n int) (uint64, error) {
+	var v uint64
+	for i := 0; i < n; i++ {
+		if b.n == 0 {
+			c, err := b.r.ReadByte()
+			if err == io.EOF {
+				return 0, io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			b.cur, b.n = c, 8
+		}
+		b.n--
+		v = v<<1 | uint64(b.cur>>b.n&1)
+	}
+	return v, nil
+}
+
+func (b *bitReader) readUint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		c, err := b.readBits(8)
+		if err != nil {
+			return 0, err
+		}
+		if shift > 63 || (shift > 56 && c&0x7f > 1) {
+			return 0, errOverflow
+		}
+		v |= (c & 0x7f) << shift
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// readChars reads n characters.
+func (b *bitReader) readChars(n uint64) (string, error) {
+	var s strings.Builder
+	for ; n > 0; n-- {
+		r, err := b.readUint()
+		if err != nil {
+			return "", err
+		}
+		if r > utf8.MaxRune || !utf8.ValidRune(rune(r)) {
+			return "", errRune
+		}
+		s.WriteRune(rune(r))
+	}
+	return s.String(), nil
+}
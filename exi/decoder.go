@@ -0,0 +1,284 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package exi
+
+import (
+	"bufio"
+	"errors"
+	"io"
+
+	"mellium.im/xml"
+)
+
+var (
+	errEventCode = errors.New("exi: invalid event code")
+	errCompactID = errors.New("exi: invalid string table reference")
+)
+
+// Decoder reads tokens from an EXI input stream.
+type Decoder struct {
+	r        bitReader
+	tab      *stringTable
+	grammars map[xml.Name]*grammar
+	stack    []element
+	start    *xml.StartElement
+	queue    []xml.Token
+	started  bool
+	done     bool
+	err      error
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &Decoder{
+		r:        bitReader{r: br},
+		tab:      newStringTable(),
+		grammars: make(map[xml.Name]*grammar),
+	}
+}
+
+// Token returns the next token in the stream.
+// At the end of the document it returns io.EOF.
+func (d *Decoder) Token() (xml.Token, error) {
+	for len(d.queue) == 0 && d.err == nil {
+		if d.done {
+			d.err = io.EOF
+			break
+		}
+		d.err = d.step()
+	}
+	if len(d.queue) > 0 {
+		tok := d.queue[0]
+		d.queue = d.queue[1:]
+		return tok, nil
+	}
+	return nil, d.err
+}
+
+// step decodes the next event and queues any resulting tokens.
+func (d *Decoder) step() error {
+	if !d.started {
+		d.started = true
+		if err := d.readHeader(); err != nil {
+			return err
+		}
+		name, err := d.readQName()
+		if err != nil {
+			return err
+		}
+		d.push(name)
+		return nil
+	}
+
+	el := &d.stack[len(d.stack)-1]
+	content := el.content
+	kind, name, generic, err := d.event(el)
+	if err != nil {
+		return err
+	}
+	if generic {
+		if kind == eventSE || kind == eventAT {
+			name, err = d.readQName()
+			if err != nil {
+				return err
+			}
+		}
+		el.g.learn(content, production{kind: kind, name: name})
+	}
+	if kind == eventAT {
+		value, err := d.readValue(name)
+		if err != nil {
+			return err
+		}
+		d.start.Attr = append(d.start.Attr, xml.Attr{Name: external(name), Value: value})
+		return nil
+	}
+	if d.start != nil {
+		d.queue = append(d.queue, *d.start)
+		d.start = nil
+	}
+	switch kind {
+	case eventSE:
+		el.content = true
+		d.push(name)
+	case eventCH:
+		el.content = true
+		value, err := d.readValue(el.name)
+		if err != nil {
+			return err
+		}
+		d.queue = append(d.queue, xml.CharData(value))
+	case eventEE:
+		d.queue = append(d.queue, xml.EndElement{Name: external(el.name)})
+		d.stack = d.stack[:len(d.stack)-1]
+		// The ED event is the only production of DocEnd.
+		d.done = len(d.stack) == 0
+	}
+	return nil
+}
+
+func (d *Decoder) readHeader() error {
+	b, err := d.r.readBits(8)
+	if err != nil {
+		return err
+	}
+	if b == uint64(cookie[0]) {
+		for i := 1; i < len(cookie); i++ {
+			c, err := d.r.readBits(8)
+			if err != nil {
+				return err
+			}
+			if c != uint64(cookie[i]) {
+				return errHeader
+			}
+		}
+		b, err = d.r.readBits(8)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case b>>6 != header>>6:
+		return errHeader
+	case b&0x20 != 0:
+		return errOptions
+	case b&0x1f != header&0x1f:
+		return errors.New("exi: unsupported version")
+	}
+	return nil
+}
+
+func (d *Decoder) push(name xml.Name) {
+	g, ok := d.grammars[name]
+	if !ok {
+		g = &grammar{}
+		d.grammars[name] = g
+	}
+	d.stack = append(d.stack, element{name: name, g: g})
+	d.start = &xml.StartElement{Name: external(name)}
+}
+
+// event reads an event code in the current grammar of el.
+// It reports whether the event was matched by a generic production, in which
+// case the qname of SE and AT events must be read and the production learned.
+func (d *Decoder) event(el *element) (eventKind, xml.Name, bool, error) {
+	learned := el.g.start
+	extra := 1
+	if el.content {
+		learned = el.g.content
+		extra = 2
+	}
+	code, err := d.r.readBits(bitsFor(len(learned) + extra))
+	if err != nil {
+		return 0, xml.Name{}, false, err
+	}
+	switch {
+	case code < uint64(len(learned)):
+		p := learned[code]
+		return p.kind, p.name, false, nil
+	case el.content && code == uint64(len(learned)):
+		return eventEE, xml.Name{}, false, nil
+	case code != uint64(len(learned)+extra-1):
+		return 0, xml.Name{}, false, errEventCode
+	}
+	second := startEvents
+	if el.content {
+		second = contentEvents
+	}
+	code, err = d.r.readBits(bitsFor(len(second)))
+	if err != nil {
+		return 0, xml.Name{}, false, err
+	}
+	if code >= uint64(len(second)) {
+		return 0, xml.Name{}, false, errEventCode
+	}
+	return second[code], xml.Name{}, true, nil
+}
+
+func (d *Decoder) readQName() (xml.Name, error) {
+	t := d.tab
+	u, err := d.r.readBits(bitsFor(len(t.uris.strs) + 1))
+	if err != nil {
+		return xml.Name{}, err
+	}
+	var uri int
+	if u == 0 {
+		s, err := d.readString()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		uri = t.addURI(s)
+	} else {
+		if u > uint64(len(t.uris.strs)) {
+			return xml.Name{}, errCompactID
+		}
+		uri = int(u - 1)
+	}
+	locals := t.locals[uri]
+	name := xml.Name{Space: t.uris.strs[uri]}
+	n, err := d.r.readUint()
+	if err != nil {
+		return name, err
+	}
+	if n == 0 {
+		name.Local, err = d.readCompactID(locals)
+		return name, err
+	}
+	name.Local, err = d.r.readChars(n - 1)
+	if err != nil {
+		return name, err
+	}
+	locals.add(name.Local)
+	return name, nil
+}
+
+func (d *Decoder) readValue(name xml.Name) (string, error) {
+	n, err := d.r.readUint()
+	if err != nil {
+		return "", err
+	}
+	switch n {
+	case 0:
+		return d.readCompactID(d.tab.localValues(name))
+	case 1:
+		return d.readCompactID(&d.tab.global)
+	}
+	s, err := d.r.readChars(n - 2)
+	if err != nil {
+		return "", err
+	}
+	d.tab.addValue(name, s)
+	return s, nil
+}
+
+// readString reads a length prefixed string.
+func (d *Decoder) readString() (string, error) {
+	n, err := d.r.readUint()
+	if err != nil {
+		return "", err
+	}
+	return d.r.readChars(n)
+}
+
+func (d *Decoder) readCompactID(p *partition) (string, error) {
+	i, err := d.r.readBits(bitsFor(len(p.strs)))
+	if err != nil {
+		return "", err
+	}
+	if i >= uint64(len(p.strs)) {
+		return "", errCompactID
+	}
+	return p.strs[i], nil
+}
+
+// external returns the name with the XML namespace reported as "xml".
+func external(name xml.Name) xml.Name {
+	name.Space = fromURI(name.Space)
+	return name
+}
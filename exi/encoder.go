@@ -0,0 +1,203 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package exi
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf8"
+
+	"mellium.im/xml"
+)
+
+// Encoder writes tokens to an output stream as EXI.
+//
+// The stream is complete once the end of the root element has been encoded and
+// Flush has been called.
+// Until then Flush only writes complete bytes.
+type Encoder struct {
+	w        bitWriter
+	tab      *stringTable
+	grammars map[xml.Name]*grammar
+	stack    []element
+	text     []byte
+	started  bool
+	done     bool
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:        bitWriter{w: bufio.NewWriter(w)},
+		tab:      newStringTable(),
+		grammars: make(map[xml.Name]*grammar),
+	}
+}
+
+// EncodeToken writes the given token.
+// Comments, processing instructions, directives, namespace declarations, and
+// character data outside of the root element are discarded.
+func (e *Encoder) EncodeToken(t xml.Token) error {
+	if st, ok := t.(xml.SourceToken); ok {
+		t = st.Token
+	}
+	switch t := t.(type) {
+	case xml.CharData:
+		if len(e.stack) > 0 {
+			e.text = append(e.text, t...)
+		}
+	case xml.CDATA:
+		if len(e.stack) > 0 {
+			e.text = append(e.text, t...)
+		}
+	case xml.StartElement:
+		if e.done {
+			return errMultipleRoots
+		}
+		e.flushText()
+		name := xml.Name{Space: toURI(t.Name.Space), Local: t.Name.Local}
+		if len(e.stack) == 0 {
+			if !e.started {
+				e.w.writeBits(header, 8)
+				e.started = true
+			}
+			// The SD event and the SE(*) event of DocContent are the only productions
+			// of their non-terminals, so their event codes have no bits.
+			e.encodeQName(name)
+		} else if e.event(&e.stack[len(e.stack)-1], eventSE, name) {
+			e.encodeQName(name)
+		}
+		g, ok := e.grammars[name]
+		if !ok {
+			g = &grammar{}
+			e.grammars[name] = g
+		}
+		e.stack = append(e.stack, element{name: name, g: g})
+		el := &e.stack[len(e.stack)-1]
+		for _, a := range t.Attr {
+			if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+				continue
+			}
+			aname := xml.Name{Space: toURI(a.Name.Space), Local: a.Name.Local}
+			if e.event(el, eventAT, aname) {
+				e.encodeQName(aname)
+			}
+			e.encodeValue(aname, a.Value)
+		}
+	case xml.EndElement:
+		if len(e.stack) == 0 {
+			return errNoElement
+		}
+		e.flushText()
+		e.event(&e.stack[len(e.stack)-1], eventEE, xml.Name{})
+		e.stack = e.stack[:len(e.stack)-1]
+		if len(e.stack) == 0 {
+			// The ED event is the only production of DocEnd.
+			e.w.pad()
+			e.done = true
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered bytes to the underlying writer.
+func (e *Encoder) Flush() error {
+	return e.w.w.Flush()
+}
+
+func (e *Encoder) flushText() {
+	if len(e.text) == 0 {
+		return
+	}
+	el := &e.stack[len(e.stack)-1]
+	e.event(el, eventCH, xml.Name{})
+	e.encodeValue(el.name, string(e.text))
+	e.text = e.text[:0]
+}
+
+// event writes the event code for an event in the current grammar of el and
+// moves el to the next non-terminal.
+// It reports whether the event was matched by a generic production, in which
+// case the qname of SE and AT events must be written.
+func (e *Encoder) event(el *element, kind eventKind, name xml.Name) bool {
+	generic := e.eventCode(el, kind, name)
+	if kind == eventSE || kind == eventCH {
+		el.content = true
+	}
+	return generic
+}
+
+func (e *Encoder) eventCode(el *element, kind eventKind, name xml.Name) bool {
+	learned := el.g.start
+	extra := 1
+	if el.content {
+		learned = el.g.content
+		extra = 2
+	}
+	bits := bitsFor(len(learned) + extra)
+	for i, p := range learned {
+		if p.match(kind, name) {
+			e.w.writeBits(uint64(i), bits)
+			return false
+		}
+	}
+	if el.content && kind == eventEE {
+		e.w.writeBits(uint64(len(learned)), bits)
+		return false
+	}
+	second := startEvents
+	if el.content {
+		second = contentEvents
+	}
+	e.w.writeBits(uint64(len(learned)+extra-1), bits)
+	for i, k := range second {
+		if k == kind {
+			e.w.writeBits(uint64(i), bitsFor(len(second)))
+		}
+	}
+	el.g.learn(el.content, production{kind: kind, name: name})
+	return true
+}
+
+func (e *Encoder) encodeQName(name xml.Name) {
+	t := e.tab
+	bits := bitsFor(len(t.uris.strs) + 1)
+	uri, ok := t.uris.lookup(name.Space)
+	if ok {
+		e.w.writeBits(uint64(uri+1), bits)
+	} else {
+		e.w.writeBits(0, bits)
+		e.w.writeUint(uint64(utf8.RuneCountInString(name.Space)))
+		e.w.writeChars(name.Space)
+		uri = t.addURI(name.Space)
+	}
+	locals := t.locals[uri]
+	if i, ok := locals.lookup(name.Local); ok {
+		e.w.writeUint(0)
+		e.w.writeBits(uint64(i), bitsFor(len(locals.strs)))
+		return
+	}
+	e.w.writeUint(uint64(utf8.RuneCountInString(name.Local)) + 1)
+	e.w.writeChars(name.Local)
+	locals.add(name.Local)
+}
+
+func (e *Encoder) encodeValue(name xml.Name, v string) {
+	t := e.tab
+	local := t.localValues(name)
+	if i, ok := local.lookup(v); ok {
+		e.w.writeUint(0)
+		e.w.writeBits(uint64(i), bitsFor(len(local.strs)))
+		return
+	}
+	if i, ok := t.global.lookup(v); ok {
+		e.w.writeUint(1)
+		e.w.writeBits(uint64(i), bitsFor(len(t.global.strs)))
+		return
+	}
+	e.w.writeUint(uint64(utf8.RuneCountInString(v)) + 2)
+	e.w.writeChars(v)
+	t.addValue(name, v)
+}
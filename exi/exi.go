@@ -0,0 +1,184 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package exi implements the W3C Efficient XML Interchange (EXI) format.
+//
+// EXI is a compact binary representation of XML designed for constrained
+// devices and networks.
+// This package implements a subset of EXI 1.0: streams are encoded without a
+// schema using the built-in grammars, bit-packed alignment, and the default
+// options, and EXI options headers are not supported.
+// Because the default options do not preserve comments, processing
+// instructions, DTDs, or namespace prefixes, these are discarded when encoding
+// and names are reported with their namespace only when decoding.
+// Attributes such as xsi:type that are given special treatment by EXI are
+// encoded like any other attribute.
+package exi // import "mellium.im/xml/exi"
+
+import (
+	"errors"
+
+	"mellium.im/xml"
+)
+
+const (
+	xmlURL = "http://www.w3.org/XML/1998/namespace"
+	xsiURL = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+// header is the distinguishing bits, the presence bit for options (unset), and
+// the format version (final version 1) of an EXI header.
+const header = 0x80
+
+// cookie is the optional EXI cookie that may precede the header.
+const cookie = "$EXI"
+
+var (
+	errMultipleRoots = errors.New("exi: multiple root elements")
+	errNoElement     = errors.New("exi: end element outside of an element")
+	errOptions       = errors.New("exi: options are not supported")
+	errHeader        = errors.New("exi: invalid header")
+)
+
+type eventKind int
+
+const (
+	eventEE eventKind = iota
+	eventAT
+	eventSE
+	eventCH
+)
+
+// production is an event that has been learned by a built-in element grammar.
+type production struct {
+	kind eventKind
+	name xml.Name
+}
+
+func (p production) match(kind eventKind, name xml.Name) bool {
+	if p.kind != kind {
+		return false
+	}
+	return (kind != eventAT && kind != eventSE) || p.name == name
+}
+
+// grammar is the built-in element grammar of an element name.
+// The learned productions of each of its non-terminals are stored most recent
+// first, which is the order of their event codes.
+type grammar struct {
+	start   []production
+	content []production
+}
+
+func (g *grammar) learn(content bool, p production) {
+	if content {
+		g.content = append([]production{p}, g.content...)
+		return
+	}
+	g.start = append([]production{p}, g.start...)
+}
+
+// element is an element that is being encoded or decoded.
+type element struct {
+	name xml.Name
+	g    *grammar
+	// content is true if the element is using the ElementContent non-terminal
+	// of its grammar instead of StartTagContent.
+	content bool
+}
+
+// The second level event codes of the StartTagContent and ElementContent
+// non-terminals of the built-in element grammars with the default options.
+var (
+	startEvents   = []eventKind{eventEE, eventAT, eventSE, eventCH}
+	contentEvents = []eventKind{eventSE, eventCH}
+)
+
+// bitsFor returns the number of bits needed to represent n distinct values.
+func bitsFor(n int) int {
+	bits := 0
+	for (1 << bits) < n {
+		bits++
+	}
+	return bits
+}
+
+// partition is a partition of the string table.
+type partition struct {
+	strs  []string
+	index map[string]int
+}
+
+func (p *partition) add(s string) {
+	if p.index == nil {
+		p.index = make(map[string]int)
+	}
+	p.index[s] = len(p.strs)
+	p.strs = append(p.strs, s)
+}
+
+func (p *partition) lookup(s string) (int, bool) {
+	i, ok := p.index[s]
+	return i, ok
+}
+
+// stringTable is the string table shared by the encoder and decoder.
+type stringTable struct {
+	uris   partition
+	locals []*partition
+	global partition
+	values map[xml.Name]*partition
+}
+
+func newStringTable() *stringTable {
+	t := &stringTable{values: make(map[xml.Name]*partition)}
+	t.addURI("")
+	t.addURI(xmlURL, "base", "id", "lang", "space")
+	t.addURI(xsiURL, "nil", "type")
+	return t
+}
+
+func (t *stringTable) addURI(uri string, locals ...string) int {
+	t.uris.add(uri)
+	p := &partition{}
+	for _, l := range locals {
+		p.add(l)
+	}
+	t.locals = append(t.locals, p)
+	return len(t.uris.strs) - 1
+}
+
+func (t *stringTable) localValues(name xml.Name) *partition {
+	p, ok := t.values[name]
+	if !ok {
+		p = &partition{}
+		t.values[name] = p
+	}
+	return p
+}
+
+// addValue adds a value that was not found in the table.
+func (t *stringTable) addValue(name xml.Name, v string) {
+	if v == "" {
+		return
+	}
+	t.global.add(v)
+	t.localValues(name).add(v)
+}
+
+// toURI and fromURI convert between the "xml" namespace used by the tokenizer
+// and its URI.
+func toURI(space string) string {
+	if space == "xml" {
+		return xmlURL
+	}
+	return space
+}
+
+func fromURI(uri string) string {
+	if uri == xmlURL {
+		return "xml"
+	}
+	return uri
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package exi_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/exi"
+)
+
+var roundTripTestCases = [...]struct {
+	in  string
+	out string
+}{
+	0: {in: `<a/>`, out: `<a></a>`},
+	1: {in: `<a b="1" c="">text</a>`},
+	2: {
+		in:  `<?xml version="1.0"?><!-- c --><feed xmlns="urn:feed"><entry id="1">x</entry><?pi?><entry id="2">x</entry><entry id="1"><![CDATA[<y>]]></entry></feed>`,
+		out: `<feed xmlns="urn:feed"><entry id="1">x</entry><entry id="2">x</entry><entry id="1">&lt;y&gt;</entry></feed>`,
+	},
+	3: {
+		in:  `<a xml:lang="en" xmlns:x="urn:x" x:b="1"><x:c>é☃😀</x:c><x:c/>` + "\n" + `</a>`,
+		out: `<a xmlns:ns1="urn:x" xml:lang="en" ns1:b="1"><ns1:c>é☃😀</ns1:c><ns1:c></ns1:c>` + "\n</a>",
+	},
+	4: {in: `<a><b><c>1</c></b><b><c>2</c><c>1</c></b>tail</a>`},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for i, tc := range roundTripTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			e := NewEncoder(&buf)
+			r := xml.NewTokenizer(strings.NewReader(tc.in))
+			for {
+				tok, err := r.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("error tokenizing: %v", err)
+				}
+				if err = e.EncodeToken(tok); err != nil {
+					t.Fatalf("error encoding: %v", err)
+				}
+			}
+			if err := e.Flush(); err != nil {
+				t.Fatalf("error flushing: %v", err)
+			}
+			if len(tc.in) > 50 && buf.Len() >= len(tc.in) {
+				t.Errorf("encoded %d bytes of XML as %d bytes", len(tc.in), buf.Len())
+			}
+
+			var out strings.Builder
+			enc := xml.NewEncoder(&out)
+			d := NewDecoder(&buf)
+			for {
+				tok, err := d.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("error decoding: %v", err)
+				}
+				if err = enc.EncodeToken(tok); err != nil {
+					t.Fatalf("error encoding XML: %v", err)
+				}
+			}
+			if err := enc.Flush(); err != nil {
+				t.Fatalf("error flushing XML: %v", err)
+			}
+			want := tc.out
+			if want == "" {
+				want = tc.in
+			}
+			if s := out.String(); s != want {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", want, s)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf)
+	for _, tok := range []xml.Token{
+		xml.StartElement{Name: xml.Name{Local: "a"}},
+		xml.EndElement{Name: xml.Name{Local: "a"}},
+	} {
+		if err := e.EncodeToken(tok); err != nil {
+			t.Fatalf("error encoding: %v", err)
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+	// Header, URI hit for "" (01), local name miss with length 1+1 and the
+	// character "a", the second level EE event code (0.00), and padding.
+	want := []byte{0x80, 0x40, 0x98, 0x40}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrong output: want=%#v, got=%#v", want, buf.Bytes())
+	}
+	err := e.EncodeToken(xml.StartElement{Name: xml.Name{Local: "b"}})
+	if err == nil {
+		t.Errorf("expected error encoding a second root element")
+	}
+}
+
+var decodeErrTestCases = [...]struct {
+	in  []byte
+	err error
+}{
+	0: {in: []byte{}, err: io.ErrUnexpectedEOF},
+	1: {in: []byte{0x40}, err: errors.New("exi: invalid header")},
+	2: {in: []byte{0xa0}, err: errors.New("exi: options are not supported")},
+	3: {in: []byte{0x81}, err: errors.New("exi: unsupported version")},
+	4: {in: []byte("$EX!\x80"), err: errors.New("exi: invalid header")},
+	5: {in: []byte{0x80, 0x40, 0x98}, err: io.ErrUnexpectedEOF},
+	6: {in: []byte{0x80, 0x40, 0x00}, err: errors.New("exi: invalid string table reference")},
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for i, tc := range decodeErrTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d := NewDecoder(bytes.NewReader(tc.in))
+			var err error
+			for err == nil {
+				_, err = d.Token()
+			}
+			if !errors.Is(err, tc.err) && err.Error() != tc.err.Error() {
+				t.Errorf("wrong error: want=%v, got=%v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestDecodeCookie(t *testing.T) {
+	d := NewDecoder(bytes.NewReader([]byte("$EXI\x80\x40\x98\x40")))
+	tok, err := d.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if start, ok := tok.(xml.StartElement); !ok || start.Name.Local != "a" {
+		t.Errorf("wrong token: %#v", tok)
+	}
+}
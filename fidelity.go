@@ -0,0 +1,108 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+)
+
+// writeSource writes the original input of st if it still matches the token.
+// It reports whether the input was written.
+func (e *RawEncoder) writeSource(st SourceToken) (bool, error) {
+	switch tok := st.Token.(type) {
+	case StartElement:
+		orig, ok := decodeSource(st.Source, e.doctype).(StartElement)
+		if !ok || len(orig.Attr) != len(tok.Attr) {
+			return false, nil
+		}
+		name, err := e.push(tok, &orig)
+		if err != nil {
+			return false, nil
+		}
+		match := name == rawName(orig.Name)
+		for i, a := range tok.Attr {
+			qname, err := e.qualify(a.Name, true, orig.Attr[i].Name.Space)
+			match = match && err == nil && a.Value == orig.Attr[i].Value && qname == rawName(orig.Attr[i].Name)
+		}
+		if !match {
+			e.pop()
+			return false, nil
+		}
+		e.scopes[len(e.scopes)-1].selfClose = bytes.HasSuffix(st.Source, []byte("/>"))
+	case EndElement:
+		if len(e.scopes) == 0 {
+			return false, nil
+		}
+		scope := e.scopes[len(e.scopes)-1]
+		if scope.selfClose {
+			// The end element was written as part of the start element.
+			return true, e.writeEnd(tok)
+		}
+		orig, ok := decodeSource(st.Source, e.doctype).(EndElement)
+		if !ok || scope.start != tok.Name || scope.name != rawName(orig.Name) {
+			return false, nil
+		}
+		e.pop()
+	case CharData:
+		orig, ok := decodeSource(st.Source, e.doctype).(CharData)
+		if !ok || !bytes.Equal(orig, tok) {
+			return false, nil
+		}
+	case Comment:
+		orig, ok := decodeSource(st.Source, e.doctype).(Comment)
+		if !ok || !bytes.Equal(orig, tok) {
+			return false, nil
+		}
+	case Directive:
+		orig, ok := decodeSource(st.Source, e.doctype).(Directive)
+		if !ok || !bytes.Equal(orig, tok) {
+			return false, nil
+		}
+	case ProcInst:
+		orig, ok := decodeSource(st.Source, e.doctype).(ProcInst)
+		if !ok || orig.Target != tok.Target || !bytes.Equal(orig.Inst, tok.Inst) {
+			return false, nil
+		}
+	case Declaration:
+		orig, ok := decodeSource(st.Source, e.doctype).(ProcInst)
+		if !ok || orig.Target != "xml" {
+			return false, nil
+		}
+		decl, err := parseDeclaration(orig)
+		if err != nil || decl != tok {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+	_, err := e.w.Write(st.Source)
+	return true, err
+}
+
+// decodeSource returns the token that src decodes to without resolving any
+// prefixes, or nil if it does not contain exactly one token.
+// If d is non-nil, entities and attributes declared by it are decoded as they
+// were by the tokenizer that src was read from.
+func decodeSource(src []byte, d *doctype) Token {
+	t := NewTokenizer(bytes.NewReader(src))
+	t.noResolve = true
+	t.doctype = d
+	tok, err := t.Token()
+	if err != nil {
+		return nil
+	}
+	if t.InputOffset() != int64(len(src)) {
+		return nil
+	}
+	return tok
+}
+
+// rawName returns the name as it appears in the input.
+func rawName(n Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
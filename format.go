@@ -0,0 +1,75 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFormatText is the number of bytes of text and attribute values that are
+// shown by FormatToken before they are truncated.
+const maxFormatText = 40
+
+// FormatToken returns a compact description of a token that is suitable for
+// log lines and test failures.
+// Each description starts with the kind of token, and text such as character
+// data and attribute values is quoted and truncated to a few dozen bytes
+// followed by its full length.
+// Names are shown with their namespace in braces, for example:
+//
+//	StartElement <{urn:example}a id="1">
+//	CharData "some text"
+//	Comment "a very long comment that goes on and on"... (120 bytes)
+//
+// Tokens wrapped in a SourceToken are formatted as the token they wrap.
+func FormatToken(tok Token) string {
+	switch tok := unwrapSource(tok).(type) {
+	case nil:
+		return "<nil>"
+	case StartElement:
+		var b strings.Builder
+		b.WriteString("StartElement <")
+		b.WriteString(describeName(tok.Name))
+		for _, a := range tok.Attr {
+			b.WriteByte(' ')
+			b.WriteString(describeName(a.Name))
+			b.WriteByte('=')
+			b.WriteString(formatText([]byte(a.Value)))
+		}
+		b.WriteByte('>')
+		return b.String()
+	case EndElement:
+		return "EndElement </" + describeName(tok.Name) + ">"
+	case CharData:
+		return "CharData " + formatText(tok)
+	case CDATA:
+		return "CDATA " + formatText(tok)
+	case Comment:
+		return "Comment " + formatText(tok)
+	case ProcInst:
+		return "ProcInst " + tok.Target + " " + formatText(tok.Inst)
+	case Declaration:
+		return "Declaration " + string(tok.ProcInst().Inst)
+	case Directive:
+		return "Directive " + formatText(tok)
+	}
+	return fmt.Sprintf("%T %v", tok, tok)
+}
+
+// formatText quotes b, truncating it without splitting a rune if it is too
+// long.
+func formatText(b []byte) string {
+	if len(b) <= maxFormatText {
+		return strconv.Quote(string(b))
+	}
+	n := maxFormatText
+	for n > 0 && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return strconv.Quote(string(b[:n])) + "... (" + strconv.Itoa(len(b)) + " bytes)"
+}
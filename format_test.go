@@ -0,0 +1,52 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var formatTokenTestCases = [...]struct {
+	tok Token
+	out string
+}{
+	0: {out: "<nil>"},
+	1: {
+		tok: StartElement{Name: Name{Space: "urn:a", Local: "a"}, Attr: []Attr{
+			{Name: Name{Local: "id"}, Value: `1"2`},
+			{Name: Name{Space: "urn:b", Local: "b"}, Value: ""},
+		}},
+		out: `StartElement <{urn:a}a id="1\"2" {urn:b}b="">`,
+	},
+	2: {tok: EndElement{Name: Name{Local: "a"}}, out: "EndElement </a>"},
+	3: {tok: CharData("a\nb"), out: `CharData "a\nb"`},
+	4: {
+		tok: CharData(strings.Repeat("a", 39) + "ééé"),
+		out: `CharData "` + strings.Repeat("a", 39) + `"... (45 bytes)`,
+	},
+	5: {tok: CDATA("x"), out: `CDATA "x"`},
+	6: {tok: Comment(" c "), out: `Comment " c "`},
+	7: {tok: ProcInst{Target: "foo", Inst: []byte("bar")}, out: `ProcInst foo "bar"`},
+	8: {tok: Declaration{Version: "1.0"}, out: `Declaration version="1.0"`},
+	9: {tok: Directive("DOCTYPE a"), out: `Directive "DOCTYPE a"`},
+	10: {
+		tok: SourceToken{Token: EndElement{Name: Name{Local: "a"}}, Source: []byte("</a >")},
+		out: "EndElement </a>",
+	},
+}
+
+func TestFormatToken(t *testing.T) {
+	for i, tc := range formatTokenTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if out := FormatToken(tc.tok); out != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+		})
+	}
+}
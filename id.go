@@ -0,0 +1,124 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// IDReader wraps a TokenReader and processes xml:id attributes as described
+// by the xml:id recommendation.
+//
+// The value of each xml:id attribute is normalized by removing leading and
+// trailing whitespace and collapsing other runs of whitespace into a single
+// space, and the normalized value is returned in place of the original.
+// It is an error if a normalized value is not an NCName or if it has already
+// been used in the document.
+// The span of each element with an ID is recorded if the underlying reader
+// reports spans, as a Tokenizer does.
+type IDReader struct {
+	r   TokenReader
+	ids map[string]Span
+}
+
+// NewIDReader returns an IDReader that reads from r.
+func NewIDReader(r TokenReader) *IDReader {
+	return &IDReader{r: r, ids: make(map[string]Span)}
+}
+
+// Token returns the next token from the underlying reader.
+func (r *IDReader) Token() (Token, error) {
+	tok, err := r.r.Token()
+	st, isSource := tok.(SourceToken)
+	if isSource {
+		tok = st.Token
+	}
+	start, ok := tok.(StartElement)
+	if !ok {
+		if isSource {
+			return st, err
+		}
+		return tok, err
+	}
+	for i, attr := range start.Attr {
+		if attr.Name.Local != "id" || (attr.Name.Space != "xml" && attr.Name.Space != xmlURL) {
+			continue
+		}
+		id := strings.Join(strings.FieldsFunc(attr.Value, func(r rune) bool {
+			return r < utf8.RuneSelf && isSpace(byte(r))
+		}), " ")
+		if !isNCName(id) {
+			return nil, fmt.Errorf("xml: invalid xml:id %q", attr.Value)
+		}
+		if _, dup := r.ids[id]; dup {
+			return nil, fmt.Errorf("xml: duplicate xml:id %q", id)
+		}
+		var span Span
+		if s, ok := r.r.(spanReader); ok {
+			span = s.Span()
+		}
+		r.ids[id] = span
+		if id != attr.Value {
+			start = start.Copy()
+			start.Attr[i].Value = id
+		}
+	}
+	if isSource {
+		st.Token = start
+		return st, err
+	}
+	return start, err
+}
+
+// Lookup returns the span of the start element with the given xml:id, if it
+// has been read.
+func (r *IDReader) Lookup(id string) (Span, bool) {
+	span, ok := r.ids[id]
+	return span, ok
+}
+
+// isNCName reports whether s is a name without a colon.
+func isNCName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !isNameStartChar(c) && (i == 0 || !isNameChar(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNameStartChar reports whether c may begin an NCName.
+func isNameStartChar(c rune) bool {
+	return c == '_' ||
+		'A' <= c && c <= 'Z' ||
+		'a' <= c && c <= 'z' ||
+		0xC0 <= c && c <= 0xD6 ||
+		0xD8 <= c && c <= 0xF6 ||
+		0xF8 <= c && c <= 0x2FF ||
+		0x370 <= c && c <= 0x37D ||
+		0x37F <= c && c <= 0x1FFF ||
+		0x200C <= c && c <= 0x200D ||
+		0x2070 <= c && c <= 0x218F ||
+		0x2C00 <= c && c <= 0x2FEF ||
+		0x3001 <= c && c <= 0xD7FF ||
+		0xF900 <= c && c <= 0xFDCF ||
+		0xFDF0 <= c && c <= 0xFFFD ||
+		0x10000 <= c && c <= 0xEFFFF
+}
+
+// isNameChar reports whether c may appear after the first character of an
+// NCName.
+func isNameChar(c rune) bool {
+	return isNameStartChar(c) ||
+		c == '-' || c == '.' || c == 0xB7 ||
+		'0' <= c && c <= '9' ||
+		0x300 <= c && c <= 0x36F ||
+		0x203F <= c && c <= 0x2040
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var idTestCases = [...]struct {
+	in  string
+	ids map[string]Span
+	out string
+	err string
+}{
+	0: {in: `<a/>`, ids: map[string]Span{}, out: `<a></a>`},
+	1: {
+		in: "<a xml:id='x'>\n<b xml:id=' \ty\n'/><c id='x'/></a>",
+		ids: map[string]Span{
+			"x": {Start: Pos{Line: 1, Col: 1}, End: Pos{Offset: 14, Line: 1, Col: 15}},
+			"y": {Start: Pos{Offset: 15, Line: 2, Col: 1}, End: Pos{Offset: 33, Line: 3, Col: 4}},
+		},
+		out: `<a xml:id="x">` + "\n" + `<b xml:id="y"></b><c id="x"></c></a>`,
+	},
+	2: {in: `<a xml:id="1"/>`, err: `xml: invalid xml:id "1"`},
+	3: {in: `<a xml:id="a:b"/>`, err: `xml: invalid xml:id "a:b"`},
+	4: {in: `<a xml:id="x"><b xml:id=" x"/></a>`, err: `xml: duplicate xml:id "x"`},
+	5: {in: `<a xml:id="é·1"/>`, ids: map[string]Span{"é·1": {Start: Pos{Line: 1, Col: 1}, End: Pos{Offset: 19, Line: 1, Col: 20}}}, out: `<a xml:id="é·1"></a>`},
+}
+
+func TestIDReader(t *testing.T) {
+	for i, tc := range idTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			r := NewIDReader(NewTokenizer(strings.NewReader(tc.in)))
+			var b strings.Builder
+			e := NewEncoder(&b)
+			var err error
+			for {
+				var tok Token
+				tok, err = r.Token()
+				if err != nil {
+					break
+				}
+				if err = e.EncodeToken(tok); err != nil {
+					t.Fatalf("error encoding: %v", err)
+				}
+			}
+			if err != io.EOF {
+				if err.Error() != tc.err {
+					t.Fatalf("wrong error: want=%s, got=%v", tc.err, err)
+				}
+				return
+			}
+			if tc.err != "" {
+				t.Fatalf("expected error %s", tc.err)
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("error flushing: %v", err)
+			}
+			if out := b.String(); out != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+			for id, want := range tc.ids {
+				span, ok := r.Lookup(id)
+				if !ok {
+					t.Errorf("ID %q not found", id)
+					continue
+				}
+				if span != want {
+					t.Errorf("wrong span for %q: want=%+v, got=%+v", id, want, span)
+				}
+			}
+			if _, ok := r.Lookup("missing"); ok {
+				t.Errorf("found ID that does not exist")
+			}
+		})
+	}
+}
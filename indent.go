@@ -0,0 +1,125 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bufio"
+	"io"
+)
+
+// Indent reads an XML document from src and writes it to dst with each
+// element, comment, processing instruction, and directive beginning on a new
+// line starting with prefix followed by one or more copies of indent according
+// to the nesting depth.
+// The document is processed one token at a time and is never loaded into
+// memory in its entirety.
+//
+// The input of every token is copied to dst unchanged, only whitespace between
+// tokens is removed or added.
+// Elements with xml:space="preserve" and elements that contain character data
+// that is not whitespace (mixed content) are copied from the point where they
+// are detected to their end tag without any changes.
+// Because the input is not buffered, a child element that appears before the
+// first non-whitespace character data of its parent will already have been
+// indented.
+func Indent(dst io.Writer, src io.Reader, prefix, indent string) error {
+	t := NewTokenizer(src)
+	t.SourceTokens = true
+	w := bufio.NewWriter(dst)
+
+	var (
+		// children records whether each open element has had indented content
+		// written to it.
+		children []bool
+		// verbatim is the depth of the element being copied unchanged, or 0.
+		verbatim int
+		ws       []byte
+		started  bool
+	)
+	newline := func() {
+		if started {
+			/* #nosec */
+			w.WriteByte('\n')
+		}
+		started = true
+		/* #nosec */
+		w.WriteString(prefix)
+		for i := 0; i < len(children); i++ {
+			/* #nosec */
+			w.WriteString(indent)
+		}
+		if len(children) > 0 {
+			children[len(children)-1] = true
+		}
+	}
+
+	for {
+		tok, err := t.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		st := tok.(SourceToken)
+		if verbatim > 0 {
+			switch st.Token.(type) {
+			case StartElement:
+				children = append(children, false)
+			case EndElement:
+				if len(children) == verbatim {
+					verbatim = 0
+				}
+				children = children[:len(children)-1]
+			}
+			/* #nosec */
+			w.Write(st.Source)
+			continue
+		}
+
+		switch tok := st.Token.(type) {
+		case CharData:
+			if onlySpace(st.Source) {
+				ws = append(ws, st.Source...)
+				continue
+			}
+			verbatim = len(children)
+			/* #nosec */
+			w.Write(ws)
+			/* #nosec */
+			w.Write(st.Source)
+			started = true
+		case StartElement:
+			newline()
+			/* #nosec */
+			w.Write(st.Source)
+			children = append(children, false)
+			for _, a := range tok.Attr {
+				if a.Name.Local == "space" && (a.Name.Space == "xml" || a.Name.Space == xmlURL) && a.Value == "preserve" {
+					verbatim = len(children)
+				}
+			}
+		case EndElement:
+			indented := len(children) > 0 && children[len(children)-1]
+			if len(children) > 0 {
+				children = children[:len(children)-1]
+			}
+			if len(st.Source) == 0 {
+				break
+			}
+			if indented {
+				newline()
+			}
+			/* #nosec */
+			w.Write(st.Source)
+		default:
+			newline()
+			/* #nosec */
+			w.Write(st.Source)
+		}
+		ws = ws[:0]
+	}
+	return w.Flush()
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var indentTestCases = []struct {
+	in     string
+	prefix string
+	indent string
+	out    string
+}{
+	0: {
+		in:     `<?xml version="1.0"?><a><b c='d'>e &amp; f</b><g/><h>  </h><!-- i --></a>`,
+		indent: "  ",
+		out: `<?xml version="1.0"?>
+<a>
+  <b c='d'>e &amp; f</b>
+  <g/>
+  <h></h>
+  <!-- i -->
+</a>`,
+	},
+	1: {
+		in: `<a>
+        <b>
+    <c></c></b>
+</a>`,
+		prefix: "> ",
+		indent: "\t",
+		out:    "> <a>\n> \t<b>\n> \t\t<c></c>\n> \t</b>\n> </a>",
+	},
+	2: {
+		in:     `<a><p>Some <b>bold</b> text.</p><pre xml:space="preserve">  x  <y/>  </pre></a>`,
+		indent: " ",
+		out:    "<a>\n <p>Some <b>bold</b> text.</p>\n <pre xml:space=\"preserve\">  x  <y/>  </pre>\n</a>",
+	},
+	3: {
+		in:     `<a><b/>  c<d/></a>`,
+		indent: " ",
+		out:    "<a>\n <b/>  c<d/></a>",
+	},
+	4: {
+		in:     `<a><![CDATA[ ]]></a>`,
+		indent: " ",
+		out:    "<a><![CDATA[ ]]></a>",
+	},
+}
+
+func TestIndent(t *testing.T) {
+	for i, tc := range indentTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf strings.Builder
+			err := Indent(&buf, strings.NewReader(tc.in), tc.prefix, tc.indent)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Fatalf("wrong output:\nwant=%q,\n got=%q", tc.out, s)
+			}
+		})
+	}
+}
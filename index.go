@@ -0,0 +1,142 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// IndexEntry is the location of an element recorded in an Index.
+type IndexEntry struct {
+	ElementRange
+
+	// Path contains the names of the element's ancestors followed by the name
+	// of the element itself.
+	Path []Name
+
+	// ID is the value of the element's xml:id attribute, or of its id attribute
+	// if it does not have one.
+	ID string
+}
+
+// Index maps elements to their locations in the input.
+type Index struct {
+	// Entries contains every indexed element in the order that their start
+	// elements appear in the input.
+	Entries []IndexEntry
+	ids     map[string]int
+}
+
+// Lookup returns the first indexed element with the given ID.
+func (idx *Index) Lookup(id string) (IndexEntry, bool) {
+	i, ok := idx.ids[id]
+	if !ok {
+		return IndexEntry{}, false
+	}
+	return idx.Entries[i], true
+}
+
+// Select returns the indexed elements that match p.
+// Unlike the Select function, elements nested inside of matching elements may
+// also be returned.
+func (idx *Index) Select(p *Path) []IndexEntry {
+	var entries []IndexEntry
+	for _, e := range idx.Entries {
+		if p.Match(e.Path) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Indexer is a TokenReader that builds an Index of the elements read from a
+// tokenizer as the tokens pass through it.
+type Indexer struct {
+	t    *Tokenizer
+	p    *Path
+	idx  Index
+	path []Name
+	open []int
+}
+
+// NewIndexer returns an Indexer that reads tokens from t and indexes the
+// elements that match p, or all elements if p is nil.
+func NewIndexer(t *Tokenizer, p *Path) *Indexer {
+	return &Indexer{t: t, p: p}
+}
+
+// Token returns the next token from the underlying tokenizer.
+func (i *Indexer) Token() (Token, error) {
+	tok, err := i.t.Token()
+	switch start := unwrapSource(tok).(type) {
+	case StartElement:
+		i.path = append(i.path, start.Name)
+		i.open = append(i.open, -1)
+		if i.p != nil && !i.p.Match(i.path) {
+			break
+		}
+		attr := start.Attr
+		if attr == nil {
+			var aerr error
+			attr, aerr = i.t.Attr()
+			if aerr != nil && err == nil {
+				err = aerr
+			}
+		}
+		e := IndexEntry{
+			ElementRange: ElementRange{
+				Name:  start.Name,
+				Start: i.t.Span().Start.Offset,
+				NS:    i.t.inherited(),
+			},
+			Path: append([]Name(nil), i.path...),
+		}
+		if id, ok := GetAttr(StartElement{Attr: attr}, Name{Space: xmlURL, Local: "id"}); ok {
+			e.ID = id
+		} else if id, ok := GetAttr(StartElement{Attr: attr}, Name{Local: "id"}); ok {
+			e.ID = id
+		}
+		n := len(i.idx.Entries)
+		i.idx.Entries = append(i.idx.Entries, e)
+		i.open[len(i.open)-1] = n
+		if e.ID != "" {
+			if i.idx.ids == nil {
+				i.idx.ids = make(map[string]int)
+			}
+			if _, ok := i.idx.ids[e.ID]; !ok {
+				i.idx.ids[e.ID] = n
+			}
+		}
+	case EndElement:
+		if len(i.open) == 0 {
+			break
+		}
+		if n := i.open[len(i.open)-1]; n >= 0 {
+			i.idx.Entries[n].End = i.t.InputOffset()
+		}
+		i.open = i.open[:len(i.open)-1]
+		i.path = i.path[:len(i.path)-1]
+	}
+	return tok, err
+}
+
+// Index returns the elements that have been indexed so far.
+// Elements that have not yet ended have an End offset of zero.
+func (i *Indexer) Index() *Index {
+	return &i.idx
+}
+
+// NewTokenizerAt returns a tokenizer that reads the element in e from r, which
+// must contain the input that e was found in.
+// Names in the element are resolved using the namespace declarations of its
+// ancestors in e.NS, and offsets are reported relative to the start of r
+// instead of the start of the element.
+// Line and column numbers are not known and start from 1.
+func NewTokenizerAt(r io.ReaderAt, e ElementRange) *Tokenizer {
+	t := NewTokenizer(io.NewSectionReader(r, e.Start, e.End-e.Start))
+	t.n = e.Start
+	t.inherit(e.NS)
+	return t
+}
@@ -0,0 +1,68 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestIndex(t *testing.T) {
+	const in = `<feed xmlns="urn:feed" xmlns:x="urn:x"><entry xml:id="a"><x:b/></entry><entry id="b"><c/></entry></feed>`
+	td := NewTokenizer(strings.NewReader(in))
+	td.LazyAttr = true
+	indexer := NewIndexer(td, MustCompilePath("entry", nil))
+	_, err := readAll(indexer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	idx := indexer.Index()
+
+	feed := Name{Space: "urn:feed", Local: "feed"}
+	entry := Name{Space: "urn:feed", Local: "entry"}
+	ns := []Attr{
+		{Name: Name{Local: "xmlns"}, Value: "urn:feed"},
+		{Name: Name{Space: "xmlns", Local: "x"}, Value: "urn:x"},
+	}
+	want := []IndexEntry{
+		{ElementRange: ElementRange{Name: entry, Start: 39, End: 71, NS: ns}, Path: []Name{feed, entry}, ID: "a"},
+		{ElementRange: ElementRange{Name: entry, Start: 71, End: 97, NS: ns}, Path: []Name{feed, entry}, ID: "b"},
+	}
+	if !reflect.DeepEqual(idx.Entries, want) {
+		t.Fatalf("wrong entries:\nwant=%+v,\n got=%+v", want, idx.Entries)
+	}
+	if e, ok := idx.Lookup("b"); !ok || !reflect.DeepEqual(e, want[1]) {
+		t.Errorf("wrong entry for ID b: want=%+v, got=%+v", want[1], e)
+	}
+	if _, ok := idx.Lookup("c"); ok {
+		t.Errorf("found entry for unknown ID")
+	}
+	if got := idx.Select(MustCompilePath("/feed/entry", nil)); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong selected entries:\nwant=%+v,\n got=%+v", want, got)
+	}
+
+	e, _ := idx.Lookup("a")
+	at := NewTokenizerAt(bytes.NewReader([]byte(in)), e.ElementRange)
+	toks, err := readAll(at)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantToks := []Token{
+		StartElement{Name: entry, Attr: []Attr{{Name: Name{Space: "xml", Local: "id"}, Value: "a"}}},
+		StartElement{Name: Name{Space: "urn:x", Local: "b"}, Attr: []Attr{}},
+		EndElement{Name: Name{Space: "urn:x", Local: "b"}},
+		EndElement{Name: entry},
+	}
+	if !reflect.DeepEqual(toks, wantToks) {
+		t.Errorf("wrong tokens:\nwant=%+v,\n got=%+v", wantToks, toks)
+	}
+	if off := at.InputOffset(); off != e.End {
+		t.Errorf("wrong offset at end of element: want=%d, got=%d", e.End, off)
+	}
+}
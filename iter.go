@@ -0,0 +1,109 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// ElementIter iterates over the child elements of an element.
+// It is created by Elements.
+type ElementIter struct {
+	r     TokenReader
+	start StartElement
+	cur   TokenReader
+	err   error
+	done  bool
+}
+
+// Elements returns an iterator over the child elements of the most recent
+// start element already consumed from r.
+// Tokens between the child elements, such as whitespace and comments, are
+// skipped and once the iterator is exhausted the end element of the parent
+// has been consumed.
+//
+// A typical use looks like this:
+//
+//	iter := xml.Elements(r)
+//	for iter.Next() {
+//		var v Record
+//		if err := iter.Decode(&v); err != nil {
+//			return err
+//		}
+//	}
+//	if err := iter.Err(); err != nil {
+//		return err
+//	}
+func Elements(r TokenReader) *ElementIter {
+	return &ElementIter{r: Inner(r)}
+}
+
+// Elements returns an iterator over the child elements of the most recent
+// start element returned by t.
+// For more information see the Elements function.
+func (t *Tokenizer) Elements() *ElementIter {
+	return Elements(t)
+}
+
+// Next advances to the next child element, skipping any part of the previous
+// element that was not read.
+// It returns false when there are no more child elements or an error occurs.
+func (iter *ElementIter) Next() bool {
+	if iter.done {
+		return false
+	}
+	if iter.cur != nil {
+		err := Skip(iter.cur)
+		iter.cur = nil
+		if err != nil {
+			iter.err = err
+			iter.done = true
+			return false
+		}
+	}
+	for {
+		tok, err := iter.r.Token()
+		if start, ok := unwrapSource(tok).(StartElement); ok {
+			iter.start = start
+			iter.cur = Inner(iter.r)
+			if err != nil && err != io.EOF {
+				iter.err = err
+			}
+			return true
+		}
+		if err == io.EOF {
+			iter.done = true
+			return false
+		}
+		if err != nil {
+			iter.err = err
+			iter.done = true
+			return false
+		}
+	}
+}
+
+// Start returns the start element of the current child element.
+func (iter *ElementIter) Start() StartElement {
+	return iter.start
+}
+
+// TokenReader returns a TokenReader over the tokens inside the current child
+// element.
+// It reports io.EOF when the end of the element is reached.
+func (iter *ElementIter) TokenReader() TokenReader {
+	return iter.cur
+}
+
+// Decode unmarshals the current child element into v as if by
+// Decoder.DecodeElement.
+func (iter *ElementIter) Decode(v interface{}) error {
+	return NewTokenDecoder(decodable(Wrap(iter.cur, iter.start))).Decode(v)
+}
+
+// Err returns the first error that was encountered by the iterator, if any.
+func (iter *ElementIter) Err() error {
+	return iter.err
+}
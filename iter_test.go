@@ -0,0 +1,84 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestElements(t *testing.T) {
+	type item struct {
+		ID   string `xml:"id,attr"`
+		Name string `xml:"name"`
+	}
+	const in = `<list>
+	<item id="1"><name>a</name><extra/></item>
+	<!-- comment -->
+	<item id="2"><name>b</name></item>
+	<other><name>c</name></other>
+</list><after/>`
+	tz := NewTokenizer(strings.NewReader(in))
+	if _, err := tz.Token(); err != nil {
+		t.Fatalf("unexpected error reading start: %v", err)
+	}
+	iter := tz.Elements()
+	var items []item
+	var skipped []string
+	for iter.Next() {
+		if iter.Start().Name.Local != "item" {
+			skipped = append(skipped, iter.Start().Name.Local)
+			continue
+		}
+		var v item
+		if err := iter.Decode(&v); err != nil {
+			t.Fatalf("unexpected error decoding: %v", err)
+		}
+		items = append(items, v)
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if iter.Next() {
+		t.Errorf("exhausted iterator should not advance")
+	}
+	if len(items) != 2 || items[0] != (item{ID: "1", Name: "a"}) || items[1] != (item{ID: "2", Name: "b"}) {
+		t.Errorf("wrong items: %+v", items)
+	}
+	if len(skipped) != 1 || skipped[0] != "other" {
+		t.Errorf("wrong skipped elements: %v", skipped)
+	}
+	tok, err := tz.Token()
+	if err != nil {
+		t.Fatalf("unexpected error after iterating: %v", err)
+	}
+	if start, ok := tok.(StartElement); !ok || start.Name.Local != "after" {
+		t.Errorf("parent end element not consumed, got %v", tok)
+	}
+}
+
+func TestElementsTokenReader(t *testing.T) {
+	r := NewTokenizer(strings.NewReader(`<a><b>one</b><c>two</c></a>`))
+	if _, err := r.Token(); err != nil {
+		t.Fatalf("unexpected error reading start: %v", err)
+	}
+	iter := Elements(r)
+	var text []string
+	for iter.Next() {
+		tok, err := iter.TokenReader().Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		text = append(text, string(tok.(CharData)))
+	}
+	if err := iter.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := strings.Join(text, " "); s != "one two" {
+		t.Errorf("wrong text: want=%q, got=%q", "one two", s)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"strconv"
+)
+
+// Kind is the kind of a token.
+// More kinds may be added in the future as new types of token are introduced,
+// so code that switches on a Kind should handle unknown values.
+type Kind int
+
+// A list of token kinds.
+const (
+	// InvalidKind is the kind of nil and of tokens with types that are not
+	// known to this package.
+	InvalidKind Kind = iota
+
+	// StartElementKind is the kind of StartElement tokens.
+	StartElementKind
+
+	// EndElementKind is the kind of EndElement tokens.
+	EndElementKind
+
+	// CharDataKind is the kind of CharData tokens.
+	CharDataKind
+
+	// CDATAKind is the kind of CDATA tokens.
+	CDATAKind
+
+	// CommentKind is the kind of Comment tokens.
+	CommentKind
+
+	// ProcInstKind is the kind of ProcInst tokens.
+	ProcInstKind
+
+	// DeclarationKind is the kind of Declaration tokens.
+	DeclarationKind
+
+	// DirectiveKind is the kind of Directive tokens.
+	DirectiveKind
+)
+
+var kindNames = [...]string{
+	InvalidKind:      "InvalidKind",
+	StartElementKind: "StartElementKind",
+	EndElementKind:   "EndElementKind",
+	CharDataKind:     "CharDataKind",
+	CDATAKind:        "CDATAKind",
+	CommentKind:      "CommentKind",
+	ProcInstKind:     "ProcInstKind",
+	DeclarationKind:  "DeclarationKind",
+	DirectiveKind:    "DirectiveKind",
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "Kind(" + strconv.Itoa(int(k)) + ")"
+	}
+	return kindNames[k]
+}
+
+// TokenKind returns the kind of tok.
+// Tokens wrapped in a SourceToken have the kind of the token they wrap.
+func TokenKind(tok Token) Kind {
+	switch unwrapSource(tok).(type) {
+	case StartElement:
+		return StartElementKind
+	case EndElement:
+		return EndElementKind
+	case CharData:
+		return CharDataKind
+	case CDATA:
+		return CDATAKind
+	case Comment:
+		return CommentKind
+	case ProcInst:
+		return ProcInstKind
+	case Declaration:
+		return DeclarationKind
+	case Directive:
+		return DirectiveKind
+	}
+	return InvalidKind
+}
@@ -0,0 +1,47 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var tokenKindTestCases = [...]struct {
+	tok  Token
+	kind Kind
+	name string
+}{
+	0:  {kind: InvalidKind, name: "InvalidKind"},
+	1:  {tok: StartElement{}, kind: StartElementKind, name: "StartElementKind"},
+	2:  {tok: EndElement{}, kind: EndElementKind, name: "EndElementKind"},
+	3:  {tok: CharData("a"), kind: CharDataKind, name: "CharDataKind"},
+	4:  {tok: CDATA("a"), kind: CDATAKind, name: "CDATAKind"},
+	5:  {tok: Comment("a"), kind: CommentKind, name: "CommentKind"},
+	6:  {tok: ProcInst{Target: "a"}, kind: ProcInstKind, name: "ProcInstKind"},
+	7:  {tok: Declaration{Version: "1.0"}, kind: DeclarationKind, name: "DeclarationKind"},
+	8:  {tok: Directive("a"), kind: DirectiveKind, name: "DirectiveKind"},
+	9:  {tok: SourceToken{Token: CharData("a")}, kind: CharDataKind, name: "CharDataKind"},
+	10: {tok: 42, kind: InvalidKind, name: "InvalidKind"},
+}
+
+func TestTokenKind(t *testing.T) {
+	for i, tc := range tokenKindTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			kind := TokenKind(tc.tok)
+			if kind != tc.kind {
+				t.Errorf("wrong kind: want=%v, got=%v", tc.kind, kind)
+			}
+			if s := kind.String(); s != tc.name {
+				t.Errorf("wrong name: want=%s, got=%s", tc.name, s)
+			}
+		})
+	}
+	if s := Kind(100).String(); s != "Kind(100)" {
+		t.Errorf("wrong name for unknown kind: got=%s", s)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Attr decodes the attributes of the start element most recently returned by
+// Token if they were skipped because LazyAttr is set.
+// Names are resolved the same way as they would have been when the start
+// element was decoded.
+// If the most recent token was not a start element with skipped attributes
+// Attr returns nil.
+func (t *Tokenizer) Attr() ([]Attr, error) {
+	if !t.hasLazy {
+		return nil, nil
+	}
+	attr, err := t.decodeRawAttrs(t.lazy)
+	if err != nil {
+		return nil, err
+	}
+	for i := range attr {
+		attr[i].Name = t.resolve(attr[i].Name, true)
+	}
+	return attr, nil
+}
+
+// lazyAttrs reports whether the attributes of the named element may be
+// skipped.
+func (t *Tokenizer) lazyAttrs(name Name) bool {
+	if !t.LazyAttr || t.ValidateDTD || t.StrictNamespaces || t.noResolve {
+		return false
+	}
+	return t.SkipAttrDefaults || t.doctype == nil || len(t.doctype.attlists[rawName(name)]) == 0
+}
+
+// decodeLazyStart finishes decoding a start element after its name without
+// decoding the attributes, unless they might affect the namespace or whitespace
+// handling of the element.
+func decodeLazyStart(t *Tokenizer, name Name, sep byte) (StartElement, error) {
+	raw := t.lazy[:0]
+	b := sep
+	var quote byte
+	for {
+		switch {
+		case b == quote:
+			quote = 0
+		case quote != 0:
+		case b == '"' || b == '\'':
+			quote = b
+		case b == '>':
+			return t.endLazyStart(name, raw)
+		}
+		raw = append(raw, b)
+		switch quote {
+		case 0:
+			raw = t.readRun(raw, `'">`, 0)
+		case '"':
+			raw = t.readRun(raw, `"`, 0)
+		default:
+			raw = t.readRun(raw, `'`, 0)
+		}
+		var err error
+		b, err = t.readByte()
+		if err != nil {
+			t.lazy = raw[:0]
+			return StartElement{}, err
+		}
+	}
+}
+
+// endLazyStart completes a start element given the raw input of its
+// attributes, which ends with the "/" of an empty element tag if there is one.
+func (t *Tokenizer) endLazyStart(name Name, raw []byte) (StartElement, error) {
+	selfClose := len(raw) > 0 && raw[len(raw)-1] == '/'
+	if selfClose {
+		raw = raw[:len(raw)-1]
+	}
+	t.lazy = raw
+	if bytes.Contains(raw, []byte("xml")) {
+		// The attributes may declare namespaces or set xml:space, so decode them
+		// now.
+		attr, err := t.decodeRawAttrs(raw)
+		if err != nil {
+			return StartElement{}, err
+		}
+		for _, a := range attr {
+			t.declare(a)
+		}
+		return t.endStart(name, attr, selfClose)
+	}
+	t.hasLazy = true
+	start := StartElement{Name: t.resolve(name, false)}
+	if selfClose {
+		t.selfClose = &start.Name
+	}
+	return start, nil
+}
+
+// decodeRawAttrs decodes the attributes in the raw input of a start tag
+// between the name and the end of the tag without resolving their names.
+func (t *Tokenizer) decodeRawAttrs(raw []byte) ([]Attr, error) {
+	sub := NewTokenizerBytes(raw)
+	sub.interned = t.interned
+	sub.LongAttr = t.LongAttr
+	sub.LongAttrSize = t.LongAttrSize
+	defer func() {
+		t.interned = sub.interned
+	}()
+	// We use an empty array instead of nil to match the behavior of encoding/xml.
+	attr := []Attr{}
+	for {
+		b, err := sub.readByte()
+		switch {
+		case errors.Is(err, io.EOF):
+			return attr, nil
+		case err != nil:
+			return nil, err
+		case isSpace(b):
+			continue
+		}
+		a, err := decodeAttr(sub, b)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = errEarlyEOF
+			}
+			return nil, err
+		}
+		if a.Name.Local != "" {
+			attr = append(attr, a)
+		}
+	}
+}
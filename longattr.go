@@ -0,0 +1,84 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+)
+
+// streamAttr passes the rest of an attribute value, starting with the part
+// that has already been decoded into head, to LongAttr.
+func streamAttr(t *Tokenizer, name Name, quote byte, stop string, head []byte) (Attr, error) {
+	r := &attrValueReader{t: t, quote: quote, stop: stop, buf: head}
+	err := t.LongAttr(name, r)
+	if err != nil {
+		return Attr{}, err
+	}
+	_, err = io.Copy(io.Discard, r)
+	if err != nil {
+		return Attr{}, err
+	}
+	return Attr{Name: name}, nil
+}
+
+// attrValueReader decodes an attribute value up to its closing quote.
+type attrValueReader struct {
+	t     *Tokenizer
+	quote byte
+	stop  string
+	// buf contains decoded bytes that have not yet been read.
+	buf  []byte
+	done bool
+}
+
+func (r *attrValueReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(r.buf) > 0 {
+		n := copy(p, r.buf)
+		r.buf = r.buf[n:]
+		return n, nil
+	}
+	if r.done {
+		return 0, io.EOF
+	}
+	t := r.t
+	// The value is not kept, so the start element can no longer be decoded
+	// again if Token is retried.
+	t.pulled = t.pulled[:0]
+	t.noRetry = true
+	if run := t.readRun(p[:0], r.stop, len(p)); len(run) > 0 {
+		normalizeAttrSpace(run)
+		return len(run), nil
+	}
+	b, err := t.readByte()
+	switch {
+	case errors.Is(err, io.EOF):
+		return 0, io.ErrUnexpectedEOF
+	case err != nil:
+		return 0, err
+	case b == r.quote:
+		r.done = true
+		return 0, io.EOF
+	case b == '&':
+		ref, err := decodeEntity(t, r.buf[:0], false)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		n := copy(p, ref)
+		r.buf = ref[n:]
+		return n, nil
+	}
+	if isSpace(b) {
+		b = ' '
+	}
+	p[0] = b
+	return 1, nil
+}
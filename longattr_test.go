@@ -0,0 +1,113 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "mellium.im/xml"
+)
+
+var longAttrTestCases = [...]struct {
+	in    string
+	size  int
+	read  int
+	names []Name
+	vals  []string
+	start StartElement
+	err   string
+}{
+	0: {
+		in:    `<a short="x" long="0123456789&amp;&#x42;"/>`,
+		size:  4,
+		read:  -1,
+		names: []Name{{Local: "long"}},
+		vals:  []string{"0123456789&B"},
+		start: StartElement{Name: Name{Local: "a"}, Attr: []Attr{
+			{Name: Name{Local: "short"}, Value: "x"},
+			{Name: Name{Local: "long"}},
+		}},
+	},
+	1: {
+		in:    `<a xmlns:p="urn:0123456789" p:long='0123456789'></a>`,
+		size:  4,
+		read:  2,
+		names: []Name{{Space: "p", Local: "long"}},
+		vals:  []string{"01"},
+		start: StartElement{Name: Name{Local: "a"}, Attr: []Attr{
+			{Name: Name{Space: "xmlns", Local: "p"}, Value: "urn:0123456789"},
+			{Name: Name{Space: "urn:0123456789", Local: "long"}},
+		}},
+	},
+	2: {
+		in:    `<a long="01234`,
+		size:  2,
+		read:  -1,
+		names: []Name{{Local: "long"}},
+		vals:  []string{""},
+		err:   io.ErrUnexpectedEOF.Error(),
+	},
+	3: {
+		in:    `<a long="0123456789">`,
+		size:  20,
+		start: StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "long"}, Value: "0123456789"}}},
+	},
+}
+
+func TestLongAttr(t *testing.T) {
+	for i, tc := range longAttrTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d := NewTokenizerSize(iotest.HalfReader(strings.NewReader(tc.in)), 16)
+			d.LongAttrSize = tc.size
+			var names []Name
+			var vals []string
+			d.LongAttr = func(name Name, r io.Reader) error {
+				names = append(names, name)
+				if tc.read >= 0 {
+					r = io.LimitReader(r, int64(tc.read))
+				}
+				val, err := io.ReadAll(iotest.OneByteReader(r))
+				vals = append(vals, string(val))
+				return err
+			}
+			tok, err := d.Token()
+			switch {
+			case tc.err != "":
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("wrong error: want=%q, got=%v", tc.err, err)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !reflect.DeepEqual(tok, tc.start):
+				t.Errorf("wrong token: want=%v, got=%v", tc.start, tok)
+			}
+			if !reflect.DeepEqual(names, tc.names) {
+				t.Errorf("wrong names: want=%v, got=%v", tc.names, names)
+			}
+			if tc.err == "" && !reflect.DeepEqual(vals, tc.vals) {
+				t.Errorf("wrong values: want=%q, got=%q", tc.vals, vals)
+			}
+		})
+	}
+}
+
+func TestLongAttrError(t *testing.T) {
+	errTest := errors.New("test")
+	d := NewTokenizer(strings.NewReader(`<a long="0123456789"/>`))
+	d.LongAttrSize = 1
+	d.LongAttr = func(Name, io.Reader) error {
+		return errTest
+	}
+	_, err := d.Token()
+	if !errors.Is(err, errTest) {
+		t.Errorf("wrong error: want=%v, got=%v", errTest, err)
+	}
+}
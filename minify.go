@@ -0,0 +1,137 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// Minify returns a TokenReader that removes comments, whitespace-only
+// character data, and namespace declarations that redeclare a namespace that
+// is already in scope from the tokens read from r.
+// Whitespace is only removed from element-only content and never from inside
+// an element with xml:space="preserve".
+// So that tokens can be streamed, only a run of whitespace is held back, and
+// it is kept if the element that contains it has already contained other
+// character data or if it is followed by other character data.
+// Whitespace between child elements that comes before the first text in an
+// element is removed.
+//
+// Minify can be used as a Transformer.
+func Minify(r TokenReader) TokenReader {
+	// The default namespace is initially bound to the empty namespace.
+	return &minifier{r: r, ns: nsStack{decls: []nsDecl{{}}}}
+}
+
+type minifier struct {
+	r        TokenReader
+	err      error
+	out      []Token
+	space    []Token
+	ns       nsStack
+	preserve []bool
+	mixed    []bool
+}
+
+func (m *minifier) Token() (Token, error) {
+	for {
+		if len(m.out) > 0 {
+			tok := m.out[0]
+			m.out[0] = nil
+			m.out = m.out[1:]
+			return tok, nil
+		}
+		m.out = m.out[:0]
+		if m.err != nil {
+			// Whitespace at the end of the input is never followed by text.
+			m.space = m.space[:0]
+			return nil, m.err
+		}
+		tok, err := m.r.Token()
+		m.err = err
+		if tok != nil {
+			m.minify(tok)
+		}
+	}
+}
+
+func (m *minifier) minify(tok Token) {
+	switch t := unwrapSource(tok).(type) {
+	case Comment:
+		return
+	case CharData:
+		switch {
+		case m.preserveSpace() || m.isMixed():
+		case onlySpace(t):
+			// The token may be overwritten by the next call to Token.
+			m.space = append(m.space, copyToken(tok))
+			return
+		default:
+			m.mixed[len(m.mixed)-1] = true
+			m.out = append(m.out, m.space...)
+		}
+	case StartElement:
+		tok = m.push(tok, t)
+	case EndElement:
+		m.pop()
+	}
+	m.space = m.space[:0]
+	m.out = append(m.out, tok)
+}
+
+// isMixed reports whether the current element has contained character data
+// other than whitespace.
+// Character data outside of the root element is never kept.
+func (m *minifier) isMixed() bool {
+	return len(m.mixed) > 0 && m.mixed[len(m.mixed)-1]
+}
+
+// push opens the scope of a start element and returns the token with any
+// redundant namespace declarations removed.
+func (m *minifier) push(tok Token, start StartElement) Token {
+	preserve := m.preserveSpace()
+	var decls []nsDecl
+	attr := make([]Attr, 0, len(start.Attr))
+	for _, a := range start.Attr {
+		var prefix string
+		switch {
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+		case a.Name.Space == "xmlns":
+			prefix = a.Name.Local
+		case a.Name.Local == "space" && (a.Name.Space == "xml" || a.Name.Space == xmlURL):
+			switch a.Value {
+			case "preserve":
+				preserve = true
+			case "default":
+				preserve = false
+			}
+			fallthrough
+		default:
+			attr = append(attr, a)
+			continue
+		}
+		if space, ok := m.ns.lookup(prefix); ok && space == a.Value {
+			continue
+		}
+		decls = append(decls, nsDecl{prefix: prefix, space: a.Value})
+		attr = append(attr, a)
+	}
+	m.ns.push(decls...)
+	m.preserve = append(m.preserve, preserve)
+	m.mixed = append(m.mixed, false)
+	if len(attr) == len(start.Attr) {
+		return tok
+	}
+	start.Attr = attr
+	return start
+}
+
+func (m *minifier) pop() {
+	if len(m.preserve) > 0 {
+		m.ns.pop()
+		m.preserve = m.preserve[:len(m.preserve)-1]
+		m.mixed = m.mixed[:len(m.mixed)-1]
+	}
+}
+
+func (m *minifier) preserveSpace() bool {
+	return len(m.preserve) > 0 && m.preserve[len(m.preserve)-1]
+}
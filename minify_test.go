@@ -0,0 +1,105 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var minifyTestCases = []struct {
+	in  string
+	out string
+}{
+	0: {
+		in: `<a>
+	<b>c</b>
+	<!-- d -->
+	<e/>
+</a>`,
+		out: `<a><b>c</b><e></e></a>`,
+	},
+	1: {
+		in:  `<a>b <c>d</c> e<!-- f --> g</a>`,
+		out: `<a>b <c>d</c> e g</a>`,
+	},
+	2: {
+		in:  `<a> <!-- b -->c</a>`,
+		out: `<a> c</a>`,
+	},
+	3: {
+		in:  `<a xml:space="preserve"> <b> </b><c xml:space="default"> <d></d> </c></a>`,
+		out: `<a xml:space="preserve"> <b> </b><c xml:space="default"><d></d></c></a>`,
+	},
+	4: {
+		in:  `<a xmlns="urn:a" xmlns:b="urn:b"><c xmlns="urn:a" xmlns:b="urn:c"><b:d xmlns:b="urn:c"></b:d></c><e xmlns=""></e></a>`,
+		out: `<a xmlns="urn:a" xmlns:b="urn:b"><c xmlns:b="urn:c"><b:d></b:d></c><e xmlns=""></e></a>`,
+	},
+	5: {
+		in:  `<a xmlns=""> <b xmlns=""></b> </a>`,
+		out: `<a><b></b></a>`,
+	},
+	6: {
+		in:  `<p>Hello <b>big</b> <i>world</i></p>`,
+		out: `<p>Hello <b>big</b> <i>world</i></p>`,
+	},
+	7: {
+		in:  `<p><b>big</b> <i>wide</i> world<br/> </p> <q> <r/> </q>`,
+		out: `<p><b>big</b><i>wide</i> world<br></br> </p><q><r></r></q>`,
+	},
+}
+
+func TestMinify(t *testing.T) {
+	for i, tc := range minifyTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			toks, err := readAll(Minify(NewTokenizer(strings.NewReader(tc.in))))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, tok := range toks {
+				err = e.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc.out, s)
+			}
+		})
+	}
+}
+
+// countReader counts the tokens that are read from a TokenReader.
+type countReader struct {
+	r TokenReader
+	n int
+}
+
+func (c *countReader) Token() (Token, error) {
+	c.n++
+	return c.r.Token()
+}
+
+func TestMinifyStreams(t *testing.T) {
+	in := "<a>" + strings.Repeat("\n\t<b>c</b>", 1000) + "\n</a>"
+	c := &countReader{r: NewTokenizer(strings.NewReader(in))}
+	m := Minify(c)
+	for i := 0; i < 5; i++ {
+		if _, err := m.Token(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if c.n > 10 {
+		t.Errorf("read %d tokens to return 5", c.n)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+var errNoMmap = errors.New("xml: memory mapping is not supported")
+
+// MappedFile is a file that has been loaded into memory for tokenizing.
+type MappedFile struct {
+	data  []byte
+	unmap func([]byte) error
+}
+
+// OpenMapped memory maps the named file so that large documents can be
+// tokenized without copying them through a buffer.
+// If the file cannot be mapped, for instance because it is not a regular
+// file or mapping is not supported on the current platform, it is read into
+// memory instead.
+// The file must not be modified while it is mapped.
+func OpenMapped(name string) (*MappedFile, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Mode().IsRegular() && info.Size() > 0 {
+		data, err := mmapFile(f, info.Size())
+		if err == nil {
+			return &MappedFile{data: data, unmap: munmapFile}, nil
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedFile{data: data}, nil
+}
+
+// Tokenizer returns a new tokenizer that reads the contents of the file as if
+// by NewTokenizerBytes.
+// Tokens returned while ZeroCopy is set may refer to the mapped memory, so
+// they must not be used after the file is closed.
+func (m *MappedFile) Tokenizer() *Tokenizer {
+	return NewTokenizerBytes(m.data)
+}
+
+// Bytes returns the contents of the file.
+// The slice must not be used after the file is closed.
+func (m *MappedFile) Bytes() []byte {
+	return m.data
+}
+
+// Close releases the memory mapping, if any.
+// It is safe to call Close more than once.
+func (m *MappedFile) Close() error {
+	data := m.data
+	m.data = nil
+	if m.unmap == nil || data == nil {
+		return nil
+	}
+	return m.unmap(data)
+}
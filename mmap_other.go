@@ -0,0 +1,19 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package xml
+
+import (
+	"os"
+)
+
+func mmapFile(*os.File, int64) ([]byte, error) {
+	return nil, errNoMmap
+}
+
+func munmapFile([]byte) error {
+	return nil
+}
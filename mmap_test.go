@@ -0,0 +1,66 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var mappedTestCases = [...]string{
+	0: ``,
+	1: `<a b="c">foo<!-- bar --><d/>&amp;</a>`,
+}
+
+func TestOpenMapped(t *testing.T) {
+	for i, tc := range mappedTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "test.xml")
+			err := os.WriteFile(name, []byte(tc), 0o600)
+			if err != nil {
+				t.Fatalf("error writing test file: %v", err)
+			}
+			want, err := readAll(NewTokenizerBytes([]byte(tc)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			f, err := OpenMapped(name)
+			if err != nil {
+				t.Fatalf("error opening file: %v", err)
+			}
+			if string(f.Bytes()) != tc {
+				t.Errorf("wrong contents: want=%q, got=%q", tc, f.Bytes())
+			}
+			got, err := readAll(f.Tokenizer())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong tokens:\nwant=%+v,\n got=%+v", want, got)
+			}
+			if err = f.Close(); err != nil {
+				t.Errorf("error closing file: %v", err)
+			}
+			if err = f.Close(); err != nil {
+				t.Errorf("error closing file twice: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenMappedMissing(t *testing.T) {
+	_, err := OpenMapped(filepath.Join(t.TempDir(), "missing.xml"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("wrong error: want=%v, got=%v", fs.ErrNotExist, err)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NamePattern matches names that may contain wildcards.
+// It is created by ParseNamePattern.
+type NamePattern struct {
+	space    string
+	local    string
+	anySpace bool
+}
+
+// ParseNamePattern parses a pattern that matches names.
+//
+// The local name may be "*" to match any local name and may be qualified by a
+// namespace in braces ("{jabber:client}message", "{jabber:client}*").
+// An unqualified local name, or one qualified by "{*}" or "*:" ("*:body"),
+// matches names in any namespace and a local name qualified by "{}" matches
+// names that are not in a namespace.
+func ParseNamePattern(pattern string) (NamePattern, error) {
+	p := NamePattern{anySpace: true}
+	s := pattern
+	switch {
+	case strings.HasPrefix(s, "{"):
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return p, fmt.Errorf("xml: unterminated namespace in name pattern %q", pattern)
+		}
+		p.space, s = s[1:end], s[end+1:]
+		p.anySpace = p.space == "*"
+		if p.anySpace {
+			p.space = ""
+		}
+	case strings.HasPrefix(s, "*:"):
+		s = s[2:]
+	}
+	if s == "" {
+		return p, errors.New("xml: empty local name in name pattern")
+	}
+	if s != "*" && strings.ContainsAny(s, "*{}:/[]()@ \t\r\n") {
+		return p, fmt.Errorf("xml: invalid local name in name pattern %q", pattern)
+	}
+	p.local = s
+	return p, nil
+}
+
+// MustParseNamePattern is like ParseNamePattern but panics if the pattern
+// cannot be parsed.
+func MustParseNamePattern(pattern string) NamePattern {
+	p, err := ParseNamePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// Match reports whether name matches the pattern.
+func (p NamePattern) Match(name Name) bool {
+	return (p.anySpace || p.space == name.Space) && (p.local == "*" || p.local == name.Local)
+}
+
+// MatchName reports whether name matches pattern using the syntax described
+// by ParseNamePattern.
+// An invalid pattern does not match any name.
+func MatchName(pattern string, name Name) bool {
+	p, err := ParseNamePattern(pattern)
+	if err != nil {
+		return false
+	}
+	return p.Match(name)
+}
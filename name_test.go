@@ -0,0 +1,53 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var matchNameTestCases = [...]struct {
+	pattern string
+	name    Name
+	match   bool
+}{
+	0:  {pattern: "message", name: Name{Space: "jabber:client", Local: "message"}, match: true},
+	1:  {pattern: "message", name: Name{Local: "message"}, match: true},
+	2:  {pattern: "message", name: Name{Local: "iq"}},
+	3:  {pattern: "{jabber:client}message", name: Name{Space: "jabber:client", Local: "message"}, match: true},
+	4:  {pattern: "{jabber:client}message", name: Name{Space: "jabber:server", Local: "message"}},
+	5:  {pattern: "{jabber:client}*", name: Name{Space: "jabber:client", Local: "iq"}, match: true},
+	6:  {pattern: "*:body", name: Name{Space: "urn:a", Local: "body"}, match: true},
+	7:  {pattern: "{*}body", name: Name{Local: "body"}, match: true},
+	8:  {pattern: "{}body", name: Name{Local: "body"}, match: true},
+	9:  {pattern: "{}body", name: Name{Space: "urn:a", Local: "body"}},
+	10: {pattern: "*", name: Name{Space: "urn:a", Local: "anything"}, match: true},
+	11: {pattern: "{http://example.com/ns}a", name: Name{Space: "http://example.com/ns", Local: "a"}, match: true},
+	12: {pattern: "", name: Name{}},
+	13: {pattern: "{urn:a", name: Name{Space: "urn:a"}},
+	14: {pattern: "a:b", name: Name{Space: "a", Local: "b"}},
+	15: {pattern: "b*", name: Name{Local: "b*"}},
+}
+
+func TestMatchName(t *testing.T) {
+	for i, tc := range matchNameTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			if match := MatchName(tc.pattern, tc.name); match != tc.match {
+				t.Errorf("wrong result matching %q against %+v: want=%t, got=%t", tc.pattern, tc.name, tc.match, match)
+			}
+		})
+	}
+}
+
+func TestParseNamePatternError(t *testing.T) {
+	for _, pattern := range []string{"", "{}", "{urn:a", "a:b", "a b"} {
+		if _, err := ParseNamePattern(pattern); err == nil {
+			t.Errorf("expected error parsing %q", pattern)
+		}
+	}
+}
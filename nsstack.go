@@ -0,0 +1,102 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// nsDecl is a namespace declared by a start element.
+// The default namespace is declared with an empty prefix.
+type nsDecl struct {
+	prefix string
+	space  string
+}
+
+// nsStack holds the namespace declarations of the open elements while tokens
+// are being written.
+// As with the bindings of a Tokenizer, the declarations of all elements are
+// kept in a single slice so that elements that do not declare any namespaces
+// cost nothing.
+type nsStack struct {
+	decls  []nsDecl
+	starts []int
+}
+
+// xmlnsDecls returns the namespaces declared by the xmlns attributes in attr.
+func xmlnsDecls(attr []Attr) []nsDecl {
+	var decls []nsDecl
+	for _, a := range attr {
+		switch {
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+			decls = append(decls, nsDecl{space: a.Value})
+		case a.Name.Space == "xmlns":
+			decls = append(decls, nsDecl{prefix: a.Name.Local, space: a.Value})
+		}
+	}
+	return decls
+}
+
+// push opens the scope of an element that makes the given declarations.
+func (s *nsStack) push(decls ...nsDecl) {
+	s.starts = append(s.starts, len(s.decls))
+	s.decls = append(s.decls, decls...)
+}
+
+// pop closes the scope of the innermost element.
+func (s *nsStack) pop() {
+	if len(s.starts) == 0 {
+		return
+	}
+	s.decls = s.decls[:s.starts[len(s.starts)-1]]
+	s.starts = s.starts[:len(s.starts)-1]
+}
+
+// own returns the declarations made by the innermost element.
+func (s *nsStack) own() []nsDecl {
+	if len(s.starts) == 0 {
+		return nil
+	}
+	return s.decls[s.starts[len(s.starts)-1]:]
+}
+
+// lookup returns the namespace bound to prefix by the innermost declaration
+// of it and reports whether there was one.
+func (s *nsStack) lookup(prefix string) (string, bool) {
+	return lookupPrefix(s.decls, prefix)
+}
+
+// prefixFor returns a prefix other than the default namespace that is bound to
+// space, either by the declarations in pending that are about to be pushed or
+// by the open elements.
+// If more than one prefix is bound to space the innermost and most recently
+// declared one is used.
+func (s *nsStack) prefixFor(pending []nsDecl, space string) (string, bool) {
+	for i := len(pending) - 1; i >= 0; i-- {
+		if d := pending[i]; d.prefix != "" && d.space == space {
+			return d.prefix, true
+		}
+	}
+	for i := len(s.decls) - 1; i >= 0; i-- {
+		d := s.decls[i]
+		if d.prefix == "" || d.space != space {
+			continue
+		}
+		if _, shadowed := lookupPrefix(pending, d.prefix); shadowed {
+			continue
+		}
+		if bound, _ := s.lookup(d.prefix); bound == space {
+			return d.prefix, true
+		}
+	}
+	return "", false
+}
+
+// lookupPrefix returns the namespace bound to prefix by the most recent
+// declaration in decls.
+func lookupPrefix(decls []nsDecl, prefix string) (string, bool) {
+	for i := len(decls) - 1; i >= 0; i-- {
+		if decls[i].prefix == prefix {
+			return decls[i].space, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// Pos is a position in the input stream.
+type Pos struct {
+	// Offset is the byte offset from the start of the input.
+	Offset int64
+	// Line is the 1 based line number.
+	Line int
+	// Col is the 1 based byte position in the line.
+	Col int
+}
+
+// Span is the range of input occupied by a token.
+// End is the position immediately after the last byte of the token.
+type Span struct {
+	Start Pos
+	End   Pos
+}
+
+// OffsetReader is a TokenReader that can report its position in the input
+// stream, such as a Tokenizer.
+type OffsetReader interface {
+	TokenReader
+	InputOffset() int64
+}
+
+// OffsetDecoder is a Decoder that reports the input offsets and positions of
+// the OffsetReader it was created from.
+//
+// A Decoder created with NewTokenDecoder has no access to the underlying input
+// so its InputOffset method always reports zero and its InputPos method always
+// reports the start of the input.
+type OffsetDecoder struct {
+	*Decoder
+	r OffsetReader
+}
+
+// NewOffsetDecoder creates a new decoder reading from r.
+// Unlike a Decoder created with NewTokenDecoder, the InputOffset method of the
+// returned decoder reports the offset of r, and if r also has an InputPos
+// method, such as a Tokenizer, InputPos reports its position.
+func NewOffsetDecoder(r OffsetReader) *OffsetDecoder {
+	return &OffsetDecoder{
+		Decoder: NewTokenDecoder(r),
+		r:       r,
+	}
+}
+
+// InputOffset returns the input stream byte offset of the current decoder
+// position.
+// The offset gives the location of the end of the most recently returned token
+// and the beginning of the next token.
+func (d *OffsetDecoder) InputOffset() int64 {
+	return d.r.InputOffset()
+}
+
+// InputPos returns the line of the current decoder position and the 1 based
+// input position of the line.
+// If the OffsetReader does not have an InputPos method the start of the input
+// is reported.
+func (d *OffsetDecoder) InputPos() (line, column int) {
+	if p, ok := d.r.(interface{ InputPos() (int, int) }); ok {
+		return p.InputPos()
+	}
+	return 1, 1
+}
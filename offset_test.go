@@ -0,0 +1,152 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var offsetTestCases = []struct {
+	in       string
+	coalesce bool
+	offsets  []int64
+}{
+	0: {},
+	1: {
+		in:      `<a>foo</a>`,
+		offsets: []int64{3, 6, 10},
+	},
+	2: {
+		in:      `<a/><!-- b --><?c d?><!e>`,
+		offsets: []int64{4, 4, 14, 21, 25},
+	},
+	3: {
+		in:       `<a>foo<![CDATA[bar]]><b/></a>`,
+		coalesce: true,
+		offsets:  []int64{3, 21, 25, 25, 29},
+	},
+	4: {
+		in:       `<a>foo<![CDATA[bar]]>baz<![CDA</a>`,
+		coalesce: true,
+		offsets:  []int64{3, 24},
+	},
+}
+
+func TestInputOffset(t *testing.T) {
+	for i, tc := range offsetTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.CoalesceCharData = tc.coalesce
+			d := NewOffsetDecoder(td)
+			if off := d.InputOffset(); off != 0 {
+				t.Fatalf("wrong initial offset: want=0, got=%d", off)
+			}
+			for j, want := range tc.offsets {
+				tok, err := d.RawToken()
+				if err != nil {
+					t.Fatalf("unexpected error on token %d: %v", j, err)
+				}
+				if off := d.InputOffset(); off != want {
+					t.Fatalf("wrong offset after token %d %T(%+[2]v): want=%d, got=%d", j, tok, want, off)
+				}
+			}
+		})
+	}
+}
+
+func TestOffsetDecoderInputPos(t *testing.T) {
+	td := NewTokenizer(strings.NewReader("<a>\n <b/>\n</a>"))
+	d := NewOffsetDecoder(td)
+	want := [][2]int{{1, 4}, {2, 2}, {2, 6}, {2, 6}, {3, 1}, {3, 5}}
+	for i, w := range want {
+		tok, err := d.RawToken()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+		if line, col := d.InputPos(); line != w[0] || col != w[1] {
+			t.Errorf("wrong position after token %d %T(%+[2]v): want=%d:%d, got=%d:%d", i, tok, w[0], w[1], line, col)
+		}
+	}
+}
+
+func TestSpan(t *testing.T) {
+	const in = "<a>\n <b x='1'\n/>foo<!-- c -->\nbar</a>"
+	want := []Span{
+		{Start: Pos{Offset: 0, Line: 1, Col: 1}, End: Pos{Offset: 3, Line: 1, Col: 4}},
+		{Start: Pos{Offset: 3, Line: 1, Col: 4}, End: Pos{Offset: 5, Line: 2, Col: 2}},
+		{Start: Pos{Offset: 5, Line: 2, Col: 2}, End: Pos{Offset: 16, Line: 3, Col: 3}},
+		{Start: Pos{Offset: 16, Line: 3, Col: 3}, End: Pos{Offset: 16, Line: 3, Col: 3}},
+		{Start: Pos{Offset: 16, Line: 3, Col: 3}, End: Pos{Offset: 19, Line: 3, Col: 6}},
+		{Start: Pos{Offset: 29, Line: 3, Col: 16}, End: Pos{Offset: 33, Line: 4, Col: 4}},
+		{Start: Pos{Offset: 33, Line: 4, Col: 4}, End: Pos{Offset: 37, Line: 4, Col: 8}},
+	}
+	td := NewTokenizer(strings.NewReader(in))
+	td.SkipComments = true
+	for i, w := range want {
+		tok, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+		if span := td.Span(); span != w {
+			t.Errorf("wrong span for token %d %T(%+[2]v):\nwant=%+v,\n got=%+v", i, tok, w, span)
+		}
+	}
+	if line, col := td.InputPos(); line != 4 || col != 8 {
+		t.Errorf("wrong input position: want=4:8, got=%d:%d", line, col)
+	}
+}
+
+func TestSpanCoalesce(t *testing.T) {
+	const in = "<a>foo\n<![CDATA[\n]]><![CDAT\n</a>"
+	td := NewTokenizer(strings.NewReader(in))
+	td.CoalesceCharData = true
+	for i := 0; i < 2; i++ {
+		_, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+	}
+	want := Span{Start: Pos{Offset: 3, Line: 1, Col: 4}, End: Pos{Offset: 20, Line: 3, Col: 4}}
+	if span := td.Span(); span != want {
+		t.Errorf("wrong span:\nwant=%+v,\n got=%+v", want, span)
+	}
+}
+
+func TestObserve(t *testing.T) {
+	const in = "<a>\n <b x='1'\n/>foo<!-- c -->\nbar</a>"
+	var spans []Span
+	var toks []Token
+	td := NewTokenizer(strings.NewReader(in))
+	td.SkipComments = true
+	td.SourceTokens = true
+	td.Observe = func(tok Token, span Span) {
+		toks = append(toks, CopyToken(tok))
+		spans = append(spans, span)
+	}
+	var want []Span
+	for {
+		tok, err := td.Token()
+		if err != nil {
+			break
+		}
+		if _, ok := tok.(SourceToken); !ok {
+			t.Fatalf("expected source token, got %T", tok)
+		}
+		want = append(want, td.Span())
+	}
+	if len(want) != 7 || !reflect.DeepEqual(spans, want) {
+		t.Errorf("wrong spans:\nwant=%+v,\n got=%+v", want, spans)
+	}
+	for i, tok := range toks {
+		if _, ok := tok.(SourceToken); ok {
+			t.Errorf("observed source token %d, want unwrapped token", i)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+)
+
+// Handler is a set of callbacks that are invoked by Parse for each token of
+// the corresponding type.
+// Any callback may be nil, in which case tokens of that type are ignored.
+type Handler struct {
+	StartElement func(StartElement) error
+	EndElement   func(EndElement) error
+	CharData     func(CharData) error
+	Comment      func(Comment) error
+	ProcInst     func(ProcInst) error
+	Directive    func(Directive) error
+	Declaration  func(Declaration) error
+}
+
+// Parse reads tokens from r until io.EOF and calls the matching callback in h
+// for each token.
+// If a callback returns an error parsing stops and the error is returned.
+// Tokens wrapped in a SourceToken are unwrapped before being passed to h and
+// CDATA is passed to the CharData callback.
+func Parse(r TokenReader, h Handler) error {
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			if herr := h.handle(tok); herr != nil {
+				return herr
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+func (h Handler) handle(tok Token) error {
+	switch tok := unwrapSource(tok).(type) {
+	case StartElement:
+		if h.StartElement != nil {
+			return h.StartElement(tok)
+		}
+	case EndElement:
+		if h.EndElement != nil {
+			return h.EndElement(tok)
+		}
+	case CharData:
+		if h.CharData != nil {
+			return h.CharData(tok)
+		}
+	case CDATA:
+		if h.CharData != nil {
+			return h.CharData(CharData(tok))
+		}
+	case Comment:
+		if h.Comment != nil {
+			return h.Comment(tok)
+		}
+	case ProcInst:
+		if h.ProcInst != nil {
+			return h.ProcInst(tok)
+		}
+	case Directive:
+		if h.Directive != nil {
+			return h.Directive(tok)
+		}
+	case Declaration:
+		if h.Declaration != nil {
+			return h.Declaration(tok)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestParse(t *testing.T) {
+	const in = `<?xml version="1.0"?><!DOCTYPE a><a><!-- b --><?c d?>e<f/></a>`
+	var events []string
+	td := NewTokenizer(strings.NewReader(in))
+	td.DecodeDeclaration = true
+	err := Parse(td, Handler{
+		StartElement: func(start StartElement) error {
+			events = append(events, "start "+start.Name.Local)
+			return nil
+		},
+		EndElement: func(end EndElement) error {
+			events = append(events, "end "+end.Name.Local)
+			return nil
+		},
+		CharData: func(cd CharData) error {
+			events = append(events, "text "+string(cd))
+			return nil
+		},
+		Comment: func(c Comment) error {
+			events = append(events, "comment"+string(c))
+			return nil
+		},
+		ProcInst: func(pi ProcInst) error {
+			events = append(events, "procinst "+pi.Target)
+			return nil
+		},
+		Declaration: func(d Declaration) error {
+			events = append(events, "declaration "+d.Version)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "declaration 1.0,start a,comment b ,procinst c,text e,start f,end f,end a"
+	if got := strings.Join(events, ","); got != want {
+		t.Fatalf("wrong events:\nwant=%s,\n got=%s", want, got)
+	}
+}
+
+func TestParseAbort(t *testing.T) {
+	errAbort := errors.New("abort")
+	var n int
+	err := Parse(NewTokenizer(strings.NewReader(`<a><b/><c/></a>`)), Handler{
+		StartElement: func(start StartElement) error {
+			n++
+			if start.Name.Local == "b" {
+				return errAbort
+			}
+			return nil
+		},
+	})
+	if err != errAbort {
+		t.Fatalf("wrong error: want=%v, got=%v", errAbort, err)
+	}
+	if n != 2 {
+		t.Fatalf("wrong number of callbacks: want=2, got=%d", n)
+	}
+}
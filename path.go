@@ -0,0 +1,216 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Path is a compiled path expression that can be matched against the names of
+// an element and its ancestors without building a tree.
+//
+// Paths are a small subset of XPath location paths made up of name steps
+// separated by "/" (child) or "//" (descendant).
+// A path that starts with "/" must match from the root element, any other path
+// may match starting at any depth as if it began with "//".
+// Each step is a name pattern as described by ParseNamePattern, or a local name
+// qualified by a prefix ("a:b", "a:*") that is looked up in the namespaces
+// passed to CompilePath.
+// Unqualified steps match names in the namespace bound to the empty prefix, or
+// in any namespace if there is none.
+type Path struct {
+	src   string
+	steps []pathStep
+}
+
+type pathStep struct {
+	NamePattern
+	desc bool
+}
+
+// CompilePath parses a path expression.
+func CompilePath(expr string, namespaces map[string]string) (*Path, error) {
+	p := &Path{src: expr}
+	s := expr
+	desc := true
+	switch {
+	case strings.HasPrefix(s, "//"):
+		s = s[2:]
+	case strings.HasPrefix(s, "/"):
+		s = s[1:]
+		desc = false
+	}
+	for {
+		// Find the end of the step, ignoring any slashes in a namespace.
+		end := 0
+		if strings.HasPrefix(s, "{") {
+			end = strings.IndexByte(s, '}')
+			if end < 0 {
+				return nil, fmt.Errorf("xml: unterminated namespace in path %q", expr)
+			}
+		}
+		if i := strings.IndexByte(s[end:], '/'); i >= 0 {
+			end += i
+		} else {
+			end = len(s)
+		}
+		step, err := parsePathStep(s[:end], namespaces)
+		if err != nil {
+			return nil, fmt.Errorf("%w in path %q", err, expr)
+		}
+		step.desc = desc
+		p.steps = append(p.steps, step)
+		if end == len(s) {
+			return p, nil
+		}
+		s = s[end+1:]
+		desc = false
+		if strings.HasPrefix(s, "/") {
+			s = s[1:]
+			desc = true
+		}
+	}
+}
+
+func parsePathStep(s string, namespaces map[string]string) (pathStep, error) {
+	qualified := strings.HasPrefix(s, "{") || strings.Contains(s, ":")
+	if prefix, local, ok := strings.Cut(s, ":"); ok && prefix != "*" && !strings.HasPrefix(s, "{") {
+		space, found := namespaces[prefix]
+		if !found || prefix == "" {
+			return pathStep{}, fmt.Errorf("xml: undeclared prefix %q", prefix)
+		}
+		s = "{" + space + "}" + local
+	}
+	pattern, err := ParseNamePattern(s)
+	if err != nil {
+		return pathStep{}, err
+	}
+	if space := namespaces[""]; !qualified && space != "" {
+		pattern.space, pattern.anySpace = space, false
+	}
+	return pathStep{NamePattern: pattern}, nil
+}
+
+// MustCompilePath is like CompilePath but panics if the expression cannot be
+// parsed.
+func MustCompilePath(expr string, namespaces map[string]string) *Path {
+	p, err := CompilePath(expr, namespaces)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// String returns the source text of the path.
+func (p *Path) String() string {
+	return p.src
+}
+
+// Match reports whether the path matches an element where path contains the
+// names of the element's ancestors followed by the name of the element itself,
+// such as the path passed to a WalkFunc.
+func (p *Path) Match(path []Name) bool {
+	return p.match(0, path)
+}
+
+func (p *Path) match(i int, path []Name) bool {
+	if i == len(p.steps) {
+		return len(path) == 0
+	}
+	step := p.steps[i]
+	for j := range path {
+		if step.Match(path[j]) && p.match(i+1, path[j+1:]) {
+			return true
+		}
+		if !step.desc {
+			break
+		}
+	}
+	return false
+}
+
+// SelectFunc is the type of the function called by Select for each matching
+// element.
+// The TokenReader returns the tokens inside the element and reports io.EOF
+// when the end of the element is reached.
+// Any tokens not read by the function are skipped.
+type SelectFunc func(start StartElement, r TokenReader) error
+
+// Select reads tokens from r until io.EOF and calls f for each element that
+// matches p.
+// Because the contents of a matching element are passed to f, elements nested
+// inside of a matching element are never matched themselves.
+// If f returns an error Select stops and returns the error.
+func Select(r TokenReader, p *Path, f SelectFunc) error {
+	var path []Name
+	for {
+		tok, err := r.Token()
+		switch tok := unwrapSource(tok).(type) {
+		case StartElement:
+			path = append(path, tok.Name)
+			if p.Match(path) {
+				inner := Inner(r)
+				if ferr := f(tok, inner); ferr != nil {
+					return ferr
+				}
+				if serr := Skip(inner); serr != nil {
+					return serr
+				}
+				path = path[:len(path)-1]
+			}
+		case EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// ForEach reads tokens from r until io.EOF and, for each element that matches
+// path, unmarshals the element into a new value of type T as if by
+// Decoder.Decode and calls f with the value.
+// Only one element is held in memory at a time.
+//
+// The path is compiled by CompilePath without any namespaces, so namespaced
+// steps must use braces, for example "/{urn:a}catalog/{urn:a}book".
+// If decoding fails or f returns an error ForEach stops and returns the error.
+func ForEach[T any](r TokenReader, path string, f func(T) error) error {
+	p, err := CompilePath(path, nil)
+	if err != nil {
+		return err
+	}
+	return Select(r, p, func(start StartElement, inner TokenReader) error {
+		var v T
+		err := NewTokenDecoder(decodable(Wrap(inner, start))).Decode(&v)
+		if err != nil {
+			return err
+		}
+		return f(v)
+	})
+}
+
+// decodable converts tokens that are specific to this package into tokens
+// that are understood by a Decoder.
+func decodable(r TokenReader) TokenReader {
+	return Transform(func(tok Token) (Token, bool) {
+		switch tok := unwrapSource(tok).(type) {
+		case CDATA:
+			return CharData(tok), true
+		case Declaration:
+			return tok.ProcInst(), true
+		default:
+			return tok, true
+		}
+	})(r)
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+const pathDoc = `<feed xmlns="http://www.w3.org/2005/Atom" xmlns:m="urn:m">
+<title>Feed</title>
+<entry><title>One</title><m:meta><title>Nested</title></m:meta></entry>
+<entry><title>Two</title></entry>
+</feed>`
+
+var pathTestCases = [...]struct {
+	path string
+	ns   map[string]string
+	out  string
+	err  bool
+}{
+	0:  {path: `/feed/entry/title`, out: "One Two"},
+	1:  {path: `//title`, out: "Feed One Nested Two"},
+	2:  {path: `title`, out: "Feed One Nested Two"},
+	3:  {path: `entry//title`, out: "One Nested Two"},
+	4:  {path: `/feed/title`, out: "Feed"},
+	5:  {path: `/title`},
+	6:  {path: `/feed/*/title`, out: "One Two"},
+	7:  {path: `m:meta/title`, ns: map[string]string{"m": "urn:m"}, out: "Nested"},
+	8:  {path: `{urn:m}meta/title`, out: "Nested"},
+	9:  {path: `/{http://www.w3.org/2005/Atom}feed/{http://www.w3.org/2005/Atom}title`, out: "Feed"},
+	10: {path: `/feed/title`, ns: map[string]string{"": "urn:other"}},
+	11: {path: `{urn:m}*/*`, out: "Nested"},
+	12: {path: `x:feed`, err: true},
+	13: {path: `/feed//`, err: true},
+	14: {path: `{urn:m`, err: true},
+	15: {path: `a[1]`, err: true},
+}
+
+func TestSelect(t *testing.T) {
+	for i, tc := range pathTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			p, err := CompilePath(tc.path, tc.ns)
+			switch {
+			case err != nil && !tc.err:
+				t.Fatalf("unexpected error compiling: %v", err)
+			case err == nil && tc.err:
+				t.Fatalf("expected error compiling %s", tc.path)
+			case err != nil:
+				return
+			}
+			var found []string
+			err = Select(NewTokenizer(strings.NewReader(pathDoc)), p, func(start StartElement, r TokenReader) error {
+				tok, err := r.Token()
+				if err != nil {
+					return err
+				}
+				found = append(found, string(tok.(CharData)))
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out := strings.Join(found, " "); out != tc.out {
+				t.Errorf("wrong matches for %s:\nwant=%q,\n got=%q", tc.path, tc.out, out)
+			}
+		})
+	}
+}
+
+func TestSelectNested(t *testing.T) {
+	var found []string
+	err := Select(NewTokenizer(strings.NewReader(`<a><b id="1"><b id="2"/></b><b id="3"/></a>`)), MustCompilePath("//b", nil), func(start StartElement, r TokenReader) error {
+		found = append(found, start.Attr[0].Value)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out := strings.Join(found, " "); out != "1 3" {
+		t.Errorf("wrong matches: want=%q, got=%q", "1 3", out)
+	}
+}
+
+func TestSelectError(t *testing.T) {
+	errStop := errors.New("stop")
+	err := Select(NewTokenizer(strings.NewReader(`<a><b/></a>`)), MustCompilePath("b", nil), func(StartElement, TokenReader) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("wrong error: want=%v, got=%v", errStop, err)
+	}
+}
+
+func TestPathMatch(t *testing.T) {
+	p := MustCompilePath("/a//c", nil)
+	if !p.Match([]Name{{Local: "a"}, {Local: "b"}, {Local: "c"}}) {
+		t.Errorf("expected match")
+	}
+	if p.Match([]Name{{Local: "x"}, {Local: "a"}, {Local: "c"}}) {
+		t.Errorf("unexpected match")
+	}
+	if p.String() != "/a//c" {
+		t.Errorf("wrong string: %q", p.String())
+	}
+}
+
+func TestForEach(t *testing.T) {
+	type book struct {
+		ID    string `xml:"id,attr"`
+		Title string `xml:"title"`
+	}
+	const in = `<catalog><book id="1"><title>One</title></book><shelf><book id="2"><title><![CDATA[Two]]></title></book></shelf></catalog>`
+	var books []book
+	tz := NewTokenizer(strings.NewReader(in))
+	tz.SourceTokens = true
+	err := ForEach(tz, "//book", func(b book) error {
+		books = append(books, b)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(books) != 2 || books[0] != (book{ID: "1", Title: "One"}) || books[1] != (book{ID: "2", Title: "Two"}) {
+		t.Errorf("wrong books decoded: %+v", books)
+	}
+
+	errStop := errors.New("stop")
+	err = ForEach(NewTokenizer(strings.NewReader(in)), "/catalog/book", func(b book) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("wrong error: want=%v, got=%v", errStop, err)
+	}
+	err = ForEach(NewTokenizer(strings.NewReader(in)), "a:book", func(b book) error {
+		return nil
+	})
+	if err == nil {
+		t.Errorf("expected error for invalid path")
+	}
+}
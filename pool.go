@@ -0,0 +1,76 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+	"sync"
+)
+
+// maxPooledBuf is the largest buffer that Reset keeps for reuse.
+// Larger buffers are left for the garbage collector so that a single large
+// token does not pin its memory for the lifetime of the tokenizer.
+const maxPooledBuf = 64 << 10
+
+var tokenizerPool = sync.Pool{
+	New: func() interface{} {
+		return &Tokenizer{}
+	},
+}
+
+// GetTokenizer returns a tokenizer reading from r.
+// The tokenizer is taken from a pool if one is available, otherwise it is
+// created as if by NewTokenizer.
+// Either way all options have their zero values.
+//
+// Tokenizers that are no longer needed may be returned to the pool by calling
+// PutTokenizer.
+func GetTokenizer(r io.Reader) *Tokenizer {
+	t := tokenizerPool.Get().(*Tokenizer)
+	t.Reset(r)
+	return t
+}
+
+// PutTokenizer resets t and returns it to the pool used by GetTokenizer.
+// The tokenizer must not be used after it is returned, and tokens returned by
+// it while ZeroCopy was set must not be retained.
+func PutTokenizer(t *Tokenizer) {
+	t.Reset(nil)
+	tokenizerPool.Put(t)
+}
+
+// Reset discards all state and options, leaving the tokenizer as it would be
+// if it had just been created by NewTokenizer(r), except that the buffers it
+// has allocated are kept so that they can be reused.
+// If r is nil the tokenizer holds no reference to its old reader and must be
+// reset again before it is used.
+func (t *Tokenizer) Reset(r io.Reader) {
+	*t = Tokenizer{
+		br:       t.br,
+		pulled:   reuse(t.pulled),
+		raw:      reuse(t.raw),
+		ns:       t.ns[:0],
+		spaces:   t.spaces[:0],
+		preserve: t.preserve[:0],
+		buf:      reuse(t.buf),
+		nameBuf:  reuse(t.nameBuf),
+		interned: t.interned,
+	}
+	if r == nil {
+		if t.br != nil {
+			t.br.Reset(nil)
+		}
+		return
+	}
+	t.setReader(r)
+}
+
+// reuse returns b truncated to zero length, or nil if it is too large to keep.
+func reuse(b []byte) []byte {
+	if cap(b) > maxPooledBuf {
+		return nil
+	}
+	return b[:0]
+}
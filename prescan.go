@@ -0,0 +1,176 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ElementRange is the range of input occupied by an element, from the start
+// of its start tag to the end of its end tag.
+type ElementRange struct {
+	Name  Name
+	Start int64
+	End   int64
+
+	// NS contains the namespace declarations made by the ancestors of the
+	// element that are still in scope at its start, as they would appear in
+	// the attributes of a start element.
+	NS []Attr
+}
+
+// Tokenizer returns a tokenizer that reads the element from b, which must be
+// the input that the range was found in.
+// Names in the element are resolved using the namespace declarations in NS
+// as well as the declarations made by the element and its descendants.
+// Offsets reported by the tokenizer are relative to the start of the range.
+func (r ElementRange) Tokenizer(b []byte) *Tokenizer {
+	t := NewTokenizerBytes(b[r.Start:r.End])
+	t.inherit(r.NS)
+	return t
+}
+
+// inherit declares namespaces outside of any element, as if by the ancestors
+// of the input.
+func (t *Tokenizer) inherit(ns []Attr) {
+	for _, a := range ns {
+		if a.Name.Space == "" {
+			t.outerSpace = a.Value
+			continue
+		}
+		t.ns = append(t.ns, nsBinding{prefix: a.Name.Local, space: a.Value})
+	}
+}
+
+// ScanElements finds the elements in b that match p without decoding their
+// attributes or content any more than is needed to find where they end.
+// If p is nil the top-level elements are found instead.
+// As with Select, elements nested inside of a matching element are never
+// matched themselves.
+//
+// The ranges may be tokenized independently, for example by ProcessRanges.
+func ScanElements(b []byte, p *Path) ([]ElementRange, error) {
+	t := NewTokenizerBytes(b)
+	t.LazyAttr = true
+	t.SkipComments = true
+	t.SkipDirectives = true
+	t.SkipWhitespace = true
+	var ranges []ElementRange
+	var path []Name
+	for {
+		tok, err := t.Token()
+		switch tok := tok.(type) {
+		case StartElement:
+			path = append(path, tok.Name)
+			if (p == nil && len(path) == 1) || (p != nil && p.Match(path)) {
+				r := ElementRange{
+					Name:  tok.Name,
+					Start: t.Span().Start.Offset,
+					NS:    t.inherited(),
+				}
+				if err := Skip(t); err != nil {
+					return ranges, err
+				}
+				r.End = t.InputOffset()
+				ranges = append(ranges, r)
+				path = path[:len(path)-1]
+			}
+		case EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return ranges, nil
+		case err != nil:
+			return ranges, err
+		}
+	}
+}
+
+// inherited returns the namespace declarations of the ancestors of the
+// innermost open element that are in scope.
+func (t *Tokenizer) inherited() []Attr {
+	var attr []Attr
+	depth := t.depth()
+	if depth > 1 {
+		if space := t.spaces[depth-2]; space != "" {
+			attr = append(attr, Attr{Name: Name{Local: "xmlns"}, Value: space})
+		}
+	} else if t.outerSpace != "" {
+		attr = append(attr, Attr{Name: Name{Local: "xmlns"}, Value: t.outerSpace})
+	}
+outer:
+	for i := len(t.ns) - 1; i >= 0; i-- {
+		b := t.ns[i]
+		if b.depth == depth {
+			continue
+		}
+		// Only the innermost binding of a prefix is in scope.
+		for _, a := range attr {
+			if a.Name.Space == "xmlns" && a.Name.Local == b.prefix {
+				continue outer
+			}
+		}
+		attr = append(attr, Attr{Name: Name{Space: "xmlns", Local: b.prefix}, Value: b.space})
+	}
+	return attr
+}
+
+// ProcessRanges calls f for each range with a tokenizer over that range of b,
+// as created by the range's Tokenizer method, and returns the results in the
+// same order as ranges.
+// Ranges are processed concurrently by up to workers goroutines, or by
+// GOMAXPROCS goroutines if workers is less than one.
+// If f returns an error no more ranges are started and the error for the
+// earliest range that failed is returned along with the results for the
+// ranges before it.
+func ProcessRanges[T any](b []byte, ranges []ElementRange, workers int, f func(ElementRange, *Tokenizer) (T, error)) ([]T, error) {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]T, len(ranges))
+	errs := make([]error, len(ranges))
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		next   int
+		failed bool
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				i := next
+				next++
+				stop := failed || i >= len(ranges)
+				mu.Unlock()
+				if stop {
+					return
+				}
+				r := ranges[i]
+				results[i], errs[i] = f(r, r.Tokenizer(b))
+				if errs[i] != nil {
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return results[:i], err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+const scanInput = `<?xml version="1.0"?>
+<!-- export -->
+<feed xmlns="urn:feed" xmlns:x="urn:x">
+ <entry id="1"><title>a &amp; b</title><x:meta/></entry>
+ <entry xmlns:x="urn:y" id="2"><x:meta><entry/></x:meta></entry>
+</feed>`
+
+var scanTestCases = [...]struct {
+	path   string
+	ranges []ElementRange
+}{
+	0: {
+		ranges: []ElementRange{{Name: Name{Space: "urn:feed", Local: "feed"}, Start: 38, End: 207}},
+	},
+	1: {
+		path: "/feed/entry",
+		ranges: []ElementRange{
+			{
+				Name:  Name{Space: "urn:feed", Local: "entry"},
+				Start: 79,
+				End:   134,
+				NS: []Attr{
+					{Name: Name{Local: "xmlns"}, Value: "urn:feed"},
+					{Name: Name{Space: "xmlns", Local: "x"}, Value: "urn:x"},
+				},
+			},
+			{
+				Name:  Name{Space: "urn:feed", Local: "entry"},
+				Start: 136,
+				End:   199,
+				NS: []Attr{
+					{Name: Name{Local: "xmlns"}, Value: "urn:feed"},
+					{Name: Name{Space: "xmlns", Local: "x"}, Value: "urn:x"},
+				},
+			},
+		},
+	},
+	2: {
+		path: "{urn:y}meta",
+		ranges: []ElementRange{
+			{
+				Name:  Name{Space: "urn:y", Local: "meta"},
+				Start: 166,
+				End:   191,
+				NS: []Attr{
+					{Name: Name{Local: "xmlns"}, Value: "urn:feed"},
+					{Name: Name{Space: "xmlns", Local: "x"}, Value: "urn:y"},
+				},
+			},
+		},
+	},
+}
+
+func TestScanElements(t *testing.T) {
+	in := []byte(scanInput)
+	for i, tc := range scanTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var p *Path
+			if tc.path != "" {
+				p = MustCompilePath(tc.path, nil)
+			}
+			ranges, err := ScanElements(in, p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(ranges, tc.ranges) {
+				t.Fatalf("wrong ranges:\nwant=%+v,\n got=%+v", tc.ranges, ranges)
+			}
+
+			// Tokenizing each range on its own must give the same tokens as
+			// selecting the elements from the whole input.
+			var want [][]Token
+			if p != nil {
+				err = Select(NewTokenizer(bytes.NewReader(in)), p, func(start StartElement, r TokenReader) error {
+					toks, err := readAll(Wrap(r, start))
+					want = append(want, toks)
+					return err
+				})
+				if err != nil {
+					t.Fatalf("unexpected error selecting elements: %v", err)
+				}
+			}
+			got, err := ProcessRanges(in, ranges, 2, func(r ElementRange, td *Tokenizer) ([]Token, error) {
+				return readAll(td)
+			})
+			if err != nil {
+				t.Fatalf("unexpected error processing ranges: %v", err)
+			}
+			if p != nil && !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong tokens:\nwant=%+v,\n got=%+v", want, got)
+			}
+		})
+	}
+}
+
+func TestProcessRangesError(t *testing.T) {
+	in := []byte(`<a/><b/><c/><d/>`)
+	ranges, err := ScanElements(in, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	errTest := errors.New("test")
+	got, err := ProcessRanges(in, ranges, 1, func(r ElementRange, td *Tokenizer) (string, error) {
+		if r.Name.Local == "c" {
+			return "", errTest
+		}
+		return r.Name.Local, nil
+	})
+	if err != errTest {
+		t.Errorf("wrong error: want=%v, got=%v", errTest, err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong results: want=%q, got=%q", want, got)
+	}
+}
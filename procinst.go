@@ -0,0 +1,56 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+)
+
+// ProcInstAttrs parses the body of a processing instruction written using the
+// common pseudo-attribute syntax, for example:
+//
+//	<?xml-stylesheet type="text/xsl" href="style.xsl"?>
+//
+// Each value must be enclosed in matching single or double quotes and
+// pseudo-attributes must be separated by whitespace.
+// Values are returned verbatim without expanding any references.
+func ProcInstAttrs(pi ProcInst) ([]Attr, error) {
+	var attrs []Attr
+	s := pi.Inst
+	for {
+		s = bytes.TrimLeft(s, xmlSpace)
+		if len(s) == 0 {
+			return attrs, nil
+		}
+		i := 0
+		for i < len(s) && isNameByte(s[i]) {
+			i++
+		}
+		if i == 0 {
+			return attrs, &SyntaxError{Msg: "expected pseudo-attribute name in processing instruction " + pi.Target}
+		}
+		name := string(s[:i])
+		s = bytes.TrimLeft(s[i:], xmlSpace)
+		if len(s) == 0 || s[0] != '=' {
+			return attrs, &SyntaxError{Msg: "expected = after pseudo-attribute " + name}
+		}
+		s = bytes.TrimLeft(s[1:], xmlSpace)
+		if len(s) == 0 || (s[0] != '"' && s[0] != '\'') {
+			return attrs, &SyntaxError{Msg: "unquoted value for pseudo-attribute " + name}
+		}
+		end := bytes.IndexByte(s[1:], s[0])
+		if end == -1 {
+			return attrs, &SyntaxError{Msg: "unterminated value for pseudo-attribute " + name}
+		}
+		attrs = append(attrs, Attr{
+			Name:  Name{Local: name},
+			Value: string(s[1 : end+1]),
+		})
+		s = s[end+2:]
+		if len(s) > 0 && !isSpace(s[0]) {
+			return attrs, &SyntaxError{Msg: "expected whitespace after pseudo-attribute " + name}
+		}
+	}
+}
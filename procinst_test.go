@@ -0,0 +1,53 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var procInstAttrsTestCases = []struct {
+	inst  string
+	attrs []Attr
+	err   bool
+}{
+	0: {},
+	1: {
+		inst: `type="text/xsl" href='x.xsl'`,
+		attrs: []Attr{
+			{Name: Name{Local: "type"}, Value: "text/xsl"},
+			{Name: Name{Local: "href"}, Value: "x.xsl"},
+		},
+	},
+	2: {
+		inst:  " a = \"it's\"\n\tb='\"' ",
+		attrs: []Attr{{Name: Name{Local: "a"}, Value: "it's"}, {Name: Name{Local: "b"}, Value: `"`}},
+	},
+	3: {inst: `a=b`, err: true},
+	4: {inst: `a="b`, err: true},
+	5: {inst: `a="b"c="d"`, err: true},
+	6: {inst: `a`, err: true},
+	7: {inst: `="b"`, err: true},
+}
+
+func TestProcInstAttrs(t *testing.T) {
+	for i, tc := range procInstAttrsTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			attrs, err := ProcInstAttrs(ProcInst{Target: "test", Inst: []byte(tc.inst)})
+			switch {
+			case tc.err && err == nil:
+				t.Fatalf("expected error, got attrs %+v", attrs)
+			case !tc.err && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case !tc.err && !reflect.DeepEqual(attrs, tc.attrs):
+				t.Fatalf("wrong attrs: want=%+v, got=%+v", tc.attrs, attrs)
+			}
+		})
+	}
+}
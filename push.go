@@ -0,0 +1,144 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// ErrNeedMoreData is returned by a PushTokenizer when the input written so far
+// ends partway through a token.
+var ErrNeedMoreData = errors.New("xml: need more data")
+
+var errClosed = errors.New("xml: write to closed tokenizer")
+
+// PushTokenizer is a Tokenizer that is fed input by calling Write instead of
+// reading from an io.Reader.
+// This allows it to be used in environments where a blocking reader is not
+// available, such as event loops.
+//
+// If the input written so far does not contain a complete token, Token returns
+// ErrNeedMoreData and the token is decoded again from its start once more input
+// has been written.
+// To keep the cost of this linear in the size of the token, Token does not
+// decode the partial token again until the input written since the last
+// attempt contains a "<" or ">" that might end it, or until the amount of new
+// input is at least as large as the partial token.
+// Tokens that contain many of these characters, such as long runs of text with
+// ">" in them, may still be decoded many times; setting CharDataChunkSize
+// bounds the amount of text that is decoded again on each attempt.
+// After Close is called Token reports io.EOF once all input has been consumed.
+type PushTokenizer struct {
+	*Tokenizer
+	buf *pushBuffer
+
+	// waiting is set if the last call to Token returned ErrNeedMoreData.
+	// partial is the length of the input that was buffered at the time, and
+	// mark and scanned are the total number of bytes that had been written
+	// when it happened and when the new input was last checked for the end of
+	// the token.
+	waiting bool
+	partial int
+	mark    int64
+	scanned int64
+}
+
+// NewPushTokenizer creates a new tokenizer that decodes input written to it.
+func NewPushTokenizer() *PushTokenizer {
+	buf := &pushBuffer{}
+	t := &Tokenizer{
+		r: buf,
+	}
+	return &PushTokenizer{
+		Tokenizer: t,
+		buf:       buf,
+	}
+}
+
+// Token returns the next XML token in the input.
+// See Tokenizer.Token for details.
+func (p *PushTokenizer) Token() (Token, error) {
+	if p.waiting && !p.buf.closed && p.r == p.buf && !p.mayComplete() {
+		return nil, ErrNeedMoreData
+	}
+	tok, err := p.Tokenizer.Token()
+	p.waiting = errors.Is(err, ErrNeedMoreData)
+	if p.waiting {
+		p.partial = p.Buffered()
+		p.mark = p.buf.total
+		p.scanned = p.buf.total
+	}
+	return tok, err
+}
+
+// mayComplete reports whether enough input has been written since Token last
+// returned ErrNeedMoreData that it is worth decoding the partial token again.
+func (p *PushTokenizer) mayComplete() bool {
+	if p.buf.total-p.mark >= int64(p.partial) {
+		return true
+	}
+	unscanned := p.buf.buf[len(p.buf.buf)-int(p.buf.total-p.scanned):]
+	p.scanned = p.buf.total
+	return bytes.ContainsAny(unscanned, "<>")
+}
+
+// Write appends p to the input.
+// It always returns len(p) and a nil error unless the tokenizer has been
+// closed.
+func (p *PushTokenizer) Write(b []byte) (int, error) {
+	if p.buf.closed {
+		return 0, errClosed
+	}
+	p.buf.write(b)
+	return len(b), nil
+}
+
+// Close marks the end of the input.
+func (p *PushTokenizer) Close() error {
+	p.buf.closed = true
+	return nil
+}
+
+// Buffered returns the number of bytes that have been written but not yet
+// consumed by the tokenizer.
+func (p *PushTokenizer) Buffered() int {
+	return len(p.buf.buf) - p.buf.off + len(p.pending)
+}
+
+// pushBuffer is an io.ByteReader that returns ErrNeedMoreData instead of
+// blocking when it runs out of input.
+type pushBuffer struct {
+	buf    []byte
+	off    int
+	total  int64
+	closed bool
+}
+
+func (b *pushBuffer) write(p []byte) {
+	if b.off == len(b.buf) {
+		b.buf = b.buf[:0]
+		b.off = 0
+	} else if b.off > cap(b.buf)/2 {
+		n := copy(b.buf, b.buf[b.off:])
+		b.buf = b.buf[:n]
+		b.off = 0
+	}
+	b.buf = append(b.buf, p...)
+	b.total += int64(len(p))
+}
+
+func (b *pushBuffer) ReadByte() (byte, error) {
+	if b.off == len(b.buf) {
+		if b.closed {
+			return 0, io.EOF
+		}
+		return 0, ErrNeedMoreData
+	}
+	c := b.buf[b.off]
+	b.off++
+	return c, nil
+}
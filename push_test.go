@@ -0,0 +1,119 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var pushTestCases = []struct {
+	in       string
+	coalesce bool
+}{
+	0: {in: `<a>foo</a>`},
+	1: {in: `<?xml version="1.0"?><a xmlns="urn:a" xmlns:b="urn:b"><b:c d='e'/><!-- f --><!DOCTYPE g [<!-- > -->]>h</a>`},
+	2: {in: `<a>foo<![CDATA[bar]]>baz<![CDAT</a>`, coalesce: true},
+	3: {in: `<a>foo<![CDATA[bar]]>baz</a>`},
+	4: {in: "<a>\n  <b xml:space='preserve'> x </b>\n</a>\n"},
+}
+
+func TestPushTokenizer(t *testing.T) {
+	for i, tc := range pushTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var want []Token
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.CoalesceCharData = tc.coalesce
+			for {
+				tok, err := td.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("error tokenizing input: %v", err)
+				}
+				want = append(want, tok)
+			}
+
+			// Feed the input one byte at a time.
+			var got []Token
+			p := NewPushTokenizer()
+			p.CoalesceCharData = tc.coalesce
+			for j := 0; j <= len(tc.in); j++ {
+				if j == len(tc.in) {
+					p.Close()
+				} else {
+					p.Write([]byte{tc.in[j]})
+				}
+				for {
+					tok, err := p.Token()
+					if errors.Is(err, ErrNeedMoreData) || err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("error tokenizing input at byte %d: %v", j, err)
+					}
+					got = append(got, tok)
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, got)
+			}
+			if off := p.InputOffset(); off != int64(len(tc.in)) {
+				t.Errorf("wrong final offset: want=%d, got=%d", len(tc.in), off)
+			}
+		})
+	}
+}
+
+func TestPushTokenizerRetries(t *testing.T) {
+	in := "<a>" + strings.Repeat("text ", 4096) + "</a>"
+	var retries int
+	p := NewPushTokenizer()
+	p.Trace = func(format string, v ...interface{}) {
+		if strings.Contains(fmt.Sprintf(format, v...), ": rewind ") {
+			retries++
+		}
+	}
+	var text int
+	for i := 0; i < len(in); i++ {
+		p.Write([]byte{in[i]})
+		for {
+			tok, err := p.Token()
+			if errors.Is(err, ErrNeedMoreData) {
+				break
+			}
+			if err != nil {
+				t.Fatalf("error tokenizing input at byte %d: %v", i, err)
+			}
+			if cd, ok := tok.(CharData); ok {
+				text += len(cd)
+			}
+		}
+	}
+	if want := len(in) - len("<a></a>"); text != want {
+		t.Errorf("wrong length of text: want=%d, got=%d", want, text)
+	}
+	// Without limiting retries the text would be decoded again after every
+	// byte.
+	if retries > 64 {
+		t.Errorf("too many retries: got=%d", retries)
+	}
+}
+
+func TestPushTokenizerWriteAfterClose(t *testing.T) {
+	p := NewPushTokenizer()
+	p.Close()
+	if _, err := p.Write([]byte("<a/>")); err == nil {
+		t.Fatalf("expected error writing to closed tokenizer")
+	}
+}
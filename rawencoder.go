@@ -0,0 +1,639 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// RawEncoder writes tokens to an output stream without the namespace prefix
+// rewriting performed by Encoder.
+// It is the counterpart to the Tokenizer: names and xmlns attributes are
+// written exactly as they are supplied.
+//
+// If the Space of a name matches a namespace declared by an xmlns attribute
+// that is in scope, the corresponding prefix (or no prefix for the default
+// namespace) is used.
+// This allows tokens returned by a Tokenizer to be written back out unchanged.
+// Otherwise, unless DeclareNamespaces is set, an error is returned: the
+// RawEncoder never writes a prefix that is not declared, and never writes an
+// element that is in no namespace inside of a default namespace declaration.
+type RawEncoder struct {
+	// Quote is the quote character used around attribute values.
+	Quote Quote
+
+	// SortAttr causes attributes to be written in a deterministic order:
+	// namespace declarations first, sorted by prefix with the default namespace
+	// first, followed by all other attributes sorted by namespace and then local
+	// name.
+	SortAttr bool
+
+	// Fidelity causes SourceTokens to be written using their original input if
+	// the token has not been modified since it was decoded, reproducing the
+	// input of a Tokenizer with SourceTokens set byte for byte.
+	// Tokens that have been modified, and tokens that are not wrapped in a
+	// SourceToken, are encoded normally.
+	// Tokens that reference entities or attribute defaults declared by a
+	// DOCTYPE are only recognized as unmodified if the DOCTYPE was written by
+	// the same encoder.
+	Fidelity bool
+
+	// Escaping controls how special characters in character data and attribute
+	// values are escaped.
+	Escaping Escaping
+
+	// DeclareNamespaces causes the Space of every element and attribute name to
+	// be treated as a namespace and xmlns attributes to be added to start
+	// elements as needed to declare them.
+	// In-scope prefixes are reused where possible; if a new prefix is needed it
+	// is generated.
+	// Declarations that are already present on a start element are kept.
+	DeclareNamespaces bool
+
+	w       *bufio.Writer
+	scopes  []rawScope
+	ns      nsStack
+	nextNS  int
+	started bool
+	doctype *doctype
+}
+
+// Quote selects the quote character used around attribute values.
+type Quote int
+
+// A list of attribute quoting styles.
+const (
+	// DoubleQuote surrounds attribute values with double quotes.
+	DoubleQuote Quote = iota
+
+	// SingleQuote surrounds attribute values with single quotes.
+	SingleQuote
+
+	// OriginalQuote uses the quote character that surrounded each attribute
+	// value in the original input.
+	// This is only known for start elements wrapped in a SourceToken, otherwise
+	// double quotes are used.
+	OriginalQuote
+)
+
+// Escaping is a set of flags that control how a RawEncoder escapes character
+// data and attribute values.
+// By default quotes are escaped using numeric character references and UTF-8
+// is written as is.
+type Escaping int
+
+// A list of escaping flags.
+const (
+	// EscapeNamed escapes quotes using the predefined entities "&apos;" and
+	// "&quot;" instead of numeric character references.
+	EscapeNamed Escaping = 1 << iota
+
+	// EscapeNonASCII escapes all characters outside of the ASCII range using
+	// hexadecimal character references.
+	EscapeNonASCII
+)
+
+type rawScope struct {
+	start     Name
+	name      string
+	selfClose bool
+}
+
+// NewRawEncoder returns a new encoder that writes to w.
+func NewRawEncoder(w io.Writer) *RawEncoder {
+	return &RawEncoder{w: bufio.NewWriter(w)}
+}
+
+// NewEncoder returns a new encoder that writes to w.
+// Unlike the encoder from encoding/xml, the returned encoder does not rewrite
+// prefixes or namespace declarations so tokens returned by a Tokenizer are
+// written back out with their original namespaces intact.
+// DeclareNamespaces is set on the returned encoder so that, as with
+// encoding/xml, names whose Space is a namespace that has not been declared
+// are written with the declarations they need.
+func NewEncoder(w io.Writer) *RawEncoder {
+	e := NewRawEncoder(w)
+	e.DeclareNamespaces = true
+	return e
+}
+
+// Encode writes the XML encoding of v to the stream.
+// Values are marshaled in the same way as Marshal, including calling
+// MarshalXML on any values that implement Marshaler, and the resulting tokens
+// are then written by e.
+//
+// Encode calls Flush before returning.
+func (e *RawEncoder) Encode(v interface{}) error {
+	return e.marshal(func(enc *Encoder) error {
+		return enc.Encode(v)
+	})
+}
+
+// EncodeElement writes the XML encoding of v to the stream, using start as the
+// outermost tag in the encoding.
+// See Encode for details.
+//
+// EncodeElement calls Flush before returning.
+func (e *RawEncoder) EncodeElement(v interface{}, start StartElement) error {
+	return e.marshal(func(enc *Encoder) error {
+		return enc.EncodeElement(v, start)
+	})
+}
+
+// marshal re-encodes the output of f.
+func (e *RawEncoder) marshal(f func(*Encoder) error) error {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	err := f(enc)
+	if err != nil {
+		return err
+	}
+	if err = enc.Flush(); err != nil {
+		return err
+	}
+	t := NewTokenizer(&buf)
+	t.SourceTokens = true
+	for {
+		tok, err := t.Token()
+		if err == io.EOF {
+			return e.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		st := tok.(SourceToken)
+		switch tok := st.Token.(type) {
+		case CharData:
+			if bytes.HasPrefix(st.Source, cdataStart) {
+				err = e.EncodeToken(CDATA(tok))
+				break
+			}
+			err = e.EncodeToken(tok)
+		default:
+			err = e.EncodeToken(tok)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// EncodeToken writes the given XML token to the stream.
+// It returns an error if StartElement and EndElement tokens are not properly
+// matched or if a token cannot be represented in XML.
+//
+// EncodeToken does not call Flush, because usually it is part of a larger
+// operation such as encoding a whole stream.
+func (e *RawEncoder) EncodeToken(t Token) error {
+	if len(e.scopes) > 0 && e.scopes[len(e.scopes)-1].selfClose {
+		if _, ok := unwrapSource(t).(EndElement); !ok {
+			return fmt.Errorf("xml: EncodeToken inside of self-closing element")
+		}
+	}
+	if dir, ok := unwrapSource(t).(Directive); ok {
+		// The DOCTYPE is needed to compare the source of later tokens that
+		// reference the entities it declares.
+		if d := parseDoctype(dir); d != nil {
+			e.doctype = d
+		}
+	}
+	if st, ok := t.(SourceToken); ok && e.Fidelity {
+		written, err := e.writeSource(st)
+		if written || err != nil {
+			return err
+		}
+	}
+	switch tok := unwrapSource(t).(type) {
+	case ProcInst:
+		if tok.Target == "xml" && e.started {
+			return fmt.Errorf("xml: EncodeToken of ProcInst xml target only valid for xml declaration, first token encoded")
+		}
+	case Declaration:
+		if e.started {
+			return fmt.Errorf("xml: EncodeToken of ProcInst xml target only valid for xml declaration, first token encoded")
+		}
+	}
+	e.started = true
+	switch tok := unwrapSource(t).(type) {
+	case StartElement:
+		var quotes []byte
+		var src *StartElement
+		if st, ok := t.(SourceToken); ok {
+			if e.Quote == OriginalQuote {
+				quotes = attrQuotes(st.Source)
+				if len(quotes) != len(tok.Attr) {
+					quotes = nil
+				}
+			}
+			if orig, ok := decodeSource(st.Source, e.doctype).(StartElement); ok && len(orig.Attr) == len(tok.Attr) {
+				src = &orig
+			}
+		}
+		return e.writeStart(tok, quotes, src)
+	case EndElement:
+		return e.writeEnd(tok)
+	case CharData:
+		return e.escape(tok, false)
+	case CDATA:
+		return e.writeCDATA(tok)
+	case Comment:
+		if bytes.Contains(tok, endComment[:2]) {
+			return fmt.Errorf("xml: EncodeToken of Comment containing --> marker")
+		}
+		/* #nosec */
+		e.w.WriteString("<!--")
+		/* #nosec */
+		e.w.Write(tok)
+		_, err := e.w.WriteString("-->")
+		return err
+	case ProcInst:
+		return e.writeProcInst(tok)
+	case Declaration:
+		return e.writeProcInst(tok.ProcInst())
+	case Directive:
+		if !isValidDirective(tok) {
+			return fmt.Errorf("xml: EncodeToken of Directive containing wrong < or > markers")
+		}
+		/* #nosec */
+		e.w.WriteString("<!")
+		/* #nosec */
+		e.w.Write(tok)
+		return e.w.WriteByte('>')
+	}
+	return fmt.Errorf("xml: EncodeToken of invalid token type")
+}
+
+// Flush flushes any buffered XML to the underlying writer.
+func (e *RawEncoder) Flush() error {
+	return e.w.Flush()
+}
+
+// escape writes s escaped in the same way as EscapeText, modified by the
+// escaping flags.
+// Newlines are only escaped in attribute values.
+func (e *RawEncoder) escape(s []byte, attr bool) error {
+	var last int
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRune(s[i:])
+		var esc string
+		switch {
+		case r == '"' && e.Escaping&EscapeNamed != 0:
+			esc = "&quot;"
+		case r == '"':
+			esc = "&#34;"
+		case r == '\'' && e.Escaping&EscapeNamed != 0:
+			esc = "&apos;"
+		case r == '\'':
+			esc = "&#39;"
+		case r == '&':
+			esc = "&amp;"
+		case r == '<':
+			esc = "&lt;"
+		case r == '>':
+			esc = "&gt;"
+		case r == '\t':
+			esc = "&#x9;"
+		case r == '\n' && attr:
+			esc = "&#xA;"
+		case r == '\r':
+			esc = "&#xD;"
+		case (r == utf8.RuneError && width == 1) || !isInCharacterRange(r):
+			esc = "\uFFFD"
+			if e.Escaping&EscapeNonASCII != 0 {
+				esc = "&#xfffd;"
+			}
+		case r >= utf8.RuneSelf && e.Escaping&EscapeNonASCII != 0:
+			esc = "&#x" + strconv.FormatInt(int64(r), 16) + ";"
+		default:
+			i += width
+			continue
+		}
+		/* #nosec */
+		e.w.Write(s[last:i])
+		/* #nosec */
+		e.w.WriteString(esc)
+		i += width
+		last = i
+	}
+	_, err := e.w.Write(s[last:])
+	return err
+}
+
+// writeCDATA writes a CDATA section, splitting it around any "]]>".
+func (e *RawEncoder) writeCDATA(data []byte) error {
+	/* #nosec */
+	e.w.Write(cdataStart)
+	for {
+		i := bytes.Index(data, cdataEnd)
+		if i == -1 {
+			break
+		}
+		// Split between the "]]" and ">" so that neither section contains the
+		// end marker.
+		/* #nosec */
+		e.w.Write(data[:i+2])
+		/* #nosec */
+		e.w.Write(cdataEnd)
+		/* #nosec */
+		e.w.Write(cdataStart)
+		data = data[i+2:]
+	}
+	/* #nosec */
+	e.w.Write(data)
+	_, err := e.w.Write(cdataEnd)
+	return err
+}
+
+func (e *RawEncoder) writeProcInst(tok ProcInst) error {
+	if tok.Target == "" {
+		return fmt.Errorf("xml: EncodeToken of ProcInst with invalid Target")
+	}
+	if bytes.Contains(tok.Inst, endProcInst) {
+		return fmt.Errorf("xml: EncodeToken of ProcInst containing ?> marker")
+	}
+	/* #nosec */
+	e.w.WriteString("<?")
+	/* #nosec */
+	e.w.WriteString(tok.Target)
+	if len(tok.Inst) > 0 {
+		/* #nosec */
+		e.w.WriteByte(' ')
+		/* #nosec */
+		e.w.Write(tok.Inst)
+	}
+	_, err := e.w.WriteString("?>")
+	return err
+}
+
+// writeStart writes a start element.
+// If src is non-nil it is the start element as it appeared in the input, and
+// the prefixes used in the input are preferred.
+func (e *RawEncoder) writeStart(start StartElement, quotes []byte, src *StartElement) error {
+	if start.Name.Local == "" {
+		return fmt.Errorf("xml: start tag with no name")
+	}
+	var decls []Attr
+	if e.DeclareNamespaces {
+		start, decls = e.declare(start)
+		if quotes != nil {
+			quotes = append(bytes.Repeat([]byte{'"'}, len(decls)), quotes...)
+		}
+	}
+	name, err := e.push(start, src)
+	if err != nil {
+		return err
+	}
+	// Qualify the attribute names before writing anything so that an error
+	// leaves the output unchanged.
+	qnames := make([]string, len(start.Attr))
+	for i, a := range start.Attr {
+		if a.Name.Local == "" {
+			continue
+		}
+		var prefer string
+		if src != nil && i >= len(decls) {
+			prefer = src.Attr[i-len(decls)].Name.Space
+		}
+		qnames[i], err = e.qualify(a.Name, true, prefer)
+		if err != nil {
+			e.pop()
+			return err
+		}
+	}
+
+	/* #nosec */
+	e.w.WriteByte('<')
+	/* #nosec */
+	e.w.WriteString(name)
+	order := make([]int, len(start.Attr))
+	for i := range order {
+		order[i] = i
+	}
+	if e.SortAttr {
+		sort.SliceStable(order, func(i, j int) bool {
+			return attrLess(start.Attr[order[i]].Name, start.Attr[order[j]].Name)
+		})
+	}
+	for _, i := range order {
+		a := start.Attr[i]
+		if a.Name.Local == "" {
+			continue
+		}
+		quote := byte('"')
+		switch {
+		case quotes != nil:
+			quote = quotes[i]
+		case e.Quote == SingleQuote:
+			quote = '\''
+		}
+		/* #nosec */
+		e.w.WriteByte(' ')
+		/* #nosec */
+		e.w.WriteString(qnames[i])
+		/* #nosec */
+		e.w.WriteByte('=')
+		/* #nosec */
+		e.w.WriteByte(quote)
+		err = e.escape([]byte(a.Value), true)
+		if err != nil {
+			return err
+		}
+		/* #nosec */
+		e.w.WriteByte(quote)
+	}
+	return e.w.WriteByte('>')
+}
+
+// declare returns start with any namespace declarations that are needed to
+// write it added to the front of its attributes, and the added declarations.
+func (e *RawEncoder) declare(start StartElement) (StartElement, []Attr) {
+	own := xmlnsDecls(start.Attr)
+	var decls []Attr
+	add := func(prefix, space string) {
+		own = append(own, nsDecl{prefix: prefix, space: space})
+		if prefix == "" {
+			decls = append(decls, Attr{Name: Name{Local: "xmlns"}, Value: space})
+			return
+		}
+		decls = append(decls, Attr{Name: Name{Space: "xmlns", Local: prefix}, Value: space})
+	}
+	needsPrefix := func(space string) {
+		if _, ok := e.ns.prefixFor(own, space); ok {
+			return
+		}
+		for {
+			e.nextNS++
+			prefix := "ns" + strconv.Itoa(e.nextNS)
+			if _, ok := lookupPrefix(own, prefix); ok {
+				continue
+			}
+			if _, ok := e.ns.lookup(prefix); ok {
+				continue
+			}
+			add(prefix, space)
+			return
+		}
+	}
+
+	switch start.Name.Space {
+	case "xml", xmlURL, "xmlns":
+	default:
+		def, ownDef := lookupPrefix(own, "")
+		if !ownDef {
+			def, _ = e.ns.lookup("")
+		}
+		switch {
+		case def == start.Name.Space:
+		case !ownDef && start.Name.Space == "":
+			add("", "")
+		case start.Name.Space == "":
+			// The element has its own conflicting default namespace declaration
+			// and cannot be written in no namespace.
+		case !ownDef:
+			if _, ok := e.ns.prefixFor(own, start.Name.Space); !ok {
+				add("", start.Name.Space)
+			}
+		default:
+			needsPrefix(start.Name.Space)
+		}
+	}
+	for _, a := range start.Attr {
+		switch a.Name.Space {
+		case "", "xml", xmlURL, "xmlns":
+			continue
+		}
+		needsPrefix(a.Name.Space)
+	}
+	if len(decls) == 0 {
+		return start, nil
+	}
+	start.Attr = append(append([]Attr(nil), decls...), start.Attr...)
+	return start, decls
+}
+
+// push opens the scope of a start element and returns its qualified name.
+// If src is non-nil it is the start element as it appeared in the input, with
+// its prefixes unresolved, and the original prefixes are preferred.
+// If the name cannot be written the scope is not opened.
+func (e *RawEncoder) push(start StartElement, src *StartElement) (string, error) {
+	e.scopes = append(e.scopes, rawScope{start: start.Name})
+	e.ns.push(xmlnsDecls(start.Attr)...)
+	var prefer string
+	if src != nil {
+		prefer = src.Name.Space
+	}
+	name, err := e.qualify(start.Name, false, prefer)
+	if err != nil {
+		e.pop()
+		return "", err
+	}
+	e.scopes[len(e.scopes)-1].name = name
+	return name, nil
+}
+
+// pop closes the scope of the innermost element.
+func (e *RawEncoder) pop() {
+	e.scopes = e.scopes[:len(e.scopes)-1]
+	e.ns.pop()
+}
+
+// attrLess reports whether the attribute named a sorts before the attribute
+// named b.
+func attrLess(a, b Name) bool {
+	aDecl := a.Space == "xmlns" || (a.Space == "" && a.Local == "xmlns")
+	bDecl := b.Space == "xmlns" || (b.Space == "" && b.Local == "xmlns")
+	switch {
+	case aDecl && bDecl:
+		return a.Space < b.Space || (a.Space == b.Space && a.Local < b.Local)
+	case aDecl != bDecl:
+		return aDecl
+	case a.Space != b.Space:
+		return a.Space < b.Space
+	}
+	return a.Local < b.Local
+}
+
+// attrQuotes returns the quote character used by each attribute in the source
+// of a start element.
+func attrQuotes(src []byte) []byte {
+	var quotes []byte
+	var quote byte
+	for _, b := range src {
+		switch {
+		case quote != 0:
+			if b == quote {
+				quote = 0
+			}
+		case b == '"' || b == '\'':
+			quote = b
+			quotes = append(quotes, b)
+		}
+	}
+	return quotes
+}
+
+func (e *RawEncoder) writeEnd(end EndElement) error {
+	if end.Name.Local == "" {
+		return fmt.Errorf("xml: end tag with no name")
+	}
+	if len(e.scopes) == 0 {
+		return fmt.Errorf("xml: end tag </%s> without start tag", end.Name.Local)
+	}
+	scope := e.scopes[len(e.scopes)-1]
+	switch {
+	case scope.start.Local != end.Name.Local:
+		return fmt.Errorf("xml: end tag </%s> does not match start tag <%s>", end.Name.Local, scope.start.Local)
+	case scope.start.Space != end.Name.Space:
+		return fmt.Errorf("xml: end tag </%s> in namespace %s does not match start tag <%s> in namespace %s", end.Name.Local, end.Name.Space, scope.start.Local, scope.start.Space)
+	}
+	e.pop()
+	if scope.selfClose {
+		return nil
+	}
+	/* #nosec */
+	e.w.WriteString("</")
+	/* #nosec */
+	e.w.WriteString(scope.name)
+	return e.w.WriteByte('>')
+}
+
+// qualify returns the name as it should be written in the current scope.
+// Attributes are never placed in the default namespace.
+// If the name cannot be written without a namespace declaration that is not in
+// scope an error is returned.
+func (e *RawEncoder) qualify(name Name, attr bool, prefer string) (string, error) {
+	switch name.Space {
+	case "":
+		if space, _ := e.ns.lookup(""); !attr && space != "" {
+			return "", fmt.Errorf("xml: element %s in no namespace is in the scope of the default namespace %s", name.Local, space)
+		}
+		return name.Local, nil
+	case "xmlns", "xml":
+		return name.Space + ":" + name.Local, nil
+	case xmlURL:
+		return "xml:" + name.Local, nil
+	}
+	if prefer != "" && prefer != "xmlns" {
+		if space, _ := e.ns.lookup(prefer); space == name.Space {
+			return prefer + ":" + name.Local, nil
+		}
+	}
+	if !attr {
+		if space, _ := e.ns.lookup(""); space == name.Space {
+			return name.Local, nil
+		}
+	}
+	if prefix, ok := e.ns.prefixFor(nil, name.Space); ok {
+		return prefix + ":" + name.Local, nil
+	}
+	return "", fmt.Errorf("xml: namespace %s of %s is not declared", name.Space, name.Local)
+}
@@ -0,0 +1,513 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var rawEncoderRoundTripTestCases = []string{
+	0: `<stream:stream xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams" to="example.net" version="1.0"><stream:features></stream:features><message xml:lang="en"><body>hi</body></message></stream:stream>`,
+	1: `<a xmlns:b="urn:b"><b:c b:d="e"><b:f xmlns:b="urn:f"></b:f></b:c></a>`,
+	2: `<?xml version="1.0"?><!DOCTYPE a><a><!-- b --><?c d?>e f</a>`,
+	3: `<a xmlns="urn:a"><b xmlns=""><c></c></b></a>`,
+}
+
+func TestRawEncoderRoundTrip(t *testing.T) {
+	for i, tc := range rawEncoderRoundTripTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc))
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			for {
+				tok, err := td.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error decoding: %v", err)
+				}
+				err = e.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err := e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc {
+				t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc, s)
+			}
+		})
+	}
+}
+
+var rawEncoderTestCases = []struct {
+	toks []Token
+	out  string
+	err  bool
+}{
+	0: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "stream", Local: "stream"}},
+			EndElement{Name: Name{Space: "stream", Local: "stream"}},
+		},
+		err: true,
+	},
+	1: {
+		toks: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "b"}, Value: `"<&>"`}}},
+			CharData("<&>"),
+			EndElement{Name: Name{Local: "a"}},
+		},
+		out: `<a b="&#34;&lt;&amp;&gt;&#34;">&lt;&amp;&gt;</a>`,
+	},
+	2: {
+		toks: []Token{Declaration{Version: "1.0", Encoding: "UTF-8"}},
+		out:  `<?xml version="1.0" encoding="UTF-8"?>`,
+	},
+	3: {
+		toks: []Token{EndElement{Name: Name{Local: "a"}}},
+		err:  true,
+	},
+	4: {
+		toks: []Token{
+			StartElement{Name: Name{Local: "a"}},
+			EndElement{Name: Name{Local: "b"}},
+		},
+		err: true,
+	},
+	5: {
+		toks: []Token{Comment("a--b")},
+		err:  true,
+	},
+	6: {
+		toks: []Token{ProcInst{Target: "a", Inst: []byte("?>")}},
+		err:  true,
+	},
+	7: {
+		toks: []Token{Directive("a>")},
+		err:  true,
+	},
+	8: {
+		toks: []Token{SourceToken{Token: CharData("a"), Source: []byte("b")}},
+		out:  `a`,
+	},
+	9: {
+		toks: []Token{CDATA("a]]>b<]]>")},
+		out:  `<![CDATA[a]]]]><![CDATA[>b<]]]]><![CDATA[>]]>`,
+	},
+	10: {
+		toks: []Token{CDATA("")},
+		out:  `<![CDATA[]]>`,
+	},
+	11: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "a"}, Attr: []Attr{{Name: Name{Local: "xmlns"}, Value: "urn:a"}}},
+			StartElement{Name: Name{Local: "b"}},
+		},
+		err: true,
+	},
+	12: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "a"}, Attr: []Attr{{Name: Name{Space: "xmlns", Local: "b"}, Value: "urn:a"}}},
+			StartElement{Name: Name{Space: "urn:b", Local: "c"}, Attr: []Attr{{Name: Name{Space: "xmlns", Local: "b"}, Value: "urn:b"}}},
+			StartElement{Name: Name{Space: "urn:a", Local: "d"}},
+		},
+		err: true,
+	},
+	13: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "a"}, Attr: []Attr{{Name: Name{Local: "xmlns"}, Value: "urn:a"}}},
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{{Name: Name{Local: "xmlns"}, Value: ""}}},
+		},
+		out: `<a xmlns="urn:a"><b xmlns="">`,
+	},
+}
+
+func TestRawEncoder(t *testing.T) {
+	for i, tc := range rawEncoderTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			var err error
+			for _, tok := range tc.toks {
+				err = e.EncodeToken(tok)
+				if err != nil {
+					break
+				}
+			}
+			switch {
+			case tc.err && err == nil:
+				t.Fatalf("expected error, got none")
+			case !tc.err && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if !tc.err {
+				if s := buf.String(); s != tc.out {
+					t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc.out, s)
+				}
+			}
+		})
+	}
+}
+
+var rawEncoderPrefixTestCases = []struct {
+	in     string
+	source bool
+	out    string
+}{
+	0: {
+		in:  `<a xmlns:x="urn:u" xmlns:y="urn:u"><y:b x:c="d"></y:b></a>`,
+		out: `<a xmlns:x="urn:u" xmlns:y="urn:u"><y:b y:c="d"></y:b></a>`,
+	},
+	1: {
+		in:     `<a xmlns:y="urn:u" xmlns:x="urn:u"><y:b y:c="d"></y:b><x:e></x:e></a>`,
+		source: true,
+		out:    `<a xmlns:y="urn:u" xmlns:x="urn:u"><y:b y:c="d"></y:b><x:e></x:e></a>`,
+	},
+	2: {
+		in:     `<a xmlns="urn:u" xmlns:p="urn:u"><p:b></p:b><b></b></a>`,
+		source: true,
+		out:    `<a xmlns="urn:u" xmlns:p="urn:u"><p:b></p:b><b></b></a>`,
+	},
+	3: {
+		in:  `<a xmlns:x="urn:u"><b xmlns:y="urn:u"><x:c></x:c></b></a>`,
+		out: `<a xmlns:x="urn:u"><b xmlns:y="urn:u"><y:c></y:c></b></a>`,
+	},
+}
+
+func TestRawEncoderPrefix(t *testing.T) {
+	for i, tc := range rawEncoderPrefixTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			// Map iteration order is random, so encode the same input several times
+			// to make sure that the choice of prefix does not depend on it.
+			for n := 0; n < 50; n++ {
+				td := NewTokenizer(strings.NewReader(tc.in))
+				td.SourceTokens = tc.source
+				var buf strings.Builder
+				e := NewRawEncoder(&buf)
+				for {
+					tok, err := td.Token()
+					if err == io.EOF {
+						break
+					}
+					if err != nil {
+						t.Fatalf("unexpected error decoding: %v", err)
+					}
+					err = e.EncodeToken(tok)
+					if err != nil {
+						t.Fatalf("unexpected error encoding: %v", err)
+					}
+				}
+				if err := e.Flush(); err != nil {
+					t.Fatalf("unexpected error flushing: %v", err)
+				}
+				if s := buf.String(); s != tc.out {
+					t.Fatalf("wrong output on attempt %d:\nwant=%s,\n got=%s", n, tc.out, s)
+				}
+			}
+		})
+	}
+}
+
+var rawEncoderQuoteTestCases = []struct {
+	quote Quote
+	out   string
+}{
+	0: {quote: DoubleQuote, out: `<a b="c" d="&#39;e&#39;" f="&#34;g&#34;"></a>`},
+	1: {quote: SingleQuote, out: `<a b='c' d='&#39;e&#39;' f='&#34;g&#34;'></a>`},
+	2: {quote: OriginalQuote, out: `<a b='c' d="&#39;e&#39;" f='&#34;g&#34;'></a>`},
+}
+
+func TestRawEncoderQuote(t *testing.T) {
+	const in = `<a b='c' d="'e'" f='"g"'></a>`
+	for i, tc := range rawEncoderQuoteTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(in))
+			td.SourceTokens = true
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			e.Quote = tc.quote
+			toks, err := readAll(td)
+			if err != nil {
+				t.Fatalf("unexpected error decoding: %v", err)
+			}
+			for _, tok := range toks {
+				err = e.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc.out, s)
+			}
+		})
+	}
+}
+
+func TestRawEncoderSortAttr(t *testing.T) {
+	const (
+		in  = `<a z="1" xmlns:y="urn:y" y:b="2" xmlns="urn:a" b="3" xmlns:c="urn:c" c:a="4" xml:lang="en"></a>`
+		out = `<a xmlns="urn:a" xmlns:c="urn:c" xmlns:y="urn:y" b="3" z="1" c:a="4" y:b="2" xml:lang="en"></a>`
+	)
+	var buf strings.Builder
+	e := NewRawEncoder(&buf)
+	e.SortAttr = true
+	toks, err := readAll(NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	for _, tok := range toks {
+		err = e.EncodeToken(tok)
+		if err != nil {
+			t.Fatalf("unexpected error encoding: %v", err)
+		}
+	}
+	if err = e.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	if s := buf.String(); s != out {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+}
+
+func TestRawEncoderFidelity(t *testing.T) {
+	const in = `<?xml version='1.0'  encoding="UTF-8"?>
+<!DOCTYPE a>
+<a  xmlns="urn:a"
+	xmlns:b='urn:b' b:c = "d&amp;e" ><b:f/><g ></g ><![CDATA[<h>]]>i &lt; j<?k l ?><!-- m --><n/></a>`
+	td := NewTokenizer(strings.NewReader(in))
+	td.SourceTokens = true
+	td.DecodeDeclaration = true
+	var buf strings.Builder
+	e := NewRawEncoder(&buf)
+	e.Fidelity = true
+	toks, err := readAll(td)
+	if err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	for _, tok := range toks {
+		if st, ok := tok.(SourceToken); ok {
+			if start, ok := st.Token.(StartElement); ok && start.Name.Local == "n" {
+				// Modifying a token causes it to be encoded normally.
+				start.Attr = append(start.Attr, Attr{Name: Name{Local: "o"}, Value: "p"})
+				st.Token = start
+				tok = st
+			}
+		}
+		err = e.EncodeToken(tok)
+		if err != nil {
+			t.Fatalf("unexpected error encoding: %v", err)
+		}
+	}
+	if err = e.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	out := in[:len(in)-len(`<n/></a>`)] + `<n o="p"></n></a>`
+	if s := buf.String(); s != out {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+}
+
+var rawEncoderFidelityDoctypeTestCases = []string{
+	0: `<!DOCTYPE a [<!ENTITY e "x">]><a>&e;</a>`,
+	1: `<!DOCTYPE a [<!ENTITY e "x"><!ATTLIST a b CDATA "c">]><a d="&e;">&e; &amp; y</a>`,
+	2: `<!DOCTYPE a [<!ATTLIST a b NMTOKENS #IMPLIED>]><a b="  c  d "/>`,
+}
+
+func TestRawEncoderFidelityDoctype(t *testing.T) {
+	for i, tc := range rawEncoderFidelityDoctypeTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc))
+			td.SourceTokens = true
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			e.Fidelity = true
+			toks, err := readAll(td)
+			if err != nil {
+				t.Fatalf("unexpected error decoding: %v", err)
+			}
+			for _, tok := range toks {
+				err = e.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc {
+				t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc, s)
+			}
+		})
+	}
+}
+
+func TestRawEncoderFidelitySelfClose(t *testing.T) {
+	td := NewTokenizer(strings.NewReader(`<a/>`))
+	td.SourceTokens = true
+	e := NewRawEncoder(&strings.Builder{})
+	e.Fidelity = true
+	tok, err := td.Token()
+	if err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	err = e.EncodeToken(tok)
+	if err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+	err = e.EncodeToken(CharData("b"))
+	if err == nil {
+		t.Fatalf("expected error encoding inside of self-closing element")
+	}
+}
+
+var rawEncoderEscapingTestCases = []struct {
+	escaping Escaping
+	out      string
+}{
+	0: {out: `<a b="&#39;&#34;白">&#39;&#34;&amp;白` + "\n</a>"},
+	1: {escaping: EscapeNamed, out: `<a b="&apos;&quot;白">&apos;&quot;&amp;白` + "\n</a>"},
+	2: {escaping: EscapeNonASCII, out: `<a b="&#39;&#34;&#x767d;">&#39;&#34;&amp;&#x767d;` + "\n</a>"},
+	3: {escaping: EscapeNamed | EscapeNonASCII, out: `<a b="&apos;&quot;&#x767d;">&apos;&quot;&amp;&#x767d;` + "\n</a>"},
+}
+
+func TestRawEncoderEscaping(t *testing.T) {
+	for i, tc := range rawEncoderEscapingTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			e.Escaping = tc.escaping
+			toks := []Token{
+				StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "b"}, Value: `'"白`}}},
+				CharData("'\"&白\n"),
+				EndElement{Name: Name{Local: "a"}},
+			}
+			for _, tok := range toks {
+				err := e.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err := e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc.out, s)
+			}
+		})
+	}
+}
+
+var declareNamespacesTestCases = []struct {
+	toks []Token
+	out  string
+}{
+	0: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "a"}},
+			StartElement{Name: Name{Space: "urn:a", Local: "b"}, Attr: []Attr{{Name: Name{Space: "urn:c", Local: "x"}, Value: "1"}}},
+			StartElement{Name: Name{Local: "c"}},
+			EndElement{Name: Name{Local: "c"}},
+			EndElement{Name: Name{Space: "urn:a", Local: "b"}},
+			EndElement{Name: Name{Space: "urn:a", Local: "a"}},
+		},
+		out: `<a xmlns="urn:a"><b xmlns:ns1="urn:c" ns1:x="1"><c xmlns=""></c></b></a>`,
+	},
+	1: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "a"}, Attr: []Attr{{Name: Name{Space: "xmlns", Local: "p"}, Value: "urn:b"}}},
+			StartElement{Name: Name{Space: "urn:b", Local: "b"}, Attr: []Attr{{Name: Name{Space: "urn:b", Local: "c"}, Value: "d"}}},
+			EndElement{Name: Name{Space: "urn:b", Local: "b"}},
+			EndElement{Name: Name{Space: "urn:a", Local: "a"}},
+		},
+		out: `<a xmlns="urn:a" xmlns:p="urn:b"><p:b p:c="d"></p:b></a>`,
+	},
+	2: {
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:y", Local: "a"}, Attr: []Attr{{Name: Name{Local: "xmlns"}, Value: "urn:x"}}},
+			EndElement{Name: Name{Space: "urn:y", Local: "a"}},
+		},
+		out: `<ns1:a xmlns:ns1="urn:y" xmlns="urn:x"></ns1:a>`,
+	},
+	3: {
+		toks: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Space: "xmlns", Local: "ns1"}, Value: "urn:z"}}},
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{{Name: Name{Space: "urn:q", Local: "c"}, Value: "d"}, {Name: Name{Space: "xml", Local: "lang"}, Value: "en"}}},
+			EndElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+		out: `<a xmlns:ns1="urn:z"><b xmlns:ns2="urn:q" ns2:c="d" xml:lang="en"></b></a>`,
+	},
+}
+
+func TestRawEncoderDeclareNamespaces(t *testing.T) {
+	for i, tc := range declareNamespacesTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var buf strings.Builder
+			e := NewRawEncoder(&buf)
+			e.DeclareNamespaces = true
+			for _, tok := range tc.toks {
+				err := e.EncodeToken(tok)
+				if err != nil {
+					t.Fatalf("unexpected error encoding: %v", err)
+				}
+			}
+			if err := e.Flush(); err != nil {
+				t.Fatalf("unexpected error flushing: %v", err)
+			}
+			if s := buf.String(); s != tc.out {
+				t.Fatalf("wrong output:\nwant=%s,\n got=%s", tc.out, s)
+			}
+		})
+	}
+}
+
+type encodeTest struct {
+	XMLName Name   `xml:"urn:a a"`
+	B       string `xml:"b,attr"`
+	C       string `xml:"c"`
+	D       string `xml:",cdata"`
+}
+
+func TestNewEncoderEncode(t *testing.T) {
+	var buf strings.Builder
+	e := NewEncoder(&buf)
+	err := e.EncodeToken(StartElement{
+		Name: Name{Space: "http://etherx.jabber.org/streams", Local: "stream"},
+		Attr: []Attr{
+			{Name: Name{Local: "xmlns"}, Value: "jabber:client"},
+			{Name: Name{Space: "xmlns", Local: "stream"}, Value: "http://etherx.jabber.org/streams"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error encoding token: %v", err)
+	}
+	err = e.Encode(encodeTest{B: `"&"`, C: "<c>", D: "]]>"})
+	if err != nil {
+		t.Fatalf("unexpected error encoding value: %v", err)
+	}
+	err = e.EncodeElement("e", StartElement{Name: Name{Local: "e"}})
+	if err != nil {
+		t.Fatalf("unexpected error encoding element: %v", err)
+	}
+	const out = `<stream:stream xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams">` +
+		`<a xmlns="urn:a" b="&#34;&amp;&#34;"><c>&lt;c&gt;</c><![CDATA[]]]]><![CDATA[>]]></a><e xmlns="">e</e>`
+	if s := buf.String(); s != out {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+}
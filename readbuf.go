@@ -0,0 +1,155 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	defaultBufSize = 4096
+	minBufSize     = 16
+	// maxEmptyReads is the number of times that a reader may return no data and
+	// no error before it is considered broken.
+	maxEmptyReads = 100
+)
+
+// NewTokenizerSize is like NewTokenizer except that if r does not implement
+// io.ByteReader the buffer that the tokenizer reads it through has size bytes
+// instead of the default 4096.
+// Larger buffers mean fewer calls to Read and longer runs of input that can be
+// scanned at once, smaller buffers use less memory per tokenizer.
+// Sizes smaller than 16 are increased to 16.
+func NewTokenizerSize(r io.Reader, size int) *Tokenizer {
+	if size < minBufSize {
+		size = minBufSize
+	}
+	return NewTokenizerBuffer(r, make([]byte, size))
+}
+
+// NewTokenizerBuffer is like NewTokenizerSize except that if r does not
+// implement io.ByteReader it is read through buf, which allows memory to be
+// allocated ahead of time or shared between tokenizers that are never used at
+// the same time.
+// The full capacity of buf is used, and buf must not be used by anything else
+// while the tokenizer is reading from r.
+// If the capacity of buf is less than 16 a new buffer is allocated instead.
+func NewTokenizerBuffer(r io.Reader, buf []byte) *Tokenizer {
+	if cap(buf) < minBufSize {
+		buf = make([]byte, minBufSize)
+	}
+	t := &Tokenizer{br: &readBuffer{buf: buf[:cap(buf)]}}
+	t.setReader(r)
+	return t
+}
+
+// readBuffer is like a bufio.Reader except that its buffer may be provided by
+// the caller.
+// It implements bufferedByteReader.
+type readBuffer struct {
+	buf  []byte
+	rd   io.Reader
+	r, w int
+	err  error
+}
+
+func newReadBuffer(rd io.Reader) *readBuffer {
+	return &readBuffer{buf: make([]byte, defaultBufSize), rd: rd}
+}
+
+// Reset discards any buffered data and switches to reading from rd.
+func (b *readBuffer) Reset(rd io.Reader) {
+	b.rd = rd
+	b.r = 0
+	b.w = 0
+	b.err = nil
+}
+
+// fill reads a new chunk into the buffer after moving any unread data to the
+// front.
+func (b *readBuffer) fill() {
+	if b.r > 0 {
+		copy(b.buf, b.buf[b.r:b.w])
+		b.w -= b.r
+		b.r = 0
+	}
+	for i := 0; i < maxEmptyReads; i++ {
+		n, err := b.rd.Read(b.buf[b.w:])
+		b.w += n
+		if err != nil {
+			b.err = err
+			return
+		}
+		if n > 0 {
+			return
+		}
+	}
+	b.err = io.ErrNoProgress
+}
+
+func (b *readBuffer) readErr() error {
+	err := b.err
+	b.err = nil
+	return err
+}
+
+func (b *readBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.r == b.w {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+		b.fill()
+		if b.r == b.w {
+			return 0, b.readErr()
+		}
+	}
+	n := copy(p, b.buf[b.r:b.w])
+	b.r += n
+	return n, nil
+}
+
+func (b *readBuffer) ReadByte() (byte, error) {
+	for b.r == b.w {
+		if b.err != nil {
+			return 0, b.readErr()
+		}
+		b.fill()
+	}
+	c := b.buf[b.r]
+	b.r++
+	return c, nil
+}
+
+// Buffered returns the number of bytes that can be read without reading from
+// the underlying reader.
+func (b *readBuffer) Buffered() int {
+	return b.w - b.r
+}
+
+// Peek returns the next n buffered bytes without consuming them.
+// Like Discard it never reads from the underlying reader, so if fewer than n
+// bytes are buffered it returns all of them and bufio.ErrBufferFull.
+func (b *readBuffer) Peek(n int) ([]byte, error) {
+	if avail := b.w - b.r; n > avail {
+		return b.buf[b.r:b.w], bufio.ErrBufferFull
+	}
+	return b.buf[b.r : b.r+n], nil
+}
+
+// Discard skips the next n buffered bytes.
+// Unlike bufio.Reader it never reads from the underlying reader, since the
+// tokenizer only ever discards input that it has already peeked.
+func (b *readBuffer) Discard(n int) (int, error) {
+	if avail := b.w - b.r; n > avail {
+		b.r = b.w
+		return avail, io.EOF
+	}
+	b.r += n
+	return n, nil
+}
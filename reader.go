@@ -0,0 +1,177 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// Skip reads tokens until it has consumed the end element matching the most
+// recent start element already consumed from r.
+// It recurs if it encounters a start element, so it can be used to skip nested
+// structures.
+// If r reaches io.EOF before the end of the element, Skip returns nil.
+func Skip(r TokenReader) error {
+	var depth int
+	for {
+		tok, err := r.Token()
+		switch unwrapSource(tok).(type) {
+		case StartElement:
+			depth++
+		case EndElement:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		}
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
+
+// Inner returns a TokenReader that reads the tokens inside the most recent
+// start element already consumed from r.
+// When the matching end element is reached it is consumed and the returned
+// reader reports io.EOF.
+func Inner(r TokenReader) TokenReader {
+	return &innerReader{r: r}
+}
+
+type innerReader struct {
+	r     TokenReader
+	depth int
+	done  bool
+}
+
+func (r *innerReader) Token() (Token, error) {
+	if r.done {
+		return nil, io.EOF
+	}
+	tok, err := r.r.Token()
+	switch unwrapSource(tok).(type) {
+	case StartElement:
+		r.depth++
+	case EndElement:
+		if r.depth == 0 {
+			r.done = true
+			return nil, io.EOF
+		}
+		r.depth--
+	}
+	return tok, err
+}
+
+// MultiTokenReader returns a TokenReader that is the logical concatenation of
+// the provided readers.
+// They are read sequentially and once all readers have returned io.EOF, Token
+// returns io.EOF.
+// If any of the readers return a non-nil, non-EOF error, Token returns that
+// error.
+func MultiTokenReader(r ...TokenReader) TokenReader {
+	readers := make([]TokenReader, len(r))
+	copy(readers, r)
+	return &multiReader{readers: readers}
+}
+
+type multiReader struct {
+	readers []TokenReader
+}
+
+func (m *multiReader) Token() (Token, error) {
+	for len(m.readers) > 0 {
+		tok, err := m.readers[0].Token()
+		if err == io.EOF {
+			m.readers[0] = nil
+			m.readers = m.readers[1:]
+			err = nil
+		}
+		if tok != nil || err != nil {
+			return tok, err
+		}
+	}
+	return nil, io.EOF
+}
+
+// TeeTokenReader returns a TokenReader that writes to w each token it reads
+// from r.
+// Any error encountered while writing is returned as the error from Token.
+// Tokens are not flushed, so w must be flushed once the stream is done.
+func TeeTokenReader(r TokenReader, w TokenWriter) TokenReader {
+	return &teeReader{r: r, w: w}
+}
+
+type teeReader struct {
+	r TokenReader
+	w TokenWriter
+}
+
+func (t *teeReader) Token() (Token, error) {
+	tok, err := t.r.Token()
+	if tok != nil {
+		if werr := t.w.EncodeToken(tok); werr != nil {
+			return tok, werr
+		}
+	}
+	return tok, err
+}
+
+// LimitTokenReader returns a TokenReader that reads from r but stops with
+// io.EOF after n tokens.
+func LimitTokenReader(r TokenReader, n int64) TokenReader {
+	return &limitReader{r: r, n: n}
+}
+
+type limitReader struct {
+	r TokenReader
+	n int64
+}
+
+func (l *limitReader) Token() (Token, error) {
+	if l.n <= 0 {
+		return nil, io.EOF
+	}
+	tok, err := l.r.Token()
+	if tok != nil {
+		l.n--
+	}
+	return tok, err
+}
+
+// ElementReader returns a TokenReader that reads the remainder of the element
+// whose start element was most recently consumed from r.
+// It returns the children of the element followed by its end element, after
+// which it returns io.EOF.
+// Unlike Inner, the end element is included in the output.
+func ElementReader(r TokenReader) TokenReader {
+	return &elementReader{r: r}
+}
+
+type elementReader struct {
+	r     TokenReader
+	depth int
+	done  bool
+}
+
+func (e *elementReader) Token() (Token, error) {
+	if e.done {
+		return nil, io.EOF
+	}
+	tok, err := e.r.Token()
+	switch unwrapSource(tok).(type) {
+	case StartElement:
+		e.depth++
+	case EndElement:
+		if e.depth == 0 {
+			e.done = true
+			return tok, nil
+		}
+		e.depth--
+	}
+	return tok, err
+}
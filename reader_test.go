@@ -0,0 +1,208 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+// readAll reads tokens from r until an error is encountered and returns them
+// along with the error (nil if it was io.EOF).
+func readAll(r TokenReader) ([]Token, error) {
+	var toks []Token
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			toks = append(toks, CopyToken(tok))
+		}
+		if err == io.EOF {
+			return toks, nil
+		}
+		if err != nil {
+			return toks, err
+		}
+	}
+}
+
+func TestSkip(t *testing.T) {
+	td := NewTokenizer(strings.NewReader(`<a><b><c/>foo</b><d/></a>`))
+	for i := 0; i < 2; i++ {
+		/* #nosec */
+		td.Token()
+	}
+	if err := Skip(td); err != nil {
+		t.Fatalf("unexpected error skipping: %v", err)
+	}
+	tok, err := td.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := StartElement{Name: Name{Local: "d"}, Attr: []Attr{}}
+	if !reflect.DeepEqual(tok, want) {
+		t.Fatalf("wrong token after skip: want=%+v, got=%+v", want, tok)
+	}
+}
+
+func TestInner(t *testing.T) {
+	td := NewTokenizer(strings.NewReader(`<a><b><c/>foo</b><d/></a>`))
+	for i := 0; i < 2; i++ {
+		/* #nosec */
+		td.Token()
+	}
+	toks, err := readAll(Inner(td))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		StartElement{Name: Name{Local: "c"}, Attr: []Attr{}},
+		EndElement{Name: Name{Local: "c"}},
+		CharData("foo"),
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+	tok, err := td.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tok, StartElement{Name: Name{Local: "d"}, Attr: []Attr{}}) {
+		t.Fatalf("inner reader did not consume the end element, got %+v", tok)
+	}
+}
+
+func TestMultiTokenReader(t *testing.T) {
+	r := MultiTokenReader(
+		NewTokenizer(strings.NewReader(`<a/>`)),
+		NewTokenizer(strings.NewReader(``)),
+		NewTokenizer(strings.NewReader(`foo`)),
+		NewTokenizer(strings.NewReader(`<b/>`)),
+	)
+	toks, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		EndElement{Name: Name{Local: "a"}},
+		CharData("foo"),
+		StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+		EndElement{Name: Name{Local: "b"}},
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+	tok, err := r.Token()
+	if tok != nil || err != io.EOF {
+		t.Fatalf("expected repeated EOF, got %+v, %v", tok, err)
+	}
+}
+
+func TestTeeTokenReader(t *testing.T) {
+	const in = `<a><b c="d">foo</b><!-- e --></a>`
+	var buf strings.Builder
+	e := NewEncoder(&buf)
+	toks, err := readAll(TeeTokenReader(NewTokenizer(strings.NewReader(in)), e))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(toks) != 6 {
+		t.Fatalf("wrong number of tokens: want=6, got=%d", len(toks))
+	}
+	if err = e.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	const want = in
+	if s := buf.String(); s != want {
+		t.Fatalf("wrong output: want=%s, got=%s", want, s)
+	}
+}
+
+func TestLimitTokenReader(t *testing.T) {
+	r := LimitTokenReader(NewTokenizer(strings.NewReader(`<a><b/><c/></a>`)), 3)
+	toks, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+		EndElement{Name: Name{Local: "b"}},
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+}
+
+var elementReaderTestCases = []struct {
+	in   string
+	skip int
+	out  []Token
+	next Token
+}{
+	0: {
+		in:   `<a><b/></a><c/>`,
+		skip: 1,
+		out: []Token{
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+		next: StartElement{Name: Name{Local: "c"}, Attr: []Attr{}},
+	},
+	1: {
+		in:   `<a><b/>foo</a><c/>`,
+		skip: 1,
+		out: []Token{
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "b"}},
+			CharData("foo"),
+			EndElement{Name: Name{Local: "a"}},
+		},
+		next: StartElement{Name: Name{Local: "c"}, Attr: []Attr{}},
+	},
+	2: {
+		in:   `<a>foo<b/></a><c/>`,
+		skip: 1,
+		out: []Token{
+			CharData("foo"),
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+		next: StartElement{Name: Name{Local: "c"}, Attr: []Attr{}},
+	},
+}
+
+func TestElementReader(t *testing.T) {
+	for i, tc := range elementReaderTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			for j := 0; j < tc.skip; j++ {
+				/* #nosec */
+				td.Token()
+			}
+			toks, err := readAll(ElementReader(td))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(toks, tc.out) {
+				t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", tc.out, toks)
+			}
+			tok, err := td.Token()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(tok, tc.next) {
+				t.Fatalf("wrong next token: want=%+v, got=%+v", tc.next, tok)
+			}
+		})
+	}
+}
@@ -0,0 +1,714 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package relaxng
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// CompileCompact parses a schema in the RELAX NG compact syntax.
+// Annotations are ignored.
+func CompileCompact(r io.Reader) (*Schema, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("relaxng: %w", err)
+	}
+	toks, err := lex(string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &compactParser{
+		toks:  toks,
+		scope: map[string]string{"xml": xmlNS},
+		libs:  map[string]string{"xsd": DatatypesNS},
+	}
+	root, err := p.topLevel()
+	if err != nil {
+		return nil, err
+	}
+	return compileTree(root)
+}
+
+type compactKind int
+
+const (
+	eofToken compactKind = iota
+	identToken
+	cnameToken
+	nsNameToken
+	literalToken
+	opToken
+)
+
+type compactToken struct {
+	kind compactKind
+	text string
+	// escaped is set for identifiers written with a leading backslash, which
+	// are never keywords.
+	escaped bool
+	line    int
+}
+
+var keywords = map[string]bool{
+	"attribute": true, "default": true, "datatypes": true, "div": true,
+	"element": true, "empty": true, "external": true, "grammar": true,
+	"include": true, "inherit": true, "list": true, "mixed": true,
+	"namespace": true, "notAllowed": true, "parent": true, "start": true,
+	"string": true, "text": true, "token": true,
+}
+
+// lex splits a compact schema into tokens, dropping comments and annotations.
+func lex(src string) ([]compactToken, error) {
+	src, err := unescapeCompact(src)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		toks  []compactToken
+		line  = 1
+		depth int
+	)
+	errorf := func(format string, v ...interface{}) error {
+		return fmt.Errorf("relaxng: line %d: %s", line, fmt.Sprintf(format, v...))
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case c == '#':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+		case c == '"' || c == '\'':
+			quote := src[i : i+1]
+			if strings.HasPrefix(src[i:], strings.Repeat(quote, 3)) {
+				quote = strings.Repeat(quote, 3)
+			}
+			end := strings.Index(src[i+len(quote):], quote)
+			if end == -1 {
+				return nil, errorf("unterminated literal")
+			}
+			lit := src[i+len(quote) : i+len(quote)+end]
+			if len(quote) == 1 && strings.ContainsRune(lit, '\n') {
+				return nil, errorf("newline in literal")
+			}
+			if depth == 0 {
+				toks = append(toks, compactToken{kind: literalToken, text: lit, line: line})
+			}
+			line += strings.Count(lit, "\n")
+			i += 2*len(quote) + end
+			continue
+		case c == '[':
+			depth++
+			i++
+			continue
+		case c == ']':
+			if depth == 0 {
+				return nil, errorf("unexpected ]")
+			}
+			depth--
+			i++
+			continue
+		}
+		start := i
+		tok := compactToken{kind: opToken, line: line}
+		r, _ := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case c == '\\' || isNameStart(r):
+			if c == '\\' {
+				tok.escaped = true
+				i++
+				start = i
+			}
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isNameRune(r) {
+					break
+				}
+				i += size
+			}
+			tok.kind = identToken
+			if i+1 < len(src) && src[i] == ':' {
+				if src[i+1] == '*' {
+					tok.kind = nsNameToken
+					tok.text = src[start:i]
+					i += 2
+					break
+				}
+				if r, _ := utf8.DecodeRuneInString(src[i+1:]); isNameStart(r) {
+					i++
+					for i < len(src) {
+						r, size := utf8.DecodeRuneInString(src[i:])
+						if !isNameRune(r) {
+							break
+						}
+						i += size
+					}
+					tok.kind = cnameToken
+				}
+			}
+			if tok.text == "" {
+				tok.text = src[start:i]
+			}
+		case strings.HasPrefix(src[i:], "|=") || strings.HasPrefix(src[i:], "&=") || strings.HasPrefix(src[i:], ">>"):
+			tok.text = src[i : i+2]
+			i += 2
+		case strings.ContainsRune("{}()=,&|?*+-~", r):
+			tok.text = src[i : i+1]
+			i++
+		default:
+			return nil, errorf("unexpected character %q", r)
+		}
+		if depth == 0 {
+			toks = append(toks, tok)
+		}
+	}
+	if depth != 0 {
+		return nil, errorf("unterminated annotation")
+	}
+	// Drop annotation elements, which are a name following ">>" whose content
+	// has already been removed.
+	out := toks[:0]
+	for i := 0; i < len(toks); i++ {
+		if toks[i].kind == opToken && toks[i].text == ">>" {
+			i++
+			continue
+		}
+		out = append(out, toks[i])
+	}
+	return append(out, compactToken{kind: eofToken, line: line}), nil
+}
+
+// unescapeCompact replaces escapes of the form \x{hex} with the characters
+// they represent.
+func unescapeCompact(src string) (string, error) {
+	if !strings.Contains(src, `\x`) {
+		return src, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.Index(src, `\x`)
+		if i == -1 {
+			b.WriteString(src)
+			return b.String(), nil
+		}
+		b.WriteString(src[:i])
+		rest := strings.TrimLeft(src[i+1:], "x")
+		if !strings.HasPrefix(rest, "{") {
+			b.WriteString(src[i : len(src)-len(rest)])
+			src = rest
+			continue
+		}
+		end := strings.IndexByte(rest, '}')
+		if end == -1 {
+			return "", fmt.Errorf("relaxng: unterminated escape")
+		}
+		n, err := strconv.ParseUint(rest[1:end], 16, 32)
+		if err != nil {
+			return "", fmt.Errorf("relaxng: invalid escape %q", rest[:end+1])
+		}
+		b.WriteRune(rune(n))
+		src = rest[end+1:]
+	}
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameRune(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// compactParser translates the compact syntax to the XML syntax.
+type compactParser struct {
+	toks      []compactToken
+	pos       int
+	scope     map[string]string
+	libs      map[string]string
+	defaultNS string
+}
+
+func (p *compactParser) peek() compactToken {
+	return p.toks[p.pos]
+}
+
+func (p *compactParser) next() compactToken {
+	tok := p.toks[p.pos]
+	if tok.kind != eofToken {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *compactParser) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("relaxng: line %d: %s", p.peek().line, fmt.Sprintf(format, v...))
+}
+
+// isOp reports whether the next token is the operator op.
+func (p *compactParser) isOp(op string) bool {
+	tok := p.peek()
+	return tok.kind == opToken && tok.text == op
+}
+
+// isKeyword reports whether the next token is the keyword kw.
+func (p *compactParser) isKeyword(kw string) bool {
+	tok := p.peek()
+	return tok.kind == identToken && !tok.escaped && tok.text == kw
+}
+
+func (p *compactParser) expect(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q", op)
+	}
+	p.next()
+	return nil
+}
+
+func (p *compactParser) node(name string) *node {
+	return &node{
+		name:  name,
+		attr:  make(map[string]string),
+		scope: p.scope,
+		line:  p.peek().line,
+	}
+}
+
+func (p *compactParser) literal() (string, error) {
+	tok := p.next()
+	if tok.kind != literalToken {
+		return "", p.errorf("expected literal")
+	}
+	s := tok.text
+	for p.isOp("~") {
+		p.next()
+		tok = p.next()
+		if tok.kind != literalToken {
+			return "", p.errorf("expected literal")
+		}
+		s += tok.text
+	}
+	return s, nil
+}
+
+func (p *compactParser) topLevel() (*node, error) {
+	for {
+		switch {
+		case p.isKeyword("namespace"), p.isKeyword("default"):
+			isDefault := p.isKeyword("default")
+			p.next()
+			if isDefault && !p.isKeyword("namespace") {
+				return nil, p.errorf("expected namespace")
+			}
+			if isDefault {
+				p.next()
+			}
+			prefix := ""
+			if tok := p.peek(); tok.kind == identToken {
+				prefix = p.next().text
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			var uri string
+			if p.isKeyword("inherit") {
+				p.next()
+			} else {
+				var err error
+				uri, err = p.literal()
+				if err != nil {
+					return nil, err
+				}
+			}
+			if prefix != "" {
+				p.scope[prefix] = uri
+			}
+			if isDefault {
+				p.defaultNS = uri
+			}
+		case p.isKeyword("datatypes"):
+			p.next()
+			tok := p.next()
+			if tok.kind != identToken {
+				return nil, p.errorf("expected prefix")
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			uri, err := p.literal()
+			if err != nil {
+				return nil, err
+			}
+			p.libs[tok.text] = uri
+		default:
+			var (
+				root *node
+				err  error
+			)
+			if p.isGrammarContent() {
+				root = p.node("grammar")
+				root.children, err = p.grammarContent()
+			} else {
+				root, err = p.pattern()
+			}
+			if err != nil {
+				return nil, err
+			}
+			if p.peek().kind != eofToken {
+				return nil, p.errorf("unexpected %q", p.peek().text)
+			}
+			return root, nil
+		}
+	}
+}
+
+// isGrammarContent reports whether the next tokens start a definition.
+func (p *compactParser) isGrammarContent() bool {
+	if p.isKeyword("start") || p.isKeyword("div") || p.isKeyword("include") {
+		return true
+	}
+	if p.peek().kind != identToken {
+		return false
+	}
+	next := p.toks[p.pos+1]
+	return next.kind == opToken && (next.text == "=" || next.text == "|=" || next.text == "&=")
+}
+
+func (p *compactParser) grammarContent() ([]*node, error) {
+	var nodes []*node
+	for p.peek().kind != eofToken && !p.isOp("}") {
+		switch {
+		case p.isKeyword("div"):
+			n := p.node("div")
+			p.next()
+			if err := p.expect("{"); err != nil {
+				return nil, err
+			}
+			var err error
+			n.children, err = p.grammarContent()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("}"); err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case p.isKeyword("include"):
+			return nil, p.errorf("include is not supported")
+		case p.peek().kind == identToken:
+			n := p.node("define")
+			name := p.next()
+			if name.text == "start" && !name.escaped {
+				n.name = "start"
+			} else {
+				n.attr["name"] = name.text
+			}
+			switch op := p.next(); op.text {
+			case "|=":
+				n.attr["combine"] = "choice"
+			case "&=":
+				n.attr["combine"] = "interleave"
+			case "=":
+			default:
+				return nil, p.errorf("expected assignment")
+			}
+			child, err := p.pattern()
+			if err != nil {
+				return nil, err
+			}
+			n.children = []*node{child}
+			nodes = append(nodes, n)
+		default:
+			return nil, p.errorf("unexpected %q in grammar", p.peek().text)
+		}
+	}
+	return nodes, nil
+}
+
+var binaryOps = map[string]string{",": "group", "&": "interleave", "|": "choice"}
+
+func (p *compactParser) pattern() (*node, error) {
+	first, err := p.particle()
+	if err != nil {
+		return nil, err
+	}
+	tok := p.peek()
+	kind, ok := binaryOps[tok.text]
+	if tok.kind != opToken || !ok {
+		return first, nil
+	}
+	n := p.node(kind)
+	n.children = []*node{first}
+	for p.isOp(tok.text) {
+		p.next()
+		child, err := p.particle()
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, child)
+	}
+	if next := p.peek(); next.kind == opToken && binaryOps[next.text] != "" {
+		return nil, p.errorf("operators %q and %q may not be mixed without parentheses", tok.text, next.text)
+	}
+	return n, nil
+}
+
+var postfixOps = map[string]string{"?": "optional", "*": "zeroOrMore", "+": "oneOrMore"}
+
+func (p *compactParser) particle() (*node, error) {
+	n, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		kind, ok := postfixOps[tok.text]
+		if tok.kind != opToken || !ok {
+			return n, nil
+		}
+		p.next()
+		wrapper := p.node(kind)
+		wrapper.children = []*node{n}
+		n = wrapper
+	}
+}
+
+// block parses a pattern in braces.
+func (p *compactParser) block() (*node, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	n, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+	return n, p.expect("}")
+}
+
+func (p *compactParser) primary() (*node, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case literalToken:
+		n := p.node("value")
+		var err error
+		n.text, err = p.literal()
+		return n, err
+	case cnameToken:
+		return p.datatype()
+	case opToken:
+		if tok.text != "(" {
+			return nil, p.errorf("unexpected %q", tok.text)
+		}
+		p.next()
+		n, err := p.pattern()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case identToken:
+	default:
+		return nil, p.errorf("expected pattern")
+	}
+	if tok.escaped || !keywords[tok.text] {
+		p.next()
+		n := p.node("ref")
+		n.attr["name"] = tok.text
+		return n, nil
+	}
+	switch tok.text {
+	case "element", "attribute":
+		n := p.node(tok.text)
+		p.next()
+		nc, err := p.nameClass(tok.text == "attribute")
+		if err != nil {
+			return nil, err
+		}
+		content, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		n.children = []*node{nc, content}
+		return n, nil
+	case "list", "mixed":
+		n := p.node(tok.text)
+		p.next()
+		content, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		n.children = []*node{content}
+		return n, nil
+	case "empty", "text", "notAllowed":
+		p.next()
+		return p.node(tok.text), nil
+	case "parent":
+		p.next()
+		name := p.next()
+		if name.kind != identToken {
+			return nil, p.errorf("expected identifier")
+		}
+		n := p.node("parentRef")
+		n.attr["name"] = name.text
+		return n, nil
+	case "grammar":
+		n := p.node("grammar")
+		p.next()
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+		var err error
+		n.children, err = p.grammarContent()
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect("}")
+	case "string", "token":
+		return p.datatype()
+	}
+	return nil, p.errorf("%s is not supported", tok.text)
+}
+
+// datatype parses a value or data pattern starting with a datatype name.
+func (p *compactParser) datatype() (*node, error) {
+	tok := p.next()
+	lib, typ := "", tok.text
+	if tok.kind == cnameToken {
+		prefix, local, _ := strings.Cut(tok.text, ":")
+		var ok bool
+		lib, ok = p.libs[prefix]
+		if !ok {
+			return nil, p.errorf("undeclared datatypes prefix %q", prefix)
+		}
+		typ = local
+	}
+	if p.peek().kind == literalToken {
+		n := p.node("value")
+		n.lib, n.attr["type"] = lib, typ
+		var err error
+		n.text, err = p.literal()
+		return n, err
+	}
+	n := p.node("data")
+	n.lib, n.attr["type"] = lib, typ
+	if p.isOp("{") {
+		p.next()
+		for !p.isOp("}") {
+			name := p.next()
+			if name.kind != identToken {
+				return nil, p.errorf("expected parameter name")
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			param := p.node("param")
+			param.attr["name"] = name.text
+			var err error
+			param.text, err = p.literal()
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, param)
+		}
+		p.next()
+	}
+	if p.isOp("-") {
+		p.next()
+		except := p.node("except")
+		child, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		except.children = []*node{child}
+		n.children = append(n.children, except)
+	}
+	return n, nil
+}
+
+func (p *compactParser) nameClass(attr bool) (*node, error) {
+	first, err := p.simpleNameClass(attr)
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOp("|") {
+		return first, nil
+	}
+	n := p.node("choice")
+	n.children = []*node{first}
+	for p.isOp("|") {
+		p.next()
+		child, err := p.simpleNameClass(attr)
+		if err != nil {
+			return nil, err
+		}
+		n.children = append(n.children, child)
+	}
+	return n, nil
+}
+
+func (p *compactParser) simpleNameClass(attr bool) (*node, error) {
+	tok := p.peek()
+	switch {
+	case tok.kind == opToken && tok.text == "(":
+		p.next()
+		n, err := p.nameClass(attr)
+		if err != nil {
+			return nil, err
+		}
+		return n, p.expect(")")
+	case tok.kind == opToken && tok.text == "*", tok.kind == nsNameToken:
+		p.next()
+		n := p.node("anyName")
+		if tok.kind == nsNameToken {
+			n.name = "nsName"
+			var ok bool
+			n.ns, ok = p.scope[tok.text]
+			if !ok {
+				return nil, p.errorf("undeclared namespace prefix %q", tok.text)
+			}
+		}
+		if p.isOp("-") {
+			p.next()
+			except := p.node("except")
+			child, err := p.simpleNameClass(attr)
+			if err != nil {
+				return nil, err
+			}
+			except.children = []*node{child}
+			n.children = []*node{except}
+		}
+		return n, nil
+	case tok.kind == cnameToken:
+		p.next()
+		prefix, local, _ := strings.Cut(tok.text, ":")
+		ns, ok := p.scope[prefix]
+		if !ok {
+			return nil, p.errorf("undeclared namespace prefix %q", prefix)
+		}
+		n := p.node("name")
+		n.ns, n.text = ns, local
+		return n, nil
+	case tok.kind == identToken:
+		p.next()
+		n := p.node("name")
+		n.text = tok.text
+		if !attr {
+			n.ns = p.defaultNS
+		}
+		return n, nil
+	}
+	return nil, p.errorf("expected name class")
+}
@@ -0,0 +1,381 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package relaxng
+
+import (
+	"io"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// Compile parses a schema in the RELAX NG XML syntax.
+func Compile(r io.Reader) (*Schema, error) {
+	root, err := parseTree(r)
+	if err != nil {
+		return nil, err
+	}
+	return compileTree(root)
+}
+
+func compileTree(root *node) (*Schema, error) {
+	c := &compiler{b: newBuilder()}
+	p, err := c.pattern(root, nil)
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[*define]bool)
+	for _, d := range c.defines {
+		if err := checkRecursion(d.p, d.nodes[0], make(map[*define]bool), done); err != nil {
+			return nil, err
+		}
+	}
+	return &Schema{start: p}, nil
+}
+
+// grammar is the scope of the definitions in a grammar pattern.
+type grammar struct {
+	parent  *grammar
+	defines map[string]*define
+	start   *define
+}
+
+type compiler struct {
+	b       *builder
+	defines []*define
+}
+
+func (g *grammar) define(name string) *define {
+	d, ok := g.defines[name]
+	if !ok {
+		d = &define{name: name}
+		g.defines[name] = d
+	}
+	return d
+}
+
+// patterns compiles a sequence of patterns into a group.
+func (c *compiler) patterns(nodes []*node, g *grammar) (*pattern, error) {
+	p := empty
+	for _, n := range nodes {
+		child, err := c.pattern(n, g)
+		if err != nil {
+			return nil, err
+		}
+		p = c.b.group(p, child)
+	}
+	return p, nil
+}
+
+func (c *compiler) pattern(n *node, g *grammar) (*pattern, error) {
+	switch n.name {
+	case "element", "attribute":
+		var (
+			nc      *nameClass
+			content = n.children
+			err     error
+		)
+		if name, ok := n.attr["name"]; ok {
+			ns := n.ns
+			if n.name == "attribute" {
+				ns = n.attr["ns"]
+			}
+			var qname xml.Name
+			qname, err = n.qname(name, ns)
+			nc = &nameClass{kind: nameName, name: qname}
+		} else {
+			if len(content) == 0 {
+				return nil, n.errorf("%s has no name", n.name)
+			}
+			nc, err = c.nameClass(content[0])
+			content = content[1:]
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n.name == "attribute" {
+			if len(content) == 0 {
+				return c.b.attribute(nc, text), nil
+			}
+			p, err := c.patterns(content, g)
+			if err != nil {
+				return nil, err
+			}
+			return c.b.attribute(nc, p), nil
+		}
+		p, err := c.patterns(content, g)
+		if err != nil {
+			return nil, err
+		}
+		return c.b.element(nc, p), nil
+	case "group", "interleave", "choice":
+		var p *pattern
+		for _, child := range n.children {
+			cp, err := c.pattern(child, g)
+			if err != nil {
+				return nil, err
+			}
+			switch {
+			case p == nil:
+				p = cp
+			case n.name == "group":
+				p = c.b.group(p, cp)
+			case n.name == "interleave":
+				p = c.b.interleave(p, cp)
+			default:
+				p = c.b.choice(p, cp)
+			}
+		}
+		if p == nil {
+			return nil, n.errorf("%s has no patterns", n.name)
+		}
+		return p, nil
+	case "optional", "zeroOrMore", "oneOrMore", "mixed", "list":
+		p, err := c.patterns(n.children, g)
+		if err != nil {
+			return nil, err
+		}
+		switch n.name {
+		case "optional":
+			return c.b.choice(p, empty), nil
+		case "zeroOrMore":
+			return c.b.choice(c.b.oneOrMore(p), empty), nil
+		case "oneOrMore":
+			return c.b.oneOrMore(p), nil
+		case "mixed":
+			return c.b.interleave(p, text), nil
+		}
+		return c.b.list(p), nil
+	case "empty":
+		return empty, nil
+	case "text":
+		return text, nil
+	case "notAllowed":
+		return notAllowed, nil
+	case "data":
+		var (
+			params [][2]string
+			except *pattern
+		)
+		for _, child := range n.children {
+			switch child.name {
+			case "param":
+				params = append(params, [2]string{child.attr["name"], strings.TrimSpace(child.text)})
+			case "except":
+				var err error
+				except, err = c.choices(child.children, g)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		dt, err := newDatatype(n.lib, n.attr["type"], params)
+		if err != nil {
+			return nil, n.errorf("%v", err)
+		}
+		return c.b.data(dt, except), nil
+	case "value":
+		lib, typ := n.lib, n.attr["type"]
+		if _, ok := n.attr["type"]; !ok {
+			lib, typ = "", "token"
+		}
+		dt, err := newDatatype(lib, typ, nil)
+		if err != nil {
+			return nil, n.errorf("%v", err)
+		}
+		return c.b.value(dt, n.text), nil
+	case "ref", "parentRef":
+		scope := g
+		if n.name == "parentRef" && scope != nil {
+			scope = scope.parent
+		}
+		if scope == nil {
+			return nil, n.errorf("%s outside of a grammar", n.name)
+		}
+		return c.b.ref(scope.define(n.attr["name"])), nil
+	case "grammar":
+		return c.grammar(n, g)
+	case "externalRef", "include":
+		return nil, n.errorf("%s is not supported", n.name)
+	}
+	return nil, n.errorf("unexpected %s", n.name)
+}
+
+// choices compiles a sequence of patterns into a choice.
+func (c *compiler) choices(nodes []*node, g *grammar) (*pattern, error) {
+	p := notAllowed
+	for _, n := range nodes {
+		child, err := c.pattern(n, g)
+		if err != nil {
+			return nil, err
+		}
+		p = c.b.choice(p, child)
+	}
+	return p, nil
+}
+
+func (c *compiler) grammar(n *node, parent *grammar) (*pattern, error) {
+	g := &grammar{parent: parent, defines: make(map[string]*define)}
+	g.start = &define{name: "start"}
+	if err := c.grammarContent(n.children, g); err != nil {
+		return nil, err
+	}
+	if len(g.start.nodes) == 0 {
+		return nil, n.errorf("grammar has no start")
+	}
+	defines := []*define{g.start}
+	for _, d := range g.defines {
+		defines = append(defines, d)
+	}
+	for _, d := range defines {
+		if err := c.define(d, g); err != nil {
+			return nil, err
+		}
+	}
+	// References in the definitions may have added undefined names.
+	for _, d := range g.defines {
+		if len(d.nodes) == 0 {
+			return nil, n.errorf("reference to undefined pattern %s", d.name)
+		}
+	}
+	return c.b.ref(g.start), nil
+}
+
+// define compiles the pattern of a definition, combining it if it is defined
+// more than once.
+func (c *compiler) define(d *define, g *grammar) error {
+	var combine string
+	for _, dn := range d.nodes {
+		p, err := c.patterns(dn.children, g)
+		if err != nil {
+			return err
+		}
+		if method := dn.attr["combine"]; method != "" {
+			if combine != "" && combine != method {
+				return dn.errorf("conflicting combine methods for %s", d.name)
+			}
+			combine = method
+		}
+		switch {
+		case d.p == nil:
+			d.p = p
+		case combine == "interleave":
+			d.p = c.b.interleave(d.p, p)
+		default:
+			d.p = c.b.choice(d.p, p)
+		}
+	}
+	if d.p != nil {
+		c.defines = append(c.defines, d)
+	}
+	return nil
+}
+
+func (c *compiler) grammarContent(nodes []*node, g *grammar) error {
+	for _, n := range nodes {
+		switch n.name {
+		case "start", "define":
+			d := g.start
+			if n.name == "define" {
+				d = g.define(n.attr["name"])
+			}
+			if len(d.nodes) > 0 && n.attr["combine"] == "" && d.nodes[0].attr["combine"] == "" {
+				return n.errorf("duplicate definition of %s", d.name)
+			}
+			d.nodes = append(d.nodes, n)
+		case "div":
+			if err := c.grammarContent(n.children, g); err != nil {
+				return err
+			}
+		case "include":
+			return n.errorf("include is not supported")
+		default:
+			return n.errorf("unexpected %s in grammar", n.name)
+		}
+	}
+	return nil
+}
+
+func (c *compiler) nameClass(n *node) (*nameClass, error) {
+	switch n.name {
+	case "name":
+		name, err := n.qname(n.text, n.ns)
+		if err != nil {
+			return nil, err
+		}
+		return &nameClass{kind: nameName, name: name}, nil
+	case "anyName", "nsName":
+		nc := &nameClass{kind: anyNameName}
+		if n.name == "nsName" {
+			nc.kind, nc.name.Space = nsNameName, n.ns
+		}
+		for _, child := range n.children {
+			if child.name != "except" {
+				continue
+			}
+			for _, ex := range child.children {
+				exc, err := c.nameClass(ex)
+				if err != nil {
+					return nil, err
+				}
+				if nc.c1 == nil {
+					nc.c1 = exc
+				} else {
+					nc.c1 = &nameClass{kind: choiceName, c1: nc.c1, c2: exc}
+				}
+			}
+		}
+		return nc, nil
+	case "choice":
+		var nc *nameClass
+		for _, child := range n.children {
+			cc, err := c.nameClass(child)
+			if err != nil {
+				return nil, err
+			}
+			if nc == nil {
+				nc = cc
+			} else {
+				nc = &nameClass{kind: choiceName, c1: nc, c2: cc}
+			}
+		}
+		if nc == nil {
+			return nil, n.errorf("choice has no name classes")
+		}
+		return nc, nil
+	}
+	return nil, n.errorf("unexpected %s in name class", n.name)
+}
+
+// checkRecursion reports an error if p refers to itself other than from
+// within an element.
+func checkRecursion(p *pattern, at *node, visiting, done map[*define]bool) error {
+	switch p.kind {
+	case refPattern:
+		d := p.ref
+		if done[d] {
+			return nil
+		}
+		if visiting[d] {
+			return at.errorf("pattern %s refers to itself outside of an element", d.name)
+		}
+		visiting[d] = true
+		err := checkRecursion(d.p, at, visiting, done)
+		delete(visiting, d)
+		done[d] = err == nil
+		return err
+	case elementPattern:
+		return nil
+	}
+	for _, child := range []*pattern{p.p1, p.p2} {
+		if child == nil {
+			continue
+		}
+		if err := checkRecursion(child, at, visiting, done); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package relaxng
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"mellium.im/xml/xsd"
+)
+
+// datatype is a datatype from a datatype library along with its parameters.
+type datatype struct {
+	// typ is nil for the built-in string and token types.
+	typ      *xsd.Type
+	collapse bool
+	params   []param
+}
+
+type param struct {
+	name    string
+	n       int
+	pattern *regexp.Regexp
+	bound   *big.Rat
+}
+
+func newDatatype(lib, name string, params [][2]string) (*datatype, error) {
+	dt := &datatype{}
+	switch lib {
+	case "":
+		switch name {
+		case "string":
+		case "token":
+			dt.collapse = true
+		default:
+			return nil, fmt.Errorf("unknown built-in datatype %q", name)
+		}
+		if len(params) > 0 {
+			return nil, fmt.Errorf("built-in datatype %q does not take parameters", name)
+		}
+		return dt, nil
+	case DatatypesNS:
+		dt.typ = xsd.Lookup(name)
+		if dt.typ == nil {
+			return nil, fmt.Errorf("unsupported datatype %q", name)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported datatype library %q", lib)
+	}
+	for _, kv := range params {
+		p := param{name: kv[0]}
+		var err error
+		switch p.name {
+		case "length", "minLength", "maxLength":
+			p.n, err = strconv.Atoi(kv[1])
+		case "pattern":
+			p.pattern, err = regexp.Compile(`^(?:` + kv[1] + `)$`)
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			var ok bool
+			p.bound, ok = new(big.Rat).SetString(kv[1])
+			if !ok {
+				err = fmt.Errorf("not a number")
+			}
+		default:
+			err = fmt.Errorf("unsupported parameter")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %s=%q for datatype %q: %v", p.name, kv[1], name, err)
+		}
+		dt.params = append(dt.params, p)
+	}
+	return dt, nil
+}
+
+// allows reports whether s is a valid value of the datatype.
+func (dt *datatype) allows(s string) bool {
+	if dt.typ == nil {
+		return true
+	}
+	v, err := dt.typ.Parse(s)
+	if err != nil {
+		return false
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	for _, p := range dt.params {
+		switch p.name {
+		case "length", "minLength", "maxLength":
+			n := utf8.RuneCountInString(s)
+			if b, ok := v.([]byte); ok {
+				n = len(b)
+			}
+			if (p.name == "length" && n != p.n) || (p.name == "minLength" && n < p.n) || (p.name == "maxLength" && n > p.n) {
+				return false
+			}
+		case "pattern":
+			if !p.pattern.MatchString(s) {
+				return false
+			}
+		default:
+			r, ok := new(big.Rat).SetString(s)
+			if !ok {
+				continue
+			}
+			c := r.Cmp(p.bound)
+			if (p.name == "minInclusive" && c < 0) || (p.name == "maxInclusive" && c > 0) ||
+				(p.name == "minExclusive" && c <= 0) || (p.name == "maxExclusive" && c >= 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// equal reports whether a and b are the same value of the datatype.
+func (dt *datatype) equal(a, b string) bool {
+	if dt.typ == nil {
+		if dt.collapse {
+			return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+		}
+		return a == b
+	}
+	va, err := dt.typ.Parse(a)
+	if err != nil {
+		return false
+	}
+	vb, err := dt.typ.Parse(b)
+	if err != nil {
+		return false
+	}
+	if ta, ok := va.(time.Time); ok {
+		return ta.Equal(vb.(time.Time))
+	}
+	return fmt.Sprint(va) == fmt.Sprint(vb)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package relaxng
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// node is an element of a schema in the XML syntax.
+// Schemas in the compact syntax are translated to nodes before they are
+// compiled.
+type node struct {
+	// name is the local name of the element in the RELAX NG namespace.
+	name string
+	attr map[string]string
+	text string
+	// ns and lib are the inherited values of the ns and datatypeLibrary
+	// attributes.
+	ns       string
+	lib      string
+	scope    map[string]string
+	children []*node
+	line     int
+}
+
+func (n *node) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("relaxng: line %d: %s", n.line, fmt.Sprintf(format, v...))
+}
+
+// qname resolves a prefixed name in the content of a name element or the name
+// attribute of an element or attribute pattern.
+// Unprefixed names are placed in ns.
+func (n *node) qname(v, ns string) (xml.Name, error) {
+	v = strings.TrimSpace(v)
+	prefix, local, ok := strings.Cut(v, ":")
+	if !ok {
+		return xml.Name{Space: ns, Local: v}, nil
+	}
+	space, bound := n.scope[prefix]
+	if !bound {
+		return xml.Name{}, n.errorf("unbound prefix %q in %q", prefix, v)
+	}
+	return xml.Name{Space: space, Local: local}, nil
+}
+
+// parseTree reads a schema in the XML syntax, ignoring foreign elements and
+// attributes.
+func parseTree(r io.Reader) (*node, error) {
+	d := xml.NewTokenizer(r)
+	d.SkipComments = true
+	var (
+		stack []*node
+		root  *node
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("relaxng: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Space != NS {
+				if err := xml.Skip(d); err != nil {
+					return nil, fmt.Errorf("relaxng: %w", err)
+				}
+				continue
+			}
+			n := &node{
+				name:  tok.Name.Local,
+				attr:  make(map[string]string),
+				scope: map[string]string{"xml": xmlNS},
+				line:  d.Span().Start.Line,
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				n.ns, n.lib, n.scope = parent.ns, parent.lib, parent.scope
+			}
+			copied := false
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					if !copied {
+						n.scope = copyScope(n.scope)
+						copied = true
+					}
+					n.scope[a.Name.Local] = a.Value
+				case a.Name.Space == "" && a.Name.Local != "xmlns":
+					n.attr[a.Name.Local] = strings.TrimSpace(a.Value)
+				}
+			}
+			if ns, ok := n.attr["ns"]; ok {
+				n.ns = ns
+			}
+			if lib, ok := n.attr["datatypeLibrary"]; ok {
+				n.lib = lib
+			}
+			if root == nil {
+				root = n
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("relaxng: empty schema document")
+	}
+	return root, nil
+}
+
+func copyScope(scope map[string]string) map[string]string {
+	c := make(map[string]string, len(scope)+1)
+	for k, v := range scope {
+		c[k] = v
+	}
+	return c
+}
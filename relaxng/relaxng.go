@@ -0,0 +1,266 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package relaxng implements RELAX NG validation.
+//
+// Schemas may be written in the XML syntax and compiled with Compile or in the
+// compact syntax and compiled with CompileCompact.
+// Documents are validated in a single pass using the derivative algorithm
+// described by James Clark in "An algorithm for RELAX NG validation".
+//
+// The built-in datatype library and the XML Schema datatype library are
+// supported.
+// XML Schema datatypes support the length, minLength, maxLength, pattern,
+// minInclusive, maxInclusive, minExclusive, and maxExclusive parameters.
+// Included and external schemas are not loaded.
+package relaxng // import "mellium.im/xml/relaxng"
+
+import (
+	"fmt"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// Namespaces used by schema documents.
+const (
+	NS          = "http://relaxng.org/ns/structure/1.0"
+	DatatypesNS = "http://www.w3.org/2001/XMLSchema-datatypes"
+)
+
+// Schema is a compiled RELAX NG schema.
+type Schema struct {
+	start *pattern
+}
+
+// Violation describes a part of a document that does not conform to a schema.
+type Violation struct {
+	// Span is the position of the token that the violation was found in if the
+	// TokenReader has a Span method, such as an xml.Tokenizer.
+	Span xml.Span
+
+	// Path contains the names of the open elements, ending with the element
+	// that the violation applies to.
+	Path []xml.Name
+
+	// Msg describes the violation.
+	Msg string
+}
+
+// Error returns a human readable description of the violation.
+func (v Violation) Error() string {
+	var b strings.Builder
+	b.WriteString("relaxng: ")
+	for _, name := range v.Path {
+		b.WriteByte('/')
+		b.WriteString(name.Local)
+	}
+	if v.Span != (xml.Span{}) {
+		fmt.Fprintf(&b, " (line %d, column %d)", v.Span.Start.Line, v.Span.Start.Col)
+	}
+	b.WriteString(": ")
+	b.WriteString(v.Msg)
+	return b.String()
+}
+
+type patternKind int
+
+const (
+	notAllowedPattern patternKind = iota
+	emptyPattern
+	textPattern
+	choicePattern
+	interleavePattern
+	groupPattern
+	oneOrMorePattern
+	listPattern
+	dataPattern
+	dataExceptPattern
+	valuePattern
+	attributePattern
+	elementPattern
+	afterPattern
+	refPattern
+)
+
+// pattern is a simplified RELAX NG pattern or a derivative of one.
+// Patterns are interned by a builder so that equal patterns are the same
+// pointer.
+type pattern struct {
+	kind   patternKind
+	p1, p2 *pattern
+	nc     *nameClass
+	dt     *datatype
+	value  string
+	ref    *define
+}
+
+// define is a named pattern.
+// References to it are resolved once the whole grammar has been compiled.
+type define struct {
+	name    string
+	p       *pattern
+	combine string
+	nodes   []*node
+}
+
+var (
+	notAllowed = &pattern{kind: notAllowedPattern}
+	empty      = &pattern{kind: emptyPattern}
+	text       = &pattern{kind: textPattern}
+)
+
+// builder creates interned patterns and applies the simplifications that keep
+// derivatives small.
+type builder struct {
+	table map[pattern]*pattern
+}
+
+func newBuilder() *builder {
+	return &builder{table: make(map[pattern]*pattern)}
+}
+
+func (b *builder) intern(p pattern) *pattern {
+	if v, ok := b.table[p]; ok {
+		return v
+	}
+	v := &p
+	b.table[p] = v
+	return v
+}
+
+// contains reports whether p is one of the alternatives of the choice c.
+func contains(c, p *pattern) bool {
+	for c.kind == choicePattern {
+		if c.p2 == p || contains(c.p2, p) {
+			return true
+		}
+		c = c.p1
+	}
+	return c == p
+}
+
+func (b *builder) choice(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed:
+		return p2
+	case p2 == notAllowed:
+		return p1
+	case contains(p1, p2):
+		return p1
+	case contains(p2, p1):
+		return p2
+	}
+	return b.intern(pattern{kind: choicePattern, p1: p1, p2: p2})
+}
+
+func (b *builder) group(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p2 == notAllowed:
+		return notAllowed
+	case p1 == empty:
+		return p2
+	case p2 == empty:
+		return p1
+	}
+	return b.intern(pattern{kind: groupPattern, p1: p1, p2: p2})
+}
+
+func (b *builder) interleave(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p2 == notAllowed:
+		return notAllowed
+	case p1 == empty:
+		return p2
+	case p2 == empty:
+		return p1
+	}
+	return b.intern(pattern{kind: interleavePattern, p1: p1, p2: p2})
+}
+
+func (b *builder) after(p1, p2 *pattern) *pattern {
+	if p1 == notAllowed || p2 == notAllowed {
+		return notAllowed
+	}
+	return b.intern(pattern{kind: afterPattern, p1: p1, p2: p2})
+}
+
+func (b *builder) oneOrMore(p *pattern) *pattern {
+	if p == notAllowed || p == empty {
+		return p
+	}
+	return b.intern(pattern{kind: oneOrMorePattern, p1: p})
+}
+
+func (b *builder) list(p *pattern) *pattern {
+	if p == notAllowed {
+		return p
+	}
+	return b.intern(pattern{kind: listPattern, p1: p})
+}
+
+func (b *builder) attribute(nc *nameClass, p *pattern) *pattern {
+	if p == notAllowed {
+		return p
+	}
+	return b.intern(pattern{kind: attributePattern, nc: nc, p1: p})
+}
+
+func (b *builder) element(nc *nameClass, p *pattern) *pattern {
+	return b.intern(pattern{kind: elementPattern, nc: nc, p1: p})
+}
+
+func (b *builder) data(dt *datatype, except *pattern) *pattern {
+	if except == nil || except == notAllowed {
+		return b.intern(pattern{kind: dataPattern, dt: dt})
+	}
+	return b.intern(pattern{kind: dataExceptPattern, dt: dt, p1: except})
+}
+
+func (b *builder) value(dt *datatype, v string) *pattern {
+	return b.intern(pattern{kind: valuePattern, dt: dt, value: v})
+}
+
+func (b *builder) ref(d *define) *pattern {
+	return b.intern(pattern{kind: refPattern, ref: d})
+}
+
+// deref returns the pattern that a reference refers to.
+func deref(p *pattern) *pattern {
+	for p.kind == refPattern {
+		p = p.ref.p
+	}
+	return p
+}
+
+type nameClassKind int
+
+const (
+	nameName nameClassKind = iota
+	anyNameName
+	nsNameName
+	choiceName
+)
+
+// nameClass is a set of names.
+// For anyName and nsName name classes c1 is the exception, if any.
+type nameClass struct {
+	kind   nameClassKind
+	name   xml.Name
+	c1, c2 *nameClass
+}
+
+func (nc *nameClass) contains(name xml.Name) bool {
+	switch nc.kind {
+	case nameName:
+		return nc.name == name
+	case anyNameName:
+		return nc.c1 == nil || !nc.c1.contains(name)
+	case nsNameName:
+		return nc.name.Space == name.Space && (nc.c1 == nil || !nc.c1.contains(name))
+	case choiceName:
+		return nc.c1.contains(name) || nc.c2.contains(name)
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package relaxng_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/relaxng"
+)
+
+const xmlSchema = `<grammar xmlns="http://relaxng.org/ns/structure/1.0"
+         xmlns:a="http://relaxng.org/ns/compatibility/annotations/1.0"
+         ns="urn:example"
+         datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+  <a:documentation>Test schema.</a:documentation>
+  <start>
+    <element name="addressBook">
+      <zeroOrMore>
+        <ref name="card"/>
+      </zeroOrMore>
+    </element>
+  </start>
+  <define name="card">
+    <element name="card">
+      <attribute name="id"><data type="positiveInteger"><param name="maxInclusive">99</param></data></attribute>
+      <optional><attribute name="kind"><choice><value>home</value><value>work</value></choice></attribute></optional>
+      <interleave>
+        <element name="name"><text/></element>
+        <element name="email"><data type="string"><param name="pattern">[^@]+@[^@]+</param></data></element>
+      </interleave>
+      <optional>
+        <element name="tags"><list><oneOrMore><data type="NCName"/></oneOrMore></list></element>
+      </optional>
+      <zeroOrMore>
+        <element><anyName><except><nsName/></except></anyName><ref name="any"/></element>
+      </zeroOrMore>
+    </element>
+  </define>
+  <define name="any">
+    <zeroOrMore>
+      <choice>
+        <attribute><anyName/></attribute>
+        <text/>
+        <element><anyName/><ref name="any"/></element>
+      </choice>
+    </zeroOrMore>
+  </define>
+</grammar>`
+
+const compactSchema = `# Test schema.
+default namespace = "urn:example"
+namespace ns = "urn:example"
+
+## The root element.
+start = element addressBook { card* }
+
+card =
+  element card {
+    attribute id { xsd:positiveInteger { maxInclusive = "99" } },
+    attribute kind { "home" | "work" }?,
+    (element name { text } & element email { xsd:string { pattern = "[^@]+@[^@]+" } }),
+    element tags { list { xsd:NCName+ } }?,
+    element * - ns:* { any }*
+  }
+
+[ a:note = "annotations are ignored" ]
+any = (attribute * { text } | text | element * { any })*
+`
+
+var validateTestCases = [...]struct {
+	in         string
+	violations []string
+}{
+	0: {in: `<addressBook xmlns="urn:example"/>`},
+	1: {
+		in: `<addressBook xmlns="urn:example">
+  <card id="1" kind="work"><email>a@example.net</email><name>A</name><tags>x y</tags><x:ext xmlns:x="urn:x" b="c"><y>z</y></x:ext></card>
+  <card id="2"><name>B</name><email>b@example.net</email></card>
+</addressBook>`,
+	},
+	2: {
+		in:         `<addressBook xmlns="urn:example"><card id="100" kind="home"><name/><email>a@b</email></card></addressBook>`,
+		violations: []string{"relaxng: /addressBook/card (line 1, column 34): attribute id is not allowed or has an invalid value"},
+	},
+	3: {
+		in:         `<addressBook xmlns="urn:example"><card id="1"><name/></card></addressBook>`,
+		violations: []string{"relaxng: /addressBook/card (line 1, column 54): content of element card is incomplete"},
+	},
+	4: {
+		in: `<addressBook xmlns="urn:example"><card><name/><email>nope</email><phone/></card><card id="1"><name/><email>a@b</email></card></addressBook>`,
+		violations: []string{
+			"relaxng: /addressBook/card (line 1, column 34): element card is missing required attributes",
+			"relaxng: /addressBook/card/email (line 1, column 54): text is not allowed or is invalid",
+			"relaxng: /addressBook/card/phone (line 1, column 66): element phone is not allowed here",
+		},
+	},
+	5: {
+		in:         `<addressBook xmlns="urn:example"><card id="1"><name/><email>a@b</email><tags>1</tags></card></addressBook>`,
+		violations: []string{"relaxng: /addressBook/card/tags (line 1, column 78): text is not allowed or is invalid"},
+	},
+	6: {
+		in:         `<addressBook/>`,
+		violations: []string{"relaxng: /addressBook (line 1, column 1): element addressBook is not allowed here"},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, syntax := range []string{"xml", "compact"} {
+		var (
+			s   *Schema
+			err error
+		)
+		if syntax == "xml" {
+			s, err = Compile(strings.NewReader(xmlSchema))
+		} else {
+			s, err = CompileCompact(strings.NewReader(compactSchema))
+		}
+		if err != nil {
+			t.Fatalf("error compiling %s schema: %v", syntax, err)
+		}
+		t.Run(syntax, func(t *testing.T) {
+			for i, tc := range validateTestCases {
+				t.Run(strconv.Itoa(i), func(t *testing.T) {
+					violations, err := s.Validate(xml.NewTokenizer(strings.NewReader(tc.in)))
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					var got []string
+					for _, v := range violations {
+						got = append(got, v.Error())
+					}
+					if strings.Join(got, "\n") != strings.Join(tc.violations, "\n") {
+						t.Errorf("wrong violations:\nwant=%q\n got=%q", tc.violations, got)
+					}
+				})
+			}
+		})
+	}
+}
+
+var compileErrorTestCases = [...]struct {
+	compact bool
+	in      string
+}{
+	0: {in: `<grammar xmlns="http://relaxng.org/ns/structure/1.0"><start><ref name="a"/></start></grammar>`},
+	1: {in: `<grammar xmlns="http://relaxng.org/ns/structure/1.0"><start><ref name="a"/></start><define name="a"><ref name="a"/></define></grammar>`},
+	2: {in: `<element xmlns="http://relaxng.org/ns/structure/1.0" name="a"><data type="string"><param name="length">1</param></data></element>`},
+	3: {compact: true, in: `element a { text, empty | text }`},
+	4: {compact: true, in: `element a { xsd:duration }`},
+	5: {compact: true, in: `element p:a { text }`},
+	6: {compact: true, in: `start = element a { text } start = empty`},
+}
+
+func TestCompileError(t *testing.T) {
+	for i, tc := range compileErrorTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var err error
+			if tc.compact {
+				_, err = CompileCompact(strings.NewReader(tc.in))
+			} else {
+				_, err = Compile(strings.NewReader(tc.in))
+			}
+			if err == nil {
+				t.Errorf("expected error compiling schema")
+			}
+		})
+	}
+}
@@ -0,0 +1,381 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package relaxng
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+type spanReader interface {
+	Span() xml.Span
+}
+
+// frame is an open element in the document being validated.
+type frame struct {
+	name xml.Name
+	span xml.Span
+	// skip is set if the element was not allowed and its content is ignored.
+	skip bool
+	// failed is set after the first violation in the content of the element.
+	failed bool
+}
+
+type validator struct {
+	b          *builder
+	p          *pattern
+	stack      []*frame
+	text       strings.Builder
+	textSpan   xml.Span
+	hasChild   bool
+	violations []Violation
+}
+
+// Validate reads tokens from r until io.EOF and returns the violations of the
+// schema that they contain.
+// After a violation the validator recovers by ignoring the offending element,
+// attribute, or text so that later violations are also reported.
+// The returned error is only non-nil if r returns an error other than io.EOF.
+func (s *Schema) Validate(r xml.TokenReader) ([]Violation, error) {
+	v := &validator{b: newBuilder(), p: s.start}
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			var span xml.Span
+			if sr, ok := r.(spanReader); ok {
+				span = sr.Span()
+			}
+			if st, ok := tok.(xml.SourceToken); ok {
+				tok = st.Token
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				v.start(tok, span)
+			case xml.EndElement:
+				v.end(span)
+			case xml.CharData:
+				v.chars(tok, span)
+			case xml.CDATA:
+				v.chars(tok, span)
+			}
+		}
+		if err == io.EOF {
+			return v.violations, nil
+		}
+		if err != nil {
+			return v.violations, err
+		}
+	}
+}
+
+func (v *validator) report(span xml.Span, path []xml.Name, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{
+		Span: span,
+		Path: append([]xml.Name(nil), path...),
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) path() []xml.Name {
+	path := make([]xml.Name, 0, len(v.stack))
+	for _, f := range v.stack {
+		path = append(path, f.name)
+	}
+	return path
+}
+
+// skipping reports whether the innermost open element is being ignored.
+func (v *validator) skipping() bool {
+	return len(v.stack) > 0 && v.stack[len(v.stack)-1].skip
+}
+
+func (v *validator) start(start xml.StartElement, span xml.Span) {
+	if v.skipping() {
+		v.stack = append(v.stack, &frame{name: start.Name, skip: true})
+		return
+	}
+	v.flushText(false)
+	v.hasChild = true
+	f := &frame{name: start.Name, span: span}
+	v.stack = append(v.stack, f)
+	p := v.startTagOpenDeriv(v.p, start.Name)
+	if p == notAllowed {
+		v.report(span, v.path(), "element %s is not allowed here", start.Name.Local)
+		f.skip = true
+		return
+	}
+	attrFailed := false
+	for _, a := range start.Attr {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		next := v.attDeriv(p, a)
+		if next == notAllowed {
+			v.report(span, v.path(), "attribute %s is not allowed or has an invalid value", a.Name.Local)
+			attrFailed = true
+			continue
+		}
+		p = next
+	}
+	next := v.startTagCloseDeriv(p)
+	if next == notAllowed {
+		// An invalid attribute that was ignored is likely the missing one.
+		if !attrFailed {
+			v.report(span, v.path(), "element %s is missing required attributes", start.Name.Local)
+		}
+		next = v.startTagCloseDeriv(v.dropAttrs(p))
+	}
+	v.p = next
+	v.hasChild = false
+}
+
+func (v *validator) chars(b []byte, span xml.Span) {
+	if v.skipping() || len(v.stack) == 0 {
+		return
+	}
+	if v.text.Len() == 0 {
+		v.textSpan = span
+	}
+	v.text.Write(b)
+}
+
+// flushText matches text read since the last tag.
+// If the element ends without children, its text must match even if empty.
+func (v *validator) flushText(end bool) {
+	s := v.text.String()
+	v.text.Reset()
+	if s == "" && !(end && !v.hasChild) {
+		return
+	}
+	f := v.stack[len(v.stack)-1]
+	p := v.textDeriv(v.p, s)
+	if strings.TrimSpace(s) == "" {
+		p = v.b.choice(v.p, p)
+	}
+	if p == notAllowed {
+		if !f.failed {
+			v.report(v.textSpan, v.path(), "text is not allowed or is invalid")
+			f.failed = true
+		}
+		return
+	}
+	v.p = p
+}
+
+func (v *validator) end(span xml.Span) {
+	if len(v.stack) == 0 {
+		return
+	}
+	f := v.stack[len(v.stack)-1]
+	if f.skip {
+		v.stack = v.stack[:len(v.stack)-1]
+		v.hasChild = true
+		return
+	}
+	v.flushText(true)
+	p := v.endTagDeriv(v.p)
+	if p == notAllowed {
+		if !f.failed {
+			v.report(span, v.path(), "content of element %s is incomplete", f.name.Local)
+		}
+		p = v.endTagDeriv(v.recover(v.p))
+	}
+	v.p = p
+	v.stack = v.stack[:len(v.stack)-1]
+	v.hasChild = true
+}
+
+// recover replaces the content pattern of the innermost open element with
+// empty so that validation may continue after its end tag.
+func (v *validator) recover(p *pattern) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return v.b.choice(v.recover(p.p1), v.recover(p.p2))
+	case afterPattern:
+		return v.b.after(empty, p.p2)
+	}
+	return p
+}
+
+// dropAttrs removes attribute patterns from the content of the innermost open
+// element.
+func (v *validator) dropAttrs(p *pattern) *pattern {
+	p = deref(p)
+	switch p.kind {
+	case attributePattern:
+		return empty
+	case afterPattern:
+		return v.b.after(v.dropAttrs(p.p1), p.p2)
+	case choicePattern:
+		return v.b.choice(v.dropAttrs(p.p1), v.dropAttrs(p.p2))
+	case groupPattern:
+		return v.b.group(v.dropAttrs(p.p1), v.dropAttrs(p.p2))
+	case interleavePattern:
+		return v.b.interleave(v.dropAttrs(p.p1), v.dropAttrs(p.p2))
+	case oneOrMorePattern:
+		return v.b.oneOrMore(v.dropAttrs(p.p1))
+	}
+	return p
+}
+
+func nullable(p *pattern) bool {
+	p = deref(p)
+	switch p.kind {
+	case groupPattern, interleavePattern:
+		return nullable(p.p1) && nullable(p.p2)
+	case choicePattern:
+		return nullable(p.p1) || nullable(p.p2)
+	case oneOrMorePattern:
+		return nullable(p.p1)
+	case emptyPattern, textPattern:
+		return true
+	}
+	return false
+}
+
+// applyAfter applies f to the second pattern of each after pattern in p.
+func (v *validator) applyAfter(f func(*pattern) *pattern, p *pattern) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return v.b.after(p.p1, f(p.p2))
+	case choicePattern:
+		return v.b.choice(v.applyAfter(f, p.p1), v.applyAfter(f, p.p2))
+	}
+	return notAllowed
+}
+
+func (v *validator) startTagOpenDeriv(p *pattern, name xml.Name) *pattern {
+	p = deref(p)
+	switch p.kind {
+	case choicePattern:
+		return v.b.choice(v.startTagOpenDeriv(p.p1, name), v.startTagOpenDeriv(p.p2, name))
+	case elementPattern:
+		if p.nc.contains(name) {
+			return v.b.after(p.p1, empty)
+		}
+	case interleavePattern:
+		p1, p2 := p.p1, p.p2
+		return v.b.choice(
+			v.applyAfter(func(x *pattern) *pattern { return v.b.interleave(x, p2) }, v.startTagOpenDeriv(p1, name)),
+			v.applyAfter(func(x *pattern) *pattern { return v.b.interleave(p1, x) }, v.startTagOpenDeriv(p2, name)),
+		)
+	case oneOrMorePattern:
+		rest := v.b.choice(p, empty)
+		return v.applyAfter(func(x *pattern) *pattern { return v.b.group(x, rest) }, v.startTagOpenDeriv(p.p1, name))
+	case groupPattern:
+		p2 := p.p2
+		x := v.applyAfter(func(y *pattern) *pattern { return v.b.group(y, p2) }, v.startTagOpenDeriv(p.p1, name))
+		if nullable(p.p1) {
+			return v.b.choice(x, v.startTagOpenDeriv(p2, name))
+		}
+		return x
+	case afterPattern:
+		p2 := p.p2
+		return v.applyAfter(func(y *pattern) *pattern { return v.b.after(y, p2) }, v.startTagOpenDeriv(p.p1, name))
+	}
+	return notAllowed
+}
+
+func (v *validator) attDeriv(p *pattern, a xml.Attr) *pattern {
+	p = deref(p)
+	switch p.kind {
+	case afterPattern:
+		return v.b.after(v.attDeriv(p.p1, a), p.p2)
+	case choicePattern:
+		return v.b.choice(v.attDeriv(p.p1, a), v.attDeriv(p.p2, a))
+	case groupPattern:
+		return v.b.choice(v.b.group(v.attDeriv(p.p1, a), p.p2), v.b.group(p.p1, v.attDeriv(p.p2, a)))
+	case interleavePattern:
+		return v.b.choice(v.b.interleave(v.attDeriv(p.p1, a), p.p2), v.b.interleave(p.p1, v.attDeriv(p.p2, a)))
+	case oneOrMorePattern:
+		return v.b.group(v.attDeriv(p.p1, a), v.b.choice(p, empty))
+	case attributePattern:
+		if p.nc.contains(a.Name) && v.valueMatch(p.p1, a.Value) {
+			return empty
+		}
+	}
+	return notAllowed
+}
+
+func (v *validator) valueMatch(p *pattern, s string) bool {
+	return (nullable(p) && strings.TrimSpace(s) == "") || nullable(v.textDeriv(p, s))
+}
+
+func (v *validator) startTagCloseDeriv(p *pattern) *pattern {
+	p = deref(p)
+	switch p.kind {
+	case afterPattern:
+		return v.b.after(v.startTagCloseDeriv(p.p1), p.p2)
+	case choicePattern:
+		return v.b.choice(v.startTagCloseDeriv(p.p1), v.startTagCloseDeriv(p.p2))
+	case groupPattern:
+		return v.b.group(v.startTagCloseDeriv(p.p1), v.startTagCloseDeriv(p.p2))
+	case interleavePattern:
+		return v.b.interleave(v.startTagCloseDeriv(p.p1), v.startTagCloseDeriv(p.p2))
+	case oneOrMorePattern:
+		return v.b.oneOrMore(v.startTagCloseDeriv(p.p1))
+	case attributePattern:
+		return notAllowed
+	}
+	return p
+}
+
+func (v *validator) textDeriv(p *pattern, s string) *pattern {
+	p = deref(p)
+	switch p.kind {
+	case choicePattern:
+		return v.b.choice(v.textDeriv(p.p1, s), v.textDeriv(p.p2, s))
+	case interleavePattern:
+		return v.b.choice(v.b.interleave(v.textDeriv(p.p1, s), p.p2), v.b.interleave(p.p1, v.textDeriv(p.p2, s)))
+	case groupPattern:
+		x := v.b.group(v.textDeriv(p.p1, s), p.p2)
+		if nullable(p.p1) {
+			return v.b.choice(x, v.textDeriv(p.p2, s))
+		}
+		return x
+	case afterPattern:
+		return v.b.after(v.textDeriv(p.p1, s), p.p2)
+	case oneOrMorePattern:
+		return v.b.group(v.textDeriv(p.p1, s), v.b.choice(p, empty))
+	case textPattern:
+		return p
+	case valuePattern:
+		if p.dt.equal(p.value, s) {
+			return empty
+		}
+	case dataPattern:
+		if p.dt.allows(s) {
+			return empty
+		}
+	case dataExceptPattern:
+		if p.dt.allows(s) && !nullable(v.textDeriv(p.p1, s)) {
+			return empty
+		}
+	case listPattern:
+		lp := p.p1
+		for _, word := range strings.Fields(s) {
+			lp = v.textDeriv(lp, word)
+		}
+		if nullable(lp) {
+			return empty
+		}
+	}
+	return notAllowed
+}
+
+func (v *validator) endTagDeriv(p *pattern) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return v.b.choice(v.endTagDeriv(p.p1), v.endTagDeriv(p.p2))
+	case afterPattern:
+		if nullable(p.p1) {
+			return p.p2
+		}
+	}
+	return notAllowed
+}
@@ -0,0 +1,15 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// SourceToken is a token along with the exact input that it was decoded from.
+// SourceTokens are returned by a Tokenizer with SourceTokens set.
+//
+// If tokens were skipped by the tokenizer (for example, comments when
+// SkipComments is set), their input is included at the start of Source.
+type SourceToken struct {
+	Token
+	Source []byte
+}
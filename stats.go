@@ -0,0 +1,56 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// Stats contains counters describing the input read by a tokenizer.
+type Stats struct {
+	// BytesRead is the number of bytes of input that have been consumed.
+	BytesRead int64
+
+	// The number of tokens of each kind that have been returned.
+	// Empty element tags count as both a start and an end element.
+	StartElements int64
+	EndElements   int64
+	CharData      int64
+	Comments      int64
+	ProcInsts     int64
+	Directives    int64
+
+	// Depth is the number of elements that are currently open, and MaxDepth the
+	// largest number that have been open at once.
+	Depth    int
+	MaxDepth int
+}
+
+// Stats returns counters describing the input that has been read so far.
+// The counters are kept until the tokenizer is reset, including across calls
+// to Restart.
+func (t *Tokenizer) Stats() Stats {
+	s := t.stats
+	s.BytesRead = t.InputOffset()
+	s.Depth = t.depth()
+	return s
+}
+
+// count updates the statistics after a token is decoded.
+func (t *Tokenizer) count(tok Token) {
+	switch tok.(type) {
+	case StartElement:
+		t.stats.StartElements++
+		if d := t.depth(); d > t.stats.MaxDepth {
+			t.stats.MaxDepth = d
+		}
+	case EndElement:
+		t.stats.EndElements++
+	case CharData:
+		t.stats.CharData++
+	case Comment:
+		t.stats.Comments++
+	case ProcInst:
+		t.stats.ProcInsts++
+	case Directive:
+		t.stats.Directives++
+	}
+}
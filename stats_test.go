@@ -0,0 +1,61 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var statsTestCases = [...]struct {
+	in    string
+	n     int
+	stats Stats
+}{
+	0: {
+		in: `<?xml version="1.0"?><!DOCTYPE a><a><!--c-->text<b><c/></b></a>`,
+		n:  -1,
+		stats: Stats{
+			BytesRead:     63,
+			StartElements: 3,
+			EndElements:   3,
+			CharData:      1,
+			Comments:      1,
+			ProcInsts:     1,
+			Directives:    1,
+			MaxDepth:      3,
+		},
+	},
+	1: {
+		in: `<a><b><c/>`,
+		n:  3,
+		stats: Stats{
+			BytesRead:     10,
+			StartElements: 3,
+			Depth:         3,
+			MaxDepth:      3,
+		},
+	},
+}
+
+func TestStats(t *testing.T) {
+	for i, tc := range statsTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d := NewTokenizer(strings.NewReader(tc.in))
+			for n := 0; n != tc.n; n++ {
+				_, err := d.Token()
+				if err != nil {
+					break
+				}
+			}
+			if s := d.Stats(); s != tc.stats {
+				t.Errorf("wrong stats:\nwant=%+v,\n got=%+v", tc.stats, s)
+			}
+		})
+	}
+}
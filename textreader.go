@@ -0,0 +1,119 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+)
+
+// CharDataReader returns a reader that streams the character data at the
+// current position of the tokenizer, with entity and character references
+// decoded, instead of returning it as a CharData token.
+// This allows very large text, such as base64 encoded files, to be processed
+// without holding all of it in memory.
+// If the next token is not character data CharDataReader returns nil and a nil
+// error, and the token is left to be returned by Token.
+//
+// The reader returns io.EOF at the end of the character data.
+// Options that apply to CharData tokens, such as TrimSpace and ValidateDTD,
+// are not applied to the text, and CDATA sections are not included in it.
+// If Token is called before the reader returns io.EOF, the rest of the text is
+// returned as a CharData token.
+func (t *Tokenizer) CharDataReader() (io.Reader, error) {
+	if t.foundStart || t.inCDATA || t.selfClose != nil {
+		return nil, nil
+	}
+	t.pulled = t.pulled[:0]
+	line, col := t.line, t.col
+	b, err := t.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if b == '<' {
+		t.foundStart = true
+		return nil, nil
+	}
+	t.unread([]byte{b})
+	t.line, t.col = line, col
+	return &charDataReader{t: t}, nil
+}
+
+type charDataReader struct {
+	t *Tokenizer
+	// ref contains the part of a decoded reference that has not yet been read.
+	ref  []byte
+	done bool
+}
+
+func (r *charDataReader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(r.ref) > 0 {
+		n = copy(p, r.ref)
+		r.ref = r.ref[n:]
+		return n, nil
+	}
+	if r.done {
+		return 0, io.EOF
+	}
+	t := r.t
+	// There is no token to restore if reading is retried, so there is no need
+	// to keep the bytes that were read.
+	t.pulled = t.pulled[:0]
+	start := t.InputOffset()
+	defer func() {
+		if werr := t.dropRaw(start); err == nil {
+			err = werr
+		}
+	}()
+
+	if run := t.readRun(p[:0], "<&", len(p)); len(run) > 0 {
+		return len(run), nil
+	}
+	b, err := t.readByte()
+	switch {
+	case errors.Is(err, io.EOF):
+		r.done = true
+		return 0, io.EOF
+	case err != nil:
+		return 0, err
+	case b == '<':
+		t.foundStart = true
+		r.done = true
+		return 0, io.EOF
+	case b == '&':
+		ref, err := decodeEntity(t, r.ref[:0], true)
+		if errors.Is(err, io.EOF) {
+			r.done = true
+		} else if err != nil {
+			return 0, err
+		}
+		n = copy(p, ref)
+		r.ref = ref[n:]
+		return n, nil
+	}
+	p[0] = b
+	return 1, nil
+}
+
+// dropRaw discards the raw input since start, which is not part of any token,
+// after writing it to Tee.
+func (t *Tokenizer) dropRaw(start int64) error {
+	if !t.recording() {
+		return nil
+	}
+	n := int(t.InputOffset() - start)
+	if n > len(t.raw) {
+		n = len(t.raw)
+	}
+	var err error
+	if t.Tee != nil && n > 0 {
+		_, err = t.Tee.Write(t.raw[:n])
+	}
+	t.raw = append(t.raw[:0], t.raw[n:]...)
+	return err
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "mellium.im/xml"
+)
+
+var charDataReaderTestCases = [...]struct {
+	in   string
+	text string
+	next Token
+}{
+	0: {in: `foo &amp; &#x42;ar<a/>`, text: "foo & Bar", next: StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}},
+	1: {in: `<a/>`, next: StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}},
+	2: {in: strings.Repeat("0123456789", 1000) + "&lt;", text: strings.Repeat("0123456789", 1000) + "<"},
+	3: {in: `text &#x3C;&#62;`, text: "text <>"},
+}
+
+func TestCharDataReader(t *testing.T) {
+	for i, tc := range charDataReaderTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var tee bytes.Buffer
+			td := NewTokenizerSize(iotest.HalfReader(strings.NewReader(tc.in)), 16)
+			td.Tee = &tee
+			r, err := td.CharDataReader()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if (r == nil) != (tc.text == "") {
+				t.Fatalf("wrong reader: got=%v", r)
+			}
+			if r != nil {
+				// Read with a small buffer to exercise references that do not fit.
+				text, err := io.ReadAll(iotest.OneByteReader(r))
+				if err != nil {
+					t.Fatalf("unexpected error reading text: %v", err)
+				}
+				if string(text) != tc.text {
+					t.Errorf("wrong text: want=%q, got=%q", tc.text, text)
+				}
+			}
+			tok, err := td.Token()
+			if tc.next == nil {
+				if err != io.EOF {
+					t.Errorf("expected EOF, got %v, %v", tok, err)
+				}
+			} else if !reflect.DeepEqual(tok, tc.next) {
+				t.Errorf("wrong next token: want=%v, got=%v", tc.next, tok)
+			}
+			_, err = readAll(td)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tee.String() != tc.in {
+				t.Errorf("wrong input written to Tee: want=%q, got=%q", tc.in, tee.String())
+			}
+		})
+	}
+}
+
+func TestCharDataReaderPartial(t *testing.T) {
+	td := NewTokenizer(strings.NewReader(`<a>foobar</a>`))
+	_, err := td.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r, err := td.CharDataReader()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := make([]byte, 3)
+	_, err = io.ReadFull(r, p)
+	if err != nil {
+		t.Fatalf("unexpected error reading text: %v", err)
+	}
+	toks, err := readAll(td)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{CharData("bar"), EndElement{Name: Name{Local: "a"}}}
+	if string(p) != "foo" || !reflect.DeepEqual(toks, want) {
+		t.Errorf("wrong text and tokens: want=%q, %v, got=%q, %v", "foo", want, p, toks)
+	}
+}
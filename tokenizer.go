@@ -5,15 +5,21 @@
 package xml
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
 	"strings"
+	"unicode/utf8"
 )
 
-const xmlURL = "http://www.w3.org/XML/1998/namespace"
+const (
+	xmlURL   = "http://www.w3.org/XML/1998/namespace"
+	xmlSpace = " \t\r\n"
+)
 
 // Various types re-used from the standard library XML package, aliased here so
 // that both packages don't need to be imported.
@@ -43,7 +49,6 @@ var (
 	MarshalIndent   = xml.MarshalIndent
 	Marshal         = xml.Marshal
 	Unmarshal       = xml.Unmarshal
-	NewEncoder      = xml.NewEncoder
 	NewTokenDecoder = xml.NewTokenDecoder
 	CopyToken       = xml.CopyToken
 	EscapeText      = xml.EscapeText
@@ -61,32 +66,645 @@ func NewDecoder(r io.Reader) *Decoder {
 
 // Tokenizer splits a reader into XML tokens without performing any verification
 // or namespace resolution on those tokens.
+//
+// By default the input is tokenized as a fragment: any number of elements and
+// character data may appear at the top level, and empty input is not an
+// error.
+// This is useful for reading the content of an element or a stream of
+// top-level elements such as those sent over an XMPP connection.
+// To require the input to be a complete document with a single root element
+// set Document.
+//
+// As required by the XML spec, line endings are normalized so that "\r\n" and
+// a lone "\r" are both read as "\n", and literal whitespace in attribute values
+// is replaced by spaces.
+// If the DOCTYPE declares an attribute with a type other than CDATA, leading and
+// trailing spaces are also removed from its value and runs of spaces are
+// collapsed.
+// Whitespace that is written as a character reference, such as "&#xD;", is
+// kept as is.
+// The input passed to Tee and the Source of a SourceToken are not normalized.
+//
+// In character data and attribute values, the predefined entities ("&lt;",
+// "&gt;", "&amp;", "&apos;", and "&quot;") and character references are
+// replaced by the text they represent.
+// References to internal entities declared by the DOCTYPE are replaced by their
+// replacement text, which in character data may contain markup that is
+// tokenized as if it appeared in the input.
+// References to external entities are only expanded in character data and only
+// if they are resolved using EntityResolver.
+// Any other reference, including a reference to an entity that may be declared
+// in an external subset that is not loaded, a character reference to a
+// character that is not allowed in XML, or an "&" that does not start a
+// reference terminated by ";", results in a SyntaxError.
 type Tokenizer struct {
+	// CharDataChunkSize, if greater than zero, limits the length of CharData
+	// tokens.
+	// Text longer than the limit is returned as several consecutive CharData
+	// tokens instead of being buffered in its entirety.
+	// Chunks never split a UTF-8 encoded rune, so they may exceed the limit by a
+	// few bytes.
+	CharDataChunkSize int
+
+	// CoalesceCharData causes adjacent runs of character data and CDATA sections
+	// to be merged into a single CharData token.
+	// By default, as in encoding/xml, each CDATA section is returned as its own
+	// token.
+	CoalesceCharData bool
+
+	// SkipWhitespace causes CharData tokens that consist entirely of XML
+	// whitespace to be dropped instead of being returned.
+	// CDATA sections and text that is split into chunks by CharDataChunkSize are
+	// never dropped.
+	SkipWhitespace bool
+
+	// TrimSpace causes leading and trailing XML whitespace to be removed from
+	// CharData tokens, except inside elements where xml:space="preserve" is in
+	// effect.
+	// Tokens that are left empty after trimming are dropped.
+	TrimSpace bool
+
+	// SkipComments causes comments to be consumed without ever being returned
+	// as Comment tokens.
+	SkipComments bool
+
+	// SkipDirectives causes directives such as <!DOCTYPE ...> to be consumed
+	// without ever being returned as Directive tokens.
+	SkipDirectives bool
+
+	// SkipAttrDefaults disables adding the default values of attributes
+	// declared by ATTLIST declarations in the internal subset of the DOCTYPE to
+	// start elements that omit them.
+	// Defaults are applied even if SkipDirectives is set.
+	SkipAttrDefaults bool
+
+	// EntityResolver, if non-nil, is used to load the external subset of the
+	// DOCTYPE and to replace references to external parsed entities declared by
+	// it with their content.
+	// By default external entities are never resolved.
+	// Because the content of entities, including internal entities, is
+	// tokenized as if it appeared in the input, the positions reported for
+	// tokens after an expanded entity are not accurate.
+	EntityResolver EntityResolver
+
+	// DecodeDeclaration causes the XML declaration to be returned as a
+	// Declaration token instead of a ProcInst.
+	// When it is set, an XML declaration that does not appear at the very start
+	// of the input, or that has invalid pseudo-attributes, is a syntax error.
+	DecodeDeclaration bool
+
+	// Tee, if non-nil, receives a copy of every byte consumed by the tokenizer.
+	// Bytes are written once per call to Token, and each write contains exactly
+	// the raw input of the returned token (preceded by the input of any tokens
+	// that were skipped).
+	// An error writing to Tee is returned from Token.
+	Tee io.Writer
+
+	// SourceTokens causes Token to return each token wrapped in a SourceToken
+	// that carries the raw input the token was decoded from.
+	// The original prefixes, attribute order and quoting, entities, and
+	// whitespace inside of tags are all preserved in the input, allowing a
+	// RawEncoder with Fidelity set to reproduce the input byte for byte.
+	SourceTokens bool
+
+	// Observe, if non-nil, is called with each token and its span as it is
+	// returned by Token, before it is wrapped in a SourceToken.
+	// Tokens that are skipped, such as comments when SkipComments is set, are
+	// not observed.
+	// If ZeroCopy is set the token must be copied to be retained.
+	Observe func(tok Token, span Span)
+
+	// Trace, if non-nil, is called to report changes to the internal state of
+	// the tokenizer such as decoding attributes, opening and closing elements,
+	// binding namespaces, and growing buffers.
+	// It is intended for debugging tokenization of malformed input and may be
+	// set to a function such as log.Printf.
+	// The messages are not stable and should not be parsed.
+	Trace func(format string, v ...interface{})
+
+	// Document causes the input to be treated as a complete XML document
+	// instead of a fragment, which is the default.
+	// It is a syntax error if the input does not contain exactly one root
+	// element or if anything other than comments, processing instructions,
+	// whitespace, and the DOCTYPE appears outside of it.
+	Document bool
+
+	// MultiDocument allows the input to contain several documents one after
+	// another if Document is also set.
+	// Token returns io.EOF at the end of each document, and NextDocument must be
+	// called to continue reading.
+	// A document ends when it is followed by a start element or an XML
+	// declaration, so any comments or processing instructions between two
+	// documents belong to the first one.
+	MultiDocument bool
+
+	// ZeroCopy causes the bytes of CharData, Comment, and Directive tokens to be
+	// returned directly from a buffer that belongs to the tokenizer and is
+	// reused by later tokens instead of being copied into newly allocated
+	// memory.
+	// The bytes are only valid until the next call to Token and may be
+	// overwritten by it, so they must be copied if they are to be retained, for
+	// example by calling CopyToken.
+	// This eliminates most per-token allocations for workloads that inspect
+	// each token and then discard it.
+	ZeroCopy bool
+
+	// StrictNamespaces causes a syntax error to be returned when a prefix that
+	// is not bound to a namespace is used in the name of an element or
+	// attribute.
+	// By default unbound prefixes are left in the Space field of the name as
+	// is.
+	StrictNamespaces bool
+
+	// LazyAttr causes the attributes of start elements to be skipped over
+	// without being decoded, so that StartElement tokens have a nil Attr field.
+	// The attributes of the most recent start element may be decoded by calling
+	// Attr before the next call to Token.
+	// Attributes that declare namespaces or set xml:space are always decoded
+	// because they affect the tokenizer, and the option has no effect if
+	// ValidateDTD or StrictNamespaces is set or if the DOCTYPE declares default
+	// attribute values for the element.
+	// Syntax errors in attributes that are skipped are not reported until they
+	// are decoded.
+	LazyAttr bool
+
+	// LongAttr, if non-nil, is called with the name of each attribute whose
+	// value is longer than LongAttrSize bytes and a reader that streams the
+	// value, so that very long values such as data: URIs do not have to be held
+	// in memory.
+	// The name has not yet had its prefix resolved, and the attribute is left
+	// in the StartElement with an empty value.
+	// Any part of the value that is not read by LongAttr is discarded, and if
+	// LongAttr returns an error it is returned by Token.
+	// Namespace declarations are never streamed.
+	//
+	// If the underlying reader returns a timeout error while the value is being
+	// streamed, the error is returned by the value reader instead of by Token
+	// and reading the value may be retried.
+	LongAttr     func(name Name, value io.Reader) error
+	LongAttrSize int
+
+	// ValidateDTD causes start elements, attributes, and character data to be
+	// checked against the ELEMENT and ATTLIST declarations in the DOCTYPE.
+	// Violations do not stop tokenization, instead they are collected and may
+	// be retrieved by calling ValidityErrors.
+	ValidateDTD bool
+
 	r          io.ByteReader
+	src        io.Reader
+	br         *readBuffer
+	try        bufferedReader
+	n          int64
+	pending    []byte
+	pulled     []byte
+	raw        []byte
+	line       int
+	col        int
+	spanStart  Pos
+	spanEnd    Pos
+	inCDATA    bool
+	cdata      bool
+	textCont   bool
 	foundStart bool
+	afterCR    bool
 	selfClose  *xml.Name
-	prefixes   []map[string]string
+	ns         []nsBinding
 	spaces     []string
+	outerSpace string
+	preserve   []bool
+	started    bool
+	noResolve  bool
+	doctype    *doctype
+	expansions int
+	validity   dtdValidator
+	foundRoot  bool
+	rootDone   bool
+	buf        []byte
+	nameBuf    []byte
+	interned   map[string]string
+	mem        *bytesReader
+	lazy       []byte
+	hasLazy    bool
+	noRetry    bool
+	stats      Stats
 }
 
 // NewTokenizer creates a new XML parser reading from r.
 // If r does not implement io.ByteReader, NewDecoder will do its own buffering.
 func NewTokenizer(r io.Reader) *Tokenizer {
 	t := &Tokenizer{}
+	t.setReader(r)
+	return t
+}
+
+func (t *Tokenizer) setReader(r io.Reader) {
+	t.src = r
+	t.mem = nil
 	if br, ok := r.(io.ByteReader); ok {
 		t.r = br
+		return
+	}
+	if t.br == nil {
+		t.br = newReadBuffer(r)
 	} else {
-		t.r = bufio.NewReader(r)
+		t.br.Reset(r)
 	}
-	return t
+	t.r = t.br
+}
+
+// SetReader replaces the reader that the tokenizer reads from, keeping all
+// other state such as open elements and namespace declarations.
+// This lets connections that are upgraded mid-stream, for example from TCP to
+// TLS, continue to use the same tokenizer.
+//
+// If keepBuffered is true, any input that was read from the old reader but has
+// not yet been tokenized (including the contents of the buffer created by
+// NewTokenizer if the old reader was not an io.ByteReader) is tokenized before
+// reading from r.
+// Otherwise it is discarded.
+func (t *Tokenizer) SetReader(r io.Reader, keepBuffered bool) {
+	if !keepBuffered {
+		t.pending = nil
+		t.foundStart = false
+		t.raw = t.raw[:0]
+	} else if br, ok := t.r.(bufferedByteReader); ok && (t.r == t.br || t.r == t.mem) {
+		// Move anything that is buffered out of the bufio.Reader or input
+		// slice before it is replaced.
+		buffered, _ := br.Peek(br.Buffered())
+		t.pending = append(t.pending, buffered...)
+		t.n += int64(len(buffered))
+		if t.recording() {
+			t.raw = append(t.raw, buffered...)
+		}
+	}
+	t.setReader(r)
 }
 
 // Token returns the next XML token in the input stream.
 // At the end of the input stream, Token returns nil, io.EOF.
+//
+// If the underlying reader returns a timeout error (a net.Error whose Timeout
+// method reports true) partway through a token, the error is returned and the
+// partially decoded token is kept so that Token can be called again once more
+// input is available.
 func (t *Tokenizer) Token() (Token, error) {
+	saved := t.save()
+	start := t.InputOffset()
+	t.noRetry = false
+	tok, err := t.next()
+	if retryable(err) && !t.noRetry {
+		t.restore(saved)
+		if t.Trace != nil {
+			t.tracef("rewind to decode %d bytes again: %v", len(t.pending), err)
+		}
+		return nil, err
+	}
+	t.count(tok)
+	if t.Observe != nil && tok != nil {
+		t.Observe(tok, t.Span())
+	}
+	if !t.recording() {
+		return tok, err
+	}
+
+	n := int(t.InputOffset() - start)
+	if n > len(t.raw) {
+		n = len(t.raw)
+	}
+	raw := t.raw[:n]
+	if t.Tee != nil && n > 0 {
+		_, werr := t.Tee.Write(raw)
+		if err == nil {
+			err = werr
+		}
+	}
+	if t.SourceTokens && tok != nil {
+		tok = SourceToken{
+			Token:  tok,
+			Source: append([]byte(nil), raw...),
+		}
+	}
+	t.raw = append(t.raw[:0], t.raw[n:]...)
+	return tok, err
+}
+
+// tokenBuf returns an empty buffer to decode the bytes of a token into,
+// reusing the memory of previous tokens.
+func (t *Tokenizer) tokenBuf() []byte {
+	return t.buf[:0]
+}
+
+// keepBuf retains the memory of a buffer returned by tokenBuf after it has
+// been grown so that it can be reused by the next token.
+func (t *Tokenizer) keepBuf(b CharData, err error) (CharData, error) {
+	if cap(b) > cap(t.buf) {
+		if t.Trace != nil {
+			t.tracef("grow token buffer from %d to %d bytes", cap(t.buf), cap(b))
+		}
+		t.buf = b[:0]
+	}
+	return b, err
+}
+
+// own copies the bytes of a token out of the buffer returned by tokenBuf so
+// that the caller may retain them, unless ZeroCopy is set.
+// The copy is allocated at its final size, so growing the buffer while the
+// token was decoded costs no further allocations.
+func (t *Tokenizer) own(tok Token) Token {
+	if t.ZeroCopy {
+		return tok
+	}
+	switch tok := tok.(type) {
+	case CharData:
+		if len(tok) == 0 {
+			// Only empty CDATA sections produce empty character data, and they have
+			// always been returned as nil.
+			return CharData(nil)
+		}
+		return CharData(cloneBytes(tok))
+	case Comment:
+		return Comment(cloneBytes(tok))
+	case Directive:
+		return Directive(cloneBytes(tok))
+	}
+	return tok
+}
+
+// cloneBytes returns a copy of b with no excess capacity.
+// Unlike appending to a nil slice, it keeps the distinction between nil and
+// empty slices.
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+// recording reports whether the raw input of tokens is being retained.
+func (t *Tokenizer) recording() bool {
+	return t.Tee != nil || t.SourceTokens
+}
+
+func (t *Tokenizer) next() (Token, error) {
+	defer func() {
+		t.spanEnd = t.pos()
+	}()
+	for {
+		t.spanStart = t.pos()
+		t.cdata = false
+		cont := t.textCont
+		if t.Document && t.MultiDocument && t.rootDone {
+			next, err := t.atNextDocument()
+			if err != nil {
+				return nil, err
+			}
+			if next {
+				return nil, io.EOF
+			}
+		}
+		tok, err := t.token()
+		if err == io.EOF && t.Document {
+			err = t.checkDocumentEnd()
+		}
+		if err != nil {
+			return t.own(tok), err
+		}
+		if tok == nil {
+			// The token was consumed without being materialized.
+			continue
+		}
+		cd, ok := tok.(CharData)
+		if !ok {
+			t.textCont = false
+			if _, ok := tok.(EndElement); ok && t.ValidateDTD {
+				t.validateEnd()
+			}
+			if t.Document {
+				if err := t.checkDocument(tok); err != nil {
+					return nil, err
+				}
+			}
+			return t.own(tok), nil
+		}
+		if t.CoalesceCharData {
+			cd, err = t.keepBuf(coalesce(t, cd))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if t.Document && t.depth() == 0 && (t.cdata || !onlySpace(cd)) {
+			return nil, t.syntaxError("character data outside of the root element")
+		}
+		if t.SkipWhitespace && !cont && !t.textCont && !t.cdata && onlySpace(cd) {
+			continue
+		}
+		if t.TrimSpace && !t.preserveSpace() {
+			if !cont {
+				cd = bytes.TrimLeft(cd, xmlSpace)
+			}
+			if !t.textCont {
+				cd = bytes.TrimRight(cd, xmlSpace)
+			}
+			if len(cd) == 0 {
+				continue
+			}
+		}
+		if t.ValidateDTD {
+			t.validateText(cd)
+		}
+		return t.own(cd), nil
+	}
+}
+
+// checkDocument enforces the structure of a document on tokens other than
+// character data if Document is set.
+func (t *Tokenizer) checkDocument(tok Token) error {
+	switch tok.(type) {
+	case StartElement:
+		if t.depth() > 1 {
+			return nil
+		}
+		if t.foundRoot {
+			return t.syntaxError("more than one root element")
+		}
+		t.foundRoot = true
+	case EndElement:
+		if t.depth() > 0 {
+			return nil
+		}
+		if !t.foundRoot || t.rootDone {
+			return t.syntaxError("end element outside of the root element")
+		}
+		t.rootDone = true
+	case Directive:
+		if t.foundRoot {
+			return t.syntaxError("directive after the start of the root element")
+		}
+	}
+	return nil
+}
+
+// syntaxError returns a syntax error at the current line.
+func (t *Tokenizer) syntaxError(msg string) *SyntaxError {
+	return &SyntaxError{Msg: msg, Line: t.line + 1}
+}
+
+// checkDocumentEnd returns an error if the input ended before the root
+// element was complete.
+func (t *Tokenizer) checkDocumentEnd() error {
+	switch {
+	case !t.foundRoot:
+		return t.syntaxError("document has no root element")
+	case !t.rootDone:
+		return errEarlyEOF
+	}
+	return io.EOF
+}
+
+// NextDocument prepares the tokenizer to read the next document in the input
+// when Document and MultiDocument are set.
+// Any tokens remaining in the current document are discarded.
+// If only whitespace remains in the input, NextDocument returns io.EOF.
+func (t *Tokenizer) NextDocument() error {
+	for {
+		_, err := t.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for !t.foundStart {
+		b, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		if !isSpace(b) {
+			t.unread([]byte{b})
+			t.col--
+			break
+		}
+	}
+	t.Restart()
+	return nil
+}
+
+// atNextDocument reports whether the next token after the root element of a
+// document starts another document, either with a start element or an XML
+// declaration.
+// No input is consumed.
+func (t *Tokenizer) atNextDocument() (bool, error) {
+	if t.selfClose != nil || t.inCDATA {
+		return false, nil
+	}
+	line, col := t.line, t.col
+	var peeked []byte
+	defer func() {
+		t.unread(peeked)
+		t.line, t.col = line, col
+	}()
+	want := []byte("<?xml")
+	if t.foundStart {
+		want = want[1:]
+	}
+	for {
+		b, err := t.readByte()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		peeked = append(peeked, b)
+		if len(peeked) > len(want) {
+			return isSpace(b), nil
+		}
+		if b == want[len(peeked)-1] {
+			continue
+		}
+		// The start of an element.
+		return len(peeked) == len(want)-3 && isNameByte(b) && b != '!', nil
+	}
+}
+
+// Restart discards all namespace declarations and open elements, returning the
+// tokenizer to the state it was in at the start of the input without
+// discarding the underlying reader or any input that has already been
+// buffered.
+// This is useful for protocols such as XMPP that restart the stream on the
+// same connection after negotiating STARTTLS or SASL.
+func (t *Tokenizer) Restart() {
+	t.inCDATA = false
+	t.cdata = false
+	t.textCont = false
+	t.started = false
+	t.selfClose = nil
+	t.ns = t.ns[:0]
+	t.spaces = t.spaces[:0]
+	t.outerSpace = ""
+	t.preserve = t.preserve[:0]
+	t.doctype = nil
+	t.expansions = 0
+	t.foundRoot = false
+	t.rootDone = false
+	t.validity = dtdValidator{}
+}
+
+// InputOffset returns the input stream byte offset of the current tokenizer
+// position.
+// The offset gives the location of the end of the most recently returned token
+// and the beginning of the next token.
+func (t *Tokenizer) InputOffset() int64 {
+	off := t.n - int64(len(t.pending))
+	if t.foundStart {
+		off--
+	}
+	return off
+}
+
+// InputPos returns the line of the current tokenizer position and the 1 based
+// input position of the line.
+// The position gives the location of the end of the most recently returned
+// token.
+func (t *Tokenizer) InputPos() (line, column int) {
+	p := t.pos()
+	return p.Line, p.Col
+}
+
+// Span returns the positions of the start and end of the most recently
+// returned token.
+// If the token was preceded by tokens that were skipped, they are not included
+// in the span.
+func (t *Tokenizer) Span() Span {
+	return Span{Start: t.spanStart, End: t.spanEnd}
+}
+
+func (t *Tokenizer) pos() Pos {
+	p := Pos{
+		Offset: t.InputOffset(),
+		Line:   t.line + 1,
+		Col:    t.col + 1,
+	}
+	if t.foundStart {
+		p.Col--
+	}
+	return p
+}
+
+func (t *Tokenizer) token() (Token, error) {
+	t.hasLazy = false
+	if t.inCDATA {
+		return t.keepBuf(decodeCDATA(t, t.tokenBuf()))
+	}
+	first := !t.started
+	t.started = true
 	if t.selfClose != nil {
 		name := *t.selfClose
 		t.selfClose = nil
+		t.pop()
 		return xml.EndElement{Name: name}, nil
 	}
 	var b byte
@@ -95,21 +713,33 @@ func (t *Tokenizer) Token() (Token, error) {
 		b = '<'
 		t.foundStart = false
 	} else {
-		b, err = t.r.ReadByte()
+		b, err = t.readByte()
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// We found a CharData. Read until we consume another '<'.
+	if b != '<' && b != '&' {
+		if cd, ok := t.memCharData(b); ok {
+			return cd, nil
+		}
+	}
 	if b != '<' {
-		// TODO: reuse buf
-		buf := []byte{b}
-		return decodeCharData(t, buf)
+		buf, err := appendCharData(t, t.tokenBuf(), b)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		cd, err := t.keepBuf(decodeCharData(t, buf))
+		if err == nil && len(cd) == 0 {
+			// An external entity that starts with markup was expanded.
+			return nil, nil
+		}
+		return cd, err
 	}
 
 	// We found a '<', figure out what it is.
-	b, err = t.r.ReadByte()
+	b, err = t.readByte()
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			return nil, errEarlyEOF
@@ -119,18 +749,29 @@ func (t *Tokenizer) Token() (Token, error) {
 	switch b {
 	case '!':
 		// Directive or comment
-		// TODO: reuse buffer
-		var buf []byte
-		b, err := t.r.ReadByte()
+		buf := t.tokenBuf()
+		b, err := t.readByte()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				return nil, errEarlyEOF
 			}
 			return nil, err
 		}
+		if b == '[' {
+			ok, err := t.consumePrefix(cdataStart[3:])
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil, errEarlyEOF
+				}
+				return nil, err
+			}
+			if ok {
+				return t.keepBuf(decodeCDATA(t, buf))
+			}
+		}
 		buf = append(buf, b)
 		if b == '-' {
-			b, err = t.r.ReadByte()
+			b, err = t.readByte()
 			if err != nil {
 				if errors.Is(err, io.EOF) {
 					return nil, errEarlyEOF
@@ -139,20 +780,50 @@ func (t *Tokenizer) Token() (Token, error) {
 			}
 			buf = append(buf, b)
 			if b == '-' {
+				if t.SkipComments {
+					return nil, skipComment(t)
+				}
 				buf = buf[:0]
-				return decodeComment(t, buf)
+				comment, err := decodeComment(t, buf)
+				t.keepBuf(CharData(comment), err)
+				return comment, err
 			} else {
 				return nil, &SyntaxError{Msg: "invalid sequence <!- not part of <!--"}
 			}
 		}
-		return decodeDirective(t, buf)
+		dir, err := decodeDirective(t, buf, false)
+		if err != nil {
+			return nil, err
+		}
+		t.keepBuf(CharData(dir), nil)
+		if d := parseDoctype(dir); d != nil {
+			if err = t.loadExternalSubset(d); err != nil {
+				return nil, err
+			}
+			t.doctype = d
+		}
+		if t.SkipDirectives {
+			return nil, nil
+		}
+		return dir, nil
 	case '?':
 		// ProcInst <?target inst?>
-		// TODO: reuse buffer
-		tok, err := decodeProcInst(t, nil)
+		tok, err := decodeProcInst(t, t.tokenBuf())
 		if err != nil {
 			return nil, err
 		}
+		t.keepBuf(CharData(tok.Inst), nil)
+		if len(tok.Inst) == 0 {
+			tok.Inst = nil
+		} else {
+			tok.Inst = cloneBytes(tok.Inst)
+		}
+		if t.DecodeDeclaration && tok.Target == "xml" {
+			if !first {
+				return nil, &SyntaxError{Msg: "XML declaration not at start of document"}
+			}
+			return parseDeclaration(tok)
+		}
 		return tok, nil
 	case '/':
 		return decodeEndElement(t)
@@ -162,14 +833,19 @@ func (t *Tokenizer) Token() (Token, error) {
 }
 
 func decodeStartElement(t *Tokenizer, b byte) (StartElement, error) {
-	t.spaces = append(t.spaces, "")
-	// TODO: defer make until we actually find a prefix?
-	t.prefixes = append(t.prefixes, make(map[string]string))
+	t.preserve = append(t.preserve, t.preserveSpace())
+	t.spaces = append(t.spaces, t.defaultSpace())
 	// TODO: check for space as sep?
-	name, sep, def, err := decodeName(t, b, false)
+	name, sep, err := decodeName(t, b)
 	if err != nil {
 		return StartElement{}, err
 	}
+	if t.Trace != nil {
+		t.tracef("push element %s at depth %d", rawName(name), t.depth())
+	}
+	if t.lazyAttrs(name) {
+		return decodeLazyStart(t, name, sep)
+	}
 	// We use an empty array instead of nil to match the behavior of encoding/xml.
 	attr := []Attr{}
 	for {
@@ -177,23 +853,22 @@ func decodeStartElement(t *Tokenizer, b byte) (StartElement, error) {
 		switch sep {
 		case 0x20, 0x9, 0xD, 0xA:
 			// Consume any spaces between the name and attributes.
-			sep, err = t.r.ReadByte()
+			sep, err = t.readByte()
 			if err != nil {
 				return StartElement{}, err
 			}
 			continue
 		case '/':
-			t.selfClose = &name
-			sep, err = t.r.ReadByte()
+			sep, err = t.readByte()
 			if err != nil {
 				return StartElement{}, err
 			}
 			if sep != '>' {
 				return StartElement{}, fmt.Errorf("xml: expected > to end the element, got %q", string(sep))
 			}
-			fallthrough
+			return t.endStart(name, attr, true)
 		case '>':
-			return StartElement{Name: name, Attr: attr}, nil
+			return t.endStart(name, attr, false)
 		}
 
 		// Decode the attribute we found.
@@ -201,111 +876,341 @@ func decodeStartElement(t *Tokenizer, b byte) (StartElement, error) {
 		if err != nil {
 			return StartElement{}, err
 		}
-		sep, err = t.r.ReadByte()
+		sep, err = t.readByte()
 		if err != nil {
 			return StartElement{}, err
 		}
 		if a.Name.Local != "" {
 			attr = append(attr, a)
 		}
-		switch {
-		case a.Name.Space == "" && a.Name.Local == "xmlns":
-			name.Space = a.Value
-			def = true
-			t.spaces[len(t.spaces)-1] = a.Value
-		case a.Name.Space == "xmlns":
-			t.prefixes[len(t.prefixes)-1][a.Name.Local] = a.Value
-			if !def && name.Space != "" && name.Space == a.Name.Local {
-				name.Space = a.Value
+		t.declare(a)
+	}
+}
+
+// endStart finishes decoding a start element once all of its attributes have
+// been decoded.
+func (t *Tokenizer) endStart(name Name, attr []Attr, selfClose bool) (StartElement, error) {
+	start, err := t.resolveStart(name, t.checkStart(name, attr))
+	if err != nil {
+		return StartElement{}, err
+	}
+	if selfClose {
+		t.selfClose = &start.Name
+	}
+	return start, nil
+}
+
+// declare applies the effects of an attribute on namespaces and whitespace
+// handling to the innermost open element.
+func (t *Tokenizer) declare(a Attr) {
+	switch {
+	case a.Name.Space == "" && a.Name.Local == "xmlns":
+		if t.Trace != nil {
+			t.tracef("bind default namespace to %q at depth %d", a.Value, t.depth())
+		}
+		t.spaces[len(t.spaces)-1] = a.Value
+	case a.Name.Space == "xmlns":
+		if t.Trace != nil {
+			t.tracef("bind prefix %q to %q at depth %d", a.Name.Local, a.Value, t.depth())
+		}
+		t.ns = append(t.ns, nsBinding{depth: t.depth(), prefix: a.Name.Local, space: a.Value})
+	case a.Name.Local == "space" && a.Name.Space == "xml":
+		switch a.Value {
+		case "preserve":
+			t.preserve[len(t.preserve)-1] = true
+		case "default":
+			t.preserve[len(t.preserve)-1] = false
+		}
+	}
+}
+
+// checkStart applies attribute defaults to a start element and validates it
+// against the DTD if ValidateDTD is set, where name and attr have not yet been
+// resolved.
+func (t *Tokenizer) checkStart(name Name, attr []Attr) []Attr {
+	t.collapseTokenized(name, attr)
+	attr = t.applyDefaults(name, attr)
+	if t.ValidateDTD {
+		t.validateStart(name, attr)
+	}
+	return attr
+}
+
+// collapseTokenized removes leading and trailing spaces from the values of
+// attributes that are declared with a type other than CDATA and collapses runs
+// of spaces, as required by the XML spec.
+func (t *Tokenizer) collapseTokenized(name Name, attr []Attr) {
+	if t.doctype == nil {
+		return
+	}
+	decls := t.doctype.attlists[rawName(name)]
+	if len(decls) == 0 {
+		return
+	}
+	for i, a := range attr {
+		for _, decl := range decls {
+			if decl.Name == a.Name && decl.typ != "CDATA" {
+				attr[i].Value = collapseSpace(a.Value)
+				break
 			}
 		}
 	}
-	return StartElement{Name: name, Attr: attr}, nil
 }
 
-func decodeEndElement(t *Tokenizer) (EndElement, error) {
-	defer func() {
-		if len(t.prefixes) > 0 {
-			t.prefixes = t.prefixes[:len(t.prefixes)-1]
+// applyDefaults appends any attributes with declared defaults that are missing
+// from attr, where name and attr have not yet been resolved.
+func (t *Tokenizer) applyDefaults(name Name, attr []Attr) []Attr {
+	if t.SkipAttrDefaults || t.doctype == nil {
+		return attr
+	}
+outer:
+	for _, def := range t.doctype.attlists[rawName(name)] {
+		if !def.hasDefault() {
+			continue
 		}
-		if len(t.spaces) > 0 {
-			t.spaces = t.spaces[:len(t.spaces)-1]
+		for _, a := range attr {
+			if a.Name == def.Name {
+				continue outer
+			}
 		}
-	}()
-	// TODO: check for space as sep?
-	name, _, _, err := decodeName(t, 0, false)
-	if err != nil {
-		return EndElement{}, err
+		attr = append(attr, def.Attr)
+		t.declare(def.Attr)
 	}
-	return EndElement{Name: name}, nil
+	return attr
 }
 
-func decodeName(t *Tokenizer, b byte, attr bool) (Name, byte, bool, error) {
-	// Set to the previous default namespace. If we find a new namespace this will
-	// be overwritten later.
-	var space string
-	// Attributes don't get the default namespace.
-	if !attr {
-		for i := len(t.spaces) - 1; i >= 0; i-- {
-			space = t.spaces[i]
-			if space != "" {
-				break
+// resolveStart resolves the prefixes of a start element and its attributes
+// once all of the namespace declarations on the element are known.
+func (t *Tokenizer) resolveStart(name Name, attr []Attr) (StartElement, error) {
+	if t.StrictNamespaces {
+		if err := t.checkBound(name, false); err != nil {
+			return StartElement{}, err
+		}
+		for _, a := range attr {
+			if err := t.checkBound(a.Name, true); err != nil {
+				return StartElement{}, err
 			}
 		}
 	}
+	for i := range attr {
+		attr[i].Name = t.resolve(attr[i].Name, true)
+	}
+	return StartElement{Name: t.resolve(name, false), Attr: attr}, nil
+}
 
-	// TODO: reuse builder
-	var foundSep bool
-	var rawFirst, rawSecond strings.Builder
+// checkBound returns an error if the prefix of a name that has not yet been
+// resolved is not bound to a namespace in the innermost open element.
+// The xml prefix is always bound, as is the xmlns prefix in attribute names.
+func (t *Tokenizer) checkBound(name Name, attr bool) error {
+	if t.noResolve || name.Space == "" || name.Space == "xml" || (attr && name.Space == "xmlns") {
+		return nil
+	}
+	if _, ok := t.lookup(name.Space); ok {
+		return nil
+	}
+	return &SyntaxError{Msg: "unbound prefix " + name.Space + " in name " + rawName(name)}
+}
+
+// resolve replaces the prefix of a name with the namespace that it is bound to
+// in the innermost open element.
+// Unprefixed element names are placed in the default namespace, attributes are
+// not.
+// Prefixes that are not bound to a namespace are left as is.
+func (t *Tokenizer) resolve(name Name, attr bool) Name {
+	if t.noResolve {
+		return name
+	}
+	if name.Space == "" {
+		if !attr {
+			name.Space = t.defaultSpace()
+		}
+		return name
+	}
+	if space, ok := t.lookup(name.Space); ok {
+		name.Space = space
+	}
+	return name
+}
+
+// nsBinding is a prefix declared on the open element at depth.
+// Bindings are kept in a single stack for all open elements so that elements
+// that do not declare any prefixes cost nothing.
+type nsBinding struct {
+	depth  int
+	prefix string
+	space  string
+}
+
+// lookup returns the namespace that prefix is bound to in the innermost open
+// element.
+func (t *Tokenizer) lookup(prefix string) (string, bool) {
+	for i := len(t.ns) - 1; i >= 0; i-- {
+		if t.ns[i].prefix == prefix {
+			return t.ns[i].space, true
+		}
+	}
+	return "", false
+}
+
+// depth returns the number of open elements.
+func (t *Tokenizer) depth() int {
+	return len(t.spaces)
+}
+
+// defaultSpace returns the default namespace of the innermost open element.
+func (t *Tokenizer) defaultSpace() string {
+	if len(t.spaces) == 0 {
+		return t.outerSpace
+	}
+	return t.spaces[len(t.spaces)-1]
+}
+
+// pop removes the scope of the innermost open element.
+func (t *Tokenizer) pop() {
+	if len(t.spaces) > 0 {
+		if t.Trace != nil {
+			t.tracef("pop element at depth %d", t.depth())
+		}
+		t.spaces = t.spaces[:len(t.spaces)-1]
+	}
+	for len(t.ns) > 0 && t.ns[len(t.ns)-1].depth > t.depth() {
+		if t.Trace != nil {
+			t.tracef("unbind prefix %q", t.ns[len(t.ns)-1].prefix)
+		}
+		t.ns = t.ns[:len(t.ns)-1]
+	}
+	if len(t.preserve) > 0 {
+		t.preserve = t.preserve[:len(t.preserve)-1]
+	}
+}
+
+// preserveSpace reports whether xml:space="preserve" is in effect for the
+// innermost open element.
+func (t *Tokenizer) preserveSpace() bool {
+	return len(t.preserve) > 0 && t.preserve[len(t.preserve)-1]
+}
+
+func decodeEndElement(t *Tokenizer) (EndElement, error) {
+	defer t.pop()
+	name, sep, err := decodeName(t, 0)
+	if err != nil {
+		return EndElement{}, err
+	}
+	if t.StrictNamespaces {
+		if err := t.checkBound(name, false); err != nil {
+			return EndElement{}, err
+		}
+	}
+	name = t.resolve(name, false)
+	for isSpace(sep) {
+		sep, err = t.readByte()
+		if err != nil {
+			return EndElement{}, err
+		}
+	}
+	if sep != '>' {
+		return EndElement{}, fmt.Errorf("xml: expected > to end the element, got %q", string(sep))
+	}
+	return EndElement{Name: name}, nil
+}
+
+// decodeName decodes a name, leaving any prefix unresolved in the Space field.
+func decodeName(t *Tokenizer, b byte) (Name, byte, error) {
+	raw := t.nameBuf[:0]
+	// The first byte is never treated as the prefix separator.
+	var off int
 	if b != 0 {
-		/* #nosec */
-		rawFirst.WriteByte(b)
+		raw = append(raw, b)
+		off = 1
 	}
 
 	for {
-		b, err := t.r.ReadByte()
+		raw = t.scanRun(raw, 0, nameRunLen)
+		b, err := t.readByte()
 		if err != nil {
-			return Name{}, 0, false, err
+			t.keepName(raw)
+			return Name{}, 0, err
 		}
 		if !isNameByte(b) {
-			if foundSep {
-				space = rawFirst.String()
-				// Go backwards up the stack looking for a prefix definition. If we find
-				// one, replace the namespace with it
-				for i := len(t.prefixes) - 1; i >= 0; i-- {
-					if resolvedSpace := t.prefixes[i][space]; resolvedSpace != "" {
-						space = resolvedSpace
-						break
-					}
-				}
-				return Name{Space: space, Local: rawSecond.String()}, b, false, nil
-			} else {
-				return Name{Space: space, Local: rawFirst.String()}, b, space != "", nil
-			}
+			t.keepName(raw)
+			return t.splitName(raw, off), b, nil
 		}
-		if b == ':' {
-			foundSep = true
-			continue
+		raw = append(raw, b)
+	}
+}
+
+// nameRunLen returns the number of name bytes at the start of p.
+func nameRunLen(p []byte) int {
+	for i, c := range p {
+		if !isNameByte(c) {
+			return i
 		}
-		if foundSep {
-			/* #nosec */
-			rawSecond.WriteByte(b)
-		} else {
-			/* #nosec */
-			rawFirst.WriteByte(b)
+	}
+	return -1
+}
+
+// splitName splits a raw name into a prefix and local name at the first colon
+// after off.
+// Any later colons are dropped.
+// Both parts share the memory of a single interned string.
+func (t *Tokenizer) splitName(raw []byte, off int) Name {
+	i := bytes.IndexByte(raw[off:], ':')
+	if i < 0 {
+		return Name{Local: t.intern(raw)}
+	}
+	i += off
+	if bytes.IndexByte(raw[i+1:], ':') >= 0 {
+		return Name{Space: t.intern(raw[:i]), Local: t.intern(bytes.ReplaceAll(raw[i+1:], []byte{':'}, nil))}
+	}
+	s := t.intern(raw)
+	return Name{Space: s[:i], Local: s[i+1:]}
+}
+
+// maxInterned is the number of distinct strings that a tokenizer will intern
+// before it starts allocating new strings for anything it has not yet seen.
+const maxInterned = 1024
+
+// intern returns a string with the contents of b, reusing the memory of an
+// earlier string with the same contents if there is one.
+// Names and namespaces are repeated many times in most documents, so this
+// avoids allocating them again for every token.
+func (t *Tokenizer) intern(b []byte) string {
+	// The compiler does not allocate for string conversions used as map keys.
+	if s, ok := t.interned[string(b)]; ok {
+		return s
+	}
+	s := string(b)
+	if len(t.interned) < maxInterned {
+		if t.interned == nil {
+			t.interned = make(map[string]string)
 		}
+		t.interned[s] = s
 	}
+	return s
 }
 
 func decodeAttr(t *Tokenizer, b byte) (Attr, error) {
-	name, sep, _, err := decodeName(t, b, true)
+	name, sep, err := decodeName(t, b)
 	if err != nil {
 		return Attr{}, err
 	}
+	if t.Trace != nil {
+		t.tracef("decode attribute %s", rawName(name))
+	}
+	// Whitespace is allowed on either side of the "=".
+	for isSpace(sep) {
+		sep, err = t.readByte()
+		if err != nil {
+			return Attr{}, err
+		}
+	}
 	if sep != '=' {
 		return Attr{}, fmt.Errorf("xml: bad attribute separator %q", string(sep))
 	}
-	b, err = t.r.ReadByte()
+	b, err = t.readByte()
+	for err == nil && isSpace(b) {
+		b, err = t.readByte()
+	}
 	if err != nil {
 		return Attr{}, err
 	}
@@ -313,42 +1218,121 @@ func decodeAttr(t *Tokenizer, b byte) (Attr, error) {
 		return Attr{}, fmt.Errorf("xml: expected quoted attribute value")
 	}
 	quote := b
+	stop := `"&`
+	if quote == '\'' {
+		stop = `'&`
+	}
+	stream := t.LongAttr != nil && t.LongAttrSize > 0 &&
+		name.Space != "xmlns" && (name.Space != "" || name.Local != "xmlns")
 	// Get the value
-	// TODO: reuse builder
-	var raw strings.Builder
+	var value []byte
 	for {
-		b, err = t.r.ReadByte()
+		if stream && len(value) > t.LongAttrSize {
+			return streamAttr(t, name, quote, stop, value)
+		}
+		max := 0
+		if stream {
+			max = t.LongAttrSize + 1 - len(value)
+		}
+		run := len(value)
+		value = t.readRun(value, stop, max)
+		normalizeAttrSpace(value[run:])
+		b, err = t.readByte()
 		if err != nil {
 			return Attr{}, err
 		}
 		// TODO: what characters are valid in a name?
 		if b == quote {
+			// Namespaces are interned because they are copied into every name
+			// that uses them.
+			if name.Space == "xmlns" || (name.Space == "" && name.Local == "xmlns") {
+				return Attr{Name: name, Value: t.intern(value)}, nil
+			}
 			return Attr{
 				Name:  name,
-				Value: raw.String(),
+				Value: string(value),
 			}, nil
 		}
-		raw.WriteByte(b)
+		if b == '&' {
+			value, err = decodeEntity(t, value, false)
+			if err != nil {
+				return Attr{}, err
+			}
+			continue
+		}
+		if isSpace(b) {
+			b = ' '
+		}
+		value = append(value, b)
+	}
+}
+
+// normalizeAttrSpace replaces literal whitespace in an attribute value with
+// spaces as required by the XML spec.
+// Whitespace that results from character references is not part of the input
+// that is passed to it, and so is left as is.
+func normalizeAttrSpace(b []byte) {
+	for i, c := range b {
+		if isSpace(c) {
+			b[i] = ' '
+		}
 	}
 }
 
-func decodeDirective(t *Tokenizer, dir []byte) (Directive, error) {
+// decodeDirective reads the remainder of a directive, keeping track of nested
+// angle brackets and quoted strings.
+// As in encoding/xml, comments inside the directive are replaced by a single
+// space.
+// If discard is true the directive is consumed without being buffered.
+func decodeDirective(t *Tokenizer, dir []byte, discard bool) (Directive, error) {
+	var (
+		inquote byte
+		depth   int
+	)
 	for {
-		b, err := t.r.ReadByte()
+		b, err := t.readByte()
 		if err != nil {
 			return nil, err
 		}
-		if b == '>' {
+		switch {
+		case inquote != 0:
+			if b == inquote {
+				inquote = 0
+			}
+		case b == '\'' || b == '"':
+			inquote = b
+		case b == '>' && depth == 0:
 			return Directive(dir), nil
+		case b == '>':
+			depth--
+		case b == '<':
+			ok, err := t.consumePrefix(begComment[1:])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				err = skipComment(t)
+				if err != nil {
+					return nil, err
+				}
+				b = ' '
+				break
+			}
+			depth++
+		}
+		if !discard {
+			dir = append(dir, b)
 		}
-		dir = append(dir, b)
 	}
 }
 
 func decodeComment(t *Tokenizer, comment []byte) (Comment, error) {
 	var found uint8
 	for {
-		b, err := t.r.ReadByte()
+		if found == 0 {
+			comment = t.readRun(comment, "-", 0)
+		}
+		b, err := t.readByte()
 		if err != nil {
 			return nil, err
 		}
@@ -368,6 +1352,25 @@ func decodeComment(t *Tokenizer, comment []byte) (Comment, error) {
 	}
 }
 
+// skipComment consumes the remainder of a comment without buffering it.
+func skipComment(t *Tokenizer) error {
+	var found int
+	for {
+		b, err := t.readByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case b == '-':
+			found++
+		case b == '>' && found > 1:
+			return nil
+		default:
+			found = 0
+		}
+	}
+}
+
 func decodeProcInst(t *Tokenizer, inst []byte) (ProcInst, error) {
 	var (
 		foundSpace bool
@@ -375,7 +1378,7 @@ func decodeProcInst(t *Tokenizer, inst []byte) (ProcInst, error) {
 		target     strings.Builder
 	)
 	for {
-		b, err := t.r.ReadByte()
+		b, err := t.readByte()
 		if err != nil {
 			return ProcInst{}, err
 		}
@@ -412,22 +1415,444 @@ func decodeProcInst(t *Tokenizer, inst []byte) (ProcInst, error) {
 	}
 }
 
+func decodeCDATA(t *Tokenizer, buf []byte) (CharData, error) {
+	t.inCDATA = true
+	t.cdata = true
+	var found int
+	for {
+		if found == 0 {
+			buf = t.readRun(buf, "]", t.chunkRoom(buf))
+		}
+		if found == 0 && t.chunkFull(buf) && endsInFullRune(buf) {
+			return CharData(buf), nil
+		}
+		b, err := t.readByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errEarlyEOF
+			}
+			return nil, err
+		}
+		switch {
+		case b == ']':
+			found++
+			continue
+		case b == '>' && found > 1:
+			for ; found > 2; found-- {
+				buf = append(buf, ']')
+			}
+			t.inCDATA = false
+			return CharData(buf), nil
+		default:
+			for ; found > 0; found-- {
+				buf = append(buf, ']')
+			}
+		}
+		buf = append(buf, b)
+	}
+}
+
 func decodeCharData(t *Tokenizer, buf []byte) (CharData, error) {
 	for {
-		b, err := t.r.ReadByte()
+		buf = t.readRun(buf, "<&", t.chunkRoom(buf))
+		if t.chunkFull(buf) && endsInFullRune(buf) {
+			t.textCont = true
+			return CharData(buf), nil
+		}
+		b, err := t.readByte()
 		if err != nil {
+			if errors.Is(err, io.EOF) && len(buf) > 0 {
+				// Return the text now and report EOF on the next call.
+				t.textCont = false
+				return CharData(buf), nil
+			}
 			return nil, err
 		}
 		if b == '<' {
 			t.foundStart = true
+			t.textCont = false
 			break
 		}
-		buf = append(buf, b)
+		buf, err = appendCharData(t, buf, b)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
 	}
-	// TODO: unescape bytes, or leave them and will the decoder do it?
 	return CharData(buf), nil
 }
 
+// appendCharData appends the character data byte b to buf, decoding the
+// entity or character reference that follows if b begins one.
+func appendCharData(t *Tokenizer, buf []byte, b byte) ([]byte, error) {
+	if b == '&' {
+		return decodeEntity(t, buf, true)
+	}
+	return append(buf, b), nil
+}
+
+// decodeEntity reads an entity or character reference following an "&" that
+// has already been consumed and appends the text it represents to buf.
+// If content is true, references to internal and external entities are
+// expanded by pushing their replacement text onto the front of the input.
+// Otherwise only internal entities may be referenced and their replacement
+// text is appended to buf.
+// Any other reference results in a SyntaxError.
+func decodeEntity(t *Tokenizer, buf []byte, content bool) ([]byte, error) {
+	start := len(buf)
+	buf = append(buf, '&')
+	for {
+		b, err := t.readByte()
+		if errors.Is(err, io.EOF) {
+			return nil, t.syntaxError("invalid character entity " + string(buf[start:]) + " (no semicolon)")
+		}
+		if err != nil {
+			return buf, err
+		}
+		if b == ';' {
+			name := string(buf[start+1:])
+			if r, ok := resolveEntity(name); ok {
+				return utf8.AppendRune(buf[:start], r), nil
+			}
+			if text, ok := t.internalEntity(name); ok {
+				if !content {
+					return t.appendAttrEntity(buf[:start], text)
+				}
+				if err := t.expand(); err != nil {
+					return buf, err
+				}
+				t.unread([]byte(text))
+				return buf[:start], nil
+			}
+			if id, ok := t.externalEntity(name); ok && content {
+				text, err := t.readEntity(id)
+				if err != nil {
+					return buf, err
+				}
+				t.unread(text)
+				return buf[:start], nil
+			}
+			return nil, t.entityError(name)
+		}
+		if b != '#' && b < utf8.RuneSelf && !isNameByte(b) {
+			return nil, t.syntaxError("invalid character entity " + string(buf[start:]) + " (no semicolon)")
+		}
+		buf = append(buf, b)
+	}
+}
+
+// onlySpace reports whether b consists entirely of XML whitespace.
+func onlySpace(b []byte) bool {
+	for _, c := range b {
+		if !isSpace(c) {
+			return false
+		}
+	}
+	return true
+}
+
 func isSpace(b byte) bool {
 	return b == 0x20 || b == 0x9 || b == 0xD || b == 0xA
 }
+
+// coalesce appends any character data or CDATA sections that immediately
+// follow cd in the input to cd.
+func coalesce(t *Tokenizer, cd CharData) (CharData, error) {
+	for !t.chunkFull(cd) {
+		if t.foundStart {
+			ok, err := t.consumePrefix(cdataStart[1:])
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			if !ok {
+				return cd, nil
+			}
+			t.foundStart = false
+			cd, err = decodeCDATA(t, cd)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		b, err := t.readByte()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return cd, nil
+			}
+			return nil, err
+		}
+		if b == '<' {
+			t.foundStart = true
+			continue
+		}
+		cd, err = appendCharData(t, cd, b)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		cd, err = decodeCharData(t, cd)
+		if err != nil {
+			return nil, err
+		}
+	}
+	t.textCont = true
+	return cd, nil
+}
+
+// state is a snapshot of the tokenizer taken at the start of a token so that
+// decoding can be retried after a recoverable error.
+type state struct {
+	pending    []byte
+	inCDATA    bool
+	textCont   bool
+	foundStart bool
+	afterCR    bool
+	started    bool
+	selfClose  *Name
+	ns         []nsBinding
+	spaces     []string
+	preserve   []bool
+	line       int
+	col        int
+}
+
+func (t *Tokenizer) save() state {
+	t.pulled = t.pulled[:0]
+	return state{
+		pending:    t.pending,
+		inCDATA:    t.inCDATA,
+		textCont:   t.textCont,
+		foundStart: t.foundStart,
+		afterCR:    t.afterCR,
+		started:    t.started,
+		selfClose:  t.selfClose,
+		ns:         t.ns,
+		spaces:     t.spaces,
+		preserve:   t.preserve,
+		line:       t.line,
+		col:        t.col,
+	}
+}
+
+// restore resets the tokenizer to a previously saved state and arranges for
+// any bytes read from the underlying reader since then to be read again.
+// Decoding only ever appends to or truncates the element stacks, so the saved
+// slices remain valid.
+func (t *Tokenizer) restore(s state) {
+	t.pending = append(append([]byte(nil), s.pending...), t.pulled...)
+	t.pulled = t.pulled[:0]
+	t.inCDATA = s.inCDATA
+	t.textCont = s.textCont
+	t.foundStart = s.foundStart
+	t.afterCR = s.afterCR
+	t.started = s.started
+	t.selfClose = s.selfClose
+	t.ns = s.ns
+	t.spaces = s.spaces
+	t.preserve = s.preserve
+	t.line = s.line
+	t.col = s.col
+}
+
+// retryable reports whether err leaves the input in a state where decoding can
+// be retried later.
+func retryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrNeedMoreData) || errors.Is(err, errWouldBlock) ||
+		errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// readByte returns the next byte of input, starting with any bytes that were
+// pushed back by unread.
+// Line endings are normalized as required by the XML spec: a carriage return
+// is returned as a line feed and a line feed that follows it is skipped.
+func (t *Tokenizer) readByte() (byte, error) {
+	var b byte
+	if len(t.pending) > 0 {
+		b = t.pending[0]
+		t.pending = t.pending[1:]
+	} else {
+		var err error
+		if t.mem != nil {
+			// Avoid the cost of calling through the interface for input that is
+			// already in memory.
+			b, err = t.mem.ReadByte()
+		} else {
+			b, err = t.r.ReadByte()
+		}
+		if err != nil {
+			return b, err
+		}
+		t.n++
+		t.pulled = append(t.pulled, b)
+		if t.recording() {
+			t.raw = append(t.raw, b)
+		}
+	}
+	if t.afterCR {
+		t.afterCR = false
+		if b == '\n' {
+			return t.readByte()
+		}
+	}
+	if b == '\r' {
+		t.afterCR = true
+		b = '\n'
+	}
+	if b == '\n' {
+		t.line++
+		t.col = 0
+	} else {
+		t.col++
+	}
+	return b, nil
+}
+
+// bufferedByteReader is implemented by readers such as *bufio.Reader that
+// expose their buffer.
+type bufferedByteReader interface {
+	io.ByteReader
+	Buffered() int
+	Peek(n int) ([]byte, error)
+	Discard(n int) (int, error)
+}
+
+// readRun appends the input up to the first byte in stop to buf and consumes
+// it, stopping after max bytes if max is greater than zero.
+// It only scans input that has already been buffered, either by unread or by
+// the underlying reader if it is a bufferedByteReader, so it may consume less
+// than the full run (or nothing at all) and callers must continue reading
+// byte by byte with readByte.
+// If max is negative nothing is read.
+// Carriage returns always end the run so that line endings are normalized by
+// readByte.
+func (t *Tokenizer) readRun(buf []byte, stop string, max int) []byte {
+	return t.scanRun(buf, max, func(p []byte) int {
+		return bytes.IndexAny(p, stop)
+	})
+}
+
+// scanRun is like readRun except that the end of the run is the index
+// returned by index, or the end of the buffered input if it returns -1.
+func (t *Tokenizer) scanRun(buf []byte, max int, index func([]byte) int) []byte {
+	if max < 0 || t.afterCR {
+		return buf
+	}
+	fromPending := len(t.pending) > 0
+	var p []byte
+	var br bufferedByteReader
+	if fromPending {
+		p = t.pending
+	} else {
+		var ok bool
+		br, ok = t.r.(bufferedByteReader)
+		if !ok {
+			return buf
+		}
+		p, _ = br.Peek(br.Buffered())
+	}
+	n := index(p)
+	if n < 0 {
+		n = len(p)
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	if cr := bytes.IndexByte(p[:n], '\r'); cr >= 0 {
+		n = cr
+	}
+	if n == 0 {
+		return buf
+	}
+	run := p[:n]
+	buf = append(buf, run...)
+	t.advance(run)
+	if fromPending {
+		t.pending = t.pending[n:]
+		return buf
+	}
+	t.discard(br, run)
+	return buf
+}
+
+// advance updates the position after the bytes in run have been consumed.
+func (t *Tokenizer) advance(run []byte) {
+	if lines := bytes.Count(run, []byte{'\n'}); lines > 0 {
+		t.line += lines
+		t.col = len(run) - bytes.LastIndexByte(run, '\n') - 1
+	} else {
+		t.col += len(run)
+	}
+}
+
+// discard consumes run, which must have been peeked from the start of the
+// buffered input of br.
+func (t *Tokenizer) discard(br bufferedByteReader, run []byte) {
+	t.n += int64(len(run))
+	t.pulled = append(t.pulled, run...)
+	if t.recording() {
+		t.raw = append(t.raw, run...)
+	}
+	/* #nosec */
+	br.Discard(len(run))
+}
+
+// chunkRoom returns the number of bytes that may be appended to buf before it
+// reaches the CharDataChunkSize limit, or 0 if there is no limit.
+func (t *Tokenizer) chunkRoom(buf []byte) int {
+	if t.CharDataChunkSize <= 0 {
+		return 0
+	}
+	if n := t.CharDataChunkSize - len(buf); n > 0 {
+		return n
+	}
+	// The chunk is only allowed to exceed the limit to complete a rune, which
+	// must be done byte by byte.
+	return -1
+}
+
+// unread pushes p back onto the front of the input.
+func (t *Tokenizer) unread(p []byte) {
+	t.pending = append(append([]byte(nil), p...), t.pending...)
+}
+
+// consumePrefix consumes p if it is next in the input and reports whether it
+// was found.
+// If p is not found, or an error is encountered, any bytes that were read are
+// pushed back.
+func (t *Tokenizer) consumePrefix(p []byte) (bool, error) {
+	line, col := t.line, t.col
+	for i := range p {
+		b, err := t.readByte()
+		if err != nil {
+			t.unread(p[:i])
+			t.line, t.col = line, col
+			return false, err
+		}
+		if b != p[i] {
+			t.unread(append(p[:i:i], b))
+			t.line, t.col = line, col
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// chunkFull reports whether buf has reached the CharDataChunkSize limit.
+func (t *Tokenizer) chunkFull(buf []byte) bool {
+	return t.CharDataChunkSize > 0 && len(buf) >= t.CharDataChunkSize
+}
+
+// endsInFullRune reports whether b ends in a complete UTF-8 sequence (or in
+// bytes that can never become a valid sequence).
+func endsInFullRune(b []byte) bool {
+	i := len(b) - 1
+	for i > 0 && i > len(b)-utf8.UTFMax && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	return utf8.FullRune(b[i:])
+}
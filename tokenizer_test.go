@@ -5,11 +5,14 @@
 package xml_test
 
 import (
+	"bufio"
 	"encoding/xml"
+	"io"
 	"reflect"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 
 	. "mellium.im/xml"
 )
@@ -50,6 +53,12 @@ var tokenizerTestCases = []struct {
     <![CDATA[Some text here.]]>
   </tag:name>
 </body><!-- missing final newline -->`},
+	10: {in: `<stream:stream xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams"><stream:features></stream:features></stream:stream>`},
+	11: {in: `<a xmlns:b="urn:b"><b:c b:d="e"><b:f xmlns:b="urn:f" b:g="h"></b:f></b:c></a>`},
+	12: {in: `<a xmlns="urn:a"><b xmlns=""><c></c></b></a>`},
+	13: {in: `<a b="&lt;&#34;&#x41;&quot;">&amp;c &#100;&gt;&apos;</a>`},
+	14: {in: `&lt;a&gt;`},
+	15: {in: `<a xmlns:p="urn:1"><p:b xmlns:p="urn:2" xmlns:q="urn:q"><p:c q:d=""/></p:b><p:e/><f xmlns:q="urn:r"/><q:g/></a>`},
 }
 
 func TestTokenize(t *testing.T) {
@@ -74,3 +83,1437 @@ func TestTokenize(t *testing.T) {
 		})
 	}
 }
+
+var charDataChunkTestCases = []struct {
+	in   string
+	size int
+	out  []Token
+}{
+	0: {
+		in:  `<a>abcdef</a>`,
+		out: []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("abcdef"), EndElement{Name: Name{Local: "a"}}},
+	},
+	1: {
+		in:   `<a>abcdef</a>`,
+		size: 4,
+		out:  []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("abcd"), CharData("ef"), EndElement{Name: Name{Local: "a"}}},
+	},
+	2: {
+		in:   `<a>abcd</a>`,
+		size: 2,
+		out:  []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("ab"), CharData("cd"), EndElement{Name: Name{Local: "a"}}},
+	},
+	3: {
+		in:   `<a>a白鵬翔</a>`,
+		size: 2,
+		out:  []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("a白"), CharData("鵬"), CharData("翔"), EndElement{Name: Name{Local: "a"}}},
+	},
+}
+
+func TestCharDataChunks(t *testing.T) {
+	for i, tc := range charDataChunkTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.CharDataChunkSize = tc.size
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var coalesceTestCases = []struct {
+	in       string
+	coalesce bool
+	size     int
+	out      []Token
+}{
+	0: {
+		in:  `<a>foo<![CDATA[<bar>]]>baz</a>`,
+		out: []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("foo"), CharData("<bar>"), CharData("baz"), EndElement{Name: Name{Local: "a"}}},
+	},
+	1: {
+		in:       `<a>foo<![CDATA[<bar>]]>baz</a>`,
+		coalesce: true,
+		out:      []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("foo<bar>baz"), EndElement{Name: Name{Local: "a"}}},
+	},
+	2: {
+		in:       `<a><![CDATA[foo]]><![CDATA[]]]]><![CDATA[>]]><b/></a>`,
+		coalesce: true,
+		out:      []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("foo]]>"), StartElement{Name: Name{Local: "b"}, Attr: []Attr{}}},
+	},
+	3: {
+		in:       `<a>foo<!-- bar -->baz</a>`,
+		coalesce: true,
+		out:      []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("foo"), Comment(" bar "), CharData("baz"), EndElement{Name: Name{Local: "a"}}},
+	},
+	4: {
+		in:       `<a>foo<![CDATA[barbaz]]>quux</a>`,
+		coalesce: true,
+		size:     4,
+		out:      []Token{StartElement{Name: Name{Local: "a"}, Attr: []Attr{}}, CharData("foob"), CharData("arba"), CharData("zquu"), CharData("x"), EndElement{Name: Name{Local: "a"}}},
+	},
+	5: {
+		in:  `<![CDATAx]>`,
+		out: []Token{Directive("[CDATAx]")},
+	},
+}
+
+func TestCoalesceCharData(t *testing.T) {
+	for i, tc := range coalesceTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.CoalesceCharData = tc.coalesce
+			td.CharDataChunkSize = tc.size
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var skipWhitespaceTestCases = []struct {
+	in       string
+	coalesce bool
+	size     int
+	out      []Token
+}{
+	0: {
+		in: "<a>\n\t<b> </b>\r\n</a>",
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	1: {
+		in: "<a> x </a>",
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData(" x "),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	2: {
+		in: "<a><![CDATA[ ]]></a>",
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData(" "),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	3: {
+		in:       "<a> <![CDATA[x]]> </a>",
+		coalesce: true,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData(" x "),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	4: {
+		in:   "<a>x   </a>",
+		size: 2,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData("x "),
+			CharData("  "),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+}
+
+func TestSkipWhitespace(t *testing.T) {
+	for i, tc := range skipWhitespaceTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SkipWhitespace = true
+			td.CoalesceCharData = tc.coalesce
+			td.CharDataChunkSize = tc.size
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var trimSpaceTestCases = []struct {
+	in   string
+	size int
+	out  []Token
+}{
+	0: {
+		in: "<a>\n  foo bar\n</a>",
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData("foo bar"),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	1: {
+		in: "<a>\n  <b/>\n</a>",
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	2: {
+		in: `<a xml:space="preserve"> x <b xml:space="default"> y </b><c/> z </a> w `,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Space: "xml", Local: "space"}, Value: "preserve"}}},
+			CharData(" x "),
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{{Name: Name{Space: "xml", Local: "space"}, Value: "default"}}},
+			CharData("y"),
+			EndElement{Name: Name{Local: "b"}},
+			StartElement{Name: Name{Local: "c"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "c"}},
+			CharData(" z "),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	3: {
+		in:   "<a>  foo  </a>",
+		size: 4,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData("fo"),
+			CharData("o"),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+}
+
+func TestTrimSpace(t *testing.T) {
+	for i, tc := range trimSpaceTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.TrimSpace = true
+			td.CharDataChunkSize = tc.size
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var skipCommentsTestCases = []struct {
+	in  string
+	out []Token
+}{
+	0: {
+		in: `<!-- foo --><a><!----><!-- - -- ---></a>`,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+	1: {
+		in: `<a>foo<!-- bar -->baz</a>`,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			CharData("foo"),
+			CharData("baz"),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+}
+
+func TestSkipComments(t *testing.T) {
+	for i, tc := range skipCommentsTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SkipComments = true
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var skipDirectivesTestCases = []struct {
+	in   string
+	skip bool
+	out  []Token
+}{
+	0: {
+		in: `<!DOCTYPE a [<!ENTITY b "c>"><!-- > -->]>` + "\n<a/>",
+		out: []Token{
+			Directive(`DOCTYPE a [<!ENTITY b "c>"> ]`),
+			CharData("\n"),
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		},
+	},
+	1: {
+		in:   `<!DOCTYPE a [<!ENTITY b "c>"><!-- > -->]>` + "\n<a/>",
+		skip: true,
+		out: []Token{
+			CharData("\n"),
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		},
+	},
+}
+
+func TestSkipDirectives(t *testing.T) {
+	for i, tc := range skipDirectivesTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SkipDirectives = tc.skip
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var attrDefaultsTestCases = []struct {
+	in   string
+	skip bool
+	out  []Token
+}{
+	0: {
+		in: `<!DOCTYPE a [
+<!ATTLIST a b CDATA "1" c CDATA #IMPLIED d CDATA #FIXED 'x &amp;&#x20;y' e CDATA #REQUIRED>
+<!ATTLIST a b CDATA "2" f (on|off) "  on " g NOTATION (n) "n">
+]><a b="3"/>`,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{
+				{Name: Name{Local: "b"}, Value: "3"},
+				{Name: Name{Local: "d"}, Value: "x & y"},
+				{Name: Name{Local: "f"}, Value: "on"},
+				{Name: Name{Local: "g"}, Value: "n"},
+			}},
+		},
+	},
+	1: {
+		in:   `<!DOCTYPE a [<!ATTLIST a b CDATA "1">]><a/>`,
+		skip: true,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		},
+	},
+	2: {
+		in: `<!DOCTYPE x:a [<!ATTLIST x:a xmlns:x CDATA #FIXED "urn:x" xmlns CDATA "urn:d" x:b CDATA "1">]><x:a><c/></x:a>`,
+		out: []Token{
+			StartElement{Name: Name{Space: "urn:x", Local: "a"}, Attr: []Attr{
+				{Name: Name{Space: "xmlns", Local: "x"}, Value: "urn:x"},
+				{Name: Name{Local: "xmlns"}, Value: "urn:d"},
+				{Name: Name{Space: "urn:x", Local: "b"}, Value: "1"},
+			}},
+			StartElement{Name: Name{Space: "urn:d", Local: "c"}, Attr: []Attr{}},
+		},
+	},
+	3: {
+		in: `<!DOCTYPE a [<!ENTITY e "<!ATTLIST a b CDATA '1'>"><?pi <!ATTLIST a c CDATA '2'>?>%p;<!ATTLIST a d CDATA "3">]><a/>`,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		},
+	},
+	4: {
+		in: `<!DOCTYPE a [<!ATTLIST b c CDATA "	1&#10;">]><a><b/></a>`,
+		out: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			StartElement{Name: Name{Local: "b"}, Attr: []Attr{{Name: Name{Local: "c"}, Value: " 1\n"}}},
+		},
+	},
+}
+
+func TestAttrDefaults(t *testing.T) {
+	for i, tc := range attrDefaultsTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SkipDirectives = true
+			td.SkipAttrDefaults = tc.skip
+			for _, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+				}
+			}
+		})
+	}
+}
+
+var strictNamespacesTestCases = []struct {
+	in  string
+	err string
+}{
+	0: {in: `<a xmlns:b="urn:b" xml:lang="en"><b:c b:d="" xmlns:e="urn:e"/></a>`},
+	1: {in: `<b:a/>`, err: "XML syntax error on line 0: unbound prefix b in name b:a"},
+	2: {in: `<a b:c=""/>`, err: "XML syntax error on line 0: unbound prefix b in name b:c"},
+	3: {in: `<a><b xmlns:c="urn:c"/><c:d/></a>`, err: "XML syntax error on line 0: unbound prefix c in name c:d"},
+	4: {in: `<a></b:a>`, err: "XML syntax error on line 0: unbound prefix b in name b:a"},
+	5: {in: `<xmlns:a/>`, err: "XML syntax error on line 0: unbound prefix xmlns in name xmlns:a"},
+}
+
+func TestStrictNamespaces(t *testing.T) {
+	for i, tc := range strictNamespacesTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.StrictNamespaces = true
+			var err error
+			for err == nil {
+				_, err = td.Token()
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || err.Error() != tc.err):
+				t.Fatalf("wrong error: want=%q, got=%v", tc.err, err)
+			}
+		})
+	}
+}
+
+var entityRefTestCases = []struct {
+	in   string
+	skip bool
+	text string
+	err  string
+}{
+	0:  {in: `<a b="&lt;&#x3E;">&amp;&#38;&#x26;</a>`, text: "&&&"},
+	1:  {in: `<a>&bogus;</a>`, err: "XML syntax error on line 1: invalid character entity &bogus;"},
+	2:  {in: `<a>&#xZZ;</a>`, err: "XML syntax error on line 1: invalid character entity &#xZZ;"},
+	3:  {in: `<a>&#0;</a>`, err: "XML syntax error on line 1: invalid character entity &#0;"},
+	4:  {in: `<a>&;</a>`, err: "XML syntax error on line 1: invalid character entity &;"},
+	5:  {in: "<a>\nb & c</a>", err: "XML syntax error on line 2: invalid character entity & (no semicolon)"},
+	6:  {in: `<a>&amp</a>`, err: "XML syntax error on line 1: invalid character entity &amp (no semicolon)"},
+	7:  {in: `<a>&amp`, err: "XML syntax error on line 1: invalid character entity &amp (no semicolon)"},
+	8:  {in: `<a b="&bogus;"/>`, err: "XML syntax error on line 1: invalid character entity &bogus;"},
+	9:  {in: `<a b="&#1;"/>`, err: "XML syntax error on line 1: invalid character entity &#1;"},
+	10: {in: `<!DOCTYPE a [<!ENTITY e "x">]><a>&e;</a>`, text: "x"},
+	11: {in: `<!DOCTYPE a [<!ENTITY e "x">]><a>&f;</a>`, err: "XML syntax error on line 1: invalid character entity &f;"},
+	12: {in: `<!DOCTYPE a SYSTEM "a.dtd"><a>&e;</a>`, err: "XML syntax error on line 1: invalid character entity &e;"},
+	13: {in: `<!DOCTYPE a [%p;]><a>&e;</a>`, err: "XML syntax error on line 1: invalid character entity &e;"},
+	14: {in: `<!DOCTYPE a><a>&e;</a>`, err: "XML syntax error on line 1: invalid character entity &e;"},
+	15: {in: `<!DOCTYPE a [<!ENTITY e "x">]><a>&e;</a>`, skip: true, text: "x"},
+	16: {in: `<!DOCTYPE a [<!ENTITY e "&#60;b>&amp;&f;</b>"><!ENTITY f "y">]><a>&e;</a>`, text: "&y"},
+	17: {in: `<!DOCTYPE a [<!ENTITY e "x"><!ENTITY e "y">]><a>&e;</a>`, text: "x"},
+	18: {in: `<!DOCTYPE a [<!ENTITY e "<b/>">]><a b="&e;"/>`, err: "XML syntax error on line 1: unescaped < inside quoted string"},
+	19: {in: `<!DOCTYPE a [<!ENTITY e "&e;">]><a>&e;</a>`, err: "xml: too many entity expansions"},
+	20: {in: `<!DOCTYPE a [<!ENTITY e "&e;">]><a b="&e;"/>`, err: "xml: too many entity expansions"},
+	21: {in: `<!DOCTYPE a [<!ENTITY e SYSTEM "e.ent">]><a>&e;</a>`, err: "XML syntax error on line 1: cannot expand entity &e;"},
+}
+
+func TestEntityRefs(t *testing.T) {
+	for i, tc := range entityRefTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SkipDirectives = tc.skip
+			td.SkipAttrDefaults = tc.skip
+			var text []byte
+			var err error
+			for err == nil {
+				var tok Token
+				tok, err = td.Token()
+				if cd, ok := tok.(CharData); ok {
+					text = append(text, cd...)
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || err.Error() != tc.err):
+				t.Fatalf("wrong error: want=%q, got=%v", tc.err, err)
+			}
+			if string(text) != tc.text {
+				t.Errorf("wrong text: want=%q, got=%q", tc.text, text)
+			}
+		})
+	}
+}
+
+var documentTestCases = []struct {
+	in       string
+	fragment bool
+	err      string
+}{
+	0:  {in: "<?xml version='1.0'?>\n<!DOCTYPE a>\n<!-- c --><a><b/>text</a>\n<?pi?>\n"},
+	1:  {in: ``, err: "XML syntax error on line 1: document has no root element"},
+	2:  {in: `<!-- c -->`, err: "XML syntax error on line 1: document has no root element"},
+	3:  {in: `<a/><b/>`, err: "XML syntax error on line 1: more than one root element"},
+	4:  {in: `text<a/>`, err: "XML syntax error on line 1: character data outside of the root element"},
+	5:  {in: `<a/>text`, err: "XML syntax error on line 1: character data outside of the root element"},
+	6:  {in: `<a/><![CDATA[ ]]>`, err: "XML syntax error on line 1: character data outside of the root element"},
+	7:  {in: `<a><b>`, err: "XML syntax error on line 0: early EOF"},
+	8:  {in: `<a/></a>`, err: "XML syntax error on line 1: end element outside of the root element"},
+	9:  {in: `<a/><!DOCTYPE a>`, err: "XML syntax error on line 1: directive after the start of the root element"},
+	10: {in: ``, fragment: true},
+	11: {in: `text<a/><b/><![CDATA[more]]>`, fragment: true},
+	12: {in: `<a/></a><!DOCTYPE a>`, fragment: true},
+	13: {in: "<a/>\n\n<b/>", err: "XML syntax error on line 3: more than one root element"},
+	14: {in: "<!-- c -->\n", err: "XML syntax error on line 2: document has no root element"},
+	15: {in: "<a/>\ntext", err: "XML syntax error on line 2: character data outside of the root element"},
+	16: {in: "<a>\n</a>\n</b>", err: "XML syntax error on line 3: end element outside of the root element"},
+}
+
+func TestDocument(t *testing.T) {
+	for i, tc := range documentTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.Document = !tc.fragment
+			var err error
+			for err == nil {
+				_, err = td.Token()
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			switch {
+			case tc.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != "" && (err == nil || err.Error() != tc.err):
+				t.Fatalf("wrong error: want=%q, got=%v", tc.err, err)
+			}
+		})
+	}
+}
+
+var multiDocumentTestCases = []struct {
+	in   string
+	docs [][]Token
+	err  string
+}{
+	0: {
+		in: "<?xml version='1.0'?><a/>\n<!-- c --><b>x</b><?xml version='1.0'?>\n<c/> ",
+		docs: [][]Token{
+			{
+				Declaration{Version: "1.0"},
+				StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+				EndElement{Name: Name{Local: "a"}},
+				CharData("\n"),
+				Comment(" c "),
+			},
+			{
+				StartElement{Name: Name{Local: "b"}, Attr: []Attr{}},
+				CharData("x"),
+				EndElement{Name: Name{Local: "b"}},
+			},
+			{
+				Declaration{Version: "1.0"},
+				CharData("\n"),
+				StartElement{Name: Name{Local: "c"}, Attr: []Attr{}},
+				EndElement{Name: Name{Local: "c"}},
+				CharData(" "),
+			},
+		},
+	},
+	1: {
+		in: "<a/><?xml-stylesheet?>",
+		docs: [][]Token{{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "a"}},
+			ProcInst{Target: "xml-stylesheet"},
+		}},
+	},
+	2: {
+		in: "<a/>\n<b>",
+		docs: [][]Token{
+			{
+				StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+				EndElement{Name: Name{Local: "a"}},
+				CharData("\n"),
+			},
+			{StartElement{Name: Name{Local: "b"}, Attr: []Attr{}}},
+		},
+		err: "XML syntax error on line 0: early EOF",
+	},
+}
+
+func TestMultiDocument(t *testing.T) {
+	for i, tc := range multiDocumentTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.Document = true
+			td.MultiDocument = true
+			td.DecodeDeclaration = true
+			for j, doc := range tc.docs {
+				if j > 0 {
+					if err := td.NextDocument(); err != nil {
+						t.Fatalf("unexpected error starting document %d: %v", j, err)
+					}
+				}
+				for _, want := range doc {
+					tok, err := td.Token()
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if !reflect.DeepEqual(tok, want) {
+						t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", want, tok)
+					}
+				}
+				_, err := td.Token()
+				if j == len(tc.docs)-1 && tc.err != "" {
+					if err == nil || err.Error() != tc.err {
+						t.Fatalf("wrong error: want=%q, got=%v", tc.err, err)
+					}
+					return
+				}
+				if err != io.EOF {
+					t.Fatalf("expected end of document %d, got error: %v", j, err)
+				}
+			}
+			if err := td.NextDocument(); err != io.EOF {
+				t.Fatalf("expected io.EOF after the last document, got: %v", err)
+			}
+		})
+	}
+}
+
+var bufferedTestCases = []struct {
+	in   string
+	size int
+}{
+	0: {in: "<a b='c&amp;d' e=\"f'g\">\nfoo &lt; bar\r\nbaz<!-- x-y -- ->z --><![CDATA[a]b]]c]]]></a>"},
+	1: {in: "<a>" + strings.Repeat("abcdefgh\n", 20) + "<b>" + strings.Repeat("白鵬翔", 20) + "</b></a>"},
+	2: {in: "<a>" + strings.Repeat("abcdefgh\n", 20) + "</a>", size: 7},
+	3: {in: "<a>" + strings.Repeat("白鵬翔", 20) + "<![CDATA[" + strings.Repeat("x]", 20) + "]]></a>", size: 5},
+	4: {in: `<a b="` + strings.Repeat("&#x41;bc", 10) + `"/>`},
+	5: {in: `<a:b:c xmlns:a="urn:a" a:d:e="f"><` + strings.Repeat("g", 40) + `/></a:b:c>`},
+	6: {in: "text<a>foo<![CDATA[bar]]>baz</a>tail"},
+}
+
+func TestBuffered(t *testing.T) {
+	for i, tc := range bufferedTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			want := NewTokenizer(strings.NewReader(tc.in))
+			want.CharDataChunkSize = tc.size
+			want.SourceTokens = true
+			got := NewTokenizer(bufio.NewReaderSize(strings.NewReader(tc.in), 16))
+			got.CharDataChunkSize = tc.size
+			got.SourceTokens = true
+			for {
+				wantTok, wantErr := want.Token()
+				gotTok, gotErr := got.Token()
+				if wantErr != gotErr {
+					t.Fatalf("wrong error: want=%v, got=%v", wantErr, gotErr)
+				}
+				if !reflect.DeepEqual(gotTok, wantTok) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", wantTok, gotTok)
+				}
+				if want.Span() != got.Span() {
+					t.Fatalf("wrong span: want=%+v, got=%+v", want.Span(), got.Span())
+				}
+				if wantErr != nil {
+					return
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizerBytes(t *testing.T) {
+	for i, tc := range bufferedTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			for _, coalesce := range []bool{false, true} {
+				want := NewTokenizer(strings.NewReader(tc.in))
+				want.CharDataChunkSize = tc.size
+				want.CoalesceCharData = coalesce
+				want.SourceTokens = true
+				got := NewTokenizerBytes([]byte(tc.in))
+				got.CharDataChunkSize = tc.size
+				got.CoalesceCharData = coalesce
+				got.SourceTokens = true
+				for {
+					wantTok, wantErr := want.Token()
+					gotTok, gotErr := got.Token()
+					if wantErr != gotErr {
+						t.Fatalf("wrong error: want=%v, got=%v", wantErr, gotErr)
+					}
+					if !reflect.DeepEqual(gotTok, wantTok) {
+						t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", wantTok, gotTok)
+					}
+					if want.Span() != got.Span() || want.InputOffset() != got.InputOffset() {
+						t.Fatalf("wrong position: want=%+v at %d, got=%+v at %d", want.Span(), want.InputOffset(), got.Span(), got.InputOffset())
+					}
+					if wantErr != nil {
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTokenizerBytesZeroCopy(t *testing.T) {
+	in := []byte(`<a>foo<b/>bar&amp;</a>`)
+	td := NewTokenizerBytes(in)
+	td.ZeroCopy = true
+	var text []CharData
+	for {
+		tok, err := td.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cd, ok := tok.(CharData); ok {
+			text = append(text, cd)
+		}
+	}
+	if len(text) != 2 {
+		t.Fatalf("wrong number of CharData tokens: want=2, got=%d", len(text))
+	}
+	// Text without references is returned as a slice of the input.
+	in[3] = 'g'
+	if string(text[0]) != "goo" {
+		t.Errorf("expected text to share memory with the input, got %q", text[0])
+	}
+	if string(text[1]) != "bar&" {
+		t.Errorf("wrong text: want=%q, got=%q", "bar&", text[1])
+	}
+}
+
+// chunkReader returns the input in chunks, with a timeout error between each
+// one.
+type chunkReader struct {
+	chunks  []string
+	timeout bool
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	if r.timeout = !r.timeout; r.timeout {
+		return 0, timeoutError{}
+	}
+	n := copy(p, r.chunks[0])
+	if r.chunks[0] = r.chunks[0][n:]; r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func TestTokenizerSize(t *testing.T) {
+	for i, tc := range bufferedTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			want := NewTokenizer(strings.NewReader(tc.in))
+			want.CharDataChunkSize = tc.size
+			want.SourceTokens = true
+			wantToks, err := readAll(want)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, td := range []*Tokenizer{
+				NewTokenizerSize(onlyReader{strings.NewReader(tc.in)}, 0),
+				NewTokenizerSize(onlyReader{strings.NewReader(tc.in)}, 1<<16),
+				NewTokenizerBuffer(onlyReader{strings.NewReader(tc.in)}, make([]byte, 0, 20)),
+			} {
+				td.CharDataChunkSize = tc.size
+				td.SourceTokens = true
+				got, err := readAll(td)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(got, wantToks) {
+					t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", wantToks, got)
+				}
+			}
+
+			// Timeouts from the underlying reader are returned without losing any
+			// buffered input.
+			var chunks []string
+			for in := tc.in; in != ""; {
+				n := 7
+				if n > len(in) {
+					n = len(in)
+				}
+				chunks = append(chunks, in[:n])
+				in = in[n:]
+			}
+			td := NewTokenizerSize(&chunkReader{chunks: chunks}, 16)
+			td.CharDataChunkSize = tc.size
+			td.SourceTokens = true
+			var got []Token
+			for {
+				tok, err := td.Token()
+				if _, ok := err.(timeoutError); ok {
+					continue
+				}
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				got = append(got, CopyToken(tok))
+			}
+			if !reflect.DeepEqual(got, wantToks) {
+				t.Fatalf("wrong tokens with timeouts:\nwant=%+v,\n got=%+v", wantToks, got)
+			}
+		})
+	}
+}
+
+var lazyAttrTestCases = []struct {
+	in    string
+	toks  []Token
+	attrs [][]Attr
+	err   string
+}{
+	0: {
+		in: `<a b="c>" d='e"'><f/><g h="&amp;"/></a>`,
+		toks: []Token{
+			StartElement{Name: Name{Local: "a"}},
+			StartElement{Name: Name{Local: "f"}},
+			EndElement{Name: Name{Local: "f"}},
+			StartElement{Name: Name{Local: "g"}},
+			EndElement{Name: Name{Local: "g"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+		attrs: [][]Attr{
+			{{Name: Name{Local: "b"}, Value: "c>"}, {Name: Name{Local: "d"}, Value: `e"`}},
+			{},
+			{{Name: Name{Local: "h"}, Value: "&"}},
+		},
+	},
+	1: {
+		in: `<a xmlns="urn:a" xmlns:p="urn:p"><b p:c="d" xml:space="preserve"> </b></a>`,
+		toks: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "a"}, Attr: []Attr{
+				{Name: Name{Local: "xmlns"}, Value: "urn:a"},
+				{Name: Name{Space: "xmlns", Local: "p"}, Value: "urn:p"},
+			}},
+			StartElement{Name: Name{Space: "urn:a", Local: "b"}, Attr: []Attr{
+				{Name: Name{Space: "urn:p", Local: "c"}, Value: "d"},
+				{Name: Name{Space: "xml", Local: "space"}, Value: "preserve"},
+			}},
+			CharData(" "),
+			EndElement{Name: Name{Space: "urn:a", Local: "b"}},
+			EndElement{Name: Name{Space: "urn:a", Local: "a"}},
+		},
+		attrs: [][]Attr{nil, nil},
+	},
+	2: {
+		in: `<a xmlns:p="urn:p"><b p:c="d"/></a>`,
+		toks: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{
+				{Name: Name{Space: "xmlns", Local: "p"}, Value: "urn:p"},
+			}},
+			StartElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "b"}},
+			EndElement{Name: Name{Local: "a"}},
+		},
+		attrs: [][]Attr{nil, {{Name: Name{Space: "urn:p", Local: "c"}, Value: "d"}}},
+	},
+	3: {
+		in:    `<a b="c" d>`,
+		toks:  []Token{StartElement{Name: Name{Local: "a"}}},
+		attrs: [][]Attr{nil},
+		err:   "XML syntax error on line 0: early EOF",
+	},
+}
+
+func TestLazyAttr(t *testing.T) {
+	for i, tc := range lazyAttrTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.LazyAttr = true
+			var toks []Token
+			var attrs [][]Attr
+			var attrErr error
+			for {
+				tok, err := td.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				toks = append(toks, tok)
+				if _, ok := tok.(StartElement); ok {
+					attr, err := td.Attr()
+					if err != nil {
+						attrErr = err
+					}
+					attrs = append(attrs, attr)
+				}
+			}
+			if !reflect.DeepEqual(toks, tc.toks) {
+				t.Errorf("wrong tokens:\nwant=%+v,\n got=%+v", tc.toks, toks)
+			}
+			if !reflect.DeepEqual(attrs, tc.attrs) {
+				t.Errorf("wrong attributes:\nwant=%+v,\n got=%+v", tc.attrs, attrs)
+			}
+			switch {
+			case tc.err == "" && attrErr != nil:
+				t.Errorf("unexpected error decoding attributes: %v", attrErr)
+			case tc.err != "" && (attrErr == nil || attrErr.Error() != tc.err):
+				t.Errorf("wrong error decoding attributes: want=%q, got=%v", tc.err, attrErr)
+			}
+		})
+	}
+}
+
+var zeroCopyTestCases = []struct {
+	in       string
+	coalesce bool
+	size     int
+}{
+	0: {in: `<!DOCTYPE a><a>foo<!-- bar --><![CDATA[baz]]>&amp;quux<b/>text</a>`},
+	1: {in: `<a>foo<![CDATA[bar]]>baz<!--c--></a>`, coalesce: true},
+	2: {in: `<a>foo bar baz<![CDATA[quux]]></a>`, size: 3},
+}
+
+func TestZeroCopy(t *testing.T) {
+	for i, tc := range zeroCopyTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			want := NewTokenizer(strings.NewReader(tc.in))
+			want.CoalesceCharData = tc.coalesce
+			want.CharDataChunkSize = tc.size
+			got := NewTokenizer(strings.NewReader(tc.in))
+			got.CoalesceCharData = tc.coalesce
+			got.CharDataChunkSize = tc.size
+			got.ZeroCopy = true
+			var prev []byte
+			for {
+				wantTok, wantErr := want.Token()
+				gotTok, gotErr := got.Token()
+				if wantErr != gotErr {
+					t.Fatalf("wrong error: want=%v, got=%v", wantErr, gotErr)
+				}
+				if wantErr != nil {
+					return
+				}
+				var b []byte
+				switch tok := gotTok.(type) {
+				case CharData:
+					b = tok
+				case Comment:
+					b = tok
+				case Directive:
+					b = tok
+				}
+				if len(b) > 0 && len(prev) > 0 && &b[0] != &prev[0] && cap(b) <= cap(prev) {
+					t.Errorf("expected buffer to be reused")
+				}
+				if len(b) > 0 {
+					prev = b
+				}
+				if !reflect.DeepEqual(CopyToken(gotTok), wantTok) {
+					t.Fatalf("wrong token:\nwant=%T(%+[1]v),\n got=%[2]T(%+[2]v)", wantTok, gotTok)
+				}
+			}
+		})
+	}
+}
+
+func TestTokensOwned(t *testing.T) {
+	const in = `<a>foo<!--bar--><?baz quux?><![CDATA[]]><!DOCTYPE a>text</a>`
+	td := NewTokenizer(strings.NewReader(in))
+	var toks []Token
+	for {
+		tok, err := td.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		toks = append(toks, tok)
+	}
+	want := []Token{
+		StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		CharData("foo"),
+		Comment("bar"),
+		ProcInst{Target: "baz", Inst: []byte("quux")},
+		CharData(nil),
+		Directive("DOCTYPE a"),
+		CharData("text"),
+		EndElement{Name: Name{Local: "a"}},
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Errorf("tokens were modified after being returned:\nwant=%+v,\n got=%+v", want, toks)
+	}
+}
+
+// repeatReader returns the same input over and over.
+type repeatReader struct {
+	b   []byte
+	off int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], r.b[r.off:])
+		n += c
+		r.off = (r.off + c) % len(r.b)
+	}
+	return n, nil
+}
+
+func TestIntern(t *testing.T) {
+	td := NewTokenizer(&repeatReader{b: []byte(`<p:a xmlns:p="urn:x" c=""></p:a>`)})
+	// Decode a few tokens first so that the names are already interned and the
+	// buffers have grown.
+	for i := 0; i < 10; i++ {
+		_, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		// Decode the start and end element.
+		for i := 0; i < 2; i++ {
+			_, err := td.Token()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+	})
+	// The tokens and the attribute slice are allocated, but the names, prefixes,
+	// and namespace are not, which would add another four allocations.
+	if allocs > 6 {
+		t.Errorf("names were not interned: got %v allocations per element", allocs)
+	}
+}
+
+type writeRecorder struct {
+	writes []string
+}
+
+func (w *writeRecorder) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+var teeTestCases = []struct {
+	in       string
+	coalesce bool
+	skip     bool
+	writes   []string
+}{
+	0: {},
+	1: {
+		in:     `<a b='c'>foo<!-- bar --><d/></a >`,
+		writes: []string{`<a b='c'>`, `foo`, `<!-- bar -->`, `<d/>`, `</a >`},
+	},
+	2: {
+		in:       `<a>foo<![CDATA[bar]]><![CDAT</a>`,
+		coalesce: true,
+		skip:     true,
+		writes:   []string{`<a>`, `foo<![CDATA[bar]]>`, `<![CDAT</a>`},
+	},
+	3: {
+		in:     `<a>foo`,
+		writes: []string{`<a>`, `foo`},
+	},
+}
+
+func TestTee(t *testing.T) {
+	for i, tc := range teeTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			w := &writeRecorder{}
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.CoalesceCharData = tc.coalesce
+			td.SkipDirectives = tc.skip
+			td.Tee = w
+			for {
+				_, err := td.Token()
+				if err != nil {
+					break
+				}
+			}
+			if !reflect.DeepEqual(w.writes, tc.writes) {
+				t.Fatalf("wrong writes: want=%q, got=%q", tc.writes, w.writes)
+			}
+		})
+	}
+}
+
+func TestSourceTokens(t *testing.T) {
+	const in = `<a b='c'>foo<!-- bar --><d/></a >`
+	want := []SourceToken{
+		{Token: StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "b"}, Value: "c"}}}, Source: []byte(`<a b='c'>`)},
+		{Token: CharData("foo"), Source: []byte(`foo`)},
+		{Token: StartElement{Name: Name{Local: "d"}, Attr: []Attr{}}, Source: []byte(`<!-- bar --><d/>`)},
+		{Token: EndElement{Name: Name{Local: "d"}}},
+		{Token: EndElement{Name: Name{Local: "a"}}, Source: []byte(`</a >`)},
+	}
+	td := NewTokenizer(strings.NewReader(in))
+	td.SkipComments = true
+	td.SourceTokens = true
+	for i, w := range want {
+		tok, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tok, w) {
+			t.Fatalf("wrong token %d:\nwant=%+v,\n got=%T(%+[3]v)", i, w, tok)
+		}
+	}
+	tok, err := td.Token()
+	if err != io.EOF || tok != nil {
+		t.Fatalf("expected EOF, got %T(%+[1]v), %v", tok, err)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	const (
+		first  = `<stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'><proceed xml:space='preserve'/>`
+		second = `<?xml version="1.0"?><stream:stream xmlns:stream='urn:other'> <foo/>`
+	)
+	td := NewTokenizer(strings.NewReader(first + second))
+	td.DecodeDeclaration = true
+	td.TrimSpace = true
+	for i := 0; i < 2; i++ {
+		_, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+	}
+	// Restart without consuming the EndElement of the self-closing proceed.
+	td.Restart()
+	want := []Token{
+		Declaration{Version: "1.0"},
+		StartElement{Name: Name{Space: "urn:other", Local: "stream"}, Attr: []Attr{{Name: Name{Space: "xmlns", Local: "stream"}, Value: "urn:other"}}},
+		StartElement{Name: Name{Local: "foo"}, Attr: []Attr{}},
+		EndElement{Name: Name{Local: "foo"}},
+	}
+	for i, w := range want {
+		tok, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tok, w) {
+			t.Fatalf("wrong token %d:\nwant=%T(%+[2]v),\n got=%[3]T(%+[3]v)", i, w, tok)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	const (
+		first  = `<a xmlns:p='urn:p'><p:b> text <!-- c -->`
+		second = `<p:a xmlns:p='urn:q'> <b/><!-- c --></p:a>`
+	)
+	want, err := readAll(NewTokenizer(onlyReader{strings.NewReader(second)}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	td := NewTokenizer(onlyReader{strings.NewReader(first)})
+	td.SkipComments = true
+	td.TrimSpace = true
+	td.SourceTokens = true
+	for i := 0; i < 3; i++ {
+		_, err := td.Token()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+	}
+	td.Reset(onlyReader{strings.NewReader(second)})
+	got, err := readAll(td)
+	if err != nil {
+		t.Fatalf("unexpected error after reset: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong tokens after reset:\nwant=%+v,\n got=%+v", want, got)
+	}
+	if off := td.InputOffset(); off != int64(len(second)) {
+		t.Errorf("wrong offset after reset: want=%d, got=%d", len(second), off)
+	}
+
+	for i := 0; i < 3; i++ {
+		td := GetTokenizer(strings.NewReader(second))
+		got, err := readAll(td)
+		if err != nil {
+			t.Fatalf("unexpected error from pooled tokenizer %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong tokens from pooled tokenizer %d:\nwant=%+v,\n got=%+v", i, want, got)
+		}
+		td.TrimSpace = true
+		PutTokenizer(td)
+	}
+}
+
+// onlyReader hides any methods other than Read so that the tokenizer has to
+// do its own buffering.
+type onlyReader struct {
+	r io.Reader
+}
+
+func (r onlyReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+var setReaderTestCases = []struct {
+	first  string
+	second string
+	keep   bool
+	out    []Token
+}{
+	0: {
+		first:  `<a xmlns="urn:a"><b/><c/>`,
+		second: `<d/></a>`,
+		keep:   true,
+		out: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "c"}, Attr: []Attr{}},
+			EndElement{Name: Name{Space: "urn:a", Local: "c"}},
+			StartElement{Name: Name{Space: "urn:a", Local: "d"}, Attr: []Attr{}},
+			EndElement{Name: Name{Space: "urn:a", Local: "d"}},
+			EndElement{Name: Name{Space: "urn:a", Local: "a"}},
+		},
+	},
+	1: {
+		first:  `<a xmlns="urn:a"><b/><c/>`,
+		second: `<d/></a>`,
+		out: []Token{
+			StartElement{Name: Name{Space: "urn:a", Local: "d"}, Attr: []Attr{}},
+			EndElement{Name: Name{Space: "urn:a", Local: "d"}},
+			EndElement{Name: Name{Space: "urn:a", Local: "a"}},
+		},
+	},
+}
+
+func TestSetReader(t *testing.T) {
+	for i, tc := range setReaderTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(onlyReader{r: strings.NewReader(tc.first)})
+			for j := 0; j < 3; j++ {
+				_, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error on token %d: %v", j, err)
+				}
+			}
+			td.SetReader(onlyReader{r: strings.NewReader(tc.second)}, tc.keep)
+			for j, want := range tc.out {
+				tok, err := td.Token()
+				if err != nil {
+					t.Fatalf("unexpected error on token %d: %v", j, err)
+				}
+				if !reflect.DeepEqual(tok, want) {
+					t.Fatalf("wrong token %d:\nwant=%T(%+[2]v),\n got=%[3]T(%+[3]v)", j, want, tok)
+				}
+			}
+			tok, err := td.Token()
+			if err != io.EOF {
+				t.Fatalf("expected EOF, got %T(%+[1]v), %v", tok, err)
+			}
+		})
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+// timeoutReader returns a timeout error instead of reading past any of the
+// given offsets in the input.
+type timeoutReader struct {
+	in    string
+	off   int
+	stops []int
+}
+
+func (r *timeoutReader) ReadByte() (byte, error) {
+	if len(r.stops) > 0 && r.off == r.stops[0] {
+		r.stops = r.stops[1:]
+		return 0, timeoutError{}
+	}
+	if r.off == len(r.in) {
+		return 0, io.EOF
+	}
+	b := r.in[r.off]
+	r.off++
+	return b, nil
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	panic("tokenizer should use ReadByte")
+}
+
+func TestTimeoutResume(t *testing.T) {
+	const in = `<a xmlns="urn:a"><b c='d'>efg<![CDATA[hij]]></b><!-- k --></a>`
+	var want []Token
+	td := NewTokenizer(strings.NewReader(in))
+	for {
+		tok, err := td.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want = append(want, tok)
+	}
+
+	var stops []int
+	for i := 1; i < len(in); i += 3 {
+		stops = append(stops, i)
+	}
+	td = NewTokenizer(&timeoutReader{in: in, stops: stops})
+	var got []Token
+	var timeouts int
+	for {
+		tok, err := td.Token()
+		if err == io.EOF {
+			break
+		}
+		if _, ok := err.(timeoutError); ok {
+			timeouts++
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, tok)
+	}
+	if timeouts != len(stops) {
+		t.Errorf("wrong number of timeouts: want=%d, got=%d", len(stops), timeouts)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, got)
+	}
+}
+
+var lineEndingTestCases = [...]struct {
+	in   string
+	toks []Token
+}{
+	0: {
+		in:   "a\r\nb\rc\n\rd&#xD;\r",
+		toks: []Token{CharData("a\nb\nc\n\nd\r\n")},
+	},
+	1: {
+		in: "<a b='\r\nc\t&#9;&#xA;'><!--\r\n--><?p \r\n?><![CDATA[\r\n]]></a>",
+		toks: []Token{
+			StartElement{Name: Name{Local: "a"}, Attr: []Attr{{Name: Name{Local: "b"}, Value: " c \t\n"}}},
+			Comment("\n"),
+			ProcInst{Target: "p", Inst: []byte("\n")},
+			CharData("\n"),
+			EndElement{Name: Name{Local: "a"}},
+		},
+	},
+}
+
+func TestLineEndings(t *testing.T) {
+	for i, tc := range lineEndingTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			for _, td := range []*Tokenizer{
+				NewTokenizer(strings.NewReader(tc.in)),
+				NewTokenizerBytes([]byte(tc.in)),
+				// Split the input between every pair of bytes.
+				NewTokenizer(iotest.OneByteReader(strings.NewReader(tc.in))),
+			} {
+				var tee strings.Builder
+				td.Tee = &tee
+				toks, err := readAll(td)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(toks, tc.toks) {
+					t.Errorf("wrong tokens:\nwant=%#v,\n got=%#v", tc.toks, toks)
+				}
+				if s := tee.String(); s != tc.in {
+					t.Errorf("input was not copied as is: want=%q, got=%q", tc.in, s)
+				}
+			}
+		})
+	}
+}
+
+var attrNormalizationTestCases = [...]struct {
+	in   string
+	attr []Attr
+}{
+	0: {
+		in:   "<a b='c\td\ne\r\nf'/>",
+		attr: []Attr{{Name: Name{Local: "b"}, Value: "c d e f"}},
+	},
+	1: {
+		in:   "<a b=' c  d '/>",
+		attr: []Attr{{Name: Name{Local: "b"}, Value: " c  d "}},
+	},
+	2: {
+		in:   "<a b='&#9;&#xA;&#xD;'/>",
+		attr: []Attr{{Name: Name{Local: "b"}, Value: "\t\n\r"}},
+	},
+	3: {
+		in: "<!DOCTYPE a [<!ATTLIST a b NMTOKENS #IMPLIED c CDATA #IMPLIED>]><a b=' x\r\n y ' c=' x  y '/>",
+		attr: []Attr{
+			{Name: Name{Local: "b"}, Value: "x y"},
+			{Name: Name{Local: "c"}, Value: " x  y "},
+		},
+	},
+	4: {
+		in:   "<!DOCTYPE a [<!ATTLIST a id ID #IMPLIED>]><a id='\tx\t'/>",
+		attr: []Attr{{Name: Name{Local: "id"}, Value: "x"}},
+	},
+	5: {
+		in:   "<!DOCTYPE a [<!ATTLIST a b (x|y) 'y'>]><a/>",
+		attr: []Attr{{Name: Name{Local: "b"}, Value: "y"}},
+	},
+}
+
+func TestAttrNormalization(t *testing.T) {
+	for i, tc := range attrNormalizationTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			td := NewTokenizer(strings.NewReader(tc.in))
+			td.SkipDirectives = true
+			tok, err := td.Token()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			start, ok := tok.(StartElement)
+			if !ok {
+				t.Fatalf("wrong token: want=StartElement, got=%T", tok)
+			}
+			if !reflect.DeepEqual(start.Attr, tc.attr) {
+				t.Errorf("wrong attributes:\nwant=%#v,\n got=%#v", tc.attr, start.Attr)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"fmt"
+)
+
+// tracef reports a change of state to Trace, prefixed with the current input
+// position.
+// Callers should check that Trace is set first to avoid formatting the
+// arguments.
+func (t *Tokenizer) tracef(format string, v ...interface{}) {
+	p := t.pos()
+	t.Trace("xml: %d:%d (offset %d): %s", p.Line, p.Col, p.Offset, fmt.Sprintf(format, v...))
+}
+
+// keepName retains the memory of the name buffer after it has been grown so
+// that it can be reused by the next name.
+func (t *Tokenizer) keepName(raw []byte) {
+	if t.Trace != nil && cap(raw) > cap(t.nameBuf) {
+		t.tracef("grow name buffer from %d to %d bytes", cap(t.nameBuf), cap(raw))
+	}
+	t.nameBuf = raw[:0]
+}
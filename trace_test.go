@@ -0,0 +1,55 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestTrace(t *testing.T) {
+	const in = `<a xmlns="urn:a" xmlns:b="urn:b"><b:c x="1"/></a>`
+	var msgs []string
+	d := NewTokenizer(strings.NewReader(in))
+	d.Trace = func(format string, v ...interface{}) {
+		msgs = append(msgs, fmt.Sprintf(format, v...))
+	}
+	for {
+		_, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	want := []string{
+		"push element a at depth 1",
+		"decode attribute xmlns",
+		"bind default namespace to \"urn:a\" at depth 1",
+		"decode attribute xmlns:b",
+		"bind prefix \"b\" to \"urn:b\" at depth 1",
+		"push element b:c at depth 2",
+		"decode attribute x",
+		"pop element at depth 2",
+		"pop element at depth 1",
+		"unbind prefix \"b\"",
+	}
+	out := strings.Join(msgs, "\n")
+	for _, w := range want {
+		i := strings.Index(out, w)
+		if i == -1 {
+			t.Fatalf("missing trace message %q in:\n%s", w, strings.Join(msgs, "\n"))
+		}
+		out = out[i+len(w):]
+	}
+	if !strings.HasPrefix(msgs[0], "xml: 1:") {
+		t.Errorf("expected message to include position, got %q", msgs[0])
+	}
+}
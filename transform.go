@@ -0,0 +1,95 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+// A Transformer returns a new TokenReader that returns transformed tokens read
+// from the TokenReader it wraps.
+type Transformer func(r TokenReader) TokenReader
+
+// Transform returns a transformer that calls f for each token.
+// If f returns false the token is dropped, otherwise the token returned by f is
+// returned in place of the original.
+func Transform(f func(Token) (Token, bool)) Transformer {
+	return func(r TokenReader) TokenReader {
+		return &transformReader{r: r, f: f}
+	}
+}
+
+// Chain returns a transformer that applies each of the transformers in order,
+// so that the first transformer reads directly from the underlying reader.
+func Chain(t ...Transformer) Transformer {
+	return func(r TokenReader) TokenReader {
+		for _, f := range t {
+			r = f(r)
+		}
+		return r
+	}
+}
+
+type transformReader struct {
+	r TokenReader
+	f func(Token) (Token, bool)
+}
+
+func (r *transformReader) Token() (Token, error) {
+	for {
+		tok, err := r.r.Token()
+		if tok != nil {
+			var ok bool
+			tok, ok = r.f(tok)
+			if !ok {
+				tok = nil
+			}
+		}
+		if tok == nil && err == nil {
+			continue
+		}
+		return tok, err
+	}
+}
+
+// RemoveComments returns a TokenReader that drops all comments read from r.
+func RemoveComments(r TokenReader) TokenReader {
+	return remove(r, func(tok Token) bool {
+		_, ok := tok.(Comment)
+		return ok
+	})
+}
+
+// RemoveProcInst returns a TokenReader that drops all processing instructions
+// read from r, including the XML declaration.
+func RemoveProcInst(r TokenReader) TokenReader {
+	return remove(r, func(tok Token) bool {
+		switch tok.(type) {
+		case ProcInst, Declaration:
+			return true
+		}
+		return false
+	})
+}
+
+// RemoveDirectives returns a TokenReader that drops all directives read from
+// r.
+func RemoveDirectives(r TokenReader) TokenReader {
+	return remove(r, func(tok Token) bool {
+		_, ok := tok.(Directive)
+		return ok
+	})
+}
+
+func remove(r TokenReader, drop func(Token) bool) TokenReader {
+	return Transform(func(tok Token) (Token, bool) {
+		return tok, !drop(unwrapSource(tok))
+	})(r)
+}
+
+// unwrapSource returns the token carried by a SourceToken, or tok itself if it
+// is not a SourceToken.
+func unwrapSource(tok Token) Token {
+	if st, ok := tok.(SourceToken); ok {
+		return st.Token
+	}
+	return tok
+}
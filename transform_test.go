@@ -0,0 +1,99 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestTransform(t *testing.T) {
+	upper := Transform(func(tok Token) (Token, bool) {
+		if cd, ok := tok.(CharData); ok {
+			return CharData(bytes.ToUpper(cd)), true
+		}
+		return tok, true
+	})
+	dropB := Transform(func(tok Token) (Token, bool) {
+		switch tok := tok.(type) {
+		case StartElement:
+			return tok, tok.Name.Local != "b"
+		case EndElement:
+			return tok, tok.Name.Local != "b"
+		}
+		return tok, true
+	})
+
+	r := Chain(upper, dropB)(NewTokenizer(strings.NewReader(`<a>foo<b/>bar</a>`)))
+	toks, err := readAll(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		CharData("FOO"),
+		CharData("BAR"),
+		EndElement{Name: Name{Local: "a"}},
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+}
+
+var removeTestCases = []struct {
+	name string
+	f    Transformer
+	out  []Token
+}{
+	{
+		name: "comments",
+		f:    RemoveComments,
+		out: []Token{
+			ProcInst{Target: "a", Inst: []byte("b")},
+			Directive("c"),
+			StartElement{Name: Name{Local: "e"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "e"}},
+		},
+	},
+	{
+		name: "procinst",
+		f:    RemoveProcInst,
+		out: []Token{
+			Directive("c"),
+			Comment(" d "),
+			StartElement{Name: Name{Local: "e"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "e"}},
+		},
+	},
+	{
+		name: "directives",
+		f:    RemoveDirectives,
+		out: []Token{
+			ProcInst{Target: "a", Inst: []byte("b")},
+			Comment(" d "),
+			StartElement{Name: Name{Local: "e"}, Attr: []Attr{}},
+			EndElement{Name: Name{Local: "e"}},
+		},
+	},
+}
+
+func TestRemove(t *testing.T) {
+	const in = `<?a b?><!c><!-- d --><e/>`
+	for _, tc := range removeTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			toks, err := readAll(tc.f(NewTokenizer(strings.NewReader(in))))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(toks, tc.out) {
+				t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", tc.out, toks)
+			}
+		})
+	}
+}
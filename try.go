@@ -0,0 +1,56 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+)
+
+var errWouldBlock = errors.New("xml: read would block")
+
+// TryToken returns the next token only if it can be decoded entirely from input
+// that has already been buffered, without reading from the underlying reader.
+// If the buffered input does not contain a complete token TryToken returns
+// false and a nil error, and any partially decoded token is kept for the next
+// call to TryToken or Token.
+//
+// Input is considered buffered if it has already been read by the tokenizer or
+// if it is reported by the Buffered method of the underlying io.ByteReader
+// (such as a *bufio.Reader, including the one created by NewTokenizer).
+func (t *Tokenizer) TryToken() (Token, bool, error) {
+	var n int
+	if b, ok := t.r.(interface{ Buffered() int }); ok {
+		n = b.Buffered()
+	}
+	r := t.r
+	t.try = bufferedReader{r: r, n: n}
+	t.r = &t.try
+	tok, err := t.Token()
+	t.r = r
+	t.try.r = nil
+	switch {
+	case errors.Is(err, errWouldBlock), errors.Is(err, ErrNeedMoreData):
+		return nil, false, nil
+	case err != nil:
+		return tok, tok != nil, err
+	}
+	return tok, true, nil
+}
+
+// bufferedReader is an io.ByteReader that reads at most n bytes from r before
+// returning errWouldBlock.
+type bufferedReader struct {
+	r io.ByteReader
+	n int
+}
+
+func (b *bufferedReader) ReadByte() (byte, error) {
+	if b.n <= 0 {
+		return 0, errWouldBlock
+	}
+	b.n--
+	return b.r.ReadByte()
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+// onceReader returns its input on the first read and panics if it is read
+// again.
+type onceReader struct {
+	in   string
+	done bool
+}
+
+func (r *onceReader) Read(p []byte) (int, error) {
+	if r.done {
+		panic("unexpected read from underlying reader")
+	}
+	r.done = true
+	return copy(p, r.in), nil
+}
+
+func TestTryToken(t *testing.T) {
+	r := &onceReader{in: `<a>foo<b c="d`}
+	br := bufio.NewReader(r)
+	/* #nosec */
+	br.Peek(1)
+	td := NewTokenizer(br)
+
+	want := []Token{
+		StartElement{Name: Name{Local: "a"}, Attr: []Attr{}},
+		CharData("foo"),
+	}
+	for i, w := range want {
+		tok, ok, err := td.TryToken()
+		if err != nil {
+			t.Fatalf("unexpected error on token %d: %v", i, err)
+		}
+		if !ok {
+			t.Fatalf("expected token %d to be decoded from buffered input", i)
+		}
+		if !reflect.DeepEqual(tok, w) {
+			t.Fatalf("wrong token %d: want=%+v, got=%+v", i, w, tok)
+		}
+	}
+	tok, ok, err := td.TryToken()
+	if tok != nil || ok || err != nil {
+		t.Fatalf("expected no token from incomplete input, got %+v, %t, %v", tok, ok, err)
+	}
+
+	// After more input is available the partial token is picked back up.
+	td.SetReader(strings.NewReader(`"/>`), true)
+	tok, err = td.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	w := StartElement{Name: Name{Local: "b"}, Attr: []Attr{{Name: Name{Local: "c"}, Value: "d"}}}
+	if !reflect.DeepEqual(tok, w) {
+		t.Fatalf("wrong token: want=%+v, got=%+v", w, tok)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var predefinedEntities = map[string]rune{
+	"lt":   '<',
+	"gt":   '>',
+	"amp":  '&',
+	"apos": '\'',
+	"quot": '"',
+}
+
+// Unescape returns b with the predefined entities ("&lt;", "&gt;", "&amp;",
+// "&apos;", and "&quot;") and character references (such as "&#60;" or
+// "&#x3C;") replaced by the characters they represent.
+// Any other entity, a character reference to a character that is not allowed
+// in XML, or an "&" that does not start a reference results in a SyntaxError.
+//
+// If b does not contain any references it is returned unchanged.
+func Unescape(b []byte) ([]byte, error) {
+	i := bytes.IndexByte(b, '&')
+	if i == -1 {
+		return b, nil
+	}
+	out := make([]byte, 0, len(b))
+	for i != -1 {
+		out = append(out, b[:i]...)
+		b = b[i+1:]
+		end := bytes.IndexByte(b, ';')
+		if end == -1 {
+			return nil, &SyntaxError{Msg: "invalid character entity &" + string(b) + " (no semicolon)"}
+		}
+		r, ok := resolveEntity(string(b[:end]))
+		if !ok {
+			return nil, &SyntaxError{Msg: "invalid character entity &" + string(b[:end+1])}
+		}
+		out = utf8.AppendRune(out, r)
+		b = b[end+1:]
+		i = bytes.IndexByte(b, '&')
+	}
+	return append(out, b...), nil
+}
+
+// UnescapeString is like Unescape but operates on strings.
+func UnescapeString(s string) (string, error) {
+	if !strings.Contains(s, "&") {
+		return s, nil
+	}
+	b, err := Unescape([]byte(s))
+	return string(b), err
+}
+
+// resolveEntity returns the character represented by the entity or character
+// reference name, which does not include the leading "&" or trailing ";".
+func resolveEntity(name string) (rune, bool) {
+	if r, ok := predefinedEntities[name]; ok {
+		return r, true
+	}
+	if len(name) < 2 || name[0] != '#' {
+		return 0, false
+	}
+	var n uint64
+	var err error
+	if name[1] == 'x' {
+		if len(name) < 3 {
+			return 0, false
+		}
+		n, err = strconv.ParseUint(name[2:], 16, 32)
+	} else {
+		n, err = strconv.ParseUint(name[1:], 10, 32)
+	}
+	if err != nil {
+		return 0, false
+	}
+	r := rune(n)
+	if !isInCharacterRange(r) {
+		return 0, false
+	}
+	return r, true
+}
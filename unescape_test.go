@@ -0,0 +1,54 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strconv"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+var unescapeTestCases = []struct {
+	in  string
+	out string
+	err bool
+}{
+	0:  {in: "abc", out: "abc"},
+	1:  {in: "&lt;&gt;&amp;&apos;&quot;", out: `<>&'"`},
+	2:  {in: "a&#60;b&#x3C;c&#x767d;", out: "a<b<c白"},
+	3:  {in: "&foo;", err: true},
+	4:  {in: "a & b", err: true},
+	5:  {in: "&amp", err: true},
+	6:  {in: "&#0;", err: true},
+	7:  {in: "&#x;", err: true},
+	8:  {in: "&#-1;", err: true},
+	9:  {in: "&#xD800;", err: true},
+	10: {in: "&;", err: true},
+}
+
+func TestUnescape(t *testing.T) {
+	for i, tc := range unescapeTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			out, err := UnescapeString(tc.in)
+			switch {
+			case tc.err && err == nil:
+				t.Fatalf("expected error, got %q", out)
+			case !tc.err && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := err.(*SyntaxError); err != nil && !ok {
+				t.Errorf("expected a syntax error, got %T", err)
+			}
+			if out != tc.out {
+				t.Errorf("wrong output: want=%q, got=%q", tc.out, out)
+			}
+			b, err := Unescape([]byte(tc.in))
+			if (err != nil) != tc.err || string(b) != tc.out {
+				t.Errorf("bytes variant differs: want=%q, got=%q, %v", tc.out, b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"errors"
+	"io"
+)
+
+// SkipElement is used as a return value from a WalkFunc to indicate that the
+// children of the element should be skipped.
+// It is not returned as an error by Walk.
+var SkipElement = errors.New("skip this element")
+
+// WalkFunc is the type of the function called by Walk for each element.
+//
+// The path argument contains the names of the element's ancestors followed by
+// the name of the element itself.
+// It is reused between calls and must not be retained.
+//
+// If the function returns SkipElement, Walk skips the element's children
+// without invoking the function for them.
+// Any other error stops the walk and is returned from Walk.
+type WalkFunc func(path []Name, start StartElement) error
+
+// Walk reads tokens from r until io.EOF, calling f for each start element.
+func Walk(r TokenReader, f WalkFunc) error {
+	var path []Name
+	for {
+		tok, err := r.Token()
+		switch tok := unwrapSource(tok).(type) {
+		case StartElement:
+			path = append(path, tok.Name)
+			ferr := f(path, tok)
+			switch {
+			case ferr == SkipElement:
+				path = path[:len(path)-1]
+				if serr := Skip(r); serr != nil {
+					return serr
+				}
+			case ferr != nil:
+				return ferr
+			}
+		case EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+		switch {
+		case errors.Is(err, io.EOF):
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+}
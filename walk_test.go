@@ -0,0 +1,46 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestWalk(t *testing.T) {
+	const in = `<a><b><c/></b><skip><d/></skip><e><f/></e></a>`
+	var visited []string
+	err := Walk(NewTokenizer(strings.NewReader(in)), func(path []Name, start StartElement) error {
+		var names []string
+		for _, name := range path {
+			names = append(names, name.Local)
+		}
+		visited = append(visited, strings.Join(names, "/"))
+		if start.Name.Local == "skip" {
+			return SkipElement
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	const want = "a a/b a/b/c a/skip a/e a/e/f"
+	if got := strings.Join(visited, " "); got != want {
+		t.Fatalf("wrong elements visited:\nwant=%s,\n got=%s", want, got)
+	}
+}
+
+func TestWalkError(t *testing.T) {
+	errStop := errors.New("stop")
+	err := Walk(NewTokenizer(strings.NewReader(`<a><b/></a>`)), func(path []Name, start StartElement) error {
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("wrong error: want=%v, got=%v", errStop, err)
+	}
+}
@@ -0,0 +1,480 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package wbxml implements a tokenizer for the WAP Binary XML (WBXML) format.
+//
+// WBXML is a compact binary encoding of XML used by protocols such as
+// Exchange ActiveSync and OMA provisioning.
+// Tag and attribute names in WBXML are replaced by single byte tokens that are
+// assigned by the document type, so callers must supply the code pages that
+// map tokens back to names.
+// The Tokenizer returns the same token types as the tokenizer in package
+// mellium.im/xml so that existing token based code can consume WBXML.
+//
+// Strings encoded as UTF-8, US-ASCII, or ISO-8859-1 are supported.
+// Extension tokens have document specific meanings and are reported as errors.
+package wbxml // import "mellium.im/xml/wbxml"
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"mellium.im/xml"
+)
+
+// Global tokens that have the same meaning in every code page.
+const (
+	tokSwitchPage = 0x00
+	tokEnd        = 0x01
+	tokEntity     = 0x02
+	tokStrI       = 0x03
+	tokLiteral    = 0x04
+	tokExtI0      = 0x40
+	tokExtI1      = 0x41
+	tokExtI2      = 0x42
+	tokPI         = 0x43
+	tokLiteralC   = 0x44
+	tokExtT0      = 0x80
+	tokExtT1      = 0x81
+	tokExtT2      = 0x82
+	tokStrT       = 0x83
+	tokLiteralA   = 0x84
+	tokExt0       = 0xc0
+	tokExt1       = 0xc1
+	tokExt2       = 0xc2
+	tokOpaque     = 0xc3
+	tokLiteralAC  = 0xc4
+)
+
+// Bits of a tag token that indicate whether the element has attributes or
+// content.
+const (
+	tagAttrs   = 0x80
+	tagContent = 0x40
+)
+
+// IANA MIBenum values of supported character sets.
+const (
+	charsetUnknown = 0
+	charsetASCII   = 3
+	charsetLatin1  = 4
+	charsetUTF8    = 106
+)
+
+var errExtension = errors.New("wbxml: extension tokens are not supported")
+
+// CodePage maps the tokens of a single code page to names and values.
+type CodePage struct {
+	// Tags maps tag tokens (without the attribute and content bits) to element
+	// names.
+	Tags map[byte]xml.Name
+
+	// Attrs maps attribute start tokens to attribute names and the prefix of
+	// their values.
+	Attrs map[byte]xml.Attr
+
+	// Values maps attribute value tokens to strings.
+	Values map[byte]string
+}
+
+// Header is the header of a WBXML document.
+type Header struct {
+	// Version is the WBXML version with the major version minus one in the high
+	// four bits and the minor version in the low four bits, so 0x03 is 1.3.
+	Version byte
+
+	// PublicID is the well known public identifier of the document type, or 0
+	// if the document type is identified by PublicIDString.
+	PublicID       uint32
+	PublicIDString string
+
+	// Charset is the IANA MIBenum of the character set of the document.
+	Charset uint32
+}
+
+// Tokenizer reads tokens from a WBXML document.
+type Tokenizer struct {
+	r        *bufio.Reader
+	pages    map[byte]CodePage
+	header   Header
+	strtbl   []byte
+	tagPage  byte
+	attrPage byte
+	stack    []xml.Name
+	queue    []xml.Token
+	started  bool
+	// root is true once the root element has been read.
+	root bool
+	err  error
+}
+
+// NewTokenizer returns a tokenizer that reads a WBXML document from r using the
+// given code pages, indexed by their page number.
+func NewTokenizer(r io.Reader, pages map[byte]CodePage) *Tokenizer {
+	return &Tokenizer{
+		r:     bufio.NewReader(r),
+		pages: pages,
+	}
+}
+
+// Header returns the header of the document, reading it if it has not already
+// been read.
+func (t *Tokenizer) Header() (Header, error) {
+	if !t.started {
+		t.started = true
+		t.err = t.readHeader()
+	}
+	if t.err != nil && t.err != io.EOF {
+		return t.header, t.err
+	}
+	return t.header, nil
+}
+
+// Token returns the next token in the document.
+// After the root element and any processing instructions that follow it it
+// returns io.EOF.
+func (t *Tokenizer) Token() (xml.Token, error) {
+	if _, err := t.Header(); err != nil {
+		return nil, err
+	}
+	for len(t.queue) == 0 && t.err == nil {
+		t.err = t.step()
+	}
+	if len(t.queue) > 0 {
+		tok := t.queue[0]
+		t.queue = t.queue[1:]
+		return tok, nil
+	}
+	return nil, t.err
+}
+
+func (t *Tokenizer) readHeader() error {
+	var err error
+	t.header.Version, err = t.readByte()
+	if err != nil {
+		return err
+	}
+	t.header.PublicID, err = t.readInt()
+	if err != nil {
+		return err
+	}
+	var publicIndex uint32
+	if t.header.PublicID == 0 {
+		publicIndex, err = t.readInt()
+		if err != nil {
+			return err
+		}
+	}
+	t.header.Charset, err = t.readInt()
+	if err != nil {
+		return err
+	}
+	switch t.header.Charset {
+	case charsetUnknown, charsetASCII, charsetLatin1, charsetUTF8:
+	default:
+		return fmt.Errorf("wbxml: unsupported charset %d", t.header.Charset)
+	}
+	n, err := t.readInt()
+	if err != nil {
+		return err
+	}
+	var strtbl bytes.Buffer
+	_, err = io.CopyN(&strtbl, t.r, int64(n))
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	t.strtbl = strtbl.Bytes()
+	if t.header.PublicID == 0 {
+		t.header.PublicIDString, err = t.tableString(publicIndex)
+	}
+	return err
+}
+
+// step reads the next token of the body and queues any resulting tokens.
+func (t *Tokenizer) step() error {
+	b, err := t.r.ReadByte()
+	if err == io.EOF && t.root {
+		return io.EOF
+	}
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	switch b {
+	case tokSwitchPage:
+		t.tagPage, err = t.readByte()
+		return err
+	case tokEnd:
+		if len(t.stack) == 0 {
+			return errors.New("wbxml: unexpected END token")
+		}
+		t.queue = append(t.queue, xml.EndElement{Name: t.stack[len(t.stack)-1]})
+		t.stack = t.stack[:len(t.stack)-1]
+		t.root = len(t.stack) == 0
+		return nil
+	case tokPI:
+		return t.readPI()
+	}
+	if len(t.stack) > 0 {
+		switch b {
+		case tokEntity:
+			r, err := t.readInt()
+			if err != nil {
+				return err
+			}
+			t.queue = append(t.queue, xml.CharData(utf8.AppendRune(nil, rune(r))))
+			return nil
+		case tokStrI:
+			s, err := t.inlineString()
+			if err != nil {
+				return err
+			}
+			t.queue = append(t.queue, xml.CharData(s))
+			return nil
+		case tokStrT:
+			s, err := t.tableStringRef()
+			if err != nil {
+				return err
+			}
+			t.queue = append(t.queue, xml.CharData(s))
+			return nil
+		case tokOpaque:
+			data, err := t.opaque()
+			if err != nil {
+				return err
+			}
+			t.queue = append(t.queue, xml.CharData(data))
+			return nil
+		case tokExtI0, tokExtI1, tokExtI2, tokExtT0, tokExtT1, tokExtT2, tokExt0, tokExt1, tokExt2:
+			return errExtension
+		}
+	}
+	return t.readTag(b)
+}
+
+// readTag reads an element that starts with the tag token b.
+func (t *Tokenizer) readTag(b byte) error {
+	var name xml.Name
+	id := b &^ (tagAttrs | tagContent)
+	switch id {
+	case tokLiteral:
+		s, err := t.tableStringRef()
+		if err != nil {
+			return err
+		}
+		name.Local = string(s)
+	case tokSwitchPage, tokEnd, tokEntity, tokStrI:
+		return fmt.Errorf("wbxml: unexpected token 0x%02x", b)
+	default:
+		var ok bool
+		name, ok = t.pages[t.tagPage].Tags[id]
+		if !ok {
+			return fmt.Errorf("wbxml: unknown tag 0x%02x in code page %d", id, t.tagPage)
+		}
+	}
+	if t.root {
+		return errors.New("wbxml: multiple root elements")
+	}
+	start := xml.StartElement{Name: name}
+	if b&tagAttrs != 0 {
+		for {
+			attr, ok, err := t.readAttr()
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			start.Attr = append(start.Attr, attr)
+		}
+	}
+	t.queue = append(t.queue, start)
+	if b&tagContent != 0 {
+		t.stack = append(t.stack, name)
+	} else {
+		t.queue = append(t.queue, xml.EndElement{Name: name})
+		t.root = len(t.stack) == 0
+	}
+	return nil
+}
+
+// readAttr reads an attribute start token and any values that follow it.
+// If the END token that terminates the list of attributes is read instead ok
+// is false.
+func (t *Tokenizer) readAttr() (attr xml.Attr, ok bool, err error) {
+	b, err := t.readByte()
+	if err != nil {
+		return attr, false, err
+	}
+	for b == tokSwitchPage {
+		t.attrPage, err = t.readByte()
+		if err != nil {
+			return attr, false, err
+		}
+		b, err = t.readByte()
+		if err != nil {
+			return attr, false, err
+		}
+	}
+	switch {
+	case b == tokEnd:
+		return attr, false, nil
+	case b == tokLiteral:
+		local, err := t.tableStringRef()
+		if err != nil {
+			return attr, false, err
+		}
+		attr.Name.Local = string(local)
+	case b < 0x80 && b > tokLiteral:
+		attr, ok = t.pages[t.attrPage].Attrs[b]
+		if !ok {
+			return attr, false, fmt.Errorf("wbxml: unknown attribute 0x%02x in code page %d", b, t.attrPage)
+		}
+	default:
+		return attr, false, fmt.Errorf("wbxml: unexpected token 0x%02x", b)
+	}
+	value := []byte(attr.Value)
+	for {
+		b, err := t.r.ReadByte()
+		if err != nil {
+			return attr, false, unexpectedEOF(err)
+		}
+		var s []byte
+		switch {
+		case b == tokSwitchPage:
+			t.attrPage, err = t.readByte()
+		case b == tokStrI:
+			s, err = t.inlineString()
+		case b == tokStrT:
+			s, err = t.tableStringRef()
+		case b == tokEntity:
+			var r uint32
+			r, err = t.readInt()
+			s = utf8.AppendRune(nil, rune(r))
+		case b == tokOpaque:
+			s, err = t.opaque()
+		case b == tokExtI0 || b == tokExtI1 || b == tokExtI2 || b == tokExtT0 || b == tokExtT1 || b == tokExtT2 || b == tokExt0 || b == tokExt1 || b == tokExt2:
+			err = errExtension
+		case b >= 0x80:
+			v, found := t.pages[t.attrPage].Values[b]
+			if !found {
+				err = fmt.Errorf("wbxml: unknown attribute value 0x%02x in code page %d", b, t.attrPage)
+			}
+			s = []byte(v)
+		default:
+			/* #nosec */
+			t.r.UnreadByte()
+			attr.Value = string(value)
+			return attr, true, nil
+		}
+		if err != nil {
+			return attr, false, err
+		}
+		value = append(value, s...)
+	}
+}
+
+// readPI reads a processing instruction, which is encoded like an attribute.
+func (t *Tokenizer) readPI() error {
+	attr, ok, err := t.readAttr()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("wbxml: processing instruction without a target")
+	}
+	b, err := t.readByte()
+	if err != nil {
+		return err
+	}
+	if b != tokEnd {
+		return fmt.Errorf("wbxml: unexpected token 0x%02x", b)
+	}
+	t.queue = append(t.queue, xml.ProcInst{Target: attr.Name.Local, Inst: []byte(attr.Value)})
+	return nil
+}
+
+func (t *Tokenizer) readByte() (byte, error) {
+	b, err := t.r.ReadByte()
+	return b, unexpectedEOF(err)
+}
+
+// readInt reads a multi-byte unsigned integer.
+func (t *Tokenizer) readInt() (uint32, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		b, err := t.readByte()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("wbxml: integer overflows 32 bits")
+}
+
+// inlineString reads a null terminated string.
+func (t *Tokenizer) inlineString() ([]byte, error) {
+	s, err := t.r.ReadBytes(0)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return t.decode(s[:len(s)-1]), nil
+}
+
+// tableStringRef reads an index into the string table and returns the string
+// at that index.
+func (t *Tokenizer) tableStringRef() ([]byte, error) {
+	i, err := t.readInt()
+	if err != nil {
+		return nil, err
+	}
+	s, err := t.tableString(i)
+	return []byte(s), err
+}
+
+func (t *Tokenizer) tableString(i uint32) (string, error) {
+	if int64(i) >= int64(len(t.strtbl)) {
+		return "", fmt.Errorf("wbxml: string table index %d out of range", i)
+	}
+	s := t.strtbl[i:]
+	if end := bytes.IndexByte(s, 0); end >= 0 {
+		s = s[:end]
+	}
+	return string(t.decode(s)), nil
+}
+
+func (t *Tokenizer) opaque() ([]byte, error) {
+	n, err := t.readInt()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	_, err = io.CopyN(&buf, t.r, int64(n))
+	return buf.Bytes(), unexpectedEOF(err)
+}
+
+// decode converts a string in the document's character set to UTF-8.
+func (t *Tokenizer) decode(s []byte) []byte {
+	if t.header.Charset != charsetLatin1 {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	for _, c := range s {
+		out = utf8.AppendRune(out, rune(c))
+	}
+	return out
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
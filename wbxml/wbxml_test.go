@@ -0,0 +1,145 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package wbxml_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/wbxml"
+)
+
+var pages = map[byte]CodePage{
+	0: {
+		Tags: map[byte]xml.Name{
+			0x05: {Space: "AirSync:", Local: "Sync"},
+			0x06: {Space: "AirSync:", Local: "Status"},
+		},
+		Attrs:  map[byte]xml.Attr{0x05: {Name: xml.Name{Local: "href"}, Value: "http://"}},
+		Values: map[byte]string{0x85: ".com"},
+	},
+	1: {
+		Tags: map[byte]xml.Name{0x05: {Space: "Email:", Local: "Subject"}},
+	},
+}
+
+// header is version 1.3, a public identifier at index 0 of the string table,
+// UTF-8, and a 12 byte string table.
+var header = []byte("\x03\x00\x00\x6a\x0cpub\x00lit\x00val\x00")
+
+var tokenizerTestCases = [...]struct {
+	in   []byte
+	toks []xml.Token
+	err  error
+}{
+	0: {
+		in: []byte("\xc5" +
+			"\x05\x03x\x00\x85\x04\x04\x83\x08\x01" +
+			"\x46\x031\x00\x02\x81\x20\x01" +
+			"\x06" +
+			"\x00\x01\x45\xc3\x02hi\x83\x08\x01" +
+			"\x44\x04\x01" +
+			"\x01" +
+			"\x43\x04\x04\x03d\x00\x01"),
+		toks: []xml.Token{
+			xml.StartElement{
+				Name: xml.Name{Space: "AirSync:", Local: "Sync"},
+				Attr: []xml.Attr{
+					{Name: xml.Name{Local: "href"}, Value: "http://x.com"},
+					{Name: xml.Name{Local: "lit"}, Value: "val"},
+				},
+			},
+			xml.StartElement{Name: xml.Name{Space: "AirSync:", Local: "Status"}},
+			xml.CharData("1"),
+			xml.CharData(" "),
+			xml.EndElement{Name: xml.Name{Space: "AirSync:", Local: "Status"}},
+			xml.StartElement{Name: xml.Name{Space: "AirSync:", Local: "Status"}},
+			xml.EndElement{Name: xml.Name{Space: "AirSync:", Local: "Status"}},
+			xml.StartElement{Name: xml.Name{Space: "Email:", Local: "Subject"}},
+			xml.CharData("hi"),
+			xml.CharData("val"),
+			xml.EndElement{Name: xml.Name{Space: "Email:", Local: "Subject"}},
+			xml.StartElement{Name: xml.Name{Local: "lit"}},
+			xml.EndElement{Name: xml.Name{Local: "lit"}},
+			xml.EndElement{Name: xml.Name{Space: "AirSync:", Local: "Sync"}},
+			xml.ProcInst{Target: "lit", Inst: []byte("d")},
+		},
+	},
+	1: {in: []byte("\x07"), err: errors.New("wbxml: unknown tag 0x07 in code page 0")},
+	2: {in: []byte("\x45\x03a"), err: io.ErrUnexpectedEOF},
+	3: {in: []byte(""), err: io.ErrUnexpectedEOF},
+	4: {in: []byte("\x45\xc0"), err: errors.New("wbxml: extension tokens are not supported")},
+	5: {in: []byte("\x06\x06"), err: errors.New("wbxml: multiple root elements")},
+	6: {in: []byte("\x45\x83\x20"), err: errors.New("wbxml: string table index 32 out of range")},
+	7: {in: []byte("\x86\x09\x01"), err: errors.New("wbxml: unknown attribute 0x09 in code page 0")},
+}
+
+func TestTokenizer(t *testing.T) {
+	for i, tc := range tokenizerTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			r := NewTokenizer(bytes.NewReader(append(header[:len(header):len(header)], tc.in...)), pages)
+			var toks []xml.Token
+			var err error
+			for {
+				var tok xml.Token
+				tok, err = r.Token()
+				if err != nil {
+					break
+				}
+				toks = append(toks, tok)
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			switch {
+			case tc.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != nil && (err == nil || (!errors.Is(err, tc.err) && err.Error() != tc.err.Error())):
+				t.Fatalf("wrong error: want=%v, got=%v", tc.err, err)
+			case err != nil:
+				return
+			}
+			if !reflect.DeepEqual(toks, tc.toks) {
+				t.Errorf("wrong tokens:\nwant=%#v,\n got=%#v", tc.toks, toks)
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	r := NewTokenizer(bytes.NewReader([]byte("\x01\x81\x00\x04\x00\x45\x03\xe9\x00\x01")), pages)
+	h, err := r.Header()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Header{Version: 1, PublicID: 128, Charset: 4}
+	if h != want {
+		t.Errorf("wrong header: want=%+v, got=%+v", want, h)
+	}
+	// ISO-8859-1 strings are converted to UTF-8.
+	_, err = r.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tok, err := r.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := string(tok.(xml.CharData)); s != "é" {
+		t.Errorf("wrong text: want=é, got=%q", s)
+	}
+}
+
+func TestUnsupportedCharset(t *testing.T) {
+	_, err := NewTokenizer(bytes.NewReader([]byte("\x03\x01\x83\x68\x00")), pages).Token()
+	if err == nil || err.Error() != "wbxml: unsupported charset 488" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const xmlnsURL = "http://www.w3.org/2000/xmlns/"
+
+// WellFormednessError describes a part of a document that is not well-formed.
+type WellFormednessError struct {
+	Span Span
+	Msg  string
+}
+
+// Error returns a description of the error and where it occurred.
+func (e WellFormednessError) Error() string {
+	return fmt.Sprintf("xml: line %d, column %d: %s", e.Span.Start.Line, e.Span.Start.Col, e.Msg)
+}
+
+// Validate reads a document from r and returns the first way in which it is
+// not well-formed, or nil if it is well-formed.
+// Well-formedness includes the constraints of Namespaces in XML, so unbound
+// prefixes and invalid namespace declarations are also reported.
+// If r returns an error other than io.EOF, it is returned unchanged.
+func Validate(r io.Reader) error {
+	c := newWFChecker(r, true)
+	err := c.run()
+	if err != nil {
+		return err
+	}
+	if len(c.errs) > 0 {
+		return c.errs[0]
+	}
+	return nil
+}
+
+// ValidateAll is like Validate except that it continues after errors that do
+// not prevent the rest of the document from being tokenized and returns all
+// of them in the order they were found.
+// Syntax errors end the document, so at most one is returned and it is always
+// the last error.
+// The returned error is only non-nil if r returns an error other than io.EOF.
+func ValidateAll(r io.Reader) ([]WellFormednessError, error) {
+	c := newWFChecker(r, false)
+	err := c.run()
+	return c.errs, err
+}
+
+// recordingReader remembers the last error returned by a reader so that it
+// can be told apart from syntax errors.
+type recordingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+type wfElement struct {
+	name Name
+	span Span
+}
+
+type wfChecker struct {
+	src     *recordingReader
+	t       *Tokenizer
+	first   bool
+	errs    []WellFormednessError
+	stack   []wfElement
+	scopes  []map[string]string
+	root    bool
+	doctype bool
+}
+
+func newWFChecker(r io.Reader, first bool) *wfChecker {
+	src := &recordingReader{r: r}
+	t := NewTokenizer(src)
+	t.noResolve = true
+	t.SourceTokens = true
+	t.DecodeDeclaration = true
+	t.SkipAttrDefaults = true
+	return &wfChecker{
+		src:    src,
+		t:      t,
+		first:  first,
+		scopes: []map[string]string{{"xml": xmlURL, "xmlns": xmlnsURL}},
+	}
+}
+
+func (c *wfChecker) report(span Span, format string, v ...interface{}) {
+	c.errs = append(c.errs, WellFormednessError{Span: span, Msg: fmt.Sprintf(format, v...)})
+}
+
+// done reports whether checking should stop.
+func (c *wfChecker) done() bool {
+	return c.first && len(c.errs) > 0
+}
+
+func (c *wfChecker) run() error {
+	for !c.done() {
+		tok, err := c.t.Token()
+		if tok != nil && err == io.EOF {
+			// Only text may be ended by the end of the input, other tokens
+			// returned with io.EOF were truncated.
+			if _, ok := tok.(SourceToken).Token.(CharData); !ok {
+				err = errEarlyEOF
+			}
+		}
+		if tok != nil && (err == nil || err == io.EOF) {
+			c.check(tok.(SourceToken))
+		}
+		switch {
+		case err == io.EOF:
+			c.end()
+			return nil
+		case err != nil && c.src.err != nil && errors.Is(err, c.src.err):
+			return err
+		case err != nil:
+			pos := c.t.pos()
+			var msg string
+			if se, ok := err.(*SyntaxError); ok {
+				msg = se.Msg
+			} else {
+				msg = strings.TrimPrefix(err.Error(), "xml: ")
+			}
+			c.report(Span{Start: pos, End: pos}, "%s", msg)
+			return nil
+		}
+	}
+	return nil
+}
+
+// end checks the state of the document once all tokens have been read.
+func (c *wfChecker) end() {
+	for i := len(c.stack) - 1; i >= 0 && !c.done(); i-- {
+		c.report(c.stack[i].span, "element %s is not closed", rawName(c.stack[i].name))
+	}
+	if !c.root && !c.done() {
+		pos := c.t.pos()
+		c.report(Span{Start: pos, End: pos}, "document has no root element")
+	}
+}
+
+func (c *wfChecker) check(st SourceToken) {
+	span := c.t.Span()
+	switch tok := st.Token.(type) {
+	case StartElement:
+		c.start(tok, span)
+	case EndElement:
+		c.endElement(tok, span)
+	case CharData:
+		c.chars(tok, span)
+		if len(c.stack) == 0 && !onlySpace(tok) {
+			c.report(span, "character data outside of the root element")
+		}
+		if !bytes.HasPrefix(st.Source, []byte("<![CDATA[")) && bytes.Contains(st.Source, []byte("]]>")) {
+			c.report(span, "]]> is not allowed in character data")
+		}
+	case Comment:
+		c.chars(tok, span)
+		body := st.Source[len("<!--") : len(st.Source)-len("-->")]
+		if bytes.Contains(body, []byte("--")) || bytes.HasSuffix(body, []byte("-")) {
+			c.report(span, "-- is not allowed in comments")
+		}
+	case ProcInst:
+		c.chars(tok.Inst, span)
+		if !isName(tok.Target) || strings.Contains(tok.Target, ":") {
+			c.report(span, "invalid processing instruction target %q", tok.Target)
+		} else if strings.EqualFold(tok.Target, "xml") {
+			c.report(span, "reserved processing instruction target %q", tok.Target)
+		}
+	case Directive:
+		switch {
+		case !bytes.HasPrefix(tok, []byte("DOCTYPE")):
+			c.report(span, "unexpected directive outside of the DOCTYPE")
+		case c.doctype:
+			c.report(span, "more than one DOCTYPE")
+		case c.root:
+			c.report(span, "DOCTYPE after the root element")
+		}
+		c.doctype = true
+	}
+}
+
+// chars reports the first character in b that is not allowed in XML.
+func (c *wfChecker) chars(b []byte, span Span) {
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if (r == utf8.RuneError && size == 1) || !isInCharacterRange(r) {
+			c.report(span, "invalid character %U", r)
+			return
+		}
+		b = b[size:]
+	}
+}
+
+func (c *wfChecker) start(start StartElement, span Span) {
+	if len(c.stack) == 0 {
+		if c.root {
+			c.report(span, "more than one root element")
+		}
+		c.root = true
+	}
+	c.stack = append(c.stack, wfElement{name: start.Name, span: span})
+
+	scope := c.scopes[len(c.scopes)-1]
+	copied := false
+	for _, a := range start.Attr {
+		var prefix string
+		switch {
+		case a.Name.Space == "xmlns":
+			prefix = a.Name.Local
+		case a.Name.Space == "" && a.Name.Local == "xmlns":
+		default:
+			continue
+		}
+		switch {
+		case prefix == "xmlns":
+			c.report(span, "the xmlns prefix must not be declared")
+		case prefix == "xml" && a.Value != xmlURL:
+			c.report(span, "the xml prefix must not be bound to %q", a.Value)
+		case prefix != "xml" && (a.Value == xmlURL || a.Value == xmlnsURL):
+			c.report(span, "namespace %q must not be declared", a.Value)
+		case prefix != "" && a.Value == "":
+			c.report(span, "prefix %s must not be bound to the empty namespace", prefix)
+		}
+		if prefix == "" {
+			continue
+		}
+		if !copied {
+			scope = copyPrefixes(scope)
+			copied = true
+		}
+		scope[prefix] = a.Value
+	}
+	c.scopes = append(c.scopes, scope)
+
+	c.name(start.Name, span)
+	seen := make(map[Name]bool, len(start.Attr))
+	for _, a := range start.Attr {
+		c.chars([]byte(a.Value), span)
+		if seen[a.Name] {
+			c.report(span, "duplicate attribute %s", rawName(a.Name))
+			continue
+		}
+		seen[a.Name] = true
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") {
+			continue
+		}
+		c.name(a.Name, span)
+	}
+	// Attributes with different prefixes may still have the same expanded name.
+	expanded := make(map[Name]string, len(start.Attr))
+	for _, a := range start.Attr {
+		if a.Name.Space == "" || a.Name.Space == "xmlns" {
+			continue
+		}
+		space, ok := scope[a.Name.Space]
+		if !ok {
+			continue
+		}
+		name := Name{Space: space, Local: a.Name.Local}
+		if other, dup := expanded[name]; dup && other != a.Name.Space {
+			c.report(span, "attributes %s and %s have the same expanded name", rawName(Name{Space: other, Local: a.Name.Local}), rawName(a.Name))
+		}
+		expanded[name] = a.Name.Space
+	}
+}
+
+// name reports invalid and unbound qualified names.
+func (c *wfChecker) name(name Name, span Span) {
+	if !isNCName(name.Local) || (name.Space != "" && !isNCName(name.Space)) {
+		c.report(span, "invalid name %q", rawName(name))
+		return
+	}
+	if name.Space == "" {
+		return
+	}
+	if _, ok := c.scopes[len(c.scopes)-1][name.Space]; !ok || name.Space == "xmlns" {
+		c.report(span, "unbound prefix %s", name.Space)
+	}
+}
+
+func (c *wfChecker) endElement(end EndElement, span Span) {
+	if len(c.stack) == 0 {
+		c.report(span, "unexpected end element %s", rawName(end.Name))
+		return
+	}
+	open := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	if open.name != end.Name {
+		c.report(span, "end element %s does not match start element %s", rawName(end.Name), rawName(open.name))
+	}
+}
+
+func copyPrefixes(scope map[string]string) map[string]string {
+	m := make(map[string]string, len(scope)+1)
+	for k, v := range scope {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	. "mellium.im/xml"
+)
+
+var validateTestCases = [...]struct {
+	in   string
+	errs []string
+}{
+	0: {
+		in: `<?xml version="1.0"?><!DOCTYPE a><!-- c --><a xmlns="urn:a" xmlns:b="urn:b" b:c="d"><b:e/><![CDATA[x]]></a>`,
+	},
+	1: {
+		in:   ``,
+		errs: []string{"xml: line 1, column 1: document has no root element"},
+	},
+	2: {
+		in: `<a><b></a></b>`,
+		errs: []string{
+			"xml: line 1, column 7: end element a does not match start element b",
+			"xml: line 1, column 11: end element b does not match start element a",
+		},
+	},
+	3: {
+		in: `text<a/><b/>`,
+		errs: []string{
+			"xml: line 1, column 1: character data outside of the root element",
+			"xml: line 1, column 9: more than one root element",
+		},
+	},
+	4: {
+		in: `<a><b>`,
+		errs: []string{
+			"xml: line 1, column 4: element b is not closed",
+			"xml: line 1, column 1: element a is not closed",
+		},
+	},
+	5: {
+		in: `<p:a q:b="" c="1" c="2" xmlns:r=""/>`,
+		errs: []string{
+			"xml: line 1, column 1: prefix r must not be bound to the empty namespace",
+			"xml: line 1, column 1: unbound prefix p",
+			"xml: line 1, column 1: unbound prefix q",
+			"xml: line 1, column 1: duplicate attribute c",
+		},
+	},
+	6: {
+		in: `<a xmlns:p="urn:x" xmlns:q="urn:x" p:b="" q:b="" xmlns:xml="urn:y"/>`,
+		errs: []string{
+			`xml: line 1, column 1: the xml prefix must not be bound to "urn:y"`,
+			"xml: line 1, column 1: attributes p:b and q:b have the same expanded name",
+		},
+	},
+	7: {
+		in: "<a><!-- a -- b --><?XML x?>]]>\x01</a>",
+		errs: []string{
+			"xml: line 1, column 4: -- is not allowed in comments",
+			`xml: line 1, column 19: reserved processing instruction target "XML"`,
+			"xml: line 1, column 28: invalid character U+0001",
+			"xml: line 1, column 28: ]]> is not allowed in character data",
+		},
+	},
+	8: {
+		in: `<a></a><!DOCTYPE a>`,
+		errs: []string{
+			"xml: line 1, column 8: DOCTYPE after the root element",
+		},
+	},
+	9: {
+		in: `<a></b`,
+		errs: []string{
+			"xml: line 1, column 7: early EOF",
+		},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for i, tc := range validateTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			errs, err := ValidateAll(strings.NewReader(tc.in))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, err := range errs {
+				got = append(got, err.Error())
+			}
+			if !reflect.DeepEqual(got, tc.errs) {
+				t.Errorf("wrong errors:\nwant=%q,\n got=%q", tc.errs, got)
+			}
+			err = Validate(strings.NewReader(tc.in))
+			switch {
+			case len(tc.errs) == 0 && err != nil:
+				t.Errorf("unexpected error from Validate: %v", err)
+			case len(tc.errs) > 0 && (err == nil || err.Error() != tc.errs[0]):
+				t.Errorf("wrong error from Validate: want=%q, got=%v", tc.errs[0], err)
+			}
+		})
+	}
+}
+
+func TestValidateReadError(t *testing.T) {
+	err := Validate(iotest.TimeoutReader(strings.NewReader("<a>")))
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Errorf("wrong error: want=%v, got=%v", iotest.ErrTimeout, err)
+	}
+}
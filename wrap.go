@@ -0,0 +1,68 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"io"
+)
+
+// Wrap returns a TokenReader that returns start, followed by all tokens read
+// from r, followed by the end element matching start.
+func Wrap(r TokenReader, start StartElement) TokenReader {
+	return &wrapReader{r: r, start: start}
+}
+
+type wrapReader struct {
+	r     TokenReader
+	start StartElement
+	state uint8
+}
+
+func (w *wrapReader) Token() (Token, error) {
+	switch w.state {
+	case 0:
+		w.state++
+		return w.start.Copy(), nil
+	case 1:
+		tok, err := w.r.Token()
+		if err != io.EOF {
+			return tok, err
+		}
+		w.state++
+		if tok != nil {
+			return tok, nil
+		}
+		fallthrough
+	case 2:
+		w.state++
+		return w.start.End(), nil
+	}
+	return nil, io.EOF
+}
+
+// Unwrap reads from r until it finds the first start element, skipping any
+// character data, comments, processing instructions, and directives before it.
+// It returns the start element and a TokenReader over the element's children.
+// Reading the returned TokenReader to io.EOF consumes the matching end element.
+//
+// If r reaches io.EOF or an end element before a start element is found,
+// io.ErrUnexpectedEOF or a SyntaxError is returned respectively.
+func Unwrap(r TokenReader) (TokenReader, StartElement, error) {
+	for {
+		tok, err := r.Token()
+		switch t := unwrapSource(tok).(type) {
+		case StartElement:
+			return Inner(r), t, nil
+		case EndElement:
+			return nil, StartElement{}, &SyntaxError{Msg: "unexpected end element </" + t.Name.Local + "> while unwrapping"}
+		}
+		switch {
+		case err == io.EOF:
+			return nil, StartElement{}, io.ErrUnexpectedEOF
+		case err != nil:
+			return nil, StartElement{}, err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestWrap(t *testing.T) {
+	start := StartElement{Name: Name{Space: "jabber:client", Local: "message"}, Attr: []Attr{{Name: Name{Local: "to"}, Value: "me@example.net"}}}
+	toks, err := readAll(Wrap(NewTokenizer(strings.NewReader(`<body>hi</body>`)), start))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		start,
+		StartElement{Name: Name{Local: "body"}, Attr: []Attr{}},
+		CharData("hi"),
+		EndElement{Name: Name{Local: "body"}},
+		start.End(),
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+}
+
+func TestUnwrap(t *testing.T) {
+	td := NewTokenizer(strings.NewReader(`<?a b?> <message to="me"><body>hi</body></message>after`))
+	inner, start, err := Unwrap(td)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantStart := StartElement{Name: Name{Local: "message"}, Attr: []Attr{{Name: Name{Local: "to"}, Value: "me"}}}
+	if !reflect.DeepEqual(start, wantStart) {
+		t.Fatalf("wrong start element: want=%+v, got=%+v", wantStart, start)
+	}
+	toks, err := readAll(inner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		StartElement{Name: Name{Local: "body"}, Attr: []Attr{}},
+		CharData("hi"),
+		EndElement{Name: Name{Local: "body"}},
+	}
+	if !reflect.DeepEqual(toks, want) {
+		t.Fatalf("wrong tokens:\nwant=%+v,\n got=%+v", want, toks)
+	}
+	tok, _ := td.Token()
+	if !reflect.DeepEqual(tok, CharData("after")) {
+		t.Fatalf("wrong token after unwrapped element: %+v", tok)
+	}
+}
+
+func TestUnwrapErrors(t *testing.T) {
+	_, _, err := Unwrap(NewTokenizer(strings.NewReader(`foo`)))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("wrong error for missing element: want=%v, got=%v", io.ErrUnexpectedEOF, err)
+	}
+	_, _, err = Unwrap(NewTokenizer(strings.NewReader(`</foo>`)))
+	if _, ok := err.(*SyntaxError); !ok {
+		t.Errorf("wrong error for end element: want=*SyntaxError, got=%T(%[1]v)", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// TokenWriter is anything that can encode tokens to an XML stream, such as an
+// Encoder.
+type TokenWriter interface {
+	EncodeToken(t Token) error
+	Flush() error
+}
+
+// WrapEncoder returns a TokenWriter that writes tokens to e after converting
+// the token types defined by this package into ones that e understands.
+// Declarations are encoded as processing instructions, CDATA is encoded as
+// character data, and SourceTokens are encoded as the token they carry.
+func WrapEncoder(e *Encoder) TokenWriter {
+	return encoderWriter{e: e}
+}
+
+// NewTokenWriter returns a TokenWriter that encodes tokens to w.
+// It is equivalent to wrapping an Encoder that writes to w with WrapEncoder.
+func NewTokenWriter(w io.Writer) TokenWriter {
+	return WrapEncoder(xml.NewEncoder(w))
+}
+
+type encoderWriter struct {
+	e *Encoder
+}
+
+func (w encoderWriter) EncodeToken(t Token) error {
+	switch tok := unwrapSource(t).(type) {
+	case Declaration:
+		return w.e.EncodeToken(tok.ProcInst())
+	case CDATA:
+		return w.e.EncodeToken(CharData(tok))
+	default:
+		return w.e.EncodeToken(tok)
+	}
+}
+
+func (w encoderWriter) Flush() error {
+	return w.e.Flush()
+}
@@ -0,0 +1,51 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xml_test
+
+import (
+	"strings"
+	"testing"
+
+	. "mellium.im/xml"
+)
+
+func TestNewTokenWriter(t *testing.T) {
+	const in = `<?xml version="1.0" encoding="UTF-8"?><a><b c="d">foo</b><!-- e --></a>`
+	td := NewTokenizer(strings.NewReader(in))
+	td.DecodeDeclaration = true
+	td.SourceTokens = true
+
+	var buf strings.Builder
+	w := NewTokenWriter(&buf)
+	toks, err := readAll(TeeTokenReader(td, w))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := toks[0].(SourceToken).Token.(Declaration); !ok {
+		t.Fatalf("expected first token to be a declaration, got %T", toks[0].(SourceToken).Token)
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	if s := buf.String(); s != in {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", in, s)
+	}
+}
+
+func TestWrapEncoderCDATA(t *testing.T) {
+	var buf strings.Builder
+	w := NewTokenWriter(&buf)
+	err := w.EncodeToken(CDATA("<a>"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing: %v", err)
+	}
+	const out = `&lt;a&gt;`
+	if s := buf.String(); s != out {
+		t.Fatalf("wrong output:\nwant=%s,\n got=%s", out, s)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmljson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"mellium.im/xml"
+)
+
+// FromJSON returns a token reader that converts JSON read from r into XML.
+// The tokens are produced as the JSON is read, so to build an element tree use
+// the result with a package such as mellium.im/xml/dom.
+//
+// The members of a top level object become top level elements, and any other
+// top level value is converted as if it were the value of a member named by
+// Item.
+// Arrays become repeated elements with the name of the member that contains
+// them, and strings, numbers, and booleans become text.
+// Null values and empty strings result in empty elements.
+//
+// Members whose names start with AttrPrefix become attributes and must have
+// values that are not objects or arrays.
+// Because the start element is returned before the members that follow it are
+// read, attributes must appear before any other members of an object.
+// Members named TextKey become text.
+func (c Conventions) FromJSON(r io.Reader) xml.TokenReader {
+	d := json.NewDecoder(r)
+	d.UseNumber()
+	return &jsonReader{c: c, d: d}
+}
+
+type frameKind int
+
+const (
+	objectFrame frameKind = iota
+	arrayFrame
+)
+
+// frame is an object or array that is being converted.
+type frame struct {
+	kind frameKind
+
+	// name is the name of the element that an object is converted to, or of
+	// the elements that items of an array are converted to.
+	name xml.Name
+
+	// top is true for the members of a top level object, which are not inside
+	// of an element.
+	top bool
+
+	// start is the start element of an object that has not been returned yet
+	// because attributes may still be added to it.
+	start *xml.StartElement
+
+	// end is the name of an element that must be closed when an array ends.
+	end *xml.Name
+}
+
+type jsonReader struct {
+	c     Conventions
+	d     *json.Decoder
+	stack []frame
+	queue []xml.Token
+	err   error
+}
+
+func (j *jsonReader) Token() (xml.Token, error) {
+	for len(j.queue) == 0 && j.err == nil {
+		j.err = j.step()
+	}
+	if len(j.queue) > 0 {
+		tok := j.queue[0]
+		j.queue = j.queue[1:]
+		return tok, nil
+	}
+	return nil, j.err
+}
+
+func (j *jsonReader) emit(toks ...xml.Token) {
+	j.queue = append(j.queue, toks...)
+}
+
+// flushStart emits the start element of the innermost object if it has not
+// yet been emitted.
+func (j *jsonReader) flushStart() {
+	f := &j.stack[len(j.stack)-1]
+	if f.start != nil {
+		j.emit(*f.start)
+		f.start = nil
+	}
+}
+
+func (j *jsonReader) next() (json.Token, error) {
+	tok, err := j.d.Token()
+	if err == io.EOF && len(j.stack) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return tok, err
+}
+
+// step reads the next JSON token and queues any resulting XML tokens.
+func (j *jsonReader) step() error {
+	tok, err := j.next()
+	if err != nil {
+		return err
+	}
+	if len(j.stack) == 0 {
+		if tok == json.Delim('{') {
+			j.stack = append(j.stack, frame{kind: objectFrame, top: true})
+			return nil
+		}
+		return j.value(j.c.item(), tok, false)
+	}
+
+	f := &j.stack[len(j.stack)-1]
+	switch f.kind {
+	case arrayFrame:
+		if tok == json.Delim(']') {
+			if f.end != nil {
+				j.emit(xml.EndElement{Name: *f.end})
+			}
+			j.stack = j.stack[:len(j.stack)-1]
+			return nil
+		}
+		return j.value(f.name, tok, true)
+	}
+
+	if tok == json.Delim('}') {
+		j.flushStart()
+		if !f.top {
+			j.emit(xml.EndElement{Name: f.name})
+		}
+		j.stack = j.stack[:len(j.stack)-1]
+		return nil
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return fmt.Errorf("xmljson: unexpected %v", tok)
+	}
+	if tok, err = j.next(); err != nil {
+		return err
+	}
+	prefix := j.c.attrPrefix()
+	switch {
+	case !f.top && key == j.c.textKey():
+		text, ok := scalar(tok)
+		if !ok {
+			return fmt.Errorf("xmljson: text member %q must not be an object or array", key)
+		}
+		j.flushStart()
+		if text != "" {
+			j.emit(xml.CharData(text))
+		}
+		return nil
+	case !f.top && strings.HasPrefix(key, prefix):
+		if f.start == nil {
+			return fmt.Errorf("xmljson: attribute %q must appear before other members", key)
+		}
+		value, ok := scalar(tok)
+		if !ok {
+			return fmt.Errorf("xmljson: attribute %q must not be an object or array", key)
+		}
+		f.start.Attr = append(f.start.Attr, xml.Attr{
+			Name:  j.c.name(strings.TrimPrefix(key, prefix)),
+			Value: value,
+		})
+		return nil
+	}
+	j.flushStart()
+	return j.value(j.c.name(key), tok, false)
+}
+
+// value converts the value of a member or array item whose first token has
+// been read.
+func (j *jsonReader) value(name xml.Name, tok json.Token, inArray bool) error {
+	switch tok {
+	case json.Delim('{'):
+		j.stack = append(j.stack, frame{
+			kind:  objectFrame,
+			name:  name,
+			start: &xml.StartElement{Name: name},
+		})
+		return nil
+	case json.Delim('['):
+		if !inArray {
+			j.stack = append(j.stack, frame{kind: arrayFrame, name: name})
+			return nil
+		}
+		j.emit(xml.StartElement{Name: name})
+		end := name
+		j.stack = append(j.stack, frame{kind: arrayFrame, name: j.c.item(), end: &end})
+		return nil
+	}
+	text, ok := scalar(tok)
+	if !ok {
+		return fmt.Errorf("xmljson: unexpected %v", tok)
+	}
+	j.emit(xml.StartElement{Name: name})
+	if text != "" {
+		j.emit(xml.CharData(text))
+	}
+	j.emit(xml.EndElement{Name: name})
+	return nil
+}
+
+// scalar returns the text of a JSON token that is not a delimiter.
+func scalar(tok json.Token) (string, bool) {
+	switch tok := tok.(type) {
+	case nil:
+		return "", true
+	case string:
+		return tok, true
+	case json.Number:
+		return tok.String(), true
+	case bool:
+		if tok {
+			return "true", true
+		}
+		return "false", true
+	}
+	return "", false
+}
+
+// sanitizeName replaces any characters in s that are not allowed in an XML
+// name (excluding ":") with "_", adding a leading "_" if s does not start with
+// a character that is allowed at the start of a name.
+func sanitizeName(s string) string {
+	if s == "" {
+		return "_"
+	}
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case isNameStart(r), i > 0 && isNameRune(r):
+			b.WriteRune(r)
+		case i == 0 && isNameRune(r):
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameRune(r rune) bool {
+	return isNameStart(r) || r == '-' || r == '.' || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
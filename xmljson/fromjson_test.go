@@ -0,0 +1,119 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmljson_test
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/xmljson"
+)
+
+var fromJSONTestCases = [...]struct {
+	in  string
+	c   Conventions
+	out string
+	err error
+}{
+	0: {in: `{}`, out: ``},
+	1: {in: `{"a":""}`, out: `<a></a>`},
+	2: {in: `{"a":"text"}`, out: `<a>text</a>`},
+	3: {in: `{"a":{"@b":"1","#text":"<&>"}}`, out: `<a b="1">&lt;&amp;&gt;</a>`},
+	4: {
+		in:  `{"feed":{"@lang":"en","entry":["a",{"@id":"2","#text":"b"}]}}`,
+		out: `<feed lang="en"><entry>a</entry><entry id="2">b</entry></feed>`,
+	},
+	5: {
+		in:  `{"a":{"n":1.5,"t":true,"f":false,"z":null,"e":[]}}`,
+		out: `<a><n>1.5</n><t>true</t><f>false</f><z></z></a>`,
+	},
+	6: {in: `"text"`, out: `<item>text</item>`},
+	7: {
+		in:  `{"a":[[1,2],[]]}`,
+		out: `<a><item>1</item><item>2</item></a><a></a>`,
+	},
+	8: {
+		in:  `{"1st key":"","":""}`,
+		out: `<_1st_key></_1st_key><_></_>`,
+	},
+	9: {
+		in: `[{"-x":"1","$":"v","k":"w"}]`,
+		c: Conventions{
+			AttrPrefix: "-",
+			TextKey:    "$",
+			Item:       "row",
+			Name: func(key string) xml.Name {
+				return xml.Name{Local: strings.ToUpper(key)}
+			},
+		},
+		out: `<row X="1">v<K>w</K></row>`,
+	},
+	10: {in: `{"a":{"b":"","@c":""}}`, err: errors.New(`xmljson: attribute "@c" must appear before other members`)},
+	11: {in: `{"a":{"@c":{}}}`, err: errors.New(`xmljson: attribute "@c" must not be an object or array`)},
+	12: {in: `{"a":{"#text":[]}}`, err: errors.New(`xmljson: text member "#text" must not be an object or array`)},
+	13: {in: `{"a":{`, err: io.ErrUnexpectedEOF},
+	14: {in: `{"@a":"","#text":""}`, out: `<_a></_a><_text></_text>`},
+}
+
+func TestFromJSON(t *testing.T) {
+	for i, tc := range fromJSONTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var b strings.Builder
+			e := xml.NewEncoder(&b)
+			r := tc.c.FromJSON(strings.NewReader(tc.in))
+			var err error
+			for {
+				var tok xml.Token
+				tok, err = r.Token()
+				if err != nil {
+					break
+				}
+				if err = e.EncodeToken(tok); err != nil {
+					t.Fatalf("error encoding token: %v", err)
+				}
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			switch {
+			case tc.err == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.err != nil && (err == nil || (err.Error() != tc.err.Error() && !errors.Is(err, tc.err))):
+				t.Fatalf("wrong error: want=%v, got=%v", tc.err, err)
+			case err != nil:
+				return
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("error flushing: %v", err)
+			}
+			if out := b.String(); out != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for i, tc := range toJSONTestCases {
+		// Custom key functions do not have an inverse.
+		if tc.err != nil || tc.c.Key != nil {
+			continue
+		}
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var b strings.Builder
+			err := tc.c.ToJSON(&b, tc.c.FromJSON(strings.NewReader(tc.out)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out := b.String(); out != tc.out {
+				t.Errorf("round trip changed output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmljson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// ToMap reads tokens from r until io.EOF and returns a map with an entry for
+// each top level element.
+// To convert a single element pass a reader that returns only that element,
+// such as the result of xml.Wrap(xml.Inner(r), start).
+//
+// Elements are converted in the same way as by ToJSON, with elements becoming
+// strings or maps of type map[string]interface{} and repeated elements
+// becoming slices of type []interface{}.
+// Unlike ToJSON, elements with the same name are grouped into a slice even if
+// they are not adjacent.
+func (c Conventions) ToMap(r xml.TokenReader) (map[string]interface{}, error) {
+	j := &jsonWriter{c: c, r: r}
+	m := make(map[string]interface{})
+	for {
+		tok, err := j.next()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			v, err := j.mapValue(tok)
+			if err != nil {
+				return nil, err
+			}
+			c.add(m, tok.Name, v)
+		case xml.EndElement:
+			return nil, fmt.Errorf("xmljson: unexpected end element </%s>", tok.Name.Local)
+		}
+	}
+}
+
+// add sets the value of an element in m, creating a slice if an element with
+// the same name has already been added.
+func (c Conventions) add(m map[string]interface{}, name xml.Name, v interface{}) {
+	key := c.key(name)
+	switch old := m[key].(type) {
+	case nil:
+		if c.array(name) {
+			v = []interface{}{v}
+		}
+		m[key] = v
+	case []interface{}:
+		m[key] = append(old, v)
+	default:
+		m[key] = []interface{}{old, v}
+	}
+}
+
+// mapValue returns the value of an element whose start element has been read.
+func (j *jsonWriter) mapValue(start xml.StartElement) (interface{}, error) {
+	var text strings.Builder
+	m := make(map[string]interface{})
+	isMap := hasAttrs(start)
+	for _, a := range start.Attr {
+		if !isNamespaceDecl(a.Name) {
+			m[j.c.attrPrefix()+j.c.key(a.Name)] = a.Value
+		}
+	}
+	for {
+		tok, err := j.nextInElement()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text.Write(tok)
+		case xml.StartElement:
+			isMap = true
+			v, err := j.mapValue(tok)
+			if err != nil {
+				return nil, err
+			}
+			j.c.add(m, tok.Name, v)
+		case xml.EndElement:
+			s := text.String()
+			if !isMap {
+				return s, nil
+			}
+			if strings.TrimSpace(s) != "" {
+				m[j.c.textKey()] = s
+			}
+			return m, nil
+		}
+	}
+}
+
+// FromMap writes the entries of m to w as elements using the same conventions
+// as FromJSON.
+// Because maps are not ordered, attributes and elements are written in order
+// sorted by their keys and text is written after any child elements.
+//
+// Values may be maps of type map[string]interface{}, slices of type
+// []interface{}, strings, booleans, numbers (including json.Number), or nil.
+// Flush is not called on w.
+func (c Conventions) FromMap(w xml.TokenWriter, m map[string]interface{}) error {
+	for _, key := range sortedKeys(m) {
+		err := c.encodeValue(w, c.name(key), m[key], false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Conventions) encodeValue(w xml.TokenWriter, name xml.Name, v interface{}, inArray bool) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return c.encodeMap(w, name, v)
+	case []interface{}:
+		itemName := name
+		if inArray {
+			err := w.EncodeToken(xml.StartElement{Name: name})
+			if err != nil {
+				return err
+			}
+			itemName = c.item()
+		}
+		for _, item := range v {
+			err := c.encodeValue(w, itemName, item, true)
+			if err != nil {
+				return err
+			}
+		}
+		if inArray {
+			return w.EncodeToken(xml.EndElement{Name: name})
+		}
+		return nil
+	}
+	text, err := mapScalar(v)
+	if err != nil {
+		return fmt.Errorf("xmljson: element %q: %w", name.Local, err)
+	}
+	err = w.EncodeToken(xml.StartElement{Name: name})
+	if err != nil {
+		return err
+	}
+	if text != "" {
+		err = w.EncodeToken(xml.CharData(text))
+		if err != nil {
+			return err
+		}
+	}
+	return w.EncodeToken(xml.EndElement{Name: name})
+}
+
+func (c Conventions) encodeMap(w xml.TokenWriter, name xml.Name, m map[string]interface{}) error {
+	prefix, textKey := c.attrPrefix(), c.textKey()
+	keys := sortedKeys(m)
+	start := xml.StartElement{Name: name}
+	for _, key := range keys {
+		if key == textKey || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		value, err := mapScalar(m[key])
+		if err != nil {
+			return fmt.Errorf("xmljson: attribute %q: %w", key, err)
+		}
+		start.Attr = append(start.Attr, xml.Attr{
+			Name:  c.name(strings.TrimPrefix(key, prefix)),
+			Value: value,
+		})
+	}
+	err := w.EncodeToken(start)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if key == textKey || strings.HasPrefix(key, prefix) {
+			continue
+		}
+		err = c.encodeValue(w, c.name(key), m[key], false)
+		if err != nil {
+			return err
+		}
+	}
+	if v, ok := m[textKey]; ok {
+		text, err := mapScalar(v)
+		if err != nil {
+			return fmt.Errorf("xmljson: text member %q: %w", textKey, err)
+		}
+		if text != "" {
+			err = w.EncodeToken(xml.CharData(text))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return w.EncodeToken(xml.EndElement{Name: name})
+}
+
+// mapScalar returns the text of a value that is not a map or slice.
+func mapScalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", v)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
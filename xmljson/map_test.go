@@ -0,0 +1,128 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmljson_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/xmljson"
+)
+
+var toMapTestCases = [...]struct {
+	in  string
+	c   Conventions
+	out map[string]interface{}
+	err error
+}{
+	0: {in: ``, out: map[string]interface{}{}},
+	1: {in: `<a>text</a>`, out: map[string]interface{}{"a": "text"}},
+	2: {
+		in: `<a b="1"><c>1</c><d/><c>2</c>text</a>`,
+		out: map[string]interface{}{"a": map[string]interface{}{
+			"@b":    "1",
+			"c":     []interface{}{"1", "2"},
+			"d":     "",
+			"#text": "text",
+		}},
+	},
+	3: {
+		in: "<a>\n\t<b/>\n</a>",
+		c:  Conventions{Array: func(n xml.Name) bool { return n.Local == "b" }},
+		out: map[string]interface{}{"a": map[string]interface{}{
+			"b": []interface{}{""},
+		}},
+	},
+	4: {in: `<a><b>`, err: io.ErrUnexpectedEOF},
+}
+
+func TestToMap(t *testing.T) {
+	for i, tc := range toMapTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			m, err := tc.c.ToMap(xml.NewTokenizer(strings.NewReader(tc.in)))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("unexpected error: want=%v, got=%v", tc.err, err)
+			}
+			if !reflect.DeepEqual(m, tc.out) {
+				t.Errorf("wrong output:\nwant=%#v,\n got=%#v", tc.out, m)
+			}
+		})
+	}
+}
+
+var fromMapTestCases = [...]struct {
+	in  map[string]interface{}
+	out string
+	err string
+}{
+	0: {in: map[string]interface{}{}},
+	1: {
+		in: map[string]interface{}{"a": map[string]interface{}{
+			"#text": "text",
+			"c":     []interface{}{1, 2.5, true, nil, json.Number("3")},
+			"@z":    "2",
+			"@b":    1,
+			"d":     []interface{}{[]interface{}{"x"}},
+		}},
+		out: `<a b="1" z="2"><c>1</c><c>2.5</c><c>true</c><c></c><c>3</c><d><item>x</item></d>text</a>`,
+	},
+	2: {
+		in:  map[string]interface{}{"a": struct{}{}},
+		err: `xmljson: element "a": unsupported value of type struct {}`,
+	},
+	3: {
+		in:  map[string]interface{}{"a": map[string]interface{}{"@b": []interface{}{}}},
+		err: `xmljson: attribute "@b": unsupported value of type []interface {}`,
+	},
+}
+
+func TestFromMap(t *testing.T) {
+	for i, tc := range fromMapTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var b strings.Builder
+			e := xml.NewEncoder(&b)
+			err := Conventions{}.FromMap(e, tc.in)
+			switch {
+			case err == nil && tc.err != "":
+				t.Fatalf("expected error %q", tc.err)
+			case err != nil && err.Error() != tc.err:
+				t.Fatalf("wrong error: want=%q, got=%q", tc.err, err)
+			case err != nil:
+				return
+			}
+			if err = e.Flush(); err != nil {
+				t.Fatalf("error flushing: %v", err)
+			}
+			if out := b.String(); out != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+		})
+	}
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	const in = `<a b="1"><c>1</c><c>2</c><d><e>x</e></d>text</a>`
+	m, err := Conventions{}.ToMap(xml.NewTokenizer(strings.NewReader(in)))
+	if err != nil {
+		t.Fatalf("error converting to map: %v", err)
+	}
+	var b strings.Builder
+	e := xml.NewEncoder(&b)
+	if err = (Conventions{}).FromMap(e, m); err != nil {
+		t.Fatalf("error converting from map: %v", err)
+	}
+	if err = e.Flush(); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+	if out := b.String(); out != in {
+		t.Errorf("wrong output:\nwant=%s,\n got=%s", in, out)
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package xmljson converts between XML and JSON.
+//
+// Elements become JSON object members named after the element.
+// An element with no attributes and no child elements becomes a string
+// containing its text, any other element becomes an object.
+// Attributes become members named with a prefix ("@" by default), and the
+// text of an element that is an object becomes a member with a special name
+// ("#text" by default).
+// Adjacent sibling elements with the same name are grouped into an array.
+// The same conventions are used to convert JSON back into XML.
+//
+// For example, the document
+//
+//	<feed lang="en"><entry>a</entry><entry id="2">b</entry></feed>
+//
+// is converted to
+//
+//	{"feed":{"@lang":"en","entry":["a",{"@id":"2","#text":"b"}]}}
+package xmljson // import "mellium.im/xml/xmljson"
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"mellium.im/xml"
+)
+
+// Conventions control how XML and JSON are mapped to one another.
+// The zero value is ready to use and uses the defaults described for each
+// field.
+type Conventions struct {
+	// AttrPrefix is prepended to the names of attributes.
+	// The default is "@".
+	AttrPrefix string
+
+	// TextKey is the name of the member that contains the text of an element
+	// that is converted to an object.
+	// The default is "#text".
+	TextKey string
+
+	// Key returns the JSON member name to use for an element or attribute.
+	// The default is the local name.
+	Key func(xml.Name) string
+
+	// Array reports whether elements with the given name should always be
+	// converted to an array, even if there is only one.
+	// Because an element is buffered in memory until it is known whether
+	// its next sibling has the same name, marking large repeated elements as
+	// arrays also allows them to be written as soon as they are read.
+	Array func(xml.Name) bool
+
+	// Name returns the element or attribute name to use for a JSON member
+	// name, not including any AttrPrefix.
+	// The default uses the member name as the local name after replacing any
+	// characters that are not allowed in a name with "_".
+	Name func(key string) xml.Name
+
+	// Item is the local name of elements created for values that are not
+	// members of an object, such as a top level string or the items of an
+	// array inside of another array.
+	// The default is "item".
+	Item string
+}
+
+func (c Conventions) attrPrefix() string {
+	if c.AttrPrefix == "" {
+		return "@"
+	}
+	return c.AttrPrefix
+}
+
+func (c Conventions) textKey() string {
+	if c.TextKey == "" {
+		return "#text"
+	}
+	return c.TextKey
+}
+
+func (c Conventions) key(name xml.Name) string {
+	if c.Key == nil {
+		return name.Local
+	}
+	return c.Key(name)
+}
+
+func (c Conventions) name(key string) xml.Name {
+	if c.Name == nil {
+		return xml.Name{Local: sanitizeName(key)}
+	}
+	return c.Name(key)
+}
+
+func (c Conventions) item() xml.Name {
+	if c.Item == "" {
+		return xml.Name{Local: "item"}
+	}
+	return xml.Name{Local: c.Item}
+}
+
+func (c Conventions) array(name xml.Name) bool {
+	return c.Array != nil && c.Array(name)
+}
+
+// ToJSON reads tokens from r until io.EOF and writes them to w as a JSON
+// object with a member for each top level element.
+//
+// Output is written as it is produced, but each element is held in memory
+// until its next sibling is read to determine whether it is part of an array,
+// unless Array reports that it always is.
+// Elements with the same name that are not adjacent result in duplicate
+// member names.
+// Comments, processing instructions, directives, and text outside of the root
+// element are ignored.
+func (c Conventions) ToJSON(w io.Writer, r xml.TokenReader) error {
+	bw := bufio.NewWriter(w)
+	j := &jsonWriter{c: c, r: r}
+	/* #nosec */
+	bw.WriteByte('{')
+	first := true
+	for {
+		tok, err := j.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if !first {
+				/* #nosec */
+				bw.WriteByte(',')
+			}
+			first = false
+			writeString(bw, c.key(tok.Name))
+			/* #nosec */
+			bw.WriteByte(':')
+			if c.array(tok.Name) {
+				/* #nosec */
+				bw.WriteByte('[')
+			}
+			if err = j.value(bw, tok); err != nil {
+				return err
+			}
+			if c.array(tok.Name) {
+				/* #nosec */
+				bw.WriteByte(']')
+			}
+		case xml.EndElement:
+			return fmt.Errorf("xmljson: unexpected end element </%s>", tok.Name.Local)
+		}
+	}
+	/* #nosec */
+	bw.WriteByte('}')
+	return bw.Flush()
+}
+
+type jsonWriter struct {
+	c   Conventions
+	r   xml.TokenReader
+	err error
+}
+
+// next returns the next element or text token.
+func (j *jsonWriter) next() (xml.Token, error) {
+	for {
+		if j.err != nil {
+			return nil, j.err
+		}
+		tok, err := j.r.Token()
+		j.err = err
+		if st, ok := tok.(xml.SourceToken); ok {
+			tok = st.Token
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement, xml.EndElement, xml.CharData:
+			return tok, nil
+		case xml.CDATA:
+			return xml.CharData(tok), nil
+		}
+	}
+}
+
+// nextInElement is like next except that it reports io.ErrUnexpectedEOF if the input
+// ends.
+func (j *jsonWriter) nextInElement() (xml.Token, error) {
+	tok, err := j.next()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return tok, err
+}
+
+// value writes the JSON value of an element whose start element has been
+// read.
+func (j *jsonWriter) value(w io.Writer, start xml.StartElement) error {
+	var text strings.Builder
+	if hasAttrs(start) {
+		return j.object(w, start, nil, &text)
+	}
+	for {
+		tok, err := j.nextInElement()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text.Write(tok)
+		case xml.StartElement:
+			return j.object(w, start, &tok, &text)
+		case xml.EndElement:
+			writeString(w, text.String())
+			return nil
+		}
+	}
+}
+
+// siblings tracks a group of adjacent sibling elements with the same name.
+type siblings struct {
+	active  bool
+	key     string
+	array   bool
+	pending *bytes.Buffer
+}
+
+// object writes an element as a JSON object.
+// If child is not nil it is the first child element and has already been
+// read, along with any text before it.
+func (j *jsonWriter) object(w io.Writer, start xml.StartElement, child *xml.StartElement, text *strings.Builder) error {
+	members := 0
+	member := func(key string) {
+		if members > 0 {
+			/* #nosec */
+			io.WriteString(w, ",")
+		}
+		members++
+		writeString(w, key)
+		/* #nosec */
+		io.WriteString(w, ":")
+	}
+	flush := func(g *siblings) {
+		switch {
+		case !g.active:
+		case g.pending != nil:
+			member(g.key)
+			/* #nosec */
+			w.Write(g.pending.Bytes())
+		case g.array:
+			/* #nosec */
+			io.WriteString(w, "]")
+		}
+		*g = siblings{}
+	}
+
+	/* #nosec */
+	io.WriteString(w, "{")
+	for _, a := range start.Attr {
+		if isNamespaceDecl(a.Name) {
+			continue
+		}
+		member(j.c.attrPrefix() + j.c.key(a.Name))
+		writeString(w, a.Value)
+	}
+	var group siblings
+	for {
+		var tok xml.Token
+		if child != nil {
+			tok, child = *child, nil
+		} else {
+			var err error
+			tok, err = j.nextInElement()
+			if err != nil {
+				return err
+			}
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text.Write(tok)
+		case xml.StartElement:
+			key := j.c.key(tok.Name)
+			var dst io.Writer = w
+			switch {
+			case group.active && group.key == key:
+				if group.pending != nil {
+					member(key)
+					/* #nosec */
+					io.WriteString(w, "[")
+					/* #nosec */
+					w.Write(group.pending.Bytes())
+					group.pending = nil
+					group.array = true
+				}
+				/* #nosec */
+				io.WriteString(w, ",")
+			default:
+				flush(&group)
+				group = siblings{active: true, key: key}
+				if j.c.array(tok.Name) {
+					member(key)
+					/* #nosec */
+					io.WriteString(w, "[")
+					group.array = true
+				} else {
+					group.pending = &bytes.Buffer{}
+					dst = group.pending
+				}
+			}
+			if err := j.value(dst, tok); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			flush(&group)
+			if s := text.String(); strings.TrimSpace(s) != "" {
+				member(j.c.textKey())
+				writeString(w, s)
+			}
+			/* #nosec */
+			io.WriteString(w, "}")
+			return nil
+		}
+	}
+}
+
+func hasAttrs(start xml.StartElement) bool {
+	for _, a := range start.Attr {
+		if !isNamespaceDecl(a.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isNamespaceDecl(name xml.Name) bool {
+	return name.Space == "xmlns" || (name.Space == "" && name.Local == "xmlns")
+}
+
+// writeString writes s as a JSON string.
+// Invalid UTF-8 is replaced with the Unicode replacement character.
+func writeString(w io.Writer, s string) {
+	var buf []byte
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == '"':
+			buf = append(buf, '\\', '"')
+		case r == '\\':
+			buf = append(buf, '\\', '\\')
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < 0x20 || r == '\u2028' || r == '\u2029':
+			buf = append(buf, fmt.Sprintf(`\u%04x`, r)...)
+		default:
+			buf = utf8.AppendRune(buf, r)
+		}
+		i += size
+	}
+	buf = append(buf, '"')
+	/* #nosec */
+	w.Write(buf)
+}
@@ -0,0 +1,82 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmljson_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/xmljson"
+)
+
+var toJSONTestCases = [...]struct {
+	in  string
+	c   Conventions
+	out string
+	err error
+}{
+	0: {in: ``, out: `{}`},
+	1: {in: `<a/>`, out: `{"a":""}`},
+	2: {in: `<a>text</a>`, out: `{"a":"text"}`},
+	3: {in: `<a b="1" xmlns="urn:a" xmlns:c="urn:c">text</a>`, out: `{"a":{"@b":"1","#text":"text"}}`},
+	4: {
+		in:  `<feed lang="en"><entry>a</entry><entry id="2">b</entry></feed>`,
+		out: `{"feed":{"@lang":"en","entry":["a",{"@id":"2","#text":"b"}]}}`,
+	},
+	5: {
+		in:  "<a>\n\t<b>1</b>\n\t<c>2</c>\n\t<b>3</b>\n</a>",
+		out: `{"a":{"b":"1","c":"2","b":"3"}}`,
+	},
+	6: {
+		in:  `<a>x<b/>y</a>`,
+		out: `{"a":{"b":"","#text":"xy"}}`,
+	},
+	7: {
+		in:  `<?xml version="1.0"?><!-- c --><a><![CDATA[<&>]]>"\</a>`,
+		out: `{"a":"<&>\"\\"}`,
+	},
+	8: {
+		in: `<a b="1"><c>2</c></a>`,
+		c: Conventions{
+			AttrPrefix: "-",
+			TextKey:    "$",
+			Key:        func(n xml.Name) string { return strings.ToUpper(n.Local) },
+			Array:      func(n xml.Name) bool { return n.Local == "a" || n.Local == "c" },
+		},
+		out: `{"A":[{"-B":"1","C":["2"]}]}`,
+	},
+	9: {in: `<a><b>`, err: io.ErrUnexpectedEOF},
+	10: {
+		in:  `<a><b><c>1</c><c>2</c></b><b/></a>`,
+		out: `{"a":{"b":[{"c":["1","2"]},""]}}`,
+	},
+	11: {in: "<a>\n\t\u2028</a>", out: `{"a":"\n\t\u2028"}`},
+}
+
+func TestToJSON(t *testing.T) {
+	for i, tc := range toJSONTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var b strings.Builder
+			err := tc.c.ToJSON(&b, xml.NewTokenizer(strings.NewReader(tc.in)))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("unexpected error: want=%v, got=%v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if out := b.String(); out != tc.out {
+				t.Errorf("wrong output:\nwant=%s,\n got=%s", tc.out, out)
+			}
+			if !json.Valid([]byte(b.String())) {
+				t.Errorf("invalid JSON: %s", b.String())
+			}
+		})
+	}
+}
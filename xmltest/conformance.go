@@ -0,0 +1,285 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmltest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// ConformanceTest is a test from the W3C XML conformance test suite.
+// The fields correspond to the attributes of the TEST element in the suite's
+// test case files.
+type ConformanceTest struct {
+	ID             string
+	Type           string
+	Entities       string
+	Sections       string
+	Recommendation string
+	Version        string
+	Edition        string
+	Description    string
+
+	// Path is the location of the test's input document.
+	Path string
+}
+
+// ConformanceResult is the result of running a single ConformanceTest.
+type ConformanceResult struct {
+	Test ConformanceTest
+
+	// Pass is true if a well-formed document was read without an error or a
+	// document that is not well-formed resulted in an error.
+	Pass bool
+
+	// Skipped is true if the test was not run because it tests an optional
+	// error that parsers may or may not report.
+	Skipped bool
+
+	// Err is the error, if any, returned while reading the document.
+	Err error
+}
+
+// ConformanceReport contains the results of running a conformance suite.
+type ConformanceReport struct {
+	Results []ConformanceResult
+}
+
+// Tally is the number of tests that passed and failed.
+type Tally struct {
+	Passed int
+	Failed int
+}
+
+// LoadConformanceSuite reads the list of tests from a local copy of the W3C
+// XML conformance test suite, where path is the location of the suite's
+// xmlconf.xml file.
+//
+// Test case files that are included by the suite through external entities
+// declared in its document type declaration are loaded as well, and the
+// paths of test documents are resolved relative to the file that lists them
+// and any xml:base attributes.
+// Callers may filter the returned tests, for example by Recommendation, before
+// running them.
+func LoadConformanceSuite(path string) ([]ConformanceTest, error) {
+	var tests []ConformanceTest
+	err := loadSuite(&tests, path, 0)
+	return tests, err
+}
+
+// maxSuiteDepth limits how deeply test case files may include one another.
+const maxSuiteDepth = 16
+
+func loadSuite(tests *[]ConformanceTest, path string, depth int) error {
+	if depth > maxSuiteDepth {
+		return fmt.Errorf("xmltest: test case files nested too deeply at %s", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	/* #nosec */
+	defer f.Close()
+
+	dir := filepath.Dir(path)
+	entities := make(map[string]bool)
+	bases := []string{dir}
+	var (
+		cur  *ConformanceTest
+		desc strings.Builder
+	)
+	r := xml.NewTokenizer(f)
+	// Test case files are loaded as suites of their own where they are
+	// referenced so that the paths in them are resolved relative to them.
+	// Any other external entity, such as the DTD of the suite, is not needed.
+	r.EntityResolver = xml.EntityResolverFunc(func(_, systemID string) (io.Reader, error) {
+		if entities[systemID] {
+			if err := loadSuite(tests, filepath.Join(dir, filepath.FromSlash(systemID)), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		return strings.NewReader(""), nil
+	})
+	for {
+		tok, err := r.Token()
+		switch tok := tok.(type) {
+		case xml.Directive:
+			parseEntityDecls(string(tok), entities)
+		case xml.StartElement:
+			base := bases[len(bases)-1]
+			if v, ok := xml.GetAttr(tok, xml.Name{Space: "xml", Local: "base"}); ok {
+				base = filepath.Join(base, filepath.FromSlash(v))
+			}
+			bases = append(bases, base)
+			if tok.Name.Local == "TEST" {
+				cur = newConformanceTest(tok, base)
+				desc.Reset()
+			}
+		case xml.EndElement:
+			bases = bases[:len(bases)-1]
+			if tok.Name.Local == "TEST" && cur != nil {
+				cur.Description = strings.Join(strings.Fields(desc.String()), " ")
+				*tests = append(*tests, *cur)
+				cur = nil
+			}
+		case xml.CharData:
+			if cur != nil {
+				desc.Write(tok)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("xmltest: error reading %s: %w", path, err)
+		}
+	}
+}
+
+func newConformanceTest(start xml.StartElement, base string) *ConformanceTest {
+	get := func(local string) string {
+		v, _ := xml.GetAttr(start, xml.Name{Local: local})
+		return v
+	}
+	return &ConformanceTest{
+		ID:             get("ID"),
+		Type:           get("TYPE"),
+		Entities:       get("ENTITIES"),
+		Sections:       get("SECTIONS"),
+		Recommendation: get("RECOMMENDATION"),
+		Version:        get("VERSION"),
+		Edition:        get("EDITION"),
+		Path:           filepath.Join(base, filepath.FromSlash(get("URI"))),
+	}
+}
+
+// parseEntityDecls adds the system identifiers of the general external
+// entities declared in a document type declaration to entities.
+func parseEntityDecls(doctype string, entities map[string]bool) {
+	for {
+		i := strings.Index(doctype, "<!ENTITY")
+		if i < 0 {
+			return
+		}
+		doctype = doctype[i+len("<!ENTITY"):]
+		fields := strings.Fields(doctype)
+		if len(fields) < 3 || fields[0] == "%" || fields[1] != "SYSTEM" {
+			continue
+		}
+		rest := strings.TrimSpace(doctype[strings.Index(doctype, "SYSTEM")+len("SYSTEM"):])
+		if rest == "" || (rest[0] != '"' && rest[0] != '\'') {
+			continue
+		}
+		end := strings.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return
+		}
+		entities[rest[1:end+1]] = true
+	}
+}
+
+// RunConformance runs each test by reading all tokens from the TokenReader
+// returned by newReader for the test's input document.
+//
+// Tests of type "valid" and "invalid" pass if no error is returned, since
+// invalid documents are still well-formed, and tests of type "not-wf" pass if
+// an error is returned.
+// Tests of type "error" are skipped.
+func RunConformance(tests []ConformanceTest, newReader func(io.Reader) xml.TokenReader) *ConformanceReport {
+	report := &ConformanceReport{}
+	for _, t := range tests {
+		res := ConformanceResult{Test: t}
+		if t.Type == "error" {
+			res.Skipped = true
+			report.Results = append(report.Results, res)
+			continue
+		}
+		f, err := os.Open(t.Path)
+		if err != nil {
+			res.Err = err
+			report.Results = append(report.Results, res)
+			continue
+		}
+		res.Err = drain(newReader(f))
+		/* #nosec */
+		f.Close()
+		res.Pass = (res.Err != nil) == (t.Type == "not-wf")
+		report.Results = append(report.Results, res)
+	}
+	return report
+}
+
+func drain(r xml.TokenReader) error {
+	for {
+		_, err := r.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Total returns the number of tests that passed and failed.
+// Skipped tests are not counted.
+func (r *ConformanceReport) Total() Tally {
+	var t Tally
+	for _, res := range r.Results {
+		t.add(res)
+	}
+	return t
+}
+
+// Productions returns the number of tests that passed and failed for each
+// production of the XML grammar referenced by the tests, such as [22] for
+// prolog.
+// Tests that reference more than one production are counted for each.
+func (r *ConformanceReport) Productions() map[int]Tally {
+	tallies := make(map[int]Tally)
+	for _, res := range r.Results {
+		for _, f := range strings.Fields(res.Test.Sections) {
+			if !strings.HasPrefix(f, "[") || !strings.HasSuffix(f, "]") {
+				continue
+			}
+			n, err := strconv.Atoi(f[1 : len(f)-1])
+			if err != nil {
+				continue
+			}
+			t := tallies[n]
+			t.add(res)
+			tallies[n] = t
+		}
+	}
+	return tallies
+}
+
+// Failures returns the results of the tests that failed.
+func (r *ConformanceReport) Failures() []ConformanceResult {
+	var failed []ConformanceResult
+	for _, res := range r.Results {
+		if !res.Pass && !res.Skipped {
+			failed = append(failed, res)
+		}
+	}
+	return failed
+}
+
+func (t *Tally) add(res ConformanceResult) {
+	switch {
+	case res.Skipped:
+	case res.Pass:
+		t.Passed++
+	default:
+		t.Failed++
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmltest_test
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"mellium.im/xml"
+	"mellium.im/xml/xmltest"
+)
+
+func TestConformance(t *testing.T) {
+	tests, err := xmltest.LoadConformanceSuite("testdata/xmlconf/xmlconf.xml")
+	if err != nil {
+		t.Fatalf("error loading suite: %v", err)
+	}
+	if len(tests) != 4 {
+		t.Fatalf("wrong number of tests: want=4, got=%d", len(tests))
+	}
+	first := tests[0]
+	if first.ID != "valid-1" || first.Type != "valid" || first.Sections != "2.1 [1]" || first.Description != "A simple well-formed document." {
+		t.Errorf("wrong test loaded: %+v", first)
+	}
+	if want := filepath.Join("testdata", "xmlconf", "sub", "docs", "valid.xml"); first.Path != want {
+		t.Errorf("wrong path: want=%q, got=%q", want, first.Path)
+	}
+
+	report := xmltest.RunConformance(tests, func(r io.Reader) xml.TokenReader {
+		return xml.NewTokenizer(r)
+	})
+	if total := report.Total(); total != (xmltest.Tally{Passed: 2, Failed: 1}) {
+		t.Errorf("wrong total: %+v", total)
+	}
+	if !report.Results[2].Skipped {
+		t.Errorf("error test was not skipped")
+	}
+	if p := report.Productions(); p[1] != (xmltest.Tally{Passed: 1, Failed: 1}) || p[15] != (xmltest.Tally{Passed: 1}) {
+		t.Errorf("wrong production tallies: %+v", p)
+	}
+	if failed := report.Failures(); len(failed) != 1 || failed[0].Test.ID != "not-wf-2" {
+		t.Errorf("wrong failures: %+v", failed)
+	}
+}
+
+func TestConformanceMissing(t *testing.T) {
+	_, err := xmltest.LoadConformanceSuite("testdata/xmlconf/missing.xml")
+	if err == nil {
+		t.Errorf("expected error loading missing suite")
+	}
+}
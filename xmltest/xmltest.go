@@ -0,0 +1,120 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package xmltest provides utilities for testing TokenReader implementations
+// and code that produces XML tokens.
+package xmltest // import "mellium.im/xml/xmltest"
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+)
+
+// Case is a single test case that is run by Run.
+type Case struct {
+	// Name is the name of the subtest.
+	// If it is empty the index of the case is used instead.
+	Name string
+
+	// In is the input that is passed to the function that creates the
+	// TokenReader being tested.
+	In string
+
+	// Out is the list of tokens that the TokenReader is expected to return.
+	Out []xml.Token
+
+	// Golden is the path of a file, usually in the testdata directory,
+	// containing an XML document that is tokenized by an xml.Tokenizer to
+	// produce the expected tokens.
+	// It is only used if Out is nil.
+	Golden string
+
+	// Err is the error that the TokenReader is expected to return after the
+	// tokens in Out.
+	// The errors are considered the same if errors.Is reports that they match
+	// or if they have the same message.
+	Err error
+}
+
+// Run runs each of the cases as a subtest of t.
+// For each case a TokenReader is created by calling newReader with the input
+// and all tokens are read from it until an error is returned.
+// The tokens are compared against the expected tokens using xml.Equal and any
+// differences are reported along with their positions.
+func Run(t *testing.T, newReader func(io.Reader) xml.TokenReader, cases ...Case) {
+	t.Helper()
+	for i, tc := range cases {
+		tc := tc
+		name := tc.Name
+		if name == "" {
+			name = strconv.Itoa(i)
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			want, err := tc.expected()
+			if err != nil {
+				t.Fatalf("error loading expected tokens: %v", err)
+			}
+			var got xml.TokenBuffer
+			err = readAll(&got, newReader(strings.NewReader(tc.In)))
+			switch {
+			case tc.Err == nil && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tc.Err != nil && err == nil:
+				t.Errorf("expected error %q", tc.Err)
+			case tc.Err != nil && !errors.Is(err, tc.Err) && err.Error() != tc.Err.Error():
+				t.Errorf("wrong error: want=%q, got=%q", tc.Err, err)
+			}
+			diffs, err := xml.DiffAll(want, &got)
+			if err != nil {
+				t.Fatalf("error comparing tokens: %v", err)
+			}
+			for _, d := range diffs {
+				t.Errorf("want != got at %s", d)
+			}
+		})
+	}
+}
+
+func (tc Case) expected() (*xml.TokenBuffer, error) {
+	var b xml.TokenBuffer
+	if tc.Out != nil || tc.Golden == "" {
+		for _, tok := range tc.Out {
+			/* #nosec */
+			b.EncodeToken(tok)
+		}
+		return &b, nil
+	}
+	f, err := os.Open(tc.Golden)
+	if err != nil {
+		return nil, err
+	}
+	/* #nosec */
+	defer f.Close()
+	return &b, readAll(&b, xml.NewTokenizer(f))
+}
+
+// readAll copies tokens from r to b until r returns an error.
+// If the error is io.EOF it returns nil.
+func readAll(b *xml.TokenBuffer, r xml.TokenReader) error {
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			/* #nosec */
+			b.EncodeToken(tok)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
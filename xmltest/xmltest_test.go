@@ -0,0 +1,40 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xmltest_test
+
+import (
+	"io"
+	"testing"
+
+	"mellium.im/xml"
+	"mellium.im/xml/xmltest"
+)
+
+func TestRun(t *testing.T) {
+	xmltest.Run(t, func(r io.Reader) xml.TokenReader {
+		return xml.NewTokenizer(r)
+	},
+		xmltest.Case{
+			Name: "tokens",
+			In:   `<a b="c">d<!--e--></a>`,
+			Out: []xml.Token{
+				xml.StartElement{Name: xml.Name{Local: "a"}, Attr: []xml.Attr{{Name: xml.Name{Local: "b"}, Value: "c"}}},
+				xml.CharData("d"),
+				xml.Comment("e"),
+				xml.EndElement{Name: xml.Name{Local: "a"}},
+			},
+		},
+		xmltest.Case{
+			In:     `<atom:feed xmlns:atom="http://www.w3.org/2005/Atom"><atom:title><![CDATA[Example]]></atom:title></atom:feed>`,
+			Golden: "testdata/feed.xml",
+		},
+		xmltest.Case{
+			In:  `<a><!-x>`,
+			Out: []xml.Token{xml.StartElement{Name: xml.Name{Local: "a"}}},
+			Err: &xml.SyntaxError{Msg: "invalid sequence <!- not part of <!--"},
+		},
+		xmltest.Case{},
+	)
+}
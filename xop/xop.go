@@ -0,0 +1,192 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package xop resolves XML-binary Optimized Packaging (XOP) includes.
+//
+// XOP, and MTOM which uses it for SOAP messages, moves binary content out of
+// an XML document and into separate MIME parts, replacing it with an
+// xop:Include element that references the part by its Content-ID.
+// The readers in this package replace those elements with the content of the
+// parts that they reference.
+package xop // import "mellium.im/xml/xop"
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// NS is the XOP namespace.
+const NS = "http://www.w3.org/2004/08/xop/include"
+
+// chunkSize is the number of bytes of a part that are encoded in each CharData
+// token.
+// It is a multiple of 3 so that each chunk can be base64 encoded without
+// padding.
+const chunkSize = 3 * 1024
+
+// Resolver returns the content of the part with the given Content-ID, without
+// the surrounding angle brackets.
+// If the returned reader is also an io.Closer it is closed after it has been
+// read.
+type Resolver func(cid string) (io.Reader, error)
+
+// Part is the token returned by Parts in place of an xop:Include element.
+// Its content must be read before the next call to Token.
+type Part struct {
+	ContentID string
+	io.Reader
+}
+
+// ContentID returns the Content-ID referenced by the cid URL href as
+// described in RFC 2392.
+func ContentID(href string) (string, error) {
+	if len(href) < 4 || !strings.EqualFold(href[:4], "cid:") {
+		return "", fmt.Errorf("xop: unsupported reference %q", href)
+	}
+	cid, err := url.PathUnescape(href[4:])
+	if err != nil {
+		return "", fmt.Errorf("xop: invalid reference %q: %w", href, err)
+	}
+	return cid, nil
+}
+
+// Resolve returns a token reader that replaces each xop:Include element read
+// from r with the base64 encoded content of the part that it references, which
+// reconstructs the original document.
+// Parts are read and encoded in chunks as tokens are read so that large parts
+// are never held in memory.
+func Resolve(r xml.TokenReader, resolve Resolver) xml.TokenReader {
+	return &includeReader{r: r, resolve: resolve}
+}
+
+// Parts returns a token reader that replaces each xop:Include element read
+// from r with a Part token from which the raw content of the referenced part
+// can be read.
+func Parts(r xml.TokenReader, resolve Resolver) xml.TokenReader {
+	return &includeReader{r: r, resolve: resolve, raw: true}
+}
+
+type includeReader struct {
+	r       xml.TokenReader
+	resolve Resolver
+	raw     bool
+	part    io.Reader
+	buf     []byte
+}
+
+func (x *includeReader) Token() (xml.Token, error) {
+	if x.part != nil {
+		if x.buf == nil {
+			x.buf = make([]byte, chunkSize)
+		}
+		n, err := io.ReadFull(x.part, x.buf)
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			err = x.closePart()
+		default:
+			/* #nosec */
+			x.closePart()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			data := make([]byte, base64.StdEncoding.EncodedLen(n))
+			base64.StdEncoding.Encode(data, x.buf[:n])
+			return xml.CharData(data), nil
+		}
+	}
+
+	tok, err := x.r.Token()
+	t := tok
+	if st, ok := t.(xml.SourceToken); ok {
+		t = st.Token
+	}
+	start, ok := t.(xml.StartElement)
+	if !ok || start.Name.Space != NS || start.Name.Local != "Include" {
+		return tok, err
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	var href string
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "href" {
+			href = attr.Value
+		}
+	}
+	cid, err := ContentID(href)
+	if err != nil {
+		return nil, err
+	}
+	// The element may contain unrecognized elements, which are ignored.
+	if err = xml.Skip(x.r); err != nil {
+		return nil, err
+	}
+	part, err := x.resolve(cid)
+	if err != nil {
+		return nil, err
+	}
+	if x.raw {
+		return Part{ContentID: cid, Reader: part}, nil
+	}
+	x.part = part
+	return x.Token()
+}
+
+func (x *includeReader) closePart() error {
+	part := x.part
+	x.part = nil
+	if c, ok := part.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// ReadMultipart reads all of the parts of a multipart/related MIME message,
+// such as an MTOM message, into memory.
+// It returns the content of the first part, which is the root document, and a
+// resolver for the remaining parts.
+func ReadMultipart(mr *multipart.Reader) (root io.Reader, resolve Resolver, err error) {
+	parts := make(map[string][]byte)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		if root == nil {
+			root = bytes.NewReader(data)
+			continue
+		}
+		cid := strings.TrimSpace(p.Header.Get("Content-Id"))
+		cid = strings.TrimSuffix(strings.TrimPrefix(cid, "<"), ">")
+		parts[cid] = data
+	}
+	if root == nil {
+		return nil, nil, errors.New("xop: message has no parts")
+	}
+	return root, func(cid string) (io.Reader, error) {
+		data, ok := parts[cid]
+		if !ok {
+			return nil, fmt.Errorf("xop: no part with Content-ID %q", cid)
+		}
+		return bytes.NewReader(data), nil
+	}, nil
+}
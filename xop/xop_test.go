@@ -0,0 +1,149 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xop_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/xop"
+)
+
+const doc = `<m xmlns:xop="http://www.w3.org/2004/08/xop/include"><photo><xop:Include href="cid:photo%40example.net"/></photo><sig><xop:Include href="cid:sig@example.net"><x/></xop:Include></sig></m>`
+
+func message(t *testing.T, parts map[string][]byte) *multipart.Reader {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	root, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {`application/xop+xml; type="text/xml"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* #nosec */
+	io.WriteString(root, doc)
+	for cid, data := range parts {
+		p, err := w.CreatePart(textproto.MIMEHeader{"Content-Id": {"<" + cid + ">"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		/* #nosec */
+		p.Write(data)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return multipart.NewReader(&buf, w.Boundary())
+}
+
+func TestResolve(t *testing.T) {
+	photo := bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6}, 1000)
+	root, resolve, err := ReadMultipart(message(t, map[string][]byte{
+		"photo@example.net": photo,
+		"sig@example.net":   []byte("signed"),
+	}))
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+	r := Resolve(xml.NewTokenizer(root), resolve)
+	var out strings.Builder
+	e := xml.NewEncoder(&out)
+	for {
+		tok, err := r.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error resolving: %v", err)
+		}
+		if err = e.EncodeToken(tok); err != nil {
+			t.Fatalf("error encoding: %v", err)
+		}
+	}
+	if err = e.Flush(); err != nil {
+		t.Fatalf("error flushing: %v", err)
+	}
+	want := `<m xmlns:xop="http://www.w3.org/2004/08/xop/include"><photo>` +
+		base64.StdEncoding.EncodeToString(photo) +
+		`</photo><sig>` + base64.StdEncoding.EncodeToString([]byte("signed")) + `</sig></m>`
+	if s := out.String(); s != want {
+		t.Errorf("wrong output:\nwant=%s,\n got=%s", want, s)
+	}
+}
+
+func TestParts(t *testing.T) {
+	r := Parts(xml.NewTokenizer(strings.NewReader(doc)), func(cid string) (io.Reader, error) {
+		return strings.NewReader("content of " + cid), nil
+	})
+	var parts []string
+	for {
+		tok, err := r.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p, ok := tok.(Part); ok {
+			data, err := io.ReadAll(p)
+			if err != nil {
+				t.Fatalf("error reading part: %v", err)
+			}
+			parts = append(parts, p.ContentID+": "+string(data))
+		}
+	}
+	want := []string{
+		"photo@example.net: content of photo@example.net",
+		"sig@example.net: content of sig@example.net",
+	}
+	if strings.Join(parts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("wrong parts: want=%q, got=%q", want, parts)
+	}
+}
+
+var resolveErrTestCases = [...]struct {
+	in  string
+	err string
+}{
+	0: {in: `<xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="http://example.net"/>`, err: `xop: unsupported reference "http://example.net"`},
+	1: {in: `<xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:%zz"/>`, err: `xop: invalid reference "cid:%zz": invalid URL escape "%zz"`},
+	2: {in: `<xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:missing"/>`, err: `xop: no part with Content-ID "missing"`},
+}
+
+func TestResolveErrors(t *testing.T) {
+	_, resolve, err := ReadMultipart(message(t, nil))
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+	for i, tc := range resolveErrTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			r := Resolve(xml.NewTokenizer(strings.NewReader(tc.in)), resolve)
+			var err error
+			for err == nil {
+				_, err = r.Token()
+			}
+			if err == io.EOF || err.Error() != tc.err {
+				t.Errorf("wrong error: want=%s, got=%v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestReadMultipartEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := ReadMultipart(multipart.NewReader(&buf, w.Boundary()))
+	if err == nil || err.Error() != "xop: message has no parts" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
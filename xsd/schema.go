@@ -0,0 +1,1049 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xsd
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"mellium.im/xml"
+)
+
+// Namespaces used by schema documents and instances.
+const (
+	NS         = "http://www.w3.org/2001/XMLSchema"
+	InstanceNS = "http://www.w3.org/2001/XMLSchema-instance"
+
+	xmlNS = "http://www.w3.org/XML/1998/namespace"
+)
+
+// Schema is a compiled set of schema documents.
+//
+// Element, attribute, type, group, and attribute group definitions are
+// supported along with the sequence, choice, all, and any particles, simple
+// and complex content derived by extension or restriction, and simple types
+// derived by restriction, list, and union.
+// The enumeration, pattern, length, minLength, maxLength, minInclusive,
+// maxInclusive, minExclusive, and maxExclusive facets are checked.
+//
+// Identity constraints, substitution groups, xsi:type, and xsi:nil are not
+// supported and includes and imports are not followed: all of the documents
+// that make up a schema must be passed to Compile.
+type Schema struct {
+	elements    map[xml.Name]*elementDecl
+	attrs       map[xml.Name]*attrDecl
+	types       map[xml.Name]interface{}
+	elementDefs map[xml.Name]*node
+	attrDefs    map[xml.Name]*node
+	groups      map[xml.Name]*node
+	attrGroups  map[xml.Name]*node
+	complexDefs map[xml.Name]*node
+	simpleDefs  map[xml.Name]*node
+}
+
+// Compile parses the schema documents read from each of the readers.
+// Definitions in each document may refer to definitions in any of the others.
+func Compile(docs ...io.Reader) (*Schema, error) {
+	s := &Schema{
+		elements:    make(map[xml.Name]*elementDecl),
+		attrs:       make(map[xml.Name]*attrDecl),
+		types:       make(map[xml.Name]interface{}),
+		elementDefs: make(map[xml.Name]*node),
+		attrDefs:    make(map[xml.Name]*node),
+		groups:      make(map[xml.Name]*node),
+		attrGroups:  make(map[xml.Name]*node),
+		complexDefs: make(map[xml.Name]*node),
+		simpleDefs:  make(map[xml.Name]*node),
+	}
+	var roots []*node
+	for _, r := range docs {
+		root, err := parseTree(r)
+		if err != nil {
+			return nil, err
+		}
+		if root.name != (xml.Name{Space: NS, Local: "schema"}) {
+			return nil, fmt.Errorf("xsd: expected schema element, found %s", root.name.Local)
+		}
+		roots = append(roots, root)
+		for _, child := range root.children {
+			name, ok := child.attrValue("name")
+			if !ok {
+				continue
+			}
+			qname := xml.Name{Space: root.targetNS, Local: name}
+			var defs map[xml.Name]*node
+			switch child.name.Local {
+			case "element":
+				defs = s.elementDefs
+			case "attribute":
+				defs = s.attrDefs
+			case "complexType":
+				defs = s.complexDefs
+			case "simpleType":
+				defs = s.simpleDefs
+			case "group":
+				defs = s.groups
+			case "attributeGroup":
+				defs = s.attrGroups
+			default:
+				continue
+			}
+			if _, ok := defs[qname]; ok {
+				return nil, child.errorf("duplicate definition of %s %s", child.name.Local, name)
+			}
+			defs[qname] = child
+		}
+	}
+	for _, root := range roots {
+		for _, child := range root.children {
+			var err error
+			switch child.name.Local {
+			case "element":
+				var decl *elementDecl
+				decl, err = s.compileElement(child, true)
+				if err == nil {
+					s.elements[decl.name] = decl
+				}
+			case "attribute":
+				var decl *attrDecl
+				decl, err = s.compileAttr(child, true)
+				if err == nil {
+					s.attrs[decl.name] = decl
+				}
+			case "complexType", "simpleType":
+				_, err = s.lookupType(xml.Name{Space: root.targetNS, Local: child.attr["name"]}, child)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+// node is an element of a schema document.
+type node struct {
+	name     xml.Name
+	attr     map[string]string
+	scope    map[string]string
+	targetNS string
+	qualElem bool
+	qualAttr bool
+	children []*node
+	line     int
+}
+
+func (n *node) attrValue(local string) (string, bool) {
+	v, ok := n.attr[local]
+	return v, ok
+}
+
+func (n *node) errorf(format string, v ...interface{}) error {
+	return fmt.Errorf("xsd: line %d: %s", n.line, fmt.Sprintf(format, v...))
+}
+
+// qname resolves a prefixed name in an attribute value.
+func (n *node) qname(v string) (xml.Name, error) {
+	prefix, local, ok := strings.Cut(v, ":")
+	if !ok {
+		prefix, local = "", v
+	}
+	space, bound := n.scope[prefix]
+	if !bound && prefix != "" {
+		return xml.Name{}, n.errorf("unbound prefix %q in %q", prefix, v)
+	}
+	return xml.Name{Space: space, Local: local}, nil
+}
+
+// parseTree reads a schema document, ignoring annotations.
+func parseTree(r io.Reader) (*node, error) {
+	d := xml.NewTokenizer(r)
+	d.SkipComments = true
+	d.SkipWhitespace = true
+	var (
+		stack []*node
+		root  *node
+	)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("xsd: %w", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			n := &node{
+				name: tok.Name,
+				attr: make(map[string]string),
+				line: d.Span().Start.Line,
+			}
+			scope := map[string]string{"xml": xmlNS}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				scope = parent.scope
+				n.targetNS, n.qualElem, n.qualAttr = parent.targetNS, parent.qualElem, parent.qualAttr
+			}
+			copied := false
+			for _, a := range tok.Attr {
+				switch {
+				case a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns"):
+					if !copied {
+						scope = copyScope(scope)
+						copied = true
+					}
+					if a.Name.Space == "" {
+						scope[""] = a.Value
+					} else {
+						scope[a.Name.Local] = a.Value
+					}
+				case a.Name.Space == "":
+					n.attr[a.Name.Local] = a.Value
+				}
+			}
+			n.scope = scope
+			if len(stack) == 0 {
+				n.targetNS = n.attr["targetNamespace"]
+				n.qualElem = n.attr["elementFormDefault"] == "qualified"
+				n.qualAttr = n.attr["attributeFormDefault"] == "qualified"
+			}
+			switch {
+			case tok.Name == xml.Name{Space: NS, Local: "annotation"}:
+				if err := xml.Skip(d); err != nil {
+					return nil, fmt.Errorf("xsd: %w", err)
+				}
+				continue
+			case len(stack) == 0:
+				root = n
+			default:
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("xsd: empty schema document")
+	}
+	return root, nil
+}
+
+func copyScope(scope map[string]string) map[string]string {
+	c := make(map[string]string, len(scope)+1)
+	for k, v := range scope {
+		c[k] = v
+	}
+	return c
+}
+
+// elementDecl is an element declaration.
+type elementDecl struct {
+	name xml.Name
+	// typ is a *simpleType or *complexType.
+	typ interface{}
+}
+
+// attrDecl is an attribute declaration or use.
+type attrDecl struct {
+	name     xml.Name
+	typ      *simpleType
+	required bool
+}
+
+type particleKind int
+
+const (
+	elementParticle particleKind = iota
+	sequenceParticle
+	choiceParticle
+	allParticle
+	anyParticle
+)
+
+// particle is a part of a content model.
+type particle struct {
+	kind     particleKind
+	min, max int
+	elem     *elementDecl
+	children []*particle
+
+	// Wildcard constraints.
+	spaces  []string
+	not     []string
+	process string
+}
+
+// unbounded is the max of a particle that may repeat any number of times.
+const unbounded = -1
+
+// complexType is a complex type definition.
+type complexType struct {
+	attrs   map[xml.Name]*attrDecl
+	anyAttr *particle
+	content *particle
+	mixed   bool
+	simple  *simpleType
+	// elements maps the names of elements in the content model to their
+	// declarations.
+	elements  map[xml.Name]*elementDecl
+	wildcards []*particle
+}
+
+// anyType is the ur-type that allows any content and attributes.
+var (
+	anyContent = &particle{kind: anyParticle, min: 0, max: unbounded, process: "lax"}
+	anyType    = &complexType{
+		anyAttr:   &particle{kind: anyParticle, process: "lax"},
+		content:   anyContent,
+		mixed:     true,
+		wildcards: []*particle{anyContent},
+	}
+)
+
+// simpleType is a simple type definition.
+type simpleType struct {
+	builtin *Type
+	base    *simpleType
+	list    *simpleType
+	union   []*simpleType
+	enum    []string
+	pattern []*regexp.Regexp
+	length  []lengthFacet
+	bounds  []boundFacet
+}
+
+type lengthFacet struct {
+	kind string
+	n    int
+}
+
+type boundFacet struct {
+	kind  string
+	value interface{}
+}
+
+var anySimpleType = &simpleType{builtin: String}
+
+func (s *Schema) lookupType(name xml.Name, from *node) (interface{}, error) {
+	if t, ok := s.types[name]; ok {
+		if t == nil {
+			return nil, from.errorf("circular definition of type %s", name.Local)
+		}
+		return t, nil
+	}
+	if name.Space == NS {
+		switch name.Local {
+		case "anyType":
+			return anyType, nil
+		case "anySimpleType":
+			return anySimpleType, nil
+		}
+		// Values of unsupported built-in types are not checked.
+		typ := Lookup(name.Local)
+		if typ == nil {
+			typ = Token
+		}
+		return &simpleType{builtin: typ}, nil
+	}
+	if def, ok := s.complexDefs[name]; ok {
+		// Complex types are registered before their content is compiled so that
+		// they may contain elements of their own type.
+		t := newComplexType(def)
+		s.types[name] = t
+		if err := s.compileComplexContent(t, def); err != nil {
+			delete(s.types, name)
+			return nil, err
+		}
+		return t, t.indexContent(def)
+	}
+	def, ok := s.simpleDefs[name]
+	if !ok {
+		return nil, from.errorf("undefined type %s", name.Local)
+	}
+	s.types[name] = nil
+	t, err := s.compileSimpleType(def)
+	if err != nil {
+		delete(s.types, name)
+		return nil, err
+	}
+	s.types[name] = t
+	return t, nil
+}
+
+func (s *Schema) lookupSimpleType(v string, from *node) (*simpleType, error) {
+	name, err := from.qname(v)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.lookupType(name, from)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := t.(*simpleType)
+	if !ok {
+		return nil, from.errorf("type %s is not a simple type", name.Local)
+	}
+	return st, nil
+}
+
+func (s *Schema) compileElement(n *node, global bool) (*elementDecl, error) {
+	if ref, ok := n.attrValue("ref"); ok {
+		name, err := n.qname(ref)
+		if err != nil {
+			return nil, err
+		}
+		if decl, ok := s.elements[name]; ok {
+			return decl, nil
+		}
+		def, ok := s.elementDefs[name]
+		if !ok {
+			return nil, n.errorf("undefined element %s", name.Local)
+		}
+		return s.compileElement(def, true)
+	}
+	local, ok := n.attrValue("name")
+	if !ok {
+		return nil, n.errorf("element has no name or ref")
+	}
+	decl := &elementDecl{name: xml.Name{Local: local}}
+	if global || n.attr["form"] == "qualified" || (n.attr["form"] == "" && n.qualElem) {
+		decl.name.Space = n.targetNS
+	}
+	if global {
+		// Register the declaration before compiling its type so that recursive
+		// references resolve.
+		if d, ok := s.elements[decl.name]; ok {
+			return d, nil
+		}
+		s.elements[decl.name] = decl
+	}
+	var err error
+	switch {
+	case n.attr["type"] != "":
+		var name xml.Name
+		name, err = n.qname(n.attr["type"])
+		if err == nil {
+			decl.typ, err = s.lookupType(name, n)
+		}
+	default:
+		decl.typ = anyType
+		for _, child := range n.children {
+			switch child.name.Local {
+			case "complexType":
+				decl.typ, err = s.compileComplexType(child)
+			case "simpleType":
+				decl.typ, err = s.compileSimpleType(child)
+			}
+		}
+	}
+	if err != nil {
+		if global {
+			delete(s.elements, decl.name)
+		}
+		return nil, err
+	}
+	return decl, nil
+}
+
+func (s *Schema) compileAttr(n *node, global bool) (*attrDecl, error) {
+	decl := &attrDecl{required: n.attr["use"] == "required"}
+	if ref, ok := n.attrValue("ref"); ok {
+		name, err := n.qname(ref)
+		if err != nil {
+			return nil, err
+		}
+		if name.Space == xmlNS {
+			decl.name, decl.typ = name, anySimpleType
+			return decl, nil
+		}
+		g, ok := s.attrs[name]
+		if !ok {
+			def, ok := s.attrDefs[name]
+			if !ok {
+				return nil, n.errorf("undefined attribute %s", name.Local)
+			}
+			var err error
+			g, err = s.compileAttr(def, true)
+			if err != nil {
+				return nil, err
+			}
+			s.attrs[name] = g
+		}
+		decl.name, decl.typ = g.name, g.typ
+		return decl, nil
+	}
+	local, ok := n.attrValue("name")
+	if !ok {
+		return nil, n.errorf("attribute has no name or ref")
+	}
+	decl.name.Local = local
+	if global || n.attr["form"] == "qualified" || (n.attr["form"] == "" && n.qualAttr) {
+		decl.name.Space = n.targetNS
+	}
+	decl.typ = anySimpleType
+	var err error
+	if t, ok := n.attrValue("type"); ok {
+		decl.typ, err = s.lookupSimpleType(t, n)
+	}
+	for _, child := range n.children {
+		if child.name.Local == "simpleType" {
+			decl.typ, err = s.compileSimpleType(child)
+		}
+	}
+	return decl, err
+}
+
+func occurs(n *node) (min, max int, err error) {
+	min, max = 1, 1
+	if v, ok := n.attrValue("minOccurs"); ok {
+		min, err = strconv.Atoi(v)
+		if err != nil || min < 0 {
+			return 0, 0, n.errorf("invalid minOccurs %q", v)
+		}
+	}
+	if v, ok := n.attrValue("maxOccurs"); ok {
+		if v == "unbounded" {
+			return min, unbounded, nil
+		}
+		max, err = strconv.Atoi(v)
+		if err != nil || max < 0 || max < min {
+			return 0, 0, n.errorf("invalid maxOccurs %q", v)
+		}
+	}
+	return min, max, nil
+}
+
+func newComplexType(n *node) *complexType {
+	return &complexType{
+		attrs:    make(map[xml.Name]*attrDecl),
+		mixed:    n.attr["mixed"] == "true",
+		elements: make(map[xml.Name]*elementDecl),
+	}
+}
+
+func (s *Schema) compileComplexType(n *node) (*complexType, error) {
+	t := newComplexType(n)
+	if err := s.compileComplexContent(t, n); err != nil {
+		return nil, err
+	}
+	return t, t.indexContent(n)
+}
+
+// compileComplexContent adds the content model and attributes defined by the
+// children of n to t.
+func (s *Schema) compileComplexContent(t *complexType, n *node) error {
+	for _, child := range n.children {
+		switch child.name.Local {
+		case "sequence", "choice", "all", "group":
+			p, err := s.compileParticle(child)
+			if err != nil {
+				return err
+			}
+			if t.content == nil {
+				t.content = p
+			} else {
+				t.content = &particle{kind: sequenceParticle, min: 1, max: 1, children: []*particle{t.content, p}}
+			}
+		case "attribute", "attributeGroup", "anyAttribute":
+			if err := s.compileAttrUse(t, child); err != nil {
+				return err
+			}
+		case "complexContent", "simpleContent":
+			if child.attr["mixed"] == "true" {
+				t.mixed = true
+			}
+			for _, deriv := range child.children {
+				if deriv.name.Local != "extension" && deriv.name.Local != "restriction" {
+					continue
+				}
+				base, err := deriv.qname(deriv.attr["base"])
+				if err != nil {
+					return err
+				}
+				bt, err := s.lookupType(base, deriv)
+				if err != nil {
+					return err
+				}
+				switch bt := bt.(type) {
+				case *simpleType:
+					t.simple = bt
+					if deriv.name.Local == "restriction" {
+						st, err := s.restrict(bt, deriv)
+						if err != nil {
+							return err
+						}
+						t.simple = st
+					}
+				case *complexType:
+					t.simple = bt.simple
+					if t.simple != nil && deriv.name.Local == "restriction" {
+						st, err := s.restrict(t.simple, deriv)
+						if err != nil {
+							return err
+						}
+						t.simple = st
+					}
+					for name, a := range bt.attrs {
+						t.attrs[name] = a
+					}
+					if deriv.name.Local == "extension" {
+						t.anyAttr = bt.anyAttr
+						t.content = bt.content
+						t.mixed = t.mixed || bt.mixed
+					}
+				}
+				if err := s.compileComplexContent(t, deriv); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compileAttrUse(t *complexType, n *node) error {
+	switch n.name.Local {
+	case "attribute":
+		if n.attr["use"] == "prohibited" {
+			return nil
+		}
+		decl, err := s.compileAttr(n, false)
+		if err != nil {
+			return err
+		}
+		t.attrs[decl.name] = decl
+	case "attributeGroup":
+		name, err := n.qname(n.attr["ref"])
+		if err != nil {
+			return err
+		}
+		def, ok := s.attrGroups[name]
+		if !ok {
+			return n.errorf("undefined attribute group %s", name.Local)
+		}
+		for _, child := range def.children {
+			if err := s.compileAttrUse(t, child); err != nil {
+				return err
+			}
+		}
+	case "anyAttribute":
+		t.anyAttr = wildcard(n)
+	}
+	return nil
+}
+
+func (s *Schema) compileParticle(n *node) (*particle, error) {
+	min, max, err := occurs(n)
+	if err != nil {
+		return nil, err
+	}
+	p := &particle{min: min, max: max}
+	switch n.name.Local {
+	case "element":
+		p.kind = elementParticle
+		p.elem, err = s.compileElement(n, false)
+		return p, err
+	case "any":
+		w := wildcard(n)
+		w.min, w.max = min, max
+		return w, nil
+	case "group":
+		name, err := n.qname(n.attr["ref"])
+		if err != nil {
+			return nil, err
+		}
+		def, ok := s.groups[name]
+		if !ok {
+			return nil, n.errorf("undefined group %s", name.Local)
+		}
+		for _, child := range def.children {
+			switch child.name.Local {
+			case "sequence", "choice", "all":
+				g, err := s.compileParticle(child)
+				if err != nil {
+					return nil, err
+				}
+				p.kind, p.children = sequenceParticle, []*particle{g}
+				return p, nil
+			}
+		}
+		return nil, n.errorf("group %s has no content", name.Local)
+	case "sequence":
+		p.kind = sequenceParticle
+	case "choice":
+		p.kind = choiceParticle
+	case "all":
+		p.kind = allParticle
+	default:
+		return nil, n.errorf("unexpected %s", n.name.Local)
+	}
+	for _, child := range n.children {
+		c, err := s.compileParticle(child)
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, c)
+	}
+	return p, nil
+}
+
+// wildcard compiles an any or anyAttribute element.
+func wildcard(n *node) *particle {
+	p := &particle{kind: anyParticle, min: 1, max: 1, process: n.attr["processContents"]}
+	if p.process == "" {
+		p.process = "strict"
+	}
+	ns, ok := n.attrValue("namespace")
+	if !ok {
+		ns = "##any"
+	}
+	for _, v := range strings.Fields(ns) {
+		switch v {
+		case "##any":
+			return p
+		case "##other":
+			p.not = append(p.not, n.targetNS, "")
+		case "##targetNamespace":
+			p.spaces = append(p.spaces, n.targetNS)
+		case "##local":
+			p.spaces = append(p.spaces, "")
+		default:
+			p.spaces = append(p.spaces, v)
+		}
+	}
+	if p.spaces == nil && p.not == nil {
+		// An empty list of namespaces matches nothing.
+		p.spaces = []string{}
+	}
+	return p
+}
+
+// allows reports whether a wildcard matches a namespace.
+func (p *particle) allows(space string) bool {
+	for _, v := range p.not {
+		if v == space {
+			return false
+		}
+	}
+	if p.spaces == nil {
+		return true
+	}
+	for _, v := range p.spaces {
+		if v == space {
+			return true
+		}
+	}
+	return false
+}
+
+// indexContent records the element declarations in the content model of a
+// complex type defined by n.
+func (t *complexType) indexContent(n *node) error {
+	if t.content == nil {
+		return nil
+	}
+	if err := t.index(t.content); err != nil {
+		return n.errorf("%v", err)
+	}
+	return nil
+}
+
+// index records the element declarations in a content model.
+func (t *complexType) index(p *particle) error {
+	switch p.kind {
+	case anyParticle:
+		t.wildcards = append(t.wildcards, p)
+		return nil
+	case elementParticle:
+		if d, ok := t.elements[p.elem.name]; ok && d != p.elem && d.typ != p.elem.typ {
+			return fmt.Errorf("element %s declared with different types", p.elem.name.Local)
+		}
+		t.elements[p.elem.name] = p.elem
+		return nil
+	}
+	for _, c := range p.children {
+		if err := t.index(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) compileSimpleType(n *node) (*simpleType, error) {
+	for _, child := range n.children {
+		switch child.name.Local {
+		case "restriction":
+			var base *simpleType
+			if v, ok := child.attrValue("base"); ok {
+				var err error
+				base, err = s.lookupSimpleType(v, child)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				for _, c := range child.children {
+					if c.name.Local == "simpleType" {
+						var err error
+						base, err = s.compileSimpleType(c)
+						if err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+			if base == nil {
+				return nil, child.errorf("restriction has no base type")
+			}
+			return s.restrict(base, child)
+		case "list":
+			var item *simpleType
+			var err error
+			if v, ok := child.attrValue("itemType"); ok {
+				item, err = s.lookupSimpleType(v, child)
+			}
+			for _, c := range child.children {
+				if c.name.Local == "simpleType" {
+					item, err = s.compileSimpleType(c)
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			if item == nil {
+				return nil, child.errorf("list has no item type")
+			}
+			return &simpleType{list: item}, nil
+		case "union":
+			t := &simpleType{}
+			for _, v := range strings.Fields(child.attr["memberTypes"]) {
+				member, err := s.lookupSimpleType(v, child)
+				if err != nil {
+					return nil, err
+				}
+				t.union = append(t.union, member)
+			}
+			for _, c := range child.children {
+				if c.name.Local == "simpleType" {
+					member, err := s.compileSimpleType(c)
+					if err != nil {
+						return nil, err
+					}
+					t.union = append(t.union, member)
+				}
+			}
+			return t, nil
+		}
+	}
+	return nil, n.errorf("simple type has no restriction, list, or union")
+}
+
+// restrict derives a simple type from base using the facets that are children
+// of n.
+func (s *Schema) restrict(base *simpleType, n *node) (*simpleType, error) {
+	t := &simpleType{base: base}
+	for _, facet := range n.children {
+		v := facet.attr["value"]
+		switch facet.name.Local {
+		case "enumeration":
+			t.enum = append(t.enum, v)
+		case "pattern":
+			re, err := regexp.Compile(`^(?:` + v + `)$`)
+			if err != nil {
+				return nil, facet.errorf("unsupported pattern %q", v)
+			}
+			t.pattern = append(t.pattern, re)
+		case "length", "minLength", "maxLength":
+			l, err := strconv.Atoi(v)
+			if err != nil || l < 0 {
+				return nil, facet.errorf("invalid %s %q", facet.name.Local, v)
+			}
+			t.length = append(t.length, lengthFacet{kind: facet.name.Local, n: l})
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			bound, err := base.parse(v)
+			if err != nil {
+				return nil, facet.errorf("invalid %s %q", facet.name.Local, v)
+			}
+			t.bounds = append(t.bounds, boundFacet{kind: facet.name.Local, value: bound})
+		}
+	}
+	return t, nil
+}
+
+// parse validates a value and returns it converted by its primitive type.
+func (t *simpleType) parse(v string) (interface{}, error) {
+	switch {
+	case t.builtin != nil:
+		return t.builtin.Parse(v)
+	case t.list != nil:
+		items := strings.Fields(v)
+		for _, item := range items {
+			if _, err := t.list.parse(item); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	case t.union != nil:
+		var err error
+		for _, member := range t.union {
+			var val interface{}
+			val, err = member.parse(v)
+			if err == nil {
+				return val, nil
+			}
+		}
+		if err == nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("value %q does not match any member of union", v)
+	}
+	val, err := t.base.parse(v)
+	if err != nil {
+		return nil, err
+	}
+	v = t.normalize(v)
+	if len(t.enum) > 0 {
+		found := false
+		for _, e := range t.enum {
+			if e == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("value %q is not one of the allowed values", v)
+		}
+	}
+	for _, re := range t.pattern {
+		if !re.MatchString(v) {
+			return nil, fmt.Errorf("value %q does not match pattern %q", v, strings.TrimSuffix(strings.TrimPrefix(re.String(), "^(?:"), ")$"))
+		}
+	}
+	for _, l := range t.length {
+		n := length(val)
+		if (l.kind == "length" && n != l.n) || (l.kind == "minLength" && n < l.n) || (l.kind == "maxLength" && n > l.n) {
+			return nil, fmt.Errorf("value %q violates %s %d", v, l.kind, l.n)
+		}
+	}
+	for _, b := range t.bounds {
+		c, ok := compare(val, b.value)
+		if !ok {
+			continue
+		}
+		if (b.kind == "minInclusive" && c < 0) || (b.kind == "maxInclusive" && c > 0) ||
+			(b.kind == "minExclusive" && c <= 0) || (b.kind == "maxExclusive" && c >= 0) {
+			return nil, fmt.Errorf("value %q violates %s %v", v, b.kind, b.value)
+		}
+	}
+	return val, nil
+}
+
+// normalize applies the whitespace facet of the primitive type to v.
+func (t *simpleType) normalize(v string) string {
+	for t.base != nil {
+		t = t.base
+	}
+	switch {
+	case t.builtin != nil:
+		return normalize(v, t.builtin.ws)
+	case t.list != nil:
+		return normalize(v, collapse)
+	}
+	return v
+}
+
+// length returns the length of a value as defined by the length facets.
+func length(v interface{}) int {
+	switch v := v.(type) {
+	case string:
+		return len([]rune(v))
+	case []byte:
+		return len(v)
+	case []string:
+		return len(v)
+	}
+	return 0
+}
+
+// compare compares two values of the same ordered primitive type.
+// It reports false if the values are not comparable.
+func compare(a, b interface{}) (int, bool) {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		switch {
+		case !ok:
+			return 0, false
+		case ta.Before(tb):
+			return -1, true
+		case ta.After(tb):
+			return 1, true
+		}
+		return 0, true
+	}
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA || okB {
+		if !okA || !okB || math.IsNaN(fa) || math.IsNaN(fb) {
+			return 0, false
+		}
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	ra, okA := toRat(a)
+	rb, okB := toRat(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	return ra.Cmp(rb), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toRat(v interface{}) (*big.Rat, bool) {
+	switch v := v.(type) {
+	case *big.Rat:
+		return v, true
+	case *big.Int:
+		return new(big.Rat).SetInt(v), true
+	case int8:
+		return big.NewRat(int64(v), 1), true
+	case int16:
+		return big.NewRat(int64(v), 1), true
+	case int32:
+		return big.NewRat(int64(v), 1), true
+	case int64:
+		return big.NewRat(v, 1), true
+	case uint8:
+		return big.NewRat(int64(v), 1), true
+	case uint16:
+		return big.NewRat(int64(v), 1), true
+	case uint32:
+		return big.NewRat(int64(v), 1), true
+	case uint64:
+		return new(big.Rat).SetInt(new(big.Int).SetUint64(v)), true
+	}
+	return nil, false
+}
@@ -0,0 +1,190 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xsd_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/xsd"
+)
+
+const testSchema = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"
+           xmlns:t="urn:example" targetNamespace="urn:example"
+           elementFormDefault="qualified">
+  <xs:annotation><xs:documentation>Test schema.</xs:documentation></xs:annotation>
+  <xs:element name="order" type="t:order"/>
+  <xs:element name="note" type="xs:string"/>
+  <xs:complexType name="base">
+    <xs:sequence>
+      <xs:element name="id" type="t:sku"/>
+    </xs:sequence>
+    <xs:attribute name="version" type="xs:int" use="required"/>
+  </xs:complexType>
+  <xs:complexType name="order">
+    <xs:complexContent>
+      <xs:extension base="t:base">
+        <xs:sequence>
+          <xs:choice>
+            <xs:element name="email" type="xs:string"/>
+            <xs:element name="phone" type="xs:string"/>
+          </xs:choice>
+          <xs:element name="item" type="t:item" maxOccurs="unbounded"/>
+          <xs:element name="tags" minOccurs="0">
+            <xs:simpleType><xs:list itemType="xs:NCName"/></xs:simpleType>
+          </xs:element>
+          <xs:any namespace="##other" processContents="lax" minOccurs="0"/>
+        </xs:sequence>
+        <xs:attribute name="status" default="new">
+          <xs:simpleType>
+            <xs:restriction base="xs:token">
+              <xs:enumeration value="new"/>
+              <xs:enumeration value="shipped"/>
+            </xs:restriction>
+          </xs:simpleType>
+        </xs:attribute>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+  <xs:complexType name="item">
+    <xs:simpleContent>
+      <xs:extension base="t:quantity">
+        <xs:attribute name="sku" type="t:sku" use="required"/>
+      </xs:extension>
+    </xs:simpleContent>
+  </xs:complexType>
+  <xs:complexType name="part" mixed="true">
+    <xs:sequence>
+      <xs:element name="part" type="t:part" minOccurs="0" maxOccurs="2"/>
+    </xs:sequence>
+  </xs:complexType>
+  <xs:element name="part" type="t:part"/>
+  <xs:element name="contact">
+    <xs:complexType>
+      <xs:all>
+        <xs:element name="name" type="xs:string"/>
+        <xs:element name="age" type="xs:int" minOccurs="0"/>
+      </xs:all>
+    </xs:complexType>
+  </xs:element>
+  <xs:simpleType name="sku">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="[A-Z]{2}-\d+"/>
+    </xs:restriction>
+  </xs:simpleType>
+  <xs:simpleType name="quantity">
+    <xs:restriction base="xs:positiveInteger">
+      <xs:maxExclusive value="100"/>
+    </xs:restriction>
+  </xs:simpleType>
+</xs:schema>`
+
+var validateTestCases = [...]struct {
+	in         string
+	violations []string
+}{
+	0: {
+		in: `<order xmlns="urn:example" version="1" status="shipped"><id>AB-1</id><phone>5</phone><item sku="AB-1">3</item><item sku="CD-2">99</item><tags>a b</tags><x:y xmlns:x="urn:other"><z/></x:y></order>`,
+	},
+	1: {
+		in:         `<order xmlns="urn:example"><id>AB-1</id><email/><item sku="AB-1">3</item></order>`,
+		violations: []string{"xsd: /order (line 1, column 1): missing required attribute version"},
+	},
+	2: {
+		in: `<order xmlns="urn:example" version="x" status="lost" extra="1"><id>ab</id><email/><item sku="AB-1">100</item></order>`,
+		violations: []string{
+			`xsd: /order (line 1, column 1): attribute version: invalid xs:int value "x": invalid syntax`,
+			`xsd: /order (line 1, column 1): attribute status: value "lost" is not one of the allowed values`,
+			`xsd: /order (line 1, column 1): attribute extra is not allowed`,
+			`xsd: /order/id (line 1, column 64): value "ab" does not match pattern "[A-Z]{2}-\\d+"`,
+			`xsd: /order/item (line 1, column 83): value "100" violates maxExclusive 100`,
+		},
+	},
+	3: {
+		in:         "<order xmlns='urn:example' version='1'>\n<id>AB-1</id>\n<item sku='AB-1'>1</item>\n</order>",
+		violations: []string{"xsd: /order/item (line 3, column 1): element item is not allowed here"},
+	},
+	4: {
+		in:         `<order xmlns="urn:example" version="1"><id>AB-1</id><email/></order>`,
+		violations: []string{"xsd: /order (line 1, column 61): content of element order is incomplete"},
+	},
+	5: {
+		in: `<order xmlns="urn:example" version="1"><id>AB-1</id>text<email/><item sku="AB-1">1</item><tags>a 1</tags></order>`,
+		violations: []string{
+			"xsd: /order (line 1, column 53): character data is not allowed",
+			`xsd: /order/tags (line 1, column 90): invalid xs:NCName value "1": invalid syntax`,
+		},
+	},
+	6: {
+		in:         `<order version="1"/>`,
+		violations: []string{"xsd: /order (line 1, column 1): no declaration for element order"},
+	},
+	7: {
+		in: `<part xmlns="urn:example">a<part>b<part/></part><part/></part>`,
+	},
+	8: {
+		in:         `<part xmlns="urn:example"><part/><part/><part/></part>`,
+		violations: []string{"xsd: /part/part (line 1, column 41): element part is not allowed here"},
+	},
+	9: {
+		in:         `<note xmlns="urn:example"><b/></note>`,
+		violations: []string{"xsd: /note/b (line 1, column 27): element b is not allowed in simple content"},
+	},
+	10: {
+		in: `<contact xmlns="urn:example"><age>3</age><name/></contact>`,
+	},
+	11: {
+		in:         `<contact xmlns="urn:example"><age>3</age></contact>`,
+		violations: []string{"xsd: /contact (line 1, column 42): content of element contact is incomplete"},
+	},
+	12: {
+		in:         `<contact xmlns="urn:example"><name/><name/></contact>`,
+		violations: []string{"xsd: /contact/name (line 1, column 37): element name is not allowed here"},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Compile(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("error compiling schema: %v", err)
+	}
+	for i, tc := range validateTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			violations, err := s.Validate(xml.NewTokenizer(strings.NewReader(tc.in)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, v := range violations {
+				got = append(got, v.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.violations, "\n") {
+				t.Errorf("wrong violations:\nwant=%q\n got=%q", tc.violations, got)
+			}
+		})
+	}
+}
+
+var compileErrorTestCases = [...]string{
+	0: `<schema/>`,
+	1: `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="b"/></xs:schema>`,
+	2: `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a" type="p:b"/></xs:schema>`,
+	3: `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:simpleType name="a"><xs:restriction base="a"/></xs:simpleType></xs:schema>`,
+	4: `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:element name="a"><xs:complexType><xs:sequence><xs:element name="b" minOccurs="2" maxOccurs="1"/></xs:sequence></xs:complexType></xs:element></xs:schema>`,
+}
+
+func TestCompileError(t *testing.T) {
+	for i, tc := range compileErrorTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			_, err := Compile(strings.NewReader(tc))
+			if err == nil {
+				t.Errorf("expected error compiling schema")
+			}
+		})
+	}
+}
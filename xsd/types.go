@@ -0,0 +1,595 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+// Package xsd implements XML Schema (XSD) datatypes and validation.
+//
+// Schema documents are compiled with Compile and the resulting Schema
+// validates token streams, reporting each part of the document that does not
+// conform along with its position.
+//
+// Values are converted from their lexical representation to Go values as
+// follows:
+//
+//   - string, normalizedString, token, language, Name, NCName, NMTOKEN, ID,
+//     IDREF, and ENTITY: string
+//   - boolean: bool
+//   - decimal: *big.Rat
+//   - integer, nonPositiveInteger, negativeInteger, nonNegativeInteger, and
+//     positiveInteger: *big.Int
+//   - long, int, short, and byte: int64, int32, int16, and int8
+//   - unsignedLong, unsignedInt, unsignedShort, and unsignedByte: uint64,
+//     uint32, uint16, and uint8
+//   - float and double: float32 and float64
+//   - dateTime, date, and time: time.Time
+//   - anyURI: *url.URL
+//   - base64Binary and hexBinary: []byte
+//
+// Values of date and time types without a timezone are returned in UTC.
+// Durations, the Gregorian partial date types, and types that depend on
+// namespace context such as QName are not supported.
+package xsd // import "mellium.im/xml/xsd"
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"mellium.im/xml"
+)
+
+type whitespace int
+
+const (
+	preserve whitespace = iota
+	replace
+	collapse
+)
+
+// Type is a built-in simple type.
+type Type struct {
+	name  string
+	ws    whitespace
+	parse func(string) (interface{}, error)
+}
+
+// ValueError is returned when a value is not valid for a type.
+type ValueError struct {
+	Type  string
+	Value string
+	Err   error
+}
+
+func (e *ValueError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("xsd: invalid xs:%s value %q: %v", e.Type, e.Value, e.Err)
+	}
+	return fmt.Sprintf("xsd: invalid xs:%s value %q", e.Type, e.Value)
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// Name returns the local name of the type in the XML Schema namespace.
+func (t *Type) Name() string {
+	return t.name
+}
+
+// Parse applies the whitespace rules of the type to s and converts it to a Go
+// value.
+func (t *Type) Parse(s string) (interface{}, error) {
+	s = normalize(s, t.ws)
+	v, err := t.parse(s)
+	if err != nil {
+		var verr *ValueError
+		if errors.As(err, &verr) {
+			return nil, err
+		}
+		return nil, &ValueError{Type: t.name, Value: s, Err: err}
+	}
+	return v, nil
+}
+
+// Validate reports whether s is a valid lexical representation of the type.
+func (t *Type) Validate(s string) error {
+	_, err := t.Parse(s)
+	return err
+}
+
+// ParseAttr parses the value of the attribute of start with the given name.
+// If there is no such attribute it returns nil and false.
+func ParseAttr(start xml.StartElement, name xml.Name, t *Type) (interface{}, bool, error) {
+	for _, a := range start.Attr {
+		if a.Name == name {
+			v, err := t.Parse(a.Value)
+			return v, true, err
+		}
+	}
+	return nil, false, nil
+}
+
+// ParseText reads tokens from r until io.EOF and parses the character data
+// that it contains.
+// It is an error if r contains any elements.
+// To parse the content of an element pass the result of xml.Inner.
+func ParseText(r xml.TokenReader, t *Type) (interface{}, error) {
+	var text strings.Builder
+	for {
+		tok, err := r.Token()
+		if st, ok := tok.(xml.SourceToken); ok {
+			tok = st.Token
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			text.Write(tok)
+		case xml.CDATA:
+			text.Write(tok)
+		case xml.StartElement:
+			return nil, fmt.Errorf("xsd: unexpected element <%s> in xs:%s value", tok.Name.Local, t.name)
+		}
+		if err == io.EOF {
+			return t.Parse(text.String())
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+var types = make(map[string]*Type)
+
+func newType(name string, ws whitespace, parse func(string) (interface{}, error)) *Type {
+	t := &Type{name: name, ws: ws, parse: parse}
+	types[name] = t
+	return t
+}
+
+// Lookup returns the built-in type with the given local name, or nil if there
+// is no such type or it is not supported.
+func Lookup(name string) *Type {
+	return types[name]
+}
+
+// Built-in types.
+var (
+	String           = newType("string", preserve, parseString)
+	NormalizedString = newType("normalizedString", replace, parseString)
+	Token            = newType("token", collapse, parseString)
+	Language         = newType("language", collapse, parseLanguage)
+	NMTOKEN          = newType("NMTOKEN", collapse, parseNMTOKEN)
+	Name             = newType("Name", collapse, parseName)
+	NCName           = newType("NCName", collapse, parseNCName)
+	ID               = newType("ID", collapse, parseNCName)
+	IDREF            = newType("IDREF", collapse, parseNCName)
+	ENTITY           = newType("ENTITY", collapse, parseNCName)
+
+	Boolean = newType("boolean", collapse, parseBoolean)
+	Decimal = newType("decimal", collapse, parseDecimal)
+	Float   = newType("float", collapse, parseFloat32)
+	Double  = newType("double", collapse, parseFloat64)
+
+	Integer            = newType("integer", collapse, bigRange(nil, nil))
+	NonPositiveInteger = newType("nonPositiveInteger", collapse, bigRange(nil, big.NewInt(0)))
+	NegativeInteger    = newType("negativeInteger", collapse, bigRange(nil, big.NewInt(-1)))
+	NonNegativeInteger = newType("nonNegativeInteger", collapse, bigRange(big.NewInt(0), nil))
+	PositiveInteger    = newType("positiveInteger", collapse, bigRange(big.NewInt(1), nil))
+	Long               = newType("long", collapse, parseInt(64))
+	Int                = newType("int", collapse, parseInt(32))
+	Short              = newType("short", collapse, parseInt(16))
+	Byte               = newType("byte", collapse, parseInt(8))
+	UnsignedLong       = newType("unsignedLong", collapse, parseUint(64))
+	UnsignedInt        = newType("unsignedInt", collapse, parseUint(32))
+	UnsignedShort      = newType("unsignedShort", collapse, parseUint(16))
+	UnsignedByte       = newType("unsignedByte", collapse, parseUint(8))
+
+	DateTime = newType("dateTime", collapse, parseDateTime)
+	Date     = newType("date", collapse, parseDate)
+	Time     = newType("time", collapse, parseTime)
+
+	AnyURI       = newType("anyURI", collapse, parseAnyURI)
+	Base64Binary = newType("base64Binary", collapse, parseBase64)
+	HexBinary    = newType("hexBinary", collapse, parseHex)
+)
+
+// normalize applies a whitespace facet.
+func normalize(s string, ws whitespace) string {
+	if ws == preserve {
+		return s
+	}
+	s = strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+	if ws == replace {
+		return s
+	}
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == ' ' }), " ")
+}
+
+var (
+	errSyntax = errors.New("invalid syntax")
+	errRange  = errors.New("value out of range")
+)
+
+func parseString(s string) (interface{}, error) {
+	return s, nil
+}
+
+func parseBoolean(s string) (interface{}, error) {
+	switch s {
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
+	}
+	return nil, errSyntax
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// integerSyntax reports whether s is an optionally signed string of digits.
+func integerSyntax(s string) bool {
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		s = s[1:]
+	}
+	return isDigits(s)
+}
+
+func parseDecimal(s string) (interface{}, error) {
+	sign := ""
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		sign, s = s[:1], s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	if (whole != "" && !isDigits(whole)) || (frac != "" && !isDigits(frac)) || (whole == "" && frac == "") {
+		return nil, errSyntax
+	}
+	r, ok := new(big.Rat).SetString(sign + "0" + whole + "." + frac + "0")
+	if !ok {
+		return nil, errSyntax
+	}
+	return r, nil
+}
+
+func parseFloat(s string, bits int) (float64, error) {
+	switch s {
+	case "INF", "+INF":
+		return math.Inf(1), nil
+	case "-INF":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	mantissa, exp, hasExp := strings.Cut(strings.ToLower(s), "e")
+	if hasExp && !integerSyntax(exp) {
+		return 0, errSyntax
+	}
+	if _, err := parseDecimal(mantissa); err != nil {
+		return 0, errSyntax
+	}
+	f, err := strconv.ParseFloat(s, bits)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return 0, errSyntax
+	}
+	// Values too large for the type round to infinity as in the XSD value
+	// space.
+	return f, nil
+}
+
+func parseFloat32(s string) (interface{}, error) {
+	f, err := parseFloat(s, 32)
+	return float32(f), err
+}
+
+func parseFloat64(s string) (interface{}, error) {
+	return parseFloat(s, 64)
+}
+
+func bigRange(min, max *big.Int) func(string) (interface{}, error) {
+	return func(s string) (interface{}, error) {
+		if !integerSyntax(s) {
+			return nil, errSyntax
+		}
+		i, ok := new(big.Int).SetString(strings.TrimPrefix(s, "+"), 10)
+		if !ok {
+			return nil, errSyntax
+		}
+		if (min != nil && i.Cmp(min) < 0) || (max != nil && i.Cmp(max) > 0) {
+			return nil, errRange
+		}
+		return i, nil
+	}
+}
+
+func parseInt(bits int) func(string) (interface{}, error) {
+	return func(s string) (interface{}, error) {
+		if !integerSyntax(s) {
+			return nil, errSyntax
+		}
+		i, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, errRange
+		}
+		switch bits {
+		case 8:
+			return int8(i), nil
+		case 16:
+			return int16(i), nil
+		case 32:
+			return int32(i), nil
+		}
+		return i, nil
+	}
+}
+
+func parseUint(bits int) func(string) (interface{}, error) {
+	return func(s string) (interface{}, error) {
+		if !integerSyntax(s) {
+			return nil, errSyntax
+		}
+		neg := s[0] == '-'
+		s = strings.TrimLeft(s, "+-")
+		i, err := strconv.ParseUint(s, 10, bits)
+		if err != nil || (neg && i != 0) {
+			return nil, errRange
+		}
+		switch bits {
+		case 8:
+			return uint8(i), nil
+		case 16:
+			return uint16(i), nil
+		case 32:
+			return uint32(i), nil
+		}
+		return i, nil
+	}
+}
+
+func parseAnyURI(s string) (interface{}, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, errSyntax
+	}
+	return u, nil
+}
+
+func parseBase64(s string) (interface{}, error) {
+	b, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		return nil, errSyntax
+	}
+	return b, nil
+}
+
+func parseHex(s string) (interface{}, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, errSyntax
+	}
+	return b, nil
+}
+
+func parseLanguage(s string) (interface{}, error) {
+	for i, part := range strings.Split(s, "-") {
+		if len(part) < 1 || len(part) > 8 {
+			return nil, errSyntax
+		}
+		for _, c := range part {
+			alpha := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+			if !alpha && (i == 0 || c < '0' || c > '9') {
+				return nil, errSyntax
+			}
+		}
+	}
+	return s, nil
+}
+
+func parseNMTOKEN(s string) (interface{}, error) {
+	if s == "" {
+		return nil, errSyntax
+	}
+	for _, c := range s {
+		if !isNameChar(c) && c != ':' {
+			return nil, errSyntax
+		}
+	}
+	return s, nil
+}
+
+func parseName(s string) (interface{}, error) {
+	for i, c := range s {
+		if !isNameStartChar(c) && c != ':' && (i == 0 || !isNameChar(c)) {
+			return nil, errSyntax
+		}
+	}
+	if s == "" {
+		return nil, errSyntax
+	}
+	return s, nil
+}
+
+func parseNCName(s string) (interface{}, error) {
+	if strings.ContainsRune(s, ':') {
+		return nil, errSyntax
+	}
+	return parseName(s)
+}
+
+// isNameStartChar reports whether c may begin an NCName.
+func isNameStartChar(c rune) bool {
+	return c == '_' ||
+		'A' <= c && c <= 'Z' ||
+		'a' <= c && c <= 'z' ||
+		0xC0 <= c && c <= 0xD6 ||
+		0xD8 <= c && c <= 0xF6 ||
+		0xF8 <= c && c <= 0x2FF ||
+		0x370 <= c && c <= 0x37D ||
+		0x37F <= c && c <= 0x1FFF ||
+		0x200C <= c && c <= 0x200D ||
+		0x2070 <= c && c <= 0x218F ||
+		0x2C00 <= c && c <= 0x2FEF ||
+		0x3001 <= c && c <= 0xD7FF ||
+		0xF900 <= c && c <= 0xFDCF ||
+		0xFDF0 <= c && c <= 0xFFFD && c != utf8.RuneError ||
+		0x10000 <= c && c <= 0xEFFFF
+}
+
+// isNameChar reports whether c may appear after the first character of an
+// NCName.
+func isNameChar(c rune) bool {
+	return isNameStartChar(c) ||
+		c == '-' || c == '.' || c == 0xB7 ||
+		'0' <= c && c <= '9' ||
+		0x300 <= c && c <= 0x36F ||
+		0x203F <= c && c <= 0x2040
+}
+
+// parseDateTime parses a dateTime of the form
+// -?YYYY-MM-DDThh:mm:ss(.s+)?(zzzzzz)?
+func parseDateTime(s string) (interface{}, error) {
+	date, clock, ok := strings.Cut(s, "T")
+	if !ok {
+		return nil, errSyntax
+	}
+	y, m, d, rest, err := splitDate(date)
+	if err != nil || rest != "" {
+		return nil, errSyntax
+	}
+	return buildTime(y, m, d, clock, true)
+}
+
+func parseDate(s string) (interface{}, error) {
+	y, m, d, rest, err := splitDate(s)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := parseZone(rest)
+	if err != nil {
+		return nil, err
+	}
+	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, loc), nil
+}
+
+func parseTime(s string) (interface{}, error) {
+	return buildTime(0, 1, 1, s, false)
+}
+
+// splitDate parses the date portion of a date or dateTime and returns any text
+// that follows it.
+func splitDate(s string) (year, month, day int, rest string, err error) {
+	neg := strings.HasPrefix(s, "-")
+	if neg {
+		s = s[1:]
+	}
+	i := strings.IndexByte(s, '-')
+	if i < 4 || (i > 4 && s[0] == '0') || !isDigits(s[:i]) || len(s) < i+6 || s[i+3] != '-' {
+		return 0, 0, 0, "", errSyntax
+	}
+	year, err = strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, 0, 0, "", errRange
+	}
+	if neg {
+		year = -year
+	}
+	if !isDigits(s[i+1:i+3]) || !isDigits(s[i+4:i+6]) {
+		return 0, 0, 0, "", errSyntax
+	}
+	month, _ = strconv.Atoi(s[i+1 : i+3])
+	day, _ = strconv.Atoi(s[i+4 : i+6])
+	if month < 1 || month > 12 || day < 1 || day > daysIn(year, month) {
+		return 0, 0, 0, "", errRange
+	}
+	return year, month, day, s[i+6:], nil
+}
+
+func daysIn(year, month int) int {
+	return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// buildTime parses a time of the form hh:mm:ss(.s+)?(zzzzzz)? and combines it
+// with a date.
+// An end of day time of 24:00:00 is allowed for dateTime values and becomes
+// the start of the next day.
+func buildTime(year, month, day int, s string, endOfDay bool) (time.Time, error) {
+	if len(s) < 8 || s[2] != ':' || s[5] != ':' || !isDigits(s[:2]) || !isDigits(s[3:5]) || !isDigits(s[6:8]) {
+		return time.Time{}, errSyntax
+	}
+	hour, _ := strconv.Atoi(s[:2])
+	min, _ := strconv.Atoi(s[3:5])
+	sec, _ := strconv.Atoi(s[6:8])
+	s = s[8:]
+	nsec := 0
+	if strings.HasPrefix(s, ".") {
+		end := 1
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		if end == 1 {
+			return time.Time{}, errSyntax
+		}
+		frac := s[1:end]
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		nsec, _ = strconv.Atoi(frac + strings.Repeat("0", 9-len(frac)))
+		s = s[end:]
+	}
+	loc, err := parseZone(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch {
+	case hour == 24 && min == 0 && sec == 0 && nsec == 0 && endOfDay:
+		return time.Date(year, time.Month(month), day+1, 0, 0, 0, 0, loc), nil
+	case hour > 23 || min > 59 || sec > 59:
+		return time.Time{}, errRange
+	}
+	return time.Date(year, time.Month(month), day, hour, min, sec, nsec, loc), nil
+}
+
+// parseZone parses an optional timezone of the form Z or (+|-)hh:mm.
+func parseZone(s string) (*time.Location, error) {
+	switch {
+	case s == "" || s == "Z":
+		return time.UTC, nil
+	case len(s) != 6 || (s[0] != '+' && s[0] != '-') || s[3] != ':' || !isDigits(s[1:3]) || !isDigits(s[4:]):
+		return nil, errSyntax
+	}
+	hour, _ := strconv.Atoi(s[1:3])
+	min, _ := strconv.Atoi(s[4:])
+	if hour > 14 || min > 59 || (hour == 14 && min != 0) {
+		return nil, errRange
+	}
+	offset := hour*3600 + min*60
+	if s[0] == '-' {
+		offset = -offset
+	}
+	if offset == 0 {
+		return time.UTC, nil
+	}
+	return time.FixedZone(s, offset), nil
+}
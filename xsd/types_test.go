@@ -0,0 +1,143 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xsd_test
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"mellium.im/xml"
+	. "mellium.im/xml/xsd"
+)
+
+var parseTestCases = [...]struct {
+	typ *Type
+	in  string
+	out interface{}
+	err bool
+}{
+	0:  {typ: Boolean, in: " true\n", out: true},
+	1:  {typ: Boolean, in: "0", out: false},
+	2:  {typ: Boolean, in: "True", err: true},
+	3:  {typ: Integer, in: "+0012", out: big.NewInt(12)},
+	4:  {typ: Integer, in: "1.0", err: true},
+	5:  {typ: PositiveInteger, in: "0", err: true},
+	6:  {typ: NonPositiveInteger, in: "-5", out: big.NewInt(-5)},
+	7:  {typ: Int, in: "-2147483648", out: int32(-2147483648)},
+	8:  {typ: Int, in: "2147483648", err: true},
+	9:  {typ: UnsignedByte, in: "255", out: uint8(255)},
+	10: {typ: UnsignedByte, in: "-0", out: uint8(0)},
+	11: {typ: UnsignedInt, in: "-1", err: true},
+	12: {typ: Decimal, in: "-.5", out: big.NewRat(-1, 2)},
+	13: {typ: Decimal, in: "3.", out: big.NewRat(3, 1)},
+	14: {typ: Decimal, in: ".", err: true},
+	15: {typ: Decimal, in: "1e3", err: true},
+	16: {typ: Double, in: "1.5E2", out: float64(150)},
+	17: {typ: Float, in: "-INF", out: float32(math.Inf(-1))},
+	18: {typ: Double, in: "Infinity", err: true},
+	19: {typ: DateTime, in: "2002-10-10T12:00:00-05:00", out: time.Date(2002, 10, 10, 12, 0, 0, 0, time.FixedZone("-05:00", -5*3600))},
+	20: {typ: DateTime, in: "2002-10-10T12:00:00.25Z", out: time.Date(2002, 10, 10, 12, 0, 0, 250000000, time.UTC)},
+	21: {typ: DateTime, in: "2002-12-31T24:00:00", out: time.Date(2003, 1, 1, 0, 0, 0, 0, time.UTC)},
+	22: {typ: DateTime, in: "2002-02-30T00:00:00", err: true},
+	23: {typ: DateTime, in: "02-10-10T12:00:00", err: true},
+	24: {typ: DateTime, in: "2002-10-10T12:00:00+15:00", err: true},
+	25: {typ: Date, in: "2000-02-29", out: time.Date(2000, 2, 29, 0, 0, 0, 0, time.UTC)},
+	26: {typ: Date, in: "2001-02-29", err: true},
+	27: {typ: Time, in: "13:20:00Z", out: time.Date(0, 1, 1, 13, 20, 0, 0, time.UTC)},
+	28: {typ: Time, in: "24:00:00", err: true},
+	29: {typ: AnyURI, in: " http://example.net/a?b ", out: &url.URL{Scheme: "http", Host: "example.net", Path: "/a", RawQuery: "b"}},
+	30: {typ: Base64Binary, in: "aGVs\n bG8=", out: []byte("hello")},
+	31: {typ: Base64Binary, in: "aGVsbG8", err: true},
+	32: {typ: HexBinary, in: "0FB7", out: []byte{0x0f, 0xb7}},
+	33: {typ: HexBinary, in: "0FB", err: true},
+	34: {typ: String, in: " a\tb ", out: " a\tb "},
+	35: {typ: NormalizedString, in: " a\tb ", out: " a b "},
+	36: {typ: Token, in: "  a \n b  ", out: "a b"},
+	37: {typ: Language, in: "en-US", out: "en-US"},
+	38: {typ: Language, in: "1en", err: true},
+	39: {typ: NCName, in: "a:b", err: true},
+	40: {typ: Name, in: "a:b", out: "a:b"},
+	41: {typ: NMTOKEN, in: "-1", out: "-1"},
+	42: {typ: ID, in: "1a", err: true},
+}
+
+func TestParse(t *testing.T) {
+	for i, tc := range parseTestCases {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			v, err := tc.typ.Parse(tc.in)
+			switch {
+			case tc.err:
+				var verr *ValueError
+				if !errors.As(err, &verr) {
+					t.Fatalf("expected a ValueError, got %v", err)
+				}
+				if verr.Type != tc.typ.Name() {
+					t.Errorf("wrong type in error: want=%q, got=%q", tc.typ.Name(), verr.Type)
+				}
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if r, ok := tc.out.(*big.Rat); ok {
+				if r.Cmp(v.(*big.Rat)) != 0 {
+					t.Errorf("wrong value: want=%v, got=%v", r, v)
+				}
+				return
+			}
+			if tm, ok := tc.out.(time.Time); ok {
+				got := v.(time.Time)
+				_, wantOff := tm.Zone()
+				_, gotOff := got.Zone()
+				if !tm.Equal(got) || wantOff != gotOff {
+					t.Errorf("wrong value: want=%v, got=%v", tm, got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(v, tc.out) {
+				t.Errorf("wrong value: want=%#v, got=%#v", tc.out, v)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if typ := Lookup("unsignedShort"); typ != UnsignedShort {
+		t.Errorf("wrong type: want=%v, got=%v", UnsignedShort, typ)
+	}
+	if typ := Lookup("duration"); typ != nil {
+		t.Errorf("expected no type, got %v", typ)
+	}
+}
+
+func TestParseText(t *testing.T) {
+	d := xml.NewTokenizer(strings.NewReader(`<a b="12"> 1<![CDATA[2]]>3 </a>`))
+	tok, err := d.Token()
+	if err != nil {
+		t.Fatalf("error reading start: %v", err)
+	}
+	start := tok.(xml.StartElement)
+	attr, ok, err := ParseAttr(start, xml.Name{Local: "b"}, Long)
+	if err != nil || !ok || attr != int64(12) {
+		t.Errorf("wrong attribute value: ok=%t, err=%v, value=%#v", ok, err, attr)
+	}
+	_, ok, _ = ParseAttr(start, xml.Name{Local: "c"}, Long)
+	if ok {
+		t.Errorf("expected missing attribute to not be found")
+	}
+	v, err := ParseText(xml.Inner(d), Integer)
+	if err != nil {
+		t.Fatalf("error parsing text: %v", err)
+	}
+	if v.(*big.Int).Int64() != 123 {
+		t.Errorf("wrong value: want=123, got=%v", v)
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2022 The Mellium Contributors.
+// Use of this source code is governed by the BSD 2-clause
+// license that can be found in the LICENSE file.
+
+package xsd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"mellium.im/xml"
+)
+
+// Violation describes a part of a document that does not conform to a schema.
+type Violation struct {
+	// Span is the position of the token that the violation was found in if the
+	// TokenReader has a Span method, such as an xml.Tokenizer.
+	Span xml.Span
+
+	// Path contains the names of the open elements, ending with the element
+	// that the violation applies to.
+	Path []xml.Name
+
+	// Msg describes the violation.
+	Msg string
+}
+
+// Error returns a human readable description of the violation.
+func (v Violation) Error() string {
+	var b strings.Builder
+	b.WriteString("xsd: ")
+	for _, name := range v.Path {
+		b.WriteByte('/')
+		b.WriteString(name.Local)
+	}
+	if v.Span != (xml.Span{}) {
+		fmt.Fprintf(&b, " (line %d, column %d)", v.Span.Start.Line, v.Span.Start.Col)
+	}
+	b.WriteString(": ")
+	b.WriteString(v.Msg)
+	return b.String()
+}
+
+type spanReader interface {
+	Span() xml.Span
+}
+
+// frame is an open element in the document being validated.
+type frame struct {
+	name    xml.Name
+	span    xml.Span
+	typ     *complexType
+	simple  *simpleType
+	text    strings.Builder
+	hasText bool
+
+	// process is "skip" if the content of the element is not validated or "lax"
+	// if only elements with global declarations are validated.
+	process string
+
+	children []xml.Name
+	spans    []xml.Span
+}
+
+type validator struct {
+	s          *Schema
+	stack      []*frame
+	violations []Violation
+}
+
+// Validate reads tokens from r until io.EOF and returns every violation of the
+// schema that they contain.
+// The returned error is only non-nil if r returns an error other than io.EOF.
+func (s *Schema) Validate(r xml.TokenReader) ([]Violation, error) {
+	v := &validator{s: s}
+	for {
+		tok, err := r.Token()
+		if tok != nil {
+			var span xml.Span
+			if sr, ok := r.(spanReader); ok {
+				span = sr.Span()
+			}
+			if st, ok := tok.(xml.SourceToken); ok {
+				tok = st.Token
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				v.start(tok, span)
+			case xml.EndElement:
+				v.end(span)
+			case xml.CharData:
+				v.chars(tok, span)
+			case xml.CDATA:
+				v.chars(tok, span)
+			}
+		}
+		if err == io.EOF {
+			return v.violations, nil
+		}
+		if err != nil {
+			return v.violations, err
+		}
+	}
+}
+
+func (v *validator) report(span xml.Span, path []xml.Name, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{
+		Span: span,
+		Path: append([]xml.Name(nil), path...),
+		Msg:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) path() []xml.Name {
+	path := make([]xml.Name, 0, len(v.stack))
+	for _, f := range v.stack {
+		path = append(path, f.name)
+	}
+	return path
+}
+
+func (v *validator) start(start xml.StartElement, span xml.Span) {
+	f := &frame{name: start.Name, span: span}
+	var (
+		decl   *elementDecl
+		parent *frame
+	)
+	if len(v.stack) > 0 {
+		parent = v.stack[len(v.stack)-1]
+	}
+	v.stack = append(v.stack, f)
+	switch {
+	case parent == nil:
+		decl = v.s.elements[start.Name]
+		if decl == nil {
+			v.report(span, v.path(), "no declaration for element %s", start.Name.Local)
+		}
+	case parent.process == "skip":
+	case parent.process == "lax":
+		decl = v.s.elements[start.Name]
+	default:
+		parent.children = append(parent.children, start.Name)
+		parent.spans = append(parent.spans, span)
+		if parent.simple != nil {
+			v.report(span, v.path(), "element %s is not allowed in simple content", start.Name.Local)
+			break
+		}
+		decl = parent.typ.elements[start.Name]
+		if decl != nil {
+			break
+		}
+		// Elements that are not in the content model are reported when the
+		// parent element ends.
+		for _, w := range parent.typ.wildcards {
+			if !w.allows(start.Name.Space) {
+				continue
+			}
+			decl = v.s.elements[start.Name]
+			if decl == nil && w.process == "strict" {
+				v.report(span, v.path(), "no declaration for element %s", start.Name.Local)
+			}
+			if decl == nil {
+				f.process = w.process
+			}
+			break
+		}
+	}
+	if decl == nil {
+		if f.process == "" {
+			f.process = "skip"
+		}
+		return
+	}
+	switch typ := decl.typ.(type) {
+	case *simpleType:
+		f.simple = typ
+	case *complexType:
+		f.typ = typ
+		f.simple = typ.simple
+	}
+	v.attrs(f, start.Attr)
+}
+
+func (v *validator) attrs(f *frame, attrs []xml.Attr) {
+	seen := make(map[xml.Name]bool, len(attrs))
+	for _, a := range attrs {
+		if a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns") || a.Name.Space == InstanceNS {
+			continue
+		}
+		seen[a.Name] = true
+		var decl *attrDecl
+		if f.typ != nil {
+			decl = f.typ.attrs[a.Name]
+			if decl == nil && f.typ.anyAttr != nil && f.typ.anyAttr.allows(a.Name.Space) {
+				decl = v.s.attrs[a.Name]
+				if decl == nil && f.typ.anyAttr.process != "strict" {
+					continue
+				}
+			}
+		}
+		if decl == nil {
+			v.report(f.span, v.path(), "attribute %s is not allowed", a.Name.Local)
+			continue
+		}
+		if _, err := decl.typ.parse(a.Value); err != nil {
+			v.report(f.span, v.path(), "attribute %s: %s", a.Name.Local, describe(err))
+		}
+	}
+	if f.typ == nil {
+		return
+	}
+	var missing []string
+	for name, decl := range f.typ.attrs {
+		if decl.required && !seen[name] {
+			missing = append(missing, name.Local)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		v.report(f.span, v.path(), "missing required attribute %s", name)
+	}
+}
+
+func (v *validator) chars(b []byte, span xml.Span) {
+	if len(v.stack) == 0 {
+		return
+	}
+	f := v.stack[len(v.stack)-1]
+	if f.process != "" {
+		return
+	}
+	if f.simple != nil {
+		f.text.Write(b)
+		return
+	}
+	if f.typ.mixed || f.hasText || len(strings.TrimSpace(string(b))) == 0 {
+		return
+	}
+	f.hasText = true
+	v.report(span, v.path(), "character data is not allowed")
+}
+
+func (v *validator) end(span xml.Span) {
+	if len(v.stack) == 0 {
+		return
+	}
+	f := v.stack[len(v.stack)-1]
+	path := v.path()
+	v.stack = v.stack[:len(v.stack)-1]
+	if f.process != "" {
+		return
+	}
+	if f.simple != nil {
+		if _, err := f.simple.parse(f.text.String()); err != nil {
+			v.report(f.span, path, "%s", describe(err))
+		}
+		return
+	}
+	m := &matcher{names: f.children}
+	from := make([]bool, len(f.children)+1)
+	from[0] = true
+	ends := from
+	if f.typ.content != nil {
+		ends = m.match(f.typ.content, from)
+	}
+	if ends[len(f.children)] {
+		return
+	}
+	if m.far < len(f.children) {
+		v.report(f.spans[m.far], append(path, f.children[m.far]), "element %s is not allowed here", f.children[m.far].Local)
+		return
+	}
+	v.report(span, path, "content of element %s is incomplete", f.name.Local)
+}
+
+// describe returns the description of a value error without the package
+// prefix.
+func describe(err error) string {
+	return strings.TrimPrefix(err.Error(), "xsd: ")
+}
+
+// matcher matches a sequence of element names against a content model.
+// Each step takes the set of positions in the sequence that matching may
+// continue from and returns the set of positions after the particle.
+type matcher struct {
+	names []xml.Name
+
+	// far is the furthest position that matching reached.
+	// If the sequence does not match, the element at far is the first one that
+	// is not allowed.
+	far int
+}
+
+func (m *matcher) reach(i int) {
+	if i > m.far {
+		m.far = i
+	}
+}
+
+// match matches p including its repetitions.
+func (m *matcher) match(p *particle, from []bool) []bool {
+	out := make([]bool, len(from))
+	if p.min == 0 {
+		copy(out, from)
+	}
+	cur := from
+	for k := 1; p.max == unbounded || k <= p.max; k++ {
+		cur = m.once(p, cur)
+		if k < p.min {
+			continue
+		}
+		// Stop once no new positions are reachable.
+		added := false
+		for i, ok := range cur {
+			if ok && !out[i] {
+				out[i] = true
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return out
+}
+
+// once matches a single occurrence of p.
+func (m *matcher) once(p *particle, from []bool) []bool {
+	out := make([]bool, len(from))
+	switch p.kind {
+	case elementParticle, anyParticle:
+		for i, ok := range from {
+			if !ok {
+				continue
+			}
+			if i < len(m.names) && p.matches(m.names[i]) {
+				out[i+1] = true
+				m.reach(i + 1)
+			}
+		}
+	case sequenceParticle:
+		out = from
+		for _, c := range p.children {
+			out = m.match(c, out)
+		}
+	case choiceParticle:
+		for _, c := range p.children {
+			for i, ok := range m.match(c, from) {
+				out[i] = out[i] || ok
+			}
+		}
+	case allParticle:
+		for i, ok := range from {
+			if !ok {
+				continue
+			}
+			used := make([]bool, len(p.children))
+			j := i
+		next:
+			for j < len(m.names) {
+				for k, c := range p.children {
+					if !used[k] && c.matches(m.names[j]) {
+						used[k] = true
+						j++
+						continue next
+					}
+				}
+				break
+			}
+			complete := true
+			for k, c := range p.children {
+				if !used[k] && c.min > 0 {
+					complete = false
+				}
+			}
+			m.reach(j)
+			if complete {
+				out[j] = true
+			}
+		}
+	}
+	return out
+}
+
+// matches reports whether an element or wildcard particle matches name.
+func (p *particle) matches(name xml.Name) bool {
+	switch p.kind {
+	case elementParticle:
+		return p.elem.name == name
+	case anyParticle:
+		return p.allows(name.Space)
+	}
+	return false
+}